@@ -0,0 +1,42 @@
+package blockstorage
+
+import (
+	"context"
+
+	"github.com/igumus/blockstorage/blockpb"
+)
+
+// ReadAuthorizer - decides whether block (file or directory) with given name may be read. Returns error cause when
+// reading is denied.
+type ReadAuthorizer func(name string) error
+
+// readAuthorizerKey - context key of read authorizer
+type readAuthorizerKey struct{}
+
+// WithReadAuthorizer - returns context which carries given read authorizer (e.g. grpc caller policy). Authorizer is
+// called with name of every named block visited while DAGs are exported (see `ExportCAR`, `ExportTar`), before the
+// block is written, and export fails with its error. Unnamed blocks (e.g. chunks) are not authorized.
+func WithReadAuthorizer(ctx context.Context, authorizer ReadAuthorizer) context.Context {
+	return context.WithValue(ctx, readAuthorizerKey{}, authorizer)
+}
+
+// authorizeNode - checks read authorizer carried by given context (see `WithReadAuthorizer`) allows reading given
+// decoded block. Sealed nodes (see `sealNode`) are decrypted to learn their names. Unnamed blocks, and contexts
+// without authorizer, are always allowed.
+func (s *storage) authorizeNode(ctx context.Context, block *blockpb.Block) error {
+	authorizer, _ := ctx.Value(readAuthorizerKey{}).(ReadAuthorizer)
+	if authorizer == nil {
+		return nil
+	}
+	if block.GetEncryption().GetSealed() {
+		opened, err := s.decryptBlock(ctx, block)
+		if err != nil {
+			return err
+		}
+		block = opened
+	}
+	if block.GetName() == "" {
+		return nil
+	}
+	return authorizer(block.GetName())
+}
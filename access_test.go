@@ -0,0 +1,44 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"sort"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestReadAuthorizer() {
+	ctx := context.Background()
+	bs := s.newTestStorage()
+
+	file, err := bs.CreateBlock(ctx, "secret.txt", bytes.NewReader([]byte("secret")))
+	require.NoError(s.T(), err)
+	digest, err := bs.CreateDirectory(ctx, "root", []*blockpb.Link{{Hash: file, Name: "secret.txt"}})
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	errDenied := errors.New("denied")
+	visited := make([]string, 0)
+	authorized := WithReadAuthorizer(ctx, func(name string) error {
+		visited = append(visited, name)
+		if name == "secret.txt" {
+			return errDenied
+		}
+		return nil
+	})
+
+	require.Equal(s.T(), errDenied, bs.ExportCAR(authorized, root, ioutil.Discard))
+	require.Equal(s.T(), errDenied, bs.ExportTar(authorized, root, ioutil.Discard))
+	sort.Strings(visited)
+	require.Equal(s.T(), []string{"root", "root", "secret.txt", "secret.txt"}, visited)
+
+	// exports without authorizer are not restricted
+	require.NoError(s.T(), bs.ExportCAR(ctx, root, ioutil.Discard))
+	require.NoError(s.T(), bs.ExportTar(ctx, root, ioutil.Discard))
+}
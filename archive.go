@@ -0,0 +1,282 @@
+package blockstorage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/util"
+	"github.com/ipfs/go-cid"
+)
+
+// Magic numbers of supported archive formats
+var (
+	gzipMagic     = []byte{0x1f, 0x8b}
+	zipMagic      = []byte("PK\x03\x04")
+	zipEmptyMagic = []byte("PK\x05\x06")
+)
+
+// Default modes of tar entries exported without mode metadata
+const (
+	defaultFileMode int64 = 0644
+	defaultDirMode  int64 = 0755
+)
+
+// AddArchive - creates directory DAG with given root `name` from given archive stream. Archive format is detected
+// from stream content: tar, gzip compressed tar or zip.
+//
+// Flow:
+// 1. Detects archive format from leading bytes of stream
+// 2. Reads archive entries (see `AddTar`). Zip archives are buffered to temporary file, as zip directory is
+// located at the end of archive.
+// 3. Keeps mode and modification time of entries as node metadata
+// 4. Returns cid of root directory
+//
+// Error:
+// - When `name` is not valid returns `"", ErrBlockNameEmpty`
+// - When entry path is absolute, escapes root or conflicts with another entry returns `"", ErrPathNotValid`
+// - When archive stream is not valid returns `"", <Tar/Gzip/Zip Error>`
+// Nodes persisted until failure are removed from permanent store (see `transaction`).
+func (s *storage) AddArchive(ctx context.Context, name string, r io.Reader) (string, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return "", stopErr
+	}
+	defer done()
+	link, err := s.transaction(ctx, func(ctx context.Context) (*blockpb.Link, error) {
+		return s.addArchive(ctx, name, r)
+	})
+	if err != nil {
+		return "", err
+	}
+	return link.Hash, nil
+}
+
+// addArchive - creates directory DAG from given archive stream (see `AddArchive`)
+func (s *storage) addArchive(ctx context.Context, name string, r io.Reader) (*blockpb.Link, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, ErrBlockNameEmpty
+	}
+	reader := bufio.NewReader(r)
+	magic, _ := reader.Peek(len(zipMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		return s.addTar(ctx, name, gz)
+	case bytes.Equal(magic, zipMagic), bytes.Equal(magic, zipEmptyMagic):
+		return s.addZip(ctx, name, reader)
+	default:
+		return s.addTar(ctx, name, reader)
+	}
+}
+
+// addZip - buffers given zip stream to temporary file, and creates directory DAG from its entries.
+func (s *storage) addZip(ctx context.Context, name string, r io.Reader) (*blockpb.Link, error) {
+	tmp, err := ioutil.TempFile("", "blockstorage-archive-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := newTreeBuilder()
+	for _, f := range archive.File {
+		ctxErr := util.CheckContext(ctx)
+		if ctxErr != nil {
+			return nil, ctxErr
+		}
+		info := f.FileInfo()
+		meta := newMetadata(info.Mode(), info.ModTime())
+		if info.IsDir() {
+			if err := tree.addDir(f.Name, meta); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		link, err := s.addZipFile(ctx, f, meta)
+		if err != nil {
+			return nil, err
+		}
+		if err := tree.addFile(f.Name, link); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.persistTree(ctx, name, tree.root)
+}
+
+// addZipFile - creates file DAG of given zip entry
+func (s *storage) addZipFile(ctx context.Context, f *zip.File, meta *blockpb.Metadata) (*blockpb.Link, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return s.createFile(ctx, path.Base(f.Name), util.NewFullReader(rc), true, meta)
+}
+
+// ExportTar - writes directory DAG with given root cid to `w` as tar stream. Entry paths are relative to root,
+// and mode/modification time of entries are restored from node metadata.
+//
+// Flow:
+// 1. Reads root block (from permanent store or p2p network), which must be a directory
+// 2. For each entry (depth first, in name order) writes tar header, and content of files (see `ReadFile`). Root
+// and entries are checked by read authorizer of `ctx` (see `WithReadAuthorizer`) before they are written.
+// 3. Closes tar stream
+//
+// Error:
+// - When root block is not a directory returns `ErrBlockNotDirectory`
+// - When entry name is not a single path segment (e.g. "..", "a/b") returns `ErrPathNotValid`
+// - When any of the flow operations fail, returns error cause. Content written to `w` until failure is not reverted.
+func (s *storage) ExportTar(ctx context.Context, root cid.Cid, w io.Writer) error {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return stopErr
+	}
+	defer done()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return ctxErr
+	}
+	block, err := s.GetBlock(ctx, root)
+	if err != nil {
+		return err
+	}
+	if block.Type != blockpb.BlockType_DIRECTORY {
+		return ErrBlockNotDirectory
+	}
+	if err := s.authorizeNode(ctx, block); err != nil {
+		return err
+	}
+	writer := tar.NewWriter(w)
+	if err := s.exportTarEntries(ctx, "", block, writer); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// exportTarEntries - writes entries of given directory block with given path prefix to tar writer.
+func (s *storage) exportTarEntries(ctx context.Context, prefix string, dir *blockpb.Block, writer *tar.Writer) error {
+	for _, link := range dir.Links {
+		ctxErr := util.CheckContext(ctx)
+		if ctxErr != nil {
+			return ctxErr
+		}
+		// entry names are not trusted (e.g. fetched or imported DAGs), so they must not escape root
+		segments, err := splitTreePath(link.Name)
+		if err != nil || len(segments) != 1 || segments[0] != link.Name {
+			return ErrPathNotValid
+		}
+		block, err := s.getLinkedBlock(ctx, link)
+		if err != nil {
+			return err
+		}
+		if err := s.authorizeNode(ctx, block); err != nil {
+			return err
+		}
+		header := &tar.Header{Name: prefix + link.Name}
+		setTarMetadata(header, block.Meta)
+		if block.Type == blockpb.BlockType_DIRECTORY {
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			if header.Mode == 0 {
+				header.Mode = defaultDirMode
+			}
+			if err := writer.WriteHeader(header); err != nil {
+				return err
+			}
+			if err := s.exportTarEntries(ctx, header.Name, block, writer); err != nil {
+				return err
+			}
+			continue
+		}
+
+		id, err := cid.Decode(link.Hash)
+		if err != nil {
+			return ErrBlockIdentifierNotValid
+		}
+		size, err := s.fileSize(ctx, id, block)
+		if err != nil {
+			return err
+		}
+		header.Typeflag = tar.TypeReg
+		header.Size = int64(size)
+		if header.Mode == 0 {
+			header.Mode = defaultFileMode
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := s.writeBlock(ctx, block, writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTarMetadata - sets mode and modification time of given tar header from given metadata. PAX format is used
+// when modification time has sub-second precision.
+func setTarMetadata(header *tar.Header, meta *blockpb.Metadata) {
+	if meta == nil {
+		return
+	}
+	header.Mode = int64(meta.Mode)
+	if meta.Mtime != 0 || meta.MtimeNsecs != 0 {
+		header.ModTime = time.Unix(meta.Mtime, int64(meta.MtimeNsecs))
+		if meta.MtimeNsecs != 0 {
+			header.Format = tar.FormatPAX
+		}
+	}
+}
+
+// fileSize - returns content size of file with given root cid and root block, without reading the content.
+// Size of dag-pb roots is read from UnixFS data, and size of `blockpb.Block` roots is sum of sizes of leaves
+// and own data.
+func (s *storage) fileSize(ctx context.Context, id cid.Cid, block *blockpb.Block) (uint64, error) {
+	if id.Type() != cid.DagProtobuf {
+		size := uint64(len(block.Data))
+		for _, child := range block.Links {
+			size += child.Tsize
+		}
+		return size, nil
+	}
+	data, err := s.readBlockData(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	node, err := blockpb.DecodeDagPB(data)
+	if err != nil {
+		return 0, err
+	}
+	fs, err := blockpb.DecodeUnixFS(node.Data)
+	if err != nil {
+		return 0, err
+	}
+	return fs.FileSize, nil
+}
@@ -0,0 +1,223 @@
+package blockstorage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+// fileMode - converts given unix permission bits to file mode (reverse of `unixMode`)
+func fileMode(mode uint32) fs.FileMode {
+	ret := fs.FileMode(mode & 0777)
+	if mode&04000 != 0 {
+		ret |= fs.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		ret |= fs.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		ret |= fs.ModeSticky
+	}
+	return ret
+}
+
+// generateZip - generates zip archive with given entries
+func generateZip(t *testing.T, entries ...tarEntry) []byte {
+	buf := &bytes.Buffer{}
+	writer := zip.NewWriter(buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: entry.mtime}
+		mode := fileMode(uint32(entry.mode))
+		if entry.dir {
+			mode |= fs.ModeDir
+		}
+		header.SetMode(mode)
+		w, err := writer.CreateHeader(header)
+		require.NoError(t, err)
+		if !entry.dir {
+			_, err = w.Write(entry.content)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+// generateTarGz - generates gzip compressed tar stream with given entries
+func generateTarGz(t *testing.T, entries ...tarEntry) []byte {
+	buf := &bytes.Buffer{}
+	writer := gzip.NewWriter(buf)
+	_, err := writer.Write(generateTar(t, entries...))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+// readTar - reads entries of given tar stream
+func readTar(t *testing.T, data []byte) []tarEntry {
+	ret := make([]tarEntry, 0)
+	reader := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return ret
+		}
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		entry := tarEntry{name: header.Name, dir: header.Typeflag == tar.TypeDir, mode: header.Mode, mtime: header.ModTime}
+		if !entry.dir {
+			entry.content = content
+		}
+		ret = append(ret, entry)
+	}
+}
+
+func (s *blockStorageSuite) TestAddArchive() {
+	ctx := context.Background()
+	mtime := time.Date(2021, 6, 1, 12, 30, 45, 0, time.UTC)
+	entries := []tarEntry{
+		{name: "bin/", dir: true, mode: 0700, mtime: mtime},
+		{name: "bin/run.sh", content: []byte("#!/bin/sh\necho run\n"), mode: 0755, mtime: mtime.Add(time.Hour)},
+		{name: "data/", dir: true, mode: 0755, mtime: mtime},
+		{name: "data/big.bin", content: bytes.Repeat([]byte("0123456789"), 10), mode: 0600, mtime: mtime.Add(2 * time.Hour)},
+		{name: "data/empty.txt", content: []byte{}, mode: 0644, mtime: mtime},
+		{name: "readme.txt", content: []byte("readme"), mode: 01644, mtime: mtime.Add(3 * time.Hour)},
+	}
+
+	formats := map[string][]byte{
+		"tar":    generateTar(s.T(), entries...),
+		"tar.gz": generateTarGz(s.T(), entries...),
+		"zip":    generateZip(s.T(), entries...),
+	}
+
+	for _, encoding := range []Encoding{BlockPBEncoding, DagPBEncoding} {
+		for format, archive := range formats {
+			s.T().Run(format, func(t *testing.T) {
+				bs := s.newTestStorage(WithEncoding(encoding))
+				bs.(*storage).chunkSize = 16
+
+				digest, err := bs.AddArchive(ctx, "archive", bytes.NewReader(archive))
+				require.NoError(t, err)
+				root, err := cid.Decode(digest)
+				require.NoError(t, err)
+
+				for _, entry := range entries {
+					id, err := bs.GetByPath(ctx, root, entry.name)
+					require.NoError(t, err, entry.name)
+					block, err := bs.GetBlock(ctx, id)
+					require.NoError(t, err, entry.name)
+					require.NotNil(t, block.Meta, entry.name)
+					require.Equal(t, uint32(entry.mode), block.Meta.Mode, entry.name)
+					require.Equal(t, entry.mtime.Unix(), block.Meta.Mtime, entry.name)
+					if !entry.dir {
+						content := &bytes.Buffer{}
+						require.NoError(t, bs.ReadFile(ctx, id, content))
+						require.Equal(t, string(entry.content), content.String(), entry.name)
+					}
+				}
+
+				exported := &bytes.Buffer{}
+				require.NoError(t, bs.ExportTar(ctx, root, exported))
+				actual := readTar(t, exported.Bytes())
+				require.Equal(t, len(entries), len(actual))
+				for i, entry := range entries {
+					require.Equal(t, entry.name, actual[i].name)
+					require.Equal(t, entry.dir, actual[i].dir, entry.name)
+					require.Equal(t, entry.mode, actual[i].mode, entry.name)
+					require.True(t, entry.mtime.Equal(actual[i].mtime), entry.name)
+					if !entry.dir {
+						require.Equal(t, entry.content, actual[i].content, entry.name)
+					}
+				}
+
+				// exported tar reproduces same directory DAG
+				again, err := bs.AddArchive(ctx, "archive", exported)
+				require.NoError(t, err)
+				require.Equal(t, digest, again)
+			})
+		}
+	}
+
+	_, err := s.newTestStorage().AddArchive(ctx, " ", bytes.NewReader(formats["tar"]))
+	require.Equal(s.T(), ErrBlockNameEmpty, err)
+}
+
+func (s *blockStorageSuite) TestExportTar() {
+	ctx := context.Background()
+	mtime := time.Unix(1600000000, 123456789)
+
+	for _, encoding := range []Encoding{BlockPBEncoding, DagPBEncoding} {
+		bs := s.newTestStorage(WithEncoding(encoding))
+
+		archive := generateTar(s.T(),
+			tarEntry{name: "precise.txt", content: []byte("precise"), mode: 0640, mtime: mtime},
+		)
+		digest, err := bs.AddArchive(ctx, "archive", bytes.NewReader(archive))
+		require.NoError(s.T(), err)
+		root, err := cid.Decode(digest)
+		require.NoError(s.T(), err)
+
+		exported := &bytes.Buffer{}
+		require.NoError(s.T(), bs.ExportTar(ctx, root, exported))
+		actual := readTar(s.T(), exported.Bytes())
+		require.Equal(s.T(), 1, len(actual))
+		require.Equal(s.T(), int64(0640), actual[0].mode)
+		require.True(s.T(), mtime.Equal(actual[0].mtime))
+
+		// entries without metadata are exported with default modes
+		file, err := bs.CreateBlock(ctx, "plain.txt", bytes.NewReader([]byte("plain")))
+		require.NoError(s.T(), err)
+		dir, err := bs.CreateDirectory(ctx, "plain", nil)
+		require.NoError(s.T(), err)
+		digest, err = bs.CreateDirectory(ctx, "root", []*blockpb.Link{
+			{Hash: file, Name: "plain.txt", Tsize: 5},
+			{Hash: dir, Name: "plain"},
+		})
+		require.NoError(s.T(), err)
+		root, err = cid.Decode(digest)
+		require.NoError(s.T(), err)
+
+		exported.Reset()
+		require.NoError(s.T(), bs.ExportTar(ctx, root, exported))
+		actual = readTar(s.T(), exported.Bytes())
+		require.Equal(s.T(), []tarEntry{
+			{name: "plain/", dir: true, mode: defaultDirMode, mtime: actual[0].mtime},
+			{name: "plain.txt", content: []byte("plain"), mode: defaultFileMode, mtime: actual[1].mtime},
+		}, actual)
+
+		fileID, err := cid.Decode(file)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), ErrBlockNotDirectory, bs.ExportTar(ctx, fileID, exported))
+	}
+}
+
+func (s *blockStorageSuite) TestExportTarEntryNotValid() {
+	ctx := context.Background()
+	store := newMemoryStore(s.T(), s.ctrl)
+	bs := s.newTestStorage(WithLocalStore(store))
+	file, err := bs.CreateBlock(ctx, "evil.txt", bytes.NewReader([]byte("evil")))
+	require.NoError(s.T(), err)
+
+	// directories written by other peers are not validated by `CreateDirectory`
+	for _, name := range []string{"", ".", "..", "../evil.txt", "a/evil.txt", "/evil.txt", "./evil.txt"} {
+		bin, err := blockpb.Encode(&blockpb.Block{Name: "root", Type: blockpb.BlockType_DIRECTORY, Links: []*blockpb.Link{
+			{Hash: file, Name: name, Tsize: 4},
+		}})
+		require.NoError(s.T(), err)
+		root, err := store.CreateObject(ctx, bytes.NewReader(bin))
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), ErrPathNotValid, bs.ExportTar(ctx, root, ioutil.Discard), name)
+	}
+}
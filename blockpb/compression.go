@@ -0,0 +1,149 @@
+package blockpb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/ipfs/go-cid"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrCompressionNotSupported is return, when data is compressed with unknown codec
+var ErrCompressionNotSupported = errors.New("blockstorage: compression codec not supported")
+
+// ErrDecompressedSizeExceeded is return, when decompressed data exceeds `MaxDecompressedSize`
+var ErrDecompressedSizeExceeded = errors.New("blockstorage: decompressed data exceeds size limit")
+
+// MaxDecompressedSize - holds upper bound of decompressed block data, same as upper bound of CAR section size, so
+// small malformed (e.g. pushed or fetched) blocks are not expanded to huge allocations
+const MaxDecompressedSize = 32 << 20
+
+// zstd encoder/decoder are safe for concurrent `EncodeAll`/`DecodeAll` calls, so they are shared
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+)
+
+// Compress - compresses given data with given codec. Compression is deterministic, so same data is always
+// addressed with same cid.
+func Compress(codec Compression, data []byte) ([]byte, error) {
+	switch codec {
+	case Compression_NONE:
+		return data, nil
+	case Compression_ZSTD:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case Compression_GZIP:
+		buf := &bytes.Buffer{}
+		writer := gzip.NewWriter(buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Compression_SNAPPY:
+		return snappy.Encode(nil, data), nil
+	default:
+		return nil, ErrCompressionNotSupported
+	}
+}
+
+// Decompress - decompresses given data which is compressed with given codec (see `Compress`)
+//
+// Error:
+// - When codec is unknown returns `nil, ErrCompressionNotSupported`
+// - When decompressed data exceeds `MaxDecompressedSize` returns `nil, ErrDecompressedSizeExceeded`
+// - When data is malformed returns `nil` with error cause
+func Decompress(codec Compression, data []byte) ([]byte, error) {
+	switch codec {
+	case Compression_NONE:
+		return data, nil
+	case Compression_ZSTD:
+		ret, err := zstdDecoder.DecodeAll(data, nil)
+		if err == zstd.ErrDecoderSizeExceeded || err == zstd.ErrWindowSizeExceeded {
+			return nil, ErrDecompressedSizeExceeded
+		}
+		return ret, err
+	case Compression_GZIP:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		// one more byte is read, so exceeding data is detected
+		ret, err := ioutil.ReadAll(io.LimitReader(reader, MaxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(ret) > MaxDecompressedSize {
+			return nil, ErrDecompressedSizeExceeded
+		}
+		return ret, nil
+	case Compression_SNAPPY:
+		size, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if size > MaxDecompressedSize {
+			return nil, ErrDecompressedSizeExceeded
+		}
+		return snappy.Decode(nil, data)
+	default:
+		return nil, ErrCompressionNotSupported
+	}
+}
+
+// Decompressed - returns copy of given block whose `Data` is decompressed regarding `Compression` of the block.
+// Returned block has no compression, so its binary form is the form of block before compression.
+func Decompressed(block *Block) (*Block, error) {
+	data, err := Decompress(block.Compression, block.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &Block{
+		Links:   block.Links,
+		Data:    data,
+		Name:    block.Name,
+		Type:    block.Type,
+		Meta:    block.Meta,
+		Erasure: block.Erasure,
+	}, nil
+}
+
+// Verify - checks given binary form of block matches with given cid. Compressed (not encrypted) blocks may be
+// addressed with binary form of block before compression (see `Decompressed`), so such blocks are verified after
+// decompression. Decompression is bounded with `MaxDecompressedSize`, so exceeding blocks are not verified.
+//
+// Error:
+// When hash function of cid is not supported returns `false` with error cause
+func Verify(id cid.Cid, data []byte) (bool, error) {
+	expected, err := id.Prefix().Sum(data)
+	if err != nil {
+		return false, err
+	}
+	if expected.Equals(id) {
+		return true, nil
+	}
+	if id.Type() != cid.Raw && id.Type() != BlockCodec {
+		return false, nil
+	}
+	block, err := Decode(data)
+	if err != nil || block.Compression == Compression_NONE || block.Encryption != nil || hasUnknownFields(block) {
+		return false, nil
+	}
+	original, err := Decompressed(block)
+	if err != nil {
+		return false, nil
+	}
+	bin, err := Encode(original)
+	if err != nil {
+		return false, nil
+	}
+	expected, err = id.Prefix().Sum(bin)
+	return err == nil && expected.Equals(id), nil
+}
@@ -0,0 +1,93 @@
+package blockpb
+
+import (
+	"bytes"
+
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func (s *blockpbSuite) TestCompressionRoundTrip() {
+	data := bytes.Repeat([]byte("level=info msg=\"block persisted\"\n"), 256)
+	for _, codec := range []Compression{Compression_NONE, Compression_ZSTD, Compression_GZIP, Compression_SNAPPY} {
+		compressed, err := Compress(codec, data)
+		s.NoError(err)
+		if codec != Compression_NONE {
+			s.Less(len(compressed), len(data))
+		}
+		again, err := Compress(codec, data)
+		s.NoError(err)
+		s.Equal(compressed, again)
+
+		decompressed, err := Decompress(codec, compressed)
+		s.NoError(err)
+		s.Equal(data, decompressed)
+	}
+
+	_, err := Compress(Compression(42), data)
+	s.ErrorIs(err, ErrCompressionNotSupported)
+	_, err = Decompress(Compression(42), data)
+	s.ErrorIs(err, ErrCompressionNotSupported)
+}
+
+func (s *blockpbSuite) TestVerifyCompressedBlock() {
+	prefix := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}
+	data := bytes.Repeat([]byte("compressible "), 128)
+	original, err := Encode(&Block{Data: data})
+	s.NoError(err)
+	compressed, err := Compress(Compression_ZSTD, data)
+	s.NoError(err)
+	stored, err := Encode(&Block{Data: compressed, Compression: Compression_ZSTD})
+	s.NoError(err)
+
+	originalID, err := prefix.Sum(original)
+	s.NoError(err)
+	storedID, err := prefix.Sum(stored)
+	s.NoError(err)
+
+	// stored block verifies against both cid of stored form and cid of original form
+	for _, id := range []cid.Cid{originalID, storedID} {
+		ok, err := Verify(id, stored)
+		s.NoError(err)
+		s.True(ok)
+	}
+	ok, err := Verify(storedID, original)
+	s.NoError(err)
+	s.False(ok)
+
+	tampered, err := Compress(Compression_ZSTD, append([]byte("x"), data...))
+	s.NoError(err)
+	tamperedBin, err := Encode(&Block{Data: tampered, Compression: Compression_ZSTD})
+	s.NoError(err)
+	ok, err = Verify(originalID, tamperedBin)
+	s.NoError(err)
+	s.False(ok)
+
+	block, err := DecodeNode(originalID, stored)
+	s.NoError(err)
+	s.Equal(data, block.Data)
+	s.Equal(Compression_NONE, block.Compression)
+}
+
+func (s *blockpbSuite) TestDecompressBounded() {
+	prefix := cid.Prefix{Version: 1, Codec: BlockCodec, MhType: mh.SHA2_256, MhLength: -1}
+	bomb := make([]byte, MaxDecompressedSize+1)
+	for _, codec := range []Compression{Compression_ZSTD, Compression_GZIP, Compression_SNAPPY} {
+		compressed, err := Compress(codec, bomb)
+		s.NoError(err)
+		s.Less(len(compressed), MaxDecompressedSize/10)
+		_, err = Decompress(codec, compressed)
+		s.ErrorIs(err, ErrDecompressedSizeExceeded, codec.String())
+
+		// exceeding block is not verified against cid of its original form
+		original, err := Encode(&Block{Data: bomb})
+		s.NoError(err)
+		originalID, err := prefix.Sum(original)
+		s.NoError(err)
+		stored, err := Encode(&Block{Data: compressed, Compression: codec})
+		s.NoError(err)
+		ok, err := Verify(originalID, stored)
+		s.NoError(err)
+		s.False(ok)
+	}
+}
@@ -0,0 +1,128 @@
+package blockpb
+
+import (
+	"errors"
+
+	"github.com/ipfs/go-cid"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrDagPBMalformed is return, when binary form is not a valid dag-pb node
+var ErrDagPBMalformed = errors.New("blockstorage: dag-pb node malformed")
+
+// dag-pb field numbers (see https://ipld.io/specs/codecs/dag-pb/spec/)
+const (
+	dagpbLinkHash  protowire.Number = 1
+	dagpbLinkName  protowire.Number = 2
+	dagpbLinkTsize protowire.Number = 3
+	dagpbNodeData  protowire.Number = 1
+	dagpbNodeLinks protowire.Number = 2
+)
+
+// EncodeDagPB - encodes given block in canonical dag-pb form (links first, then data). Link hashes
+// must be string form of cids. `Name` of block has no counterpart in dag-pb, so it is not encoded.
+// Link names and sizes are always written, as go-ipfs does.
+func EncodeDagPB(block *Block) ([]byte, error) {
+	var ret []byte
+	for _, link := range block.Links {
+		id, err := cid.Decode(link.Hash)
+		if err != nil {
+			return nil, err
+		}
+		var bin []byte
+		bin = protowire.AppendTag(bin, dagpbLinkHash, protowire.BytesType)
+		bin = protowire.AppendBytes(bin, id.Bytes())
+		bin = protowire.AppendTag(bin, dagpbLinkName, protowire.BytesType)
+		bin = protowire.AppendString(bin, link.Name)
+		bin = protowire.AppendTag(bin, dagpbLinkTsize, protowire.VarintType)
+		bin = protowire.AppendVarint(bin, link.Tsize)
+
+		ret = protowire.AppendTag(ret, dagpbNodeLinks, protowire.BytesType)
+		ret = protowire.AppendBytes(ret, bin)
+	}
+	if block.Data != nil {
+		ret = protowire.AppendTag(ret, dagpbNodeData, protowire.BytesType)
+		ret = protowire.AppendBytes(ret, block.Data)
+	}
+	return ret, nil
+}
+
+// decodeDagPBLink - decodes binary form of dag-pb link
+func decodeDagPBLink(data []byte) (*Link, error) {
+	link := &Link{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, ErrDagPBMalformed
+		}
+		data = data[n:]
+		switch {
+		case num == dagpbLinkHash && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, ErrDagPBMalformed
+			}
+			id, err := cid.Cast(v)
+			if err != nil {
+				return nil, ErrDagPBMalformed
+			}
+			link.Hash = id.String()
+			if id.Type() == cid.Raw {
+				link.Type = LinkType_RAW
+			}
+			data = data[n:]
+		case num == dagpbLinkName && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return nil, ErrDagPBMalformed
+			}
+			link.Name = v
+			data = data[n:]
+		case num == dagpbLinkTsize && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, ErrDagPBMalformed
+			}
+			link.Tsize = v
+			data = data[n:]
+		default:
+			return nil, ErrDagPBMalformed
+		}
+	}
+	if link.Hash == "" {
+		return nil, ErrDagPBMalformed
+	}
+	return link, nil
+}
+
+// DecodeDagPB - decodes binary form of dag-pb node to block. Link hashes are string form of cids,
+// and `Data` of block is raw `Data` of node (e.g. UnixFS encoded). Links to raw codec cids are raw leaves,
+// so their type is `LinkType_RAW`.
+func DecodeDagPB(data []byte) (*Block, error) {
+	block := &Block{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 || typ != protowire.BytesType {
+			return nil, ErrDagPBMalformed
+		}
+		data = data[n:]
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return nil, ErrDagPBMalformed
+		}
+		data = data[n:]
+		switch num {
+		case dagpbNodeLinks:
+			link, err := decodeDagPBLink(v)
+			if err != nil {
+				return nil, err
+			}
+			block.Links = append(block.Links, link)
+		case dagpbNodeData:
+			block.Data = append([]byte{}, v...)
+		default:
+			return nil, ErrDagPBMalformed
+		}
+	}
+	return block, nil
+}
@@ -0,0 +1,127 @@
+package blockpb
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+// cidV0 - returns CIDv0 (dag-pb, sha256) of given binary form
+func cidV0(t *testing.T, data []byte) string {
+	digest, err := mh.Sum(data, mh.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV0(digest).String()
+}
+
+func (s *blockpbSuite) TestWellKnownUnixFSNodes() {
+	testCases := []struct {
+		name     string
+		fs       *UnixFS
+		expected string
+	}{
+		{name: "empty_directory", fs: &UnixFS{Type: UnixFSDirectory}, expected: "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"},
+		{name: "empty_file", fs: &UnixFS{Type: UnixFSFile}, expected: "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			data, err := EncodeDagPB(&Block{Data: EncodeUnixFS(tc.fs)})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, cidV0(t, data))
+		})
+	}
+}
+
+func (s *blockpbSuite) TestDagPBRoundTrip() {
+	leaf, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}.Sum([]byte("leaf"))
+	require.NoError(s.T(), err)
+
+	fs := &UnixFS{Type: UnixFSFile, FileSize: 8, BlockSizes: []uint64{4, 4}}
+	node := &Block{
+		Name: "ignored",
+		Links: []*Link{
+			{Hash: leaf.String(), Tsize: 4},
+			{Hash: leaf.String(), Name: "named", Tsize: 4},
+		},
+		Data: EncodeUnixFS(fs),
+	}
+	data, err := EncodeDagPB(node)
+	require.NoError(s.T(), err)
+
+	decoded, err := DecodeDagPB(data)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), "", decoded.Name)
+	require.Equal(s.T(), len(node.Links), len(decoded.Links))
+	for i, link := range node.Links {
+		require.Equal(s.T(), link.Hash, decoded.Links[i].Hash)
+		require.Equal(s.T(), link.Name, decoded.Links[i].Name)
+		require.Equal(s.T(), link.Tsize, decoded.Links[i].Tsize)
+	}
+
+	decodedFs, err := DecodeUnixFS(decoded.Data)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), fs, decodedFs)
+
+	_, err = DecodeDagPB([]byte{0x12, 0x05, 0x0a})
+	require.Equal(s.T(), ErrDagPBMalformed, err)
+	_, err = DecodeUnixFS([]byte{0x12, 0x00})
+	require.Equal(s.T(), ErrUnixFSMalformed, err)
+}
+
+func (s *blockpbSuite) TestDecodeNode() {
+	rawPrefix := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}
+	dagPrefix := cid.Prefix{Version: 1, Codec: cid.DagProtobuf, MhType: mh.SHA2_256, MhLength: -1}
+	nodePrefix := cid.Prefix{Version: 1, Codec: BlockCodec, MhType: mh.SHA2_256, MhLength: -1}
+
+	legacy, err := Encode(&Block{Name: "file", Links: []*Link{{Hash: "hash", Tsize: 3}}})
+	require.NoError(s.T(), err)
+	unixfs, err := EncodeDagPB(&Block{Data: EncodeUnixFS(&UnixFS{Type: UnixFSFile, Data: []byte("content"), FileSize: 7})})
+	require.NoError(s.T(), err)
+	leaf := []byte("hello world")
+	// raw leaf which is also a valid `Block` binary form (`Data` field with "abc")
+	ambiguous := []byte("\x12\x03abc")
+
+	testCases := []struct {
+		name   string
+		prefix cid.Prefix
+		typ    LinkType
+		data   []byte
+		links  int
+		block  string
+		value  []byte
+	}{
+		{name: "blockpb_block", prefix: nodePrefix, data: legacy, links: 1, block: "file"},
+		{name: "legacy_blockpb_block", prefix: rawPrefix, data: legacy, links: 1, block: "file"},
+		{name: "raw_leaf", prefix: rawPrefix, data: leaf, value: leaf},
+		{name: "raw_linked_leaf_parsable_as_block", prefix: rawPrefix, typ: LinkType_RAW, data: ambiguous, value: ambiguous},
+		{name: "blockpb_leaf", prefix: nodePrefix, data: ambiguous, value: []byte("abc")},
+		{name: "unixfs_node", prefix: dagPrefix, data: unixfs, value: []byte("content")},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			id, err := tc.prefix.Sum(tc.data)
+			require.NoError(t, err)
+			block, err := DecodeLinkedNode(id, tc.typ, tc.data)
+			require.NoError(t, err)
+			require.Equal(t, tc.links, len(block.Links))
+			require.Equal(t, tc.block, block.Name)
+			require.Equal(t, tc.value, block.Data)
+		})
+	}
+}
+
+func (s *blockpbSuite) TestDecodeNodeNotValid() {
+	nodePrefix := cid.Prefix{Version: 1, Codec: BlockCodec, MhType: mh.SHA2_256, MhLength: -1}
+	data := []byte("hello world")
+	id, err := nodePrefix.Sum(data)
+	s.NoError(err)
+	_, err = DecodeNode(id, data)
+	s.Error(err)
+}
@@ -1,9 +1,18 @@
 package blockpb
 
-import "google.golang.org/protobuf/proto"
+import (
+	"github.com/ipfs/go-cid"
+	"google.golang.org/protobuf/proto"
+)
 
+// BlockCodec - holds multicodec of cids of `Block` nodes (multicodec private use range) of DAGs with raw leaves, so
+// nodes are told apart from raw leaves (`cid.Raw`) by their cids. Other `Block` nodes are addressed with `cid.Raw`.
+const BlockCodec uint64 = 0x300b10
+
+// Encode - encodes given block to binary form. Encoding is deterministic (e.g. metadata attributes are
+// ordered by key), so same blocks are always addressed with same cids.
 func Encode(block *Block) ([]byte, error) {
-	blockBin, blockErr := proto.Marshal(block)
+	blockBin, blockErr := proto.MarshalOptions{Deterministic: true}.Marshal(block)
 	if blockErr != nil {
 		return nil, blockErr
 	}
@@ -17,3 +26,80 @@ func Decode(data []byte) (*Block, error) {
 	}
 	return &block, nil
 }
+
+// hasUnknownFields - checks decoded block (or any of its links) has fields not defined in `store.proto`
+func hasUnknownFields(block *Block) bool {
+	if len(block.ProtoReflect().GetUnknown()) > 0 {
+		return true
+	}
+	for _, link := range block.Links {
+		if len(link.ProtoReflect().GetUnknown()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeNode - decodes binary form of block with given cid regarding codec of the cid.
+// - dag-pb: decodes dag-pb node. When node carries UnixFS data, `Data` of returned block is the content held
+// by node (empty for directories/intermediate nodes), otherwise raw `Data` of node. UnixFS directories are
+// returned with `BlockType_DIRECTORY` type, and UnixFS mode/mtime are returned as `Meta`.
+// - `BlockCodec`: decodes `Block` created by blockstorage. Compressed blocks are returned with decompressed `Data`
+// (see `Decompressed`), unless they are encrypted, since encrypted blocks are decompressed after decryption.
+// - raw: decodes `Block` created by blockstorage (see `BlockCodec`) as well. Raw leaves share the same codec, so
+// data that is not a valid `Block` is returned as leaf (`Data` only). When parent link is known, prefer
+// `DecodeLinkedNode`.
+// - other codecs: returns leaf (`Data` only).
+//
+// Error:
+// When binary form is not valid regarding codec (dag-pb, `BlockCodec`) returns `nil` with error cause
+func DecodeNode(id cid.Cid, data []byte) (*Block, error) {
+	switch id.Type() {
+	case cid.DagProtobuf:
+		block, err := DecodeDagPB(data)
+		if err != nil {
+			return nil, err
+		}
+		if fs, err := DecodeUnixFS(block.Data); err == nil {
+			block.Data = fs.Data
+			if fs.Type == UnixFSDirectory {
+				block.Type = BlockType_DIRECTORY
+			}
+			block.Meta = fs.Metadata()
+		}
+		return block, nil
+	case BlockCodec:
+		block, err := Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		if block.Compression != Compression_NONE && block.Encryption == nil {
+			return Decompressed(block)
+		}
+		return block, nil
+	case cid.Raw:
+		block, err := Decode(data)
+		if err != nil || hasUnknownFields(block) {
+			return &Block{Data: data}, nil
+		}
+		if block.Compression != Compression_NONE && block.Encryption == nil {
+			original, err := Decompressed(block)
+			if err != nil {
+				return &Block{Data: data}, nil
+			}
+			return original, nil
+		}
+		return block, nil
+	default:
+		return &Block{Data: data}, nil
+	}
+}
+
+// DecodeLinkedNode - decodes binary form of block with given cid, which is referenced with given link type.
+// Raw leaves (`LinkType_RAW`) are returned as leaf (`Data` only), others are decoded via `DecodeNode`.
+func DecodeLinkedNode(id cid.Cid, typ LinkType, data []byte) (*Block, error) {
+	if typ == LinkType_RAW {
+		return &Block{Data: data}, nil
+	}
+	return DecodeNode(id, data)
+}
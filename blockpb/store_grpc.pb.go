@@ -20,6 +20,17 @@ const _ = grpc.SupportPackageIsVersion7
 type BlockStorageGrpcServiceClient interface {
 	WriteBlock(ctx context.Context, opts ...grpc.CallOption) (BlockStorageGrpcService_WriteBlockClient, error)
 	GetBlock(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*Block, error)
+	ExportCAR(ctx context.Context, in *ExportCARRequest, opts ...grpc.CallOption) (BlockStorageGrpcService_ExportCARClient, error)
+	ImportCAR(ctx context.Context, opts ...grpc.CallOption) (BlockStorageGrpcService_ImportCARClient, error)
+	WriteTree(ctx context.Context, opts ...grpc.CallOption) (BlockStorageGrpcService_WriteTreeClient, error)
+	WriteArchive(ctx context.Context, opts ...grpc.CallOption) (BlockStorageGrpcService_WriteArchiveClient, error)
+	ExportTar(ctx context.Context, in *ExportTarRequest, opts ...grpc.CallOption) (BlockStorageGrpcService_ExportTarClient, error)
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*BlockStat, error)
+	ListBlocks(ctx context.Context, in *ListBlocksRequest, opts ...grpc.CallOption) (BlockStorageGrpcService_ListBlocksClient, error)
+	StartUpload(ctx context.Context, in *StartUploadRequest, opts ...grpc.CallOption) (*UploadStatus, error)
+	GetUploadStatus(ctx context.Context, in *UploadStatusRequest, opts ...grpc.CallOption) (*UploadStatus, error)
+	WriteUpload(ctx context.Context, opts ...grpc.CallOption) (BlockStorageGrpcService_WriteUploadClient, error)
+	GetUsage(ctx context.Context, in *UsageRequest, opts ...grpc.CallOption) (*Usage, error)
 }
 
 type blockStorageGrpcServiceClient struct {
@@ -73,12 +84,291 @@ func (c *blockStorageGrpcServiceClient) GetBlock(ctx context.Context, in *GetBlo
 	return out, nil
 }
 
+func (c *blockStorageGrpcServiceClient) ExportCAR(ctx context.Context, in *ExportCARRequest, opts ...grpc.CallOption) (BlockStorageGrpcService_ExportCARClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlockStorageGrpcService_ServiceDesc.Streams[1], "/blockpb.BlockStorageGrpcService/ExportCAR", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blockStorageGrpcServiceExportCARClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BlockStorageGrpcService_ExportCARClient interface {
+	Recv() (*CARChunk, error)
+	grpc.ClientStream
+}
+
+type blockStorageGrpcServiceExportCARClient struct {
+	grpc.ClientStream
+}
+
+func (x *blockStorageGrpcServiceExportCARClient) Recv() (*CARChunk, error) {
+	m := new(CARChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blockStorageGrpcServiceClient) ImportCAR(ctx context.Context, opts ...grpc.CallOption) (BlockStorageGrpcService_ImportCARClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlockStorageGrpcService_ServiceDesc.Streams[2], "/blockpb.BlockStorageGrpcService/ImportCAR", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blockStorageGrpcServiceImportCARClient{stream}
+	return x, nil
+}
+
+type BlockStorageGrpcService_ImportCARClient interface {
+	Send(*CARChunk) error
+	CloseAndRecv() (*ImportCARResponse, error)
+	grpc.ClientStream
+}
+
+type blockStorageGrpcServiceImportCARClient struct {
+	grpc.ClientStream
+}
+
+func (x *blockStorageGrpcServiceImportCARClient) Send(m *CARChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *blockStorageGrpcServiceImportCARClient) CloseAndRecv() (*ImportCARResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportCARResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blockStorageGrpcServiceClient) WriteTree(ctx context.Context, opts ...grpc.CallOption) (BlockStorageGrpcService_WriteTreeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlockStorageGrpcService_ServiceDesc.Streams[3], "/blockpb.BlockStorageGrpcService/WriteTree", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blockStorageGrpcServiceWriteTreeClient{stream}
+	return x, nil
+}
+
+type BlockStorageGrpcService_WriteTreeClient interface {
+	Send(*WriteBlockRequest) error
+	CloseAndRecv() (*WriteBlockResponse, error)
+	grpc.ClientStream
+}
+
+type blockStorageGrpcServiceWriteTreeClient struct {
+	grpc.ClientStream
+}
+
+func (x *blockStorageGrpcServiceWriteTreeClient) Send(m *WriteBlockRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *blockStorageGrpcServiceWriteTreeClient) CloseAndRecv() (*WriteBlockResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(WriteBlockResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blockStorageGrpcServiceClient) WriteArchive(ctx context.Context, opts ...grpc.CallOption) (BlockStorageGrpcService_WriteArchiveClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlockStorageGrpcService_ServiceDesc.Streams[4], "/blockpb.BlockStorageGrpcService/WriteArchive", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blockStorageGrpcServiceWriteArchiveClient{stream}
+	return x, nil
+}
+
+type BlockStorageGrpcService_WriteArchiveClient interface {
+	Send(*WriteBlockRequest) error
+	CloseAndRecv() (*WriteBlockResponse, error)
+	grpc.ClientStream
+}
+
+type blockStorageGrpcServiceWriteArchiveClient struct {
+	grpc.ClientStream
+}
+
+func (x *blockStorageGrpcServiceWriteArchiveClient) Send(m *WriteBlockRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *blockStorageGrpcServiceWriteArchiveClient) CloseAndRecv() (*WriteBlockResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(WriteBlockResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blockStorageGrpcServiceClient) ExportTar(ctx context.Context, in *ExportTarRequest, opts ...grpc.CallOption) (BlockStorageGrpcService_ExportTarClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlockStorageGrpcService_ServiceDesc.Streams[5], "/blockpb.BlockStorageGrpcService/ExportTar", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blockStorageGrpcServiceExportTarClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BlockStorageGrpcService_ExportTarClient interface {
+	Recv() (*TarChunk, error)
+	grpc.ClientStream
+}
+
+type blockStorageGrpcServiceExportTarClient struct {
+	grpc.ClientStream
+}
+
+func (x *blockStorageGrpcServiceExportTarClient) Recv() (*TarChunk, error) {
+	m := new(TarChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blockStorageGrpcServiceClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*BlockStat, error) {
+	out := new(BlockStat)
+	err := c.cc.Invoke(ctx, "/blockpb.BlockStorageGrpcService/Stat", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blockStorageGrpcServiceClient) ListBlocks(ctx context.Context, in *ListBlocksRequest, opts ...grpc.CallOption) (BlockStorageGrpcService_ListBlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlockStorageGrpcService_ServiceDesc.Streams[6], "/blockpb.BlockStorageGrpcService/ListBlocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blockStorageGrpcServiceListBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BlockStorageGrpcService_ListBlocksClient interface {
+	Recv() (*BlockStat, error)
+	grpc.ClientStream
+}
+
+type blockStorageGrpcServiceListBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *blockStorageGrpcServiceListBlocksClient) Recv() (*BlockStat, error) {
+	m := new(BlockStat)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blockStorageGrpcServiceClient) StartUpload(ctx context.Context, in *StartUploadRequest, opts ...grpc.CallOption) (*UploadStatus, error) {
+	out := new(UploadStatus)
+	err := c.cc.Invoke(ctx, "/blockpb.BlockStorageGrpcService/StartUpload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blockStorageGrpcServiceClient) GetUploadStatus(ctx context.Context, in *UploadStatusRequest, opts ...grpc.CallOption) (*UploadStatus, error) {
+	out := new(UploadStatus)
+	err := c.cc.Invoke(ctx, "/blockpb.BlockStorageGrpcService/GetUploadStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blockStorageGrpcServiceClient) WriteUpload(ctx context.Context, opts ...grpc.CallOption) (BlockStorageGrpcService_WriteUploadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BlockStorageGrpcService_ServiceDesc.Streams[7], "/blockpb.BlockStorageGrpcService/WriteUpload", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blockStorageGrpcServiceWriteUploadClient{stream}
+	return x, nil
+}
+
+type BlockStorageGrpcService_WriteUploadClient interface {
+	Send(*UploadRequest) error
+	CloseAndRecv() (*WriteBlockResponse, error)
+	grpc.ClientStream
+}
+
+type blockStorageGrpcServiceWriteUploadClient struct {
+	grpc.ClientStream
+}
+
+func (x *blockStorageGrpcServiceWriteUploadClient) Send(m *UploadRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *blockStorageGrpcServiceWriteUploadClient) CloseAndRecv() (*WriteBlockResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(WriteBlockResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blockStorageGrpcServiceClient) GetUsage(ctx context.Context, in *UsageRequest, opts ...grpc.CallOption) (*Usage, error) {
+	out := new(Usage)
+	err := c.cc.Invoke(ctx, "/blockpb.BlockStorageGrpcService/GetUsage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BlockStorageGrpcServiceServer is the server API for BlockStorageGrpcService service.
 // All implementations must embed UnimplementedBlockStorageGrpcServiceServer
 // for forward compatibility
 type BlockStorageGrpcServiceServer interface {
 	WriteBlock(BlockStorageGrpcService_WriteBlockServer) error
 	GetBlock(context.Context, *GetBlockRequest) (*Block, error)
+	ExportCAR(*ExportCARRequest, BlockStorageGrpcService_ExportCARServer) error
+	ImportCAR(BlockStorageGrpcService_ImportCARServer) error
+	WriteTree(BlockStorageGrpcService_WriteTreeServer) error
+	WriteArchive(BlockStorageGrpcService_WriteArchiveServer) error
+	ExportTar(*ExportTarRequest, BlockStorageGrpcService_ExportTarServer) error
+	Stat(context.Context, *StatRequest) (*BlockStat, error)
+	ListBlocks(*ListBlocksRequest, BlockStorageGrpcService_ListBlocksServer) error
+	StartUpload(context.Context, *StartUploadRequest) (*UploadStatus, error)
+	GetUploadStatus(context.Context, *UploadStatusRequest) (*UploadStatus, error)
+	WriteUpload(BlockStorageGrpcService_WriteUploadServer) error
+	GetUsage(context.Context, *UsageRequest) (*Usage, error)
 	mustEmbedUnimplementedBlockStorageGrpcServiceServer()
 }
 
@@ -92,6 +382,39 @@ func (UnimplementedBlockStorageGrpcServiceServer) WriteBlock(BlockStorageGrpcSer
 func (UnimplementedBlockStorageGrpcServiceServer) GetBlock(context.Context, *GetBlockRequest) (*Block, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetBlock not implemented")
 }
+func (UnimplementedBlockStorageGrpcServiceServer) ExportCAR(*ExportCARRequest, BlockStorageGrpcService_ExportCARServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportCAR not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) ImportCAR(BlockStorageGrpcService_ImportCARServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportCAR not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) WriteTree(BlockStorageGrpcService_WriteTreeServer) error {
+	return status.Errorf(codes.Unimplemented, "method WriteTree not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) WriteArchive(BlockStorageGrpcService_WriteArchiveServer) error {
+	return status.Errorf(codes.Unimplemented, "method WriteArchive not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) ExportTar(*ExportTarRequest, BlockStorageGrpcService_ExportTarServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportTar not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) Stat(context.Context, *StatRequest) (*BlockStat, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) ListBlocks(*ListBlocksRequest, BlockStorageGrpcService_ListBlocksServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListBlocks not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) StartUpload(context.Context, *StartUploadRequest) (*UploadStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartUpload not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) GetUploadStatus(context.Context, *UploadStatusRequest) (*UploadStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUploadStatus not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) WriteUpload(BlockStorageGrpcService_WriteUploadServer) error {
+	return status.Errorf(codes.Unimplemented, "method WriteUpload not implemented")
+}
+func (UnimplementedBlockStorageGrpcServiceServer) GetUsage(context.Context, *UsageRequest) (*Usage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsage not implemented")
+}
 func (UnimplementedBlockStorageGrpcServiceServer) mustEmbedUnimplementedBlockStorageGrpcServiceServer() {
 }
 
@@ -150,6 +473,245 @@ func _BlockStorageGrpcService_GetBlock_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BlockStorageGrpcService_ExportCAR_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportCARRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BlockStorageGrpcServiceServer).ExportCAR(m, &blockStorageGrpcServiceExportCARServer{stream})
+}
+
+type BlockStorageGrpcService_ExportCARServer interface {
+	Send(*CARChunk) error
+	grpc.ServerStream
+}
+
+type blockStorageGrpcServiceExportCARServer struct {
+	grpc.ServerStream
+}
+
+func (x *blockStorageGrpcServiceExportCARServer) Send(m *CARChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _BlockStorageGrpcService_ImportCAR_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BlockStorageGrpcServiceServer).ImportCAR(&blockStorageGrpcServiceImportCARServer{stream})
+}
+
+type BlockStorageGrpcService_ImportCARServer interface {
+	SendAndClose(*ImportCARResponse) error
+	Recv() (*CARChunk, error)
+	grpc.ServerStream
+}
+
+type blockStorageGrpcServiceImportCARServer struct {
+	grpc.ServerStream
+}
+
+func (x *blockStorageGrpcServiceImportCARServer) SendAndClose(m *ImportCARResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *blockStorageGrpcServiceImportCARServer) Recv() (*CARChunk, error) {
+	m := new(CARChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _BlockStorageGrpcService_WriteTree_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BlockStorageGrpcServiceServer).WriteTree(&blockStorageGrpcServiceWriteTreeServer{stream})
+}
+
+type BlockStorageGrpcService_WriteTreeServer interface {
+	SendAndClose(*WriteBlockResponse) error
+	Recv() (*WriteBlockRequest, error)
+	grpc.ServerStream
+}
+
+type blockStorageGrpcServiceWriteTreeServer struct {
+	grpc.ServerStream
+}
+
+func (x *blockStorageGrpcServiceWriteTreeServer) SendAndClose(m *WriteBlockResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *blockStorageGrpcServiceWriteTreeServer) Recv() (*WriteBlockRequest, error) {
+	m := new(WriteBlockRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _BlockStorageGrpcService_WriteArchive_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BlockStorageGrpcServiceServer).WriteArchive(&blockStorageGrpcServiceWriteArchiveServer{stream})
+}
+
+type BlockStorageGrpcService_WriteArchiveServer interface {
+	SendAndClose(*WriteBlockResponse) error
+	Recv() (*WriteBlockRequest, error)
+	grpc.ServerStream
+}
+
+type blockStorageGrpcServiceWriteArchiveServer struct {
+	grpc.ServerStream
+}
+
+func (x *blockStorageGrpcServiceWriteArchiveServer) SendAndClose(m *WriteBlockResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *blockStorageGrpcServiceWriteArchiveServer) Recv() (*WriteBlockRequest, error) {
+	m := new(WriteBlockRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _BlockStorageGrpcService_ExportTar_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportTarRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BlockStorageGrpcServiceServer).ExportTar(m, &blockStorageGrpcServiceExportTarServer{stream})
+}
+
+type BlockStorageGrpcService_ExportTarServer interface {
+	Send(*TarChunk) error
+	grpc.ServerStream
+}
+
+type blockStorageGrpcServiceExportTarServer struct {
+	grpc.ServerStream
+}
+
+func (x *blockStorageGrpcServiceExportTarServer) Send(m *TarChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _BlockStorageGrpcService_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockStorageGrpcServiceServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blockpb.BlockStorageGrpcService/Stat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockStorageGrpcServiceServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlockStorageGrpcService_ListBlocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListBlocksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BlockStorageGrpcServiceServer).ListBlocks(m, &blockStorageGrpcServiceListBlocksServer{stream})
+}
+
+type BlockStorageGrpcService_ListBlocksServer interface {
+	Send(*BlockStat) error
+	grpc.ServerStream
+}
+
+type blockStorageGrpcServiceListBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *blockStorageGrpcServiceListBlocksServer) Send(m *BlockStat) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _BlockStorageGrpcService_StartUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockStorageGrpcServiceServer).StartUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blockpb.BlockStorageGrpcService/StartUpload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockStorageGrpcServiceServer).StartUpload(ctx, req.(*StartUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlockStorageGrpcService_GetUploadStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockStorageGrpcServiceServer).GetUploadStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blockpb.BlockStorageGrpcService/GetUploadStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockStorageGrpcServiceServer).GetUploadStatus(ctx, req.(*UploadStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlockStorageGrpcService_WriteUpload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BlockStorageGrpcServiceServer).WriteUpload(&blockStorageGrpcServiceWriteUploadServer{stream})
+}
+
+type BlockStorageGrpcService_WriteUploadServer interface {
+	SendAndClose(*WriteBlockResponse) error
+	Recv() (*UploadRequest, error)
+	grpc.ServerStream
+}
+
+type blockStorageGrpcServiceWriteUploadServer struct {
+	grpc.ServerStream
+}
+
+func (x *blockStorageGrpcServiceWriteUploadServer) SendAndClose(m *WriteBlockResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *blockStorageGrpcServiceWriteUploadServer) Recv() (*UploadRequest, error) {
+	m := new(UploadRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _BlockStorageGrpcService_GetUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockStorageGrpcServiceServer).GetUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blockpb.BlockStorageGrpcService/GetUsage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockStorageGrpcServiceServer).GetUsage(ctx, req.(*UsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // BlockStorageGrpcService_ServiceDesc is the grpc.ServiceDesc for BlockStorageGrpcService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -161,6 +723,22 @@ var BlockStorageGrpcService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetBlock",
 			Handler:    _BlockStorageGrpcService_GetBlock_Handler,
 		},
+		{
+			MethodName: "Stat",
+			Handler:    _BlockStorageGrpcService_Stat_Handler,
+		},
+		{
+			MethodName: "StartUpload",
+			Handler:    _BlockStorageGrpcService_StartUpload_Handler,
+		},
+		{
+			MethodName: "GetUploadStatus",
+			Handler:    _BlockStorageGrpcService_GetUploadStatus_Handler,
+		},
+		{
+			MethodName: "GetUsage",
+			Handler:    _BlockStorageGrpcService_GetUsage_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -168,6 +746,41 @@ var BlockStorageGrpcService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _BlockStorageGrpcService_WriteBlock_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "ExportCAR",
+			Handler:       _BlockStorageGrpcService_ExportCAR_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportCAR",
+			Handler:       _BlockStorageGrpcService_ImportCAR_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WriteTree",
+			Handler:       _BlockStorageGrpcService_WriteTree_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WriteArchive",
+			Handler:       _BlockStorageGrpcService_WriteArchive_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ExportTar",
+			Handler:       _BlockStorageGrpcService_ExportTar_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListBlocks",
+			Handler:       _BlockStorageGrpcService_ListBlocks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WriteUpload",
+			Handler:       _BlockStorageGrpcService_WriteUpload_Handler,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "store.proto",
 }
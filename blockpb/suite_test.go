@@ -0,0 +1,21 @@
+package blockpb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type blockpbSuite struct {
+	suite.Suite
+	*require.Assertions
+}
+
+func TestBlockpbSuite(t *testing.T) {
+	suite.Run(t, new(blockpbSuite))
+}
+
+func (s *blockpbSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+}
@@ -0,0 +1,234 @@
+package blockpb
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrUnixFSMalformed is return, when binary form is not a valid UnixFS data
+var ErrUnixFSMalformed = errors.New("blockstorage: unixfs data malformed")
+
+// UnixFSType - represents UnixFS node type
+type UnixFSType uint64
+
+// UnixFS node types
+const (
+	UnixFSRaw       UnixFSType = 0
+	UnixFSDirectory UnixFSType = 1
+	UnixFSFile      UnixFSType = 2
+	UnixFSMetadata  UnixFSType = 3
+	UnixFSSymlink   UnixFSType = 4
+	UnixFSHAMTShard UnixFSType = 5
+)
+
+// UnixFS field numbers (see https://github.com/ipfs/specs/blob/main/UNIXFS.md)
+const (
+	unixfsType       protowire.Number = 1
+	unixfsData       protowire.Number = 2
+	unixfsFileSize   protowire.Number = 3
+	unixfsBlockSizes protowire.Number = 4
+	unixfsMode       protowire.Number = 7
+	unixfsMtime      protowire.Number = 8
+	unixTimeSeconds  protowire.Number = 1
+	unixTimeNsecs    protowire.Number = 2
+)
+
+// UnixTime - captures/represents modification time of UnixFS node
+type UnixTime struct {
+	Seconds int64
+	Nsecs   uint32
+}
+
+// UnixFS - captures/represents UnixFS data carried in `Data` field of dag-pb nodes
+type UnixFS struct {
+	Type       UnixFSType
+	Data       []byte
+	FileSize   uint64
+	BlockSizes []uint64
+	Mode       uint32
+	Mtime      *UnixTime
+}
+
+// EncodeUnixFS - encodes given UnixFS data in the same form as go-ipfs does. File size is only written
+// for file and raw nodes, block sizes are written unpacked (proto2). Mode and modification time (UnixFS 1.5)
+// are only written when set.
+func EncodeUnixFS(u *UnixFS) []byte {
+	var ret []byte
+	ret = protowire.AppendTag(ret, unixfsType, protowire.VarintType)
+	ret = protowire.AppendVarint(ret, uint64(u.Type))
+	if u.Data != nil {
+		ret = protowire.AppendTag(ret, unixfsData, protowire.BytesType)
+		ret = protowire.AppendBytes(ret, u.Data)
+	}
+	if u.Type == UnixFSFile || u.Type == UnixFSRaw {
+		ret = protowire.AppendTag(ret, unixfsFileSize, protowire.VarintType)
+		ret = protowire.AppendVarint(ret, u.FileSize)
+	}
+	for _, size := range u.BlockSizes {
+		ret = protowire.AppendTag(ret, unixfsBlockSizes, protowire.VarintType)
+		ret = protowire.AppendVarint(ret, size)
+	}
+	if u.Mode != 0 {
+		ret = protowire.AppendTag(ret, unixfsMode, protowire.VarintType)
+		ret = protowire.AppendVarint(ret, uint64(u.Mode))
+	}
+	if u.Mtime != nil {
+		var mtime []byte
+		mtime = protowire.AppendTag(mtime, unixTimeSeconds, protowire.VarintType)
+		mtime = protowire.AppendVarint(mtime, uint64(u.Mtime.Seconds))
+		if u.Mtime.Nsecs != 0 {
+			mtime = protowire.AppendTag(mtime, unixTimeNsecs, protowire.Fixed32Type)
+			mtime = protowire.AppendFixed32(mtime, u.Mtime.Nsecs)
+		}
+		ret = protowire.AppendTag(ret, unixfsMtime, protowire.BytesType)
+		ret = protowire.AppendBytes(ret, mtime)
+	}
+	return ret
+}
+
+// decodeUnixTime - decodes binary form of UnixFS modification time
+func decodeUnixTime(data []byte) (*UnixTime, error) {
+	ret := &UnixTime{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, ErrUnixFSMalformed
+		}
+		data = data[n:]
+		switch {
+		case num == unixTimeSeconds && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			ret.Seconds = int64(v)
+			data = data[n:]
+		case num == unixTimeNsecs && typ == protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			ret.Nsecs = v
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			data = data[n:]
+		}
+	}
+	return ret, nil
+}
+
+// DecodeUnixFS - decodes binary form of UnixFS data. Fields not used by blockstorage are skipped.
+func DecodeUnixFS(data []byte) (*UnixFS, error) {
+	ret := &UnixFS{}
+	hasType := false
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, ErrUnixFSMalformed
+		}
+		data = data[n:]
+		switch {
+		case num == unixfsType && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 || v > uint64(UnixFSHAMTShard) {
+				return nil, ErrUnixFSMalformed
+			}
+			ret.Type = UnixFSType(v)
+			hasType = true
+			data = data[n:]
+		case num == unixfsData && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			ret.Data = append([]byte{}, v...)
+			data = data[n:]
+		case num == unixfsFileSize && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			ret.FileSize = v
+			data = data[n:]
+		case num == unixfsBlockSizes && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			ret.BlockSizes = append(ret.BlockSizes, v)
+			data = data[n:]
+		case num == unixfsBlockSizes && typ == protowire.BytesType:
+			packed, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			for len(packed) > 0 {
+				v, m := protowire.ConsumeVarint(packed)
+				if m < 0 {
+					return nil, ErrUnixFSMalformed
+				}
+				ret.BlockSizes = append(ret.BlockSizes, v)
+				packed = packed[m:]
+			}
+			data = data[n:]
+		case num == unixfsMode && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			ret.Mode = uint32(v)
+			data = data[n:]
+		case num == unixfsMtime && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			mtime, err := decodeUnixTime(v)
+			if err != nil {
+				return nil, err
+			}
+			ret.Mtime = mtime
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, ErrUnixFSMalformed
+			}
+			data = data[n:]
+		}
+	}
+	if !hasType {
+		return nil, ErrUnixFSMalformed
+	}
+	return ret, nil
+}
+
+// Metadata - returns mode and modification time of UnixFS node as `Metadata`, or `nil` when both are not set.
+func (u *UnixFS) Metadata() *Metadata {
+	if u.Mode == 0 && u.Mtime == nil {
+		return nil
+	}
+	ret := &Metadata{Mode: u.Mode}
+	if u.Mtime != nil {
+		ret.Mtime = u.Mtime.Seconds
+		ret.MtimeNsecs = u.Mtime.Nsecs
+	}
+	return ret
+}
+
+// SetMetadata - sets mode and modification time of UnixFS node from given metadata. Zero modification time
+// is treated as not set.
+func (u *UnixFS) SetMetadata(meta *Metadata) {
+	if meta == nil {
+		return
+	}
+	u.Mode = meta.Mode
+	if meta.Mtime != 0 || meta.MtimeNsecs != 0 {
+		u.Mtime = &UnixTime{Seconds: meta.Mtime, Nsecs: meta.MtimeNsecs}
+	}
+}
@@ -0,0 +1,144 @@
+package blockstorage
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	"google.golang.org/protobuf/proto"
+)
+
+// CacheStats - captures/represents counters and usage of decoded block cache (see `WithBlockCache`)
+type CacheStats struct {
+	// Hits - count of block reads served from cache
+	Hits uint64
+	// Misses - count of block reads which read and decoded block from stores
+	Misses uint64
+	// Entries - count of cached blocks
+	Entries int
+	// Bytes - total size of cached blocks
+	Bytes uint64
+	// MaxBytes - size limit of cache, zero when cache is disabled
+	MaxBytes uint64
+}
+
+// Captures/Represents cache key of decoded block: same binary form is decoded differently regarding link type
+type blockCacheKey struct {
+	id  cid.Cid
+	typ blockpb.LinkType
+}
+
+// Captures/Represents cached decoded block with its size
+type blockCacheEntry struct {
+	key   blockCacheKey
+	block *blockpb.Block
+	size  uint64
+}
+
+// Captures/Represents size bounded LRU (least recently used) cache of decoded blocks. Zero size limit disables
+// cache, so every read is counted as miss.
+type blockCache struct {
+	lock     sync.Mutex
+	maxBytes uint64
+	bytes    uint64
+	entries  map[blockCacheKey]*list.Element
+	order    *list.List
+	hits     uint64
+	misses   uint64
+}
+
+// newBlockCache - returns empty block cache limited with given total size of blocks in bytes
+func newBlockCache(maxBytes uint64) *blockCache {
+	return &blockCache{maxBytes: maxBytes, entries: make(map[blockCacheKey]*list.Element), order: list.New()}
+}
+
+// get - returns copy of cached block with given cid decoded regarding given link type, and marks it recently used
+func (c *blockCache) get(id cid.Cid, typ blockpb.LinkType) (*blockpb.Block, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[blockCacheKey{id: id, typ: typ}]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	// callers may modify returned block, so cached block is not shared
+	return proto.Clone(elem.Value.(*blockCacheEntry).block).(*blockpb.Block), true
+}
+
+// put - caches copy of given decoded block, and evicts least recently used blocks until cache fits its size limit.
+// Blocks larger than size limit are not cached.
+func (c *blockCache) put(id cid.Cid, typ blockpb.LinkType, block *blockpb.Block) {
+	if c.maxBytes == 0 {
+		return
+	}
+	size := uint64(proto.Size(block))
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if size > c.maxBytes {
+		return
+	}
+	key := blockCacheKey{id: id, typ: typ}
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	entry := &blockCacheEntry{key: key, block: proto.Clone(block).(*blockpb.Block), size: size}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		c.evict(c.order.Back())
+	}
+}
+
+// remove - removes cached blocks with given cid (e.g. when block is removed from permanent store)
+func (c *blockCache) remove(id cid.Cid) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, typ := range []blockpb.LinkType{blockpb.LinkType_BLOCK, blockpb.LinkType_RAW} {
+		if elem, ok := c.entries[blockCacheKey{id: id, typ: typ}]; ok {
+			c.evict(elem)
+		}
+	}
+}
+
+// evict - removes given element of cache, lock should be held by caller
+func (c *blockCache) evict(elem *list.Element) {
+	entry := c.order.Remove(elem).(*blockCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+// stats - returns counters and usage of cache
+func (c *blockCache) stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: len(c.entries), Bytes: c.bytes, MaxBytes: c.maxBytes}
+}
+
+// loadBlock - returns decoded block with given cid referenced with given link type (see `decodeLinkedBlock`) from
+// block cache, or reads it from permanent store or p2p network (see `readBlockData`) and caches it. Encrypted
+// blocks are cached as stored, and decrypted on each read, so key provider decides access of every caller.
+func (s *storage) loadBlock(ctx context.Context, id cid.Cid, typ blockpb.LinkType) (*blockpb.Block, error) {
+	block, ok := s.cache.get(id, typ)
+	if !ok {
+		data, err := s.readBlockData(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		block, err = blockpb.DecodeLinkedNode(id, typ, data)
+		if err != nil {
+			return nil, err
+		}
+		s.cache.put(id, typ, block)
+	}
+	return s.decryptBlock(ctx, block)
+}
+
+// CacheStats - returns hit/miss counters and usage of decoded block cache (see `WithBlockCache`)
+func (s *storage) CacheStats() CacheStats {
+	return s.cache.stats()
+}
@@ -0,0 +1,143 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage/blockpb"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func (s *blockStorageSuite) TestBlockCacheEviction() {
+	prefix := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}
+	blocks := make([]*blockpb.Block, 3)
+	ids := make([]cid.Cid, 3)
+	for i := range blocks {
+		blocks[i] = &blockpb.Block{Data: bytes.Repeat([]byte{byte(i)}, 100)}
+		bin, err := blockpb.Encode(blocks[i])
+		require.NoError(s.T(), err)
+		ids[i], err = prefix.Sum(bin)
+		require.NoError(s.T(), err)
+	}
+	size := uint64(proto.Size(blocks[0]))
+
+	cache := newBlockCache(2 * size)
+	cache.put(ids[0], blockpb.LinkType_BLOCK, blocks[0])
+	cache.put(ids[1], blockpb.LinkType_BLOCK, blocks[1])
+	_, ok := cache.get(ids[0], blockpb.LinkType_BLOCK)
+	require.True(s.T(), ok)
+	// least recently used block is evicted
+	cache.put(ids[2], blockpb.LinkType_BLOCK, blocks[2])
+	_, ok = cache.get(ids[1], blockpb.LinkType_BLOCK)
+	require.False(s.T(), ok)
+
+	cached, ok := cache.get(ids[0], blockpb.LinkType_BLOCK)
+	require.True(s.T(), ok)
+	require.Equal(s.T(), blocks[0].Data, cached.Data)
+	cached.Data[0] = 0xff
+	cached, ok = cache.get(ids[0], blockpb.LinkType_BLOCK)
+	require.True(s.T(), ok)
+	require.Equal(s.T(), blocks[0].Data, cached.Data)
+	_, ok = cache.get(ids[0], blockpb.LinkType_RAW)
+	require.False(s.T(), ok)
+
+	cache.remove(ids[0])
+	_, ok = cache.get(ids[0], blockpb.LinkType_BLOCK)
+	require.False(s.T(), ok)
+	require.Equal(s.T(), CacheStats{Hits: 3, Misses: 3, Entries: 1, Bytes: size, MaxBytes: 2 * size}, cache.stats())
+
+	disabled := newBlockCache(0)
+	disabled.put(ids[0], blockpb.LinkType_BLOCK, blocks[0])
+	_, ok = disabled.get(ids[0], blockpb.LinkType_BLOCK)
+	require.False(s.T(), ok)
+	require.Equal(s.T(), CacheStats{Misses: 1}, disabled.stats())
+}
+
+func (s *blockStorageSuite) TestBlockCache() {
+	ctx := context.Background()
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	peer.EXPECT().GetRemoteBlock(gomock.Any(), gomock.Any()).Return(nil, errors.New("block not found"))
+	bs, err := NewFakeBlockStorage(ctx, WithLocalStore(newMemoryStore(s.T(), s.ctrl)), WithPeer(peer), WithBlockCache(4<<20))
+	require.NoError(s.T(), err)
+	impl := bs.(*storage)
+	data := bytes.Repeat([]byte("hot content\n"), 100000)
+	digest, err := bs.CreateBlock(ctx, "hot.txt", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	before := bs.CacheStats()
+	for i := 0; i < 3; i++ {
+		_, err := bs.GetBlock(ctx, root)
+		require.NoError(s.T(), err)
+	}
+	stats := bs.CacheStats()
+	require.Equal(s.T(), before.Hits+2, stats.Hits)
+	require.Equal(s.T(), before.Misses+1, stats.Misses)
+
+	for i := 0; i < 2; i++ {
+		content := &bytes.Buffer{}
+		require.NoError(s.T(), bs.ReadFile(ctx, root, content))
+		require.Equal(s.T(), data, content.Bytes())
+	}
+	stats = bs.CacheStats()
+	require.LessOrEqual(s.T(), stats.Bytes, uint64(4<<20))
+	require.Greater(s.T(), stats.Entries, 1)
+
+	// blocks removed from permanent store are invalidated
+	stored, err := impl.localStore.ReadObject(ctx, root)
+	require.NoError(s.T(), err)
+	key, err := impl.localStore.ObjectKey(stored)
+	require.NoError(s.T(), err)
+	ws := newWriteSet()
+	ws.owned[key] = []cid.Cid{root}
+	impl.rollback(ctx, ws)
+	_, err = bs.GetBlock(ctx, root)
+	require.Error(s.T(), err)
+}
+
+// Captures/Represents key provider which provides its key only to callers allowed via context
+type callerKeyProvider struct {
+	KeyProvider
+}
+
+func (p *callerKeyProvider) Key(ctx context.Context, id string) ([]byte, error) {
+	if callerFrom(ctx) != "owner" {
+		return nil, ErrEncryptionKeyNotFound
+	}
+	return p.KeyProvider.Key(ctx, id)
+}
+
+func (s *blockStorageSuite) TestBlockCacheEncrypted() {
+	ctx := WithCaller(context.Background(), "owner")
+	keys := &callerKeyProvider{KeyProvider: NewStaticKeyProvider("kek-1", bytes.Repeat([]byte{7}, 32))}
+	bs := s.newTestStorage(WithEncryption(keys, FileKeyEncryption), WithBlockCache(4<<20))
+	data := bytes.Repeat([]byte("cached secret\n"), 1000)
+	digest, err := bs.CreateBlock(ctx, "secret.txt", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), bs.ReadFile(ctx, root, content))
+	require.Equal(s.T(), data, content.Bytes())
+
+	// cached blocks are decrypted for each caller, so callers without key access read no plaintext
+	before := bs.CacheStats()
+	other := WithCaller(context.Background(), "other")
+	_, err = bs.GetBlock(other, root)
+	require.ErrorIs(s.T(), err, ErrEncryptionKeyNotFound)
+	require.Error(s.T(), bs.ReadFile(other, root, &bytes.Buffer{}))
+	require.Equal(s.T(), before.Misses, bs.CacheStats().Misses)
+
+	block, err := bs.GetBlock(ctx, root)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), "secret.txt", block.Name)
+}
@@ -0,0 +1,190 @@
+package blockstorage
+
+import (
+	"context"
+	"io"
+	"log"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/car"
+	"github.com/igumus/blockstorage/util"
+	"github.com/ipfs/go-cid"
+)
+
+// ExportCAR - writes DAG (Directed Acyclic Graph) with given root cid (aka content identifier) to `w` in
+// CARv1 (Content Addressable aRchive) format.
+//
+// Flow:
+// 1. Writes CAR header with given root cid.
+// 2. Reads root block (from permanent store or p2p network), checks read authorizer of `ctx` allows it (see
+// `WithReadAuthorizer`), and writes it as CAR section.
+// 3. Repeats step 2 for each link of block (DAG traversal, depth first). Already written blocks are skipped.
+//
+// Error:
+// When any of the flow operations fail, returns error cause. Content written to `w` until failure is not reverted.
+func (s *storage) ExportCAR(ctx context.Context, root cid.Cid, w io.Writer) error {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return stopErr
+	}
+	defer done()
+	writer, err := car.NewWriter(w, root)
+	if err != nil {
+		return err
+	}
+	return s.exportBlock(ctx, root, blockpb.LinkType_BLOCK, writer, make(map[cid.Cid]bool))
+}
+
+// exportBlock - writes block with given cid and link type, and its descendants to CAR writer.
+func (s *storage) exportBlock(ctx context.Context, id cid.Cid, typ blockpb.LinkType, writer *car.Writer, visited map[cid.Cid]bool) error {
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return ctxErr
+	}
+	if visited[id] {
+		return nil
+	}
+	visited[id] = true
+
+	data, err := s.readBlockData(ctx, id)
+	if err != nil {
+		return err
+	}
+	block, err := blockpb.DecodeLinkedNode(id, typ, data)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeNode(ctx, block); err != nil {
+		return err
+	}
+	if err := writer.WriteBlock(id, data); err != nil {
+		return err
+	}
+	links := block.Links
+	if block.Erasure != nil {
+		// parity is exported as well, so erasure coded DAG stays recoverable on importing side
+		links = append(append(make([]*blockpb.Link, 0, len(links)+len(block.Erasure.Parity)), links...), block.Erasure.Parity...)
+	}
+	for _, link := range links {
+		childID, err := cid.Decode(link.Hash)
+		if err != nil {
+			return ErrBlockIdentifierNotValid
+		}
+		if err := s.exportBlock(ctx, childID, link.Type, writer, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportCAR - reads CARv1 (Content Addressable aRchive) from `r` and persists its blocks to permanent store.
+// Returns root cids declared in CAR header.
+//
+// Flow:
+// 1. Reads CAR header.
+// 2. Reads each block section and verifies block data against its cid.
+// 3. Persists verified block to permanent store (unless it already exists). Block ownership is announced when
+// import succeeds.
+// 4. Adds header roots which are named files or directories to file index (see `ListBlocks`)
+//
+// Error:
+// - When CAR framing not valid returns associated `car` package error
+// - When block data not matches with its cid returns `ErrBlockIntegrityViolated`
+// - When block cid hash function is not known returns `ErrBlockHashNotSupported`
+// Blocks persisted until failure are removed from permanent store (see `transaction`).
+func (s *storage) ImportCAR(ctx context.Context, r io.Reader) ([]cid.Cid, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	defer done()
+	reader, err := car.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	_, err = s.transaction(ctx, func(ctx context.Context) (*blockpb.Link, error) {
+		for {
+			ctxErr := util.CheckContext(ctx)
+			if ctxErr != nil {
+				return nil, ctxErr
+			}
+			id, data, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			ok, err := blockpb.Verify(id, data)
+			if err != nil {
+				return nil, ErrBlockHashNotSupported
+			}
+			if !ok {
+				log.Printf("err: verifying imported block failed: %s\n", id)
+				return nil, ErrBlockIntegrityViolated
+			}
+			stored, err := s.importBlock(ctx, id, data)
+			if err != nil {
+				return nil, err
+			}
+			if stored {
+				count++
+			}
+		}
+		return nil, s.indexRoots(ctx, reader.Roots)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.debug {
+		log.Printf("debug: imported %d blocks from car, roots: %v\n", count, reader.Roots)
+	}
+	return reader.Roots, nil
+}
+
+// indexRoots - adds given roots which exist in permanent store and are named files or directories to file index
+// (see `ListBlocks`). Roots which can not be read (e.g. encryption key not available) are not indexed.
+func (s *storage) indexRoots(ctx context.Context, roots []cid.Cid) error {
+	for _, root := range roots {
+		if !s.localStore.HasObject(ctx, root) {
+			continue
+		}
+		block, err := s.GetBlock(ctx, root)
+		if err != nil {
+			log.Printf("warn: reading imported root failed: %s, %s\n", root, err.Error())
+			continue
+		}
+		if block.Name == "" {
+			continue
+		}
+		if err := s.indexFile(ctx, &blockpb.Link{Hash: root.String()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importBlock - persists verified block with given cid to permanent store (unless it already exists), recording
+// it to operation's write set (see `transaction`), and announces block ownership (deferred until operation commits,
+// when block is claimed by operation). Returns whether the block is newly persisted. Imported blocks are shared
+// with in-flight operations which persisted same blocks (see `claimNode`).
+func (s *storage) importBlock(ctx context.Context, id cid.Cid, data []byte) (bool, error) {
+	claimed, err := s.claimNode(ctx, writeSetFrom(ctx), id, data)
+	if err != nil {
+		return false, err
+	}
+	if s.localStore.HasObject(ctx, id) {
+		return false, nil
+	}
+	if err := s.localStore.PutObject(ctx, id, data); err != nil {
+		return false, err
+	}
+	if !claimed {
+		s.peer.AnnounceBlock(ctx, id)
+	}
+	return true, nil
+}
@@ -0,0 +1,132 @@
+// Package car implements CARv1 (Content Addressable aRchive) framing.
+//
+// CARv1 layout: varint prefixed DAG-CBOR header (`{roots: [cid...], version: 1}`) followed by
+// sections, each of them varint prefixed concatenation of block cid and block data.
+package car
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Version - holds supported CAR version
+const Version = 1
+
+// maxSectionSize - holds upper bound of header/section size, to prevent huge allocations on malformed input
+const maxSectionSize = 32 << 20
+
+// ErrVersionNotSupported is return, when CAR version is not 1
+var ErrVersionNotSupported = errors.New("blockstorage: car version not supported")
+
+// ErrRootsNotSpecified is return, when CAR has no root cid
+var ErrRootsNotSpecified = errors.New("blockstorage: car roots not specified")
+
+// ErrSectionMalformed is return, when CAR section is not valid
+var ErrSectionMalformed = errors.New("blockstorage: car section malformed")
+
+// Writer - writes CARv1 framing to underlying writer
+type Writer struct {
+	writer io.Writer
+}
+
+// writeSection - writes varint length prefixed section parts to underlying writer
+func writeSection(w io.Writer, parts ...[]byte) error {
+	size := 0
+	for _, part := range parts {
+		size += len(part)
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(size))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewWriter - creates CAR writer, and writes header with given roots.
+func NewWriter(w io.Writer, roots ...cid.Cid) (*Writer, error) {
+	if len(roots) < 1 {
+		return nil, ErrRootsNotSpecified
+	}
+	if err := writeSection(w, encodeHeader(roots)); err != nil {
+		return nil, err
+	}
+	return &Writer{writer: w}, nil
+}
+
+// WriteBlock - writes block with given cid and data as CAR section.
+func (w *Writer) WriteBlock(id cid.Cid, data []byte) error {
+	return writeSection(w.writer, id.Bytes(), data)
+}
+
+// Reader - reads CARv1 framing from underlying reader
+type Reader struct {
+	reader *bufio.Reader
+	Roots  []cid.Cid
+}
+
+// readSection - reads varint length prefixed section. Returns `io.EOF` when there is no more section.
+func readSection(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, ErrSectionMalformed
+	}
+	if size == 0 || size > maxSectionSize {
+		return nil, ErrSectionMalformed
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, ErrSectionMalformed
+	}
+	return data, nil
+}
+
+// NewReader - creates CAR reader, and reads header.
+//
+// Error:
+// - When header not valid returns `ErrHeaderMalformed`
+// - When CAR version is not 1 returns `ErrVersionNotSupported`
+// - When header has no root returns `ErrRootsNotSpecified`
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := bufio.NewReader(r)
+	data, err := readSection(reader)
+	if err != nil {
+		return nil, ErrHeaderMalformed
+	}
+	roots, version, err := decodeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if version != Version {
+		return nil, ErrVersionNotSupported
+	}
+	if len(roots) < 1 {
+		return nil, ErrRootsNotSpecified
+	}
+	return &Reader{reader: reader, Roots: roots}, nil
+}
+
+// Next - reads next block from CAR. Returns `io.EOF` when all blocks are read.
+func (r *Reader) Next() (cid.Cid, []byte, error) {
+	data, err := readSection(r.reader)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	n, id, err := cid.CidFromBytes(data)
+	if err != nil {
+		return cid.Undef, nil, ErrSectionMalformed
+	}
+	return id, data[n:], nil
+}
@@ -0,0 +1,119 @@
+package car
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *carSuite) TestRoundTrip() {
+	blocks := make(map[cid.Cid][]byte)
+	order := make([]cid.Cid, 0)
+	for i := 0; i < 5; i++ {
+		data := []byte(fmt.Sprintf("block-%d", i))
+		id, err := s.digestPrefix.Sum(data)
+		require.NoError(s.T(), err)
+		blocks[id] = data
+		order = append(order, id)
+	}
+
+	buf := &bytes.Buffer{}
+	writer, err := NewWriter(buf, order[0], order[1])
+	require.NoError(s.T(), err)
+	for _, id := range order {
+		require.NoError(s.T(), writer.WriteBlock(id, blocks[id]))
+	}
+
+	reader, err := NewReader(buf)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), []cid.Cid{order[0], order[1]}, reader.Roots)
+	for _, expected := range order {
+		id, data, err := reader.Next()
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), expected, id)
+		require.Equal(s.T(), blocks[expected], data)
+	}
+	_, _, err = reader.Next()
+	require.Equal(s.T(), io.EOF, err)
+}
+
+func (s *carSuite) TestHeaderEncoding() {
+	id, err := s.digestPrefix.Sum([]byte("root"))
+	require.NoError(s.T(), err)
+
+	// {"roots": [42(h'00' + cid)], "version": 1}
+	expected := []byte{0xa2, 0x65, 'r', 'o', 'o', 't', 's', 0x81, 0xd8, 0x2a, 0x58, byte(len(id.Bytes()) + 1), 0x00}
+	expected = append(expected, id.Bytes()...)
+	expected = append(expected, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x01)
+	require.Equal(s.T(), expected, encodeHeader([]cid.Cid{id}))
+
+	roots, version, err := decodeHeader(expected)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(1), version)
+	require.Equal(s.T(), []cid.Cid{id}, roots)
+}
+
+func (s *carSuite) TestMalformedInput() {
+	id, err := s.digestPrefix.Sum([]byte("root"))
+	require.NoError(s.T(), err)
+
+	versionTwo := encodeHeader([]cid.Cid{id})
+	versionTwo[len(versionTwo)-1] = 0x02
+
+	testCases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{
+			name: "empty_input",
+			data: []byte{},
+			err:  ErrHeaderMalformed,
+		},
+		{
+			name: "truncated_header",
+			data: []byte{0x10, 0xa2},
+			err:  ErrHeaderMalformed,
+		},
+		{
+			name: "not_a_map",
+			data: []byte{0x01, 0x01},
+			err:  ErrHeaderMalformed,
+		},
+		{
+			name: "unsupported_version",
+			data: append([]byte{byte(len(versionTwo))}, versionTwo...),
+			err:  ErrVersionNotSupported,
+		},
+		{
+			name: "no_roots",
+			data: append([]byte{byte(len(encodeHeader(nil)))}, encodeHeader(nil)...),
+			err:  ErrRootsNotSpecified,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(tc.data))
+			require.Equal(t, tc.err, err)
+		})
+	}
+
+	_, err = NewWriter(&bytes.Buffer{})
+	require.Equal(s.T(), ErrRootsNotSpecified, err)
+
+	buf := &bytes.Buffer{}
+	_, err = NewWriter(buf, id)
+	require.NoError(s.T(), err)
+	buf.Write([]byte{0x05, 0x01, 0x02})
+	reader, err := NewReader(buf)
+	require.NoError(s.T(), err)
+	_, _, err = reader.Next()
+	require.Equal(s.T(), ErrSectionMalformed, err)
+}
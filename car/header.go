@@ -0,0 +1,193 @@
+package car
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/ipfs/go-cid"
+)
+
+// ErrHeaderMalformed is return, when CAR header is not a valid DAG-CBOR encoded header
+var ErrHeaderMalformed = errors.New("blockstorage: car header malformed")
+
+// CBOR major types and constants used in CAR header
+const (
+	cborMajorUint   = 0
+	cborMajorBytes  = 2
+	cborMajorText   = 3
+	cborMajorArray  = 4
+	cborMajorMap    = 5
+	cborMajorTag    = 6
+	cborTagCid      = 42
+	cborMaxItemSize = 1 << 20
+)
+
+// Header keys in DAG-CBOR canonical order (shorter keys first)
+const (
+	headerKeyRoots   = "roots"
+	headerKeyVersion = "version"
+)
+
+// writeCborHead - writes CBOR item head with given major type and argument
+func writeCborHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= 0xff:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= 0xffffffff:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func writeCborText(buf *bytes.Buffer, s string) {
+	writeCborHead(buf, cborMajorText, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+// encodeHeader - encodes CARv1 header `{roots: [...], version: 1}` in DAG-CBOR form.
+// CIDs are encoded as tag 42 byte strings prefixed with multibase identity byte (0x00).
+func encodeHeader(roots []cid.Cid) []byte {
+	buf := &bytes.Buffer{}
+	writeCborHead(buf, cborMajorMap, 2)
+	writeCborText(buf, headerKeyRoots)
+	writeCborHead(buf, cborMajorArray, uint64(len(roots)))
+	for _, root := range roots {
+		bin := root.Bytes()
+		writeCborHead(buf, cborMajorTag, cborTagCid)
+		writeCborHead(buf, cborMajorBytes, uint64(len(bin)+1))
+		buf.WriteByte(0)
+		buf.Write(bin)
+	}
+	writeCborText(buf, headerKeyVersion)
+	writeCborHead(buf, cborMajorUint, Version)
+	return buf.Bytes()
+}
+
+// readCborHead - reads CBOR item head and returns major type and argument
+func readCborHead(r *bytes.Reader) (byte, uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, ErrHeaderMalformed
+	}
+	major := b >> 5
+	info := b & 0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		v, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, ErrHeaderMalformed
+		}
+		return major, uint64(v), nil
+	case info == 25:
+		var v uint16
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return 0, 0, ErrHeaderMalformed
+		}
+		return major, uint64(v), nil
+	case info == 26:
+		var v uint32
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return 0, 0, ErrHeaderMalformed
+		}
+		return major, uint64(v), nil
+	case info == 27:
+		var v uint64
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return 0, 0, ErrHeaderMalformed
+		}
+		return major, v, nil
+	default:
+		return 0, 0, ErrHeaderMalformed
+	}
+}
+
+// readCborBytes - reads content of byte/text string item with given size
+func readCborBytes(r *bytes.Reader, n uint64) ([]byte, error) {
+	if n > cborMaxItemSize || n > uint64(r.Len()) {
+		return nil, ErrHeaderMalformed
+	}
+	ret := make([]byte, n)
+	if _, err := io.ReadFull(r, ret); err != nil {
+		return nil, ErrHeaderMalformed
+	}
+	return ret, nil
+}
+
+// readCborCid - reads tag 42 encoded CID
+func readCborCid(r *bytes.Reader) (cid.Cid, error) {
+	major, tag, err := readCborHead(r)
+	if err != nil || major != cborMajorTag || tag != cborTagCid {
+		return cid.Undef, ErrHeaderMalformed
+	}
+	major, n, err := readCborHead(r)
+	if err != nil || major != cborMajorBytes {
+		return cid.Undef, ErrHeaderMalformed
+	}
+	bin, err := readCborBytes(r, n)
+	if err != nil || len(bin) < 2 || bin[0] != 0 {
+		return cid.Undef, ErrHeaderMalformed
+	}
+	return cid.Cast(bin[1:])
+}
+
+// decodeHeader - decodes DAG-CBOR encoded CARv1 header. Returns roots and version of CAR.
+func decodeHeader(data []byte) ([]cid.Cid, uint64, error) {
+	r := bytes.NewReader(data)
+	major, entries, err := readCborHead(r)
+	if err != nil || major != cborMajorMap {
+		return nil, 0, ErrHeaderMalformed
+	}
+
+	var roots []cid.Cid
+	version := uint64(0)
+	for i := uint64(0); i < entries; i++ {
+		major, n, err := readCborHead(r)
+		if err != nil || major != cborMajorText {
+			return nil, 0, ErrHeaderMalformed
+		}
+		key, err := readCborBytes(r, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		switch string(key) {
+		case headerKeyRoots:
+			major, count, err := readCborHead(r)
+			if err != nil || major != cborMajorArray || count > uint64(r.Len()) {
+				return nil, 0, ErrHeaderMalformed
+			}
+			roots = make([]cid.Cid, 0, count)
+			for j := uint64(0); j < count; j++ {
+				root, err := readCborCid(r)
+				if err != nil {
+					return nil, 0, ErrHeaderMalformed
+				}
+				roots = append(roots, root)
+			}
+		case headerKeyVersion:
+			major, v, err := readCborHead(r)
+			if err != nil || major != cborMajorUint {
+				return nil, 0, ErrHeaderMalformed
+			}
+			version = v
+		default:
+			return nil, 0, ErrHeaderMalformed
+		}
+	}
+	if r.Len() != 0 {
+		return nil, 0, ErrHeaderMalformed
+	}
+	return roots, version, nil
+}
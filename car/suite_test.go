@@ -0,0 +1,30 @@
+package car
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type carSuite struct {
+	suite.Suite
+	*require.Assertions
+	digestPrefix cid.Prefix
+}
+
+func TestCarSuite(t *testing.T) {
+	suite.Run(t, new(carSuite))
+}
+
+func (s *carSuite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	s.digestPrefix = cid.Prefix{
+		Version:  1,
+		Codec:    cid.Raw,
+		MhType:   mh.SHA2_256,
+		MhLength: -1,
+	}
+}
@@ -0,0 +1,155 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage/car"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestStorage - creates fake block storage over in-memory store with mock peer
+func (s *blockStorageSuite) newTestStorage(opts ...BlockStorageOption) BlockStorage {
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	opts = append([]BlockStorageOption{WithLocalStore(newMemoryStore(s.T(), s.ctrl)), WithPeer(peer)}, opts...)
+	storage, err := NewFakeBlockStorage(context.Background(), opts...)
+	require.NoError(s.T(), err)
+	return storage
+}
+
+func (s *blockStorageSuite) TestCARExportImport() {
+	ctx := context.Background()
+	source := s.newTestStorage()
+	target := s.newTestStorage()
+
+	data := make([]byte, 0)
+	for i := 0; i < 3; i++ {
+		buf := &bytes.Buffer{}
+		_, err := buf.ReadFrom(generateRandomByteReader(s.T(), 300<<10))
+		require.NoError(s.T(), err)
+		data = append(data, buf.Bytes()...)
+	}
+	digest, err := source.CreateBlock(ctx, "exported.bin", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	archive := &bytes.Buffer{}
+	require.NoError(s.T(), source.ExportCAR(ctx, root, archive))
+
+	reader, err := car.NewReader(bytes.NewReader(archive.Bytes()))
+	require.NoError(s.T(), err)
+	count := 0
+	for {
+		_, _, err := reader.Next()
+		if err != nil {
+			break
+		}
+		count++
+	}
+	require.Equal(s.T(), 3, count)
+
+	roots, err := target.ImportCAR(ctx, bytes.NewReader(archive.Bytes()))
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), []cid.Cid{root}, roots)
+
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), target.ReadFile(ctx, root, content))
+	require.Equal(s.T(), data, content.Bytes())
+
+	// imported named roots are listed like created files
+	stats, err := target.ListBlocks(ctx, BlockFilter{})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), stats, 1)
+	require.Equal(s.T(), root.String(), stats[0].Cid)
+	require.Equal(s.T(), "exported.bin", stats[0].Name)
+	require.Equal(s.T(), uint64(len(data)), stats[0].Size)
+}
+
+func (s *blockStorageSuite) TestCARImportRollback() {
+	ctx := context.Background()
+	prefix := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}
+	valid, err := prefix.Sum([]byte("valid"))
+	require.NoError(s.T(), err)
+	tampered, err := prefix.Sum([]byte("tampered"))
+	require.NoError(s.T(), err)
+
+	archive := &bytes.Buffer{}
+	writer, err := car.NewWriter(archive, valid)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), writer.WriteBlock(valid, []byte("valid")))
+	require.NoError(s.T(), writer.WriteBlock(tampered, []byte("tampered data")))
+
+	// blocks persisted before failing block are removed
+	target := s.newTestStorage()
+	_, err = target.ImportCAR(ctx, archive)
+	require.Equal(s.T(), ErrBlockIntegrityViolated, err)
+	require.False(s.T(), target.(*storage).localStore.HasObject(ctx, valid))
+}
+
+func (s *blockStorageSuite) TestCARImportVerification() {
+	ctx := context.Background()
+	data := []byte("block data")
+
+	sha256Prefix := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}
+	sha512Prefix := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_512, MhLength: -1}
+	valid, err := sha256Prefix.Sum(data)
+	require.NoError(s.T(), err)
+	validSha512, err := sha512Prefix.Sum(data)
+	require.NoError(s.T(), err)
+	unknownHash, err := mh.Encode(make([]byte, 32), 0x300001)
+	require.NoError(s.T(), err)
+	unsupported := cid.NewCidV1(cid.Raw, unknownHash)
+
+	testCases := []struct {
+		name string
+		id   cid.Cid
+		data []byte
+		err  error
+	}{
+		{
+			name: "valid_block",
+			id:   valid,
+			data: data,
+			err:  nil,
+		},
+		{
+			name: "valid_sha512_block",
+			id:   validSha512,
+			data: data,
+			err:  nil,
+		},
+		{
+			name: "tampered_block",
+			id:   valid,
+			data: []byte("tampered data"),
+			err:  ErrBlockIntegrityViolated,
+		},
+		{
+			name: "unsupported_hash",
+			id:   unsupported,
+			data: data,
+			err:  ErrBlockHashNotSupported,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			archive := &bytes.Buffer{}
+			writer, err := car.NewWriter(archive, tc.id)
+			require.NoError(t, err)
+			require.NoError(t, writer.WriteBlock(tc.id, tc.data))
+
+			_, err = s.newTestStorage().ImportCAR(ctx, archive)
+			require.Equal(t, tc.err, err)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Command bsctl is a command line client of blockstorage GRPC endpoint.
+//
+// Usage:
+//
+//	bsctl car export -addr <host:port> -cid <root cid> [-out <file>]
+//	bsctl car import -addr <host:port> [-in <file>]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// defaultAddr - holds default blockstorage GRPC endpoint address
+const defaultAddr = "localhost:9000"
+
+// chunkSize - holds size of chunks streamed to endpoint
+const chunkSize = 512 << 10
+
+const usage = `Usage:
+  bsctl car export -addr <host:port> -cid <root cid> [-out <file>]
+  bsctl car import -addr <host:port> [-in <file>]
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "err: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) < 2 || args[0] != "car" {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command")
+	}
+	switch args[1] {
+	case "export":
+		return carExport(args[2:])
+	case "import":
+		return carImport(args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown car command: %s", args[1])
+	}
+}
+
+// dial - creates client connection to blockstorage GRPC endpoint
+func dial(ctx context.Context, addr string) (*grpc.ClientConn, blockpb.BlockStorageGrpcServiceClient, error) {
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, blockpb.NewBlockStorageGrpcServiceClient(conn), nil
+}
+
+// carExport - streams CAR archive of given root from endpoint to output file (or stdout).
+func carExport(args []string) error {
+	flags := flag.NewFlagSet("car export", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr, "blockstorage grpc endpoint address")
+	root := flags.String("cid", "", "root block cid to export")
+	out := flags.String("out", "", "output file (default: stdout)")
+	flags.Parse(args)
+	if *root == "" {
+		flags.Usage()
+		return fmt.Errorf("root cid not specified")
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ctx := context.Background()
+	conn, client, err := dial(ctx, *addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := client.ExportCAR(ctx, &blockpb.ExportCARRequest{Cid: *root})
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.GetData()); err != nil {
+			return err
+		}
+	}
+}
+
+// carImport - streams CAR archive from input file (or stdin) to endpoint, and prints imported roots.
+func carImport(args []string) error {
+	flags := flag.NewFlagSet("car import", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr, "blockstorage grpc endpoint address")
+	in := flags.String("in", "", "input file (default: stdin)")
+	flags.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx := context.Background()
+	conn, client, err := dial(ctx, *addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := client.ImportCAR(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		buf := make([]byte, chunkSize)
+		n, err := r.Read(buf)
+		if n > 0 {
+			if sendErr := stream.Send(&blockpb.CARChunk{Data: buf[:n]}); sendErr != nil {
+				// actual failure cause is returned on CloseAndRecv
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	for _, root := range resp.GetRoots() {
+		fmt.Println(root)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package blockstorage
+
+import (
+	"context"
+
+	"github.com/igumus/blockstorage/blockpb"
+)
+
+// encodeLeafBlock - encodes leaf block with given data regarding storage's compression (see `WithCompression`),
+// and encrypts compressed data with given file key (optional, see `WithEncryption`). Returns binary form to store,
+// and binary form addressed by cid of the leaf. Data is stored uncompressed when compression does not reduce its
+// size.
+func (s *storage) encodeLeafBlock(data []byte, key *fileKey) ([]byte, []byte, error) {
+	block := &blockpb.Block{Data: data}
+	if s.compression != blockpb.Compression_NONE {
+		compressed, err := blockpb.Compress(s.compression, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(compressed) < len(data) {
+			block.Data = compressed
+			block.Compression = s.compression
+		}
+	}
+	if key != nil {
+		if err := encryptLeaf(block, key); err != nil {
+			return nil, nil, err
+		}
+	}
+	stored, err := blockpb.Encode(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	// encrypted leaves are always addressed with stored form, so cids not disclose digest of content
+	if s.addressing == OriginalAddressing && block.Compression != blockpb.Compression_NONE && key == nil {
+		original, err := blockpb.Encode(&blockpb.Block{Data: data})
+		if err != nil {
+			return nil, nil, err
+		}
+		return stored, original, nil
+	}
+	return stored, stored, nil
+}
+
+// persistEncodedLeaf - encodes given chunk as leaf block (see `encodeLeafBlock`), and persists it addressed
+// regarding storage's addressing (see `Addressing`). Returned link's `Tsize` is size of the chunk before
+// compression and encryption. Returns stored (binary) form of leaf with its link.
+func (s *storage) persistEncodedLeaf(ctx context.Context, data []byte, key *fileKey) (*blockpb.Link, []byte, error) {
+	stored, addressed, err := s.encodeLeafBlock(data, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := s.nodeID(s.nodeCodec(), addressed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.persistNodeWithID(ctx, id, stored); err != nil {
+		return nil, nil, err
+	}
+	return &blockpb.Link{
+		Hash:  id.String(),
+		Tsize: uint64(len(data)),
+	}, stored, nil
+}
@@ -0,0 +1,80 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestCompression() {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("ts=2022-07-01T10:00:00Z level=info msg=\"chunk persisted\"\n"), 20000)
+
+	leafHashes := func(bs BlockStorage, digest string) []string {
+		root, err := cid.Decode(digest)
+		require.NoError(s.T(), err)
+		block, err := bs.GetBlock(ctx, root)
+		require.NoError(s.T(), err)
+		ret := make([]string, 0, len(block.Links))
+		for _, link := range block.Links {
+			ret = append(ret, link.Hash)
+		}
+		return ret
+	}
+	plain := s.newTestStorage()
+	plainDigest, err := plain.CreateBlock(ctx, "app.log", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	plainLeaves := leafHashes(plain, plainDigest)
+
+	for _, codec := range []blockpb.Compression{blockpb.Compression_ZSTD, blockpb.Compression_GZIP, blockpb.Compression_SNAPPY} {
+		for _, addressing := range []Addressing{CompressedAddressing, OriginalAddressing} {
+			s.T().Log(codec, addressing)
+			bs := s.newTestStorage(WithCompression(codec, addressing), WithDatastore(dssync.MutexWrap(ds.NewMapDatastore())))
+			impl := bs.(*storage)
+			digest, err := bs.CreateBlock(ctx, "app.log", bytes.NewReader(data))
+			require.NoError(s.T(), err)
+			if addressing == OriginalAddressing {
+				require.Equal(s.T(), plainLeaves, leafHashes(bs, digest))
+			} else {
+				require.NotEqual(s.T(), plainLeaves, leafHashes(bs, digest))
+			}
+			root, err := cid.Decode(digest)
+			require.NoError(s.T(), err)
+
+			content := &bytes.Buffer{}
+			require.NoError(s.T(), bs.ReadFile(ctx, root, content))
+			require.Equal(s.T(), data, content.Bytes())
+
+			block, err := bs.GetBlock(ctx, root)
+			require.NoError(s.T(), err)
+			stored := 0
+			for _, link := range block.Links {
+				id, err := cid.Decode(link.Hash)
+				require.NoError(s.T(), err)
+				bin, err := impl.localStore.ReadObject(ctx, id)
+				require.NoError(s.T(), err)
+				stored += len(bin)
+
+				leaf, err := bs.GetBlock(ctx, id)
+				require.NoError(s.T(), err)
+				require.Equal(s.T(), link.Tsize, uint64(len(leaf.Data)))
+			}
+			require.Less(s.T(), stored, len(data))
+
+			// compressed blocks are carried as stored, and verified by importing side
+			archive := &bytes.Buffer{}
+			require.NoError(s.T(), bs.ExportCAR(ctx, root, archive))
+			target := s.newTestStorage()
+			_, err = target.ImportCAR(ctx, archive)
+			require.NoError(s.T(), err)
+			content.Reset()
+			require.NoError(s.T(), target.ReadFile(ctx, root, content))
+			require.Equal(s.T(), data, content.Bytes())
+		}
+	}
+}
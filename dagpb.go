@@ -0,0 +1,131 @@
+package blockstorage
+
+import (
+	"context"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+)
+
+// dagpbMaxLinks - holds max link count of dag-pb node (same as go-ipfs balanced layout)
+const dagpbMaxLinks = 174
+
+// Captures/Represents link to file DAG node with size of file content under the node
+type sizedLink struct {
+	link     *blockpb.Link
+	fileSize uint64
+	// stored (binary) form of leaf, kept until leaf is added to stripe of erasure coded file (see `addStripeLeaf`)
+	stored []byte
+}
+
+// persistDagPBNode - creates and persists dag-pb node (UnixFS file with given metadata) which links given children.
+func (s *storage) persistDagPBNode(ctx context.Context, children []*sizedLink, meta *blockpb.Metadata) (*sizedLink, error) {
+	fs := &blockpb.UnixFS{
+		Type:       blockpb.UnixFSFile,
+		BlockSizes: make([]uint64, 0, len(children)),
+	}
+	fs.SetMetadata(meta)
+	node := &blockpb.Block{
+		Links: make([]*blockpb.Link, 0, len(children)),
+	}
+	tsize := uint64(0)
+	for _, child := range children {
+		fs.FileSize += child.fileSize
+		fs.BlockSizes = append(fs.BlockSizes, child.fileSize)
+		node.Links = append(node.Links, child.link)
+		tsize += child.link.Tsize
+	}
+	node.Data = blockpb.EncodeUnixFS(fs)
+
+	data, err := blockpb.EncodeDagPB(node)
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.persistNode(ctx, cid.DagProtobuf, data)
+	if err != nil {
+		return nil, err
+	}
+	return &sizedLink{
+		link: &blockpb.Link{
+			Hash:  id.String(),
+			Tsize: tsize + uint64(len(data)),
+		},
+		fileSize: fs.FileSize,
+	}, nil
+}
+
+// persistDagPBLeaf - persists given chunk as leaf of dag-pb DAG. Leaves are raw blocks, except CIDv0 DAGs
+// (raw codec is not defined for CIDv0), whose leaves are dag-pb nodes with UnixFS file data (as go-ipfs does).
+func (s *storage) persistDagPBLeaf(ctx context.Context, chunk []byte) (*sizedLink, error) {
+	if s.prefix.Version > 0 {
+		id, err := s.persistNode(ctx, cid.Raw, chunk)
+		if err != nil {
+			return nil, err
+		}
+		return &sizedLink{
+			link:     &blockpb.Link{Hash: id.String(), Tsize: uint64(len(chunk)), Type: blockpb.LinkType_RAW},
+			fileSize: uint64(len(chunk)),
+		}, nil
+	}
+
+	fs := &blockpb.UnixFS{
+		Type:     blockpb.UnixFSFile,
+		Data:     chunk,
+		FileSize: uint64(len(chunk)),
+	}
+	data, err := blockpb.EncodeDagPB(&blockpb.Block{Data: blockpb.EncodeUnixFS(fs)})
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.persistNode(ctx, cid.DagProtobuf, data)
+	if err != nil {
+		return nil, err
+	}
+	return &sizedLink{
+		link:     &blockpb.Link{Hash: id.String(), Tsize: uint64(len(data))},
+		fileSize: fs.FileSize,
+	}, nil
+}
+
+// createDagPBRoot - creates root of IPFS compatible (`ipfs add`, with same chunk size and cid version) DAG of
+// given leaves (see `persistDagPBLeaf`).
+//
+// Flow:
+// 1. When content fits to single chunk and there is no metadata, returns link of the leaf. When there is no content
+// and `allowEmpty` is set, persists empty UnixFS file node.
+// 2. Otherwise groups nodes of each level by `dagpbMaxLinks` into dag-pb nodes with UnixFS file data
+// (balanced layout), until single root (which carries mode/mtime of given metadata) remains.
+// 3. Returns link of root (dag-pb), whose `Tsize` is cumulative size of the DAG
+//
+// Error:
+// - When there is no leaf and `allowEmpty` not set, returns `nil, ErrBlockDataEmpty`
+func (s *storage) createDagPBRoot(ctx context.Context, leaves []*sizedLink, allowEmpty bool, meta *blockpb.Metadata) (*blockpb.Link, error) {
+	level := leaves
+	if len(level) < 1 && !allowEmpty {
+		return nil, ErrBlockDataEmpty
+	}
+
+	for len(level) > dagpbMaxLinks {
+		next := make([]*sizedLink, 0, len(level)/dagpbMaxLinks+1)
+		for start := 0; start < len(level); start += dagpbMaxLinks {
+			end := start + dagpbMaxLinks
+			if end > len(level) {
+				end = len(level)
+			}
+			node, err := s.persistDagPBNode(ctx, level[start:end], nil)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, node)
+		}
+		level = next
+	}
+	if len(level) == 1 && meta == nil {
+		return level[0].link, nil
+	}
+	root, err := s.persistDagPBNode(ctx, level, meta)
+	if err != nil {
+		return nil, err
+	}
+	return root.link, nil
+}
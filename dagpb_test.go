@@ -0,0 +1,100 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestDagPBBlockCreation() {
+	ctx := context.Background()
+	testCases := []struct {
+		name      string
+		chunkSize int
+		size      int
+		codec     uint64
+		links     int
+	}{
+		{name: "single_chunk", chunkSize: 16, size: 10, codec: cid.Raw, links: 0},
+		{name: "multi_chunk", chunkSize: 16, size: 50, codec: cid.DagProtobuf, links: 4},
+		{name: "full_node", chunkSize: 16, size: 16 * dagpbMaxLinks, codec: cid.DagProtobuf, links: dagpbMaxLinks},
+		{name: "balanced_layout", chunkSize: 16, size: 16*dagpbMaxLinks + 1, codec: cid.DagProtobuf, links: 2},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			bs := s.newTestStorage(WithEncoding(DagPBEncoding))
+			bs.(*storage).chunkSize = tc.chunkSize
+
+			buf := &bytes.Buffer{}
+			_, err := buf.ReadFrom(generateRandomByteReader(t, tc.size))
+			require.NoError(t, err)
+			data := buf.Bytes()
+
+			digest, err := bs.CreateBlock(ctx, tc.name, bytes.NewReader(data))
+			require.NoError(t, err)
+			root, err := cid.Decode(digest)
+			require.NoError(t, err)
+			require.Equal(t, uint64(1), root.Version())
+			require.Equal(t, tc.codec, root.Type())
+
+			block, err := bs.GetBlock(ctx, root)
+			require.NoError(t, err)
+			require.Equal(t, tc.links, len(block.Links))
+			if tc.codec == cid.Raw {
+				require.Equal(t, data, block.Data)
+			} else {
+				require.Empty(t, block.Data)
+				require.Equal(t, "", block.Name)
+			}
+
+			content := &bytes.Buffer{}
+			require.NoError(t, bs.ReadFile(ctx, root, content))
+			require.Equal(t, data, content.Bytes())
+		})
+	}
+}
+
+func (s *blockStorageSuite) TestDagPBRootNode() {
+	ctx := context.Background()
+	source := s.newTestStorage(WithEncoding(DagPBEncoding))
+	source.(*storage).chunkSize = 4
+
+	digest, err := source.CreateBlock(ctx, "file", bytes.NewReader([]byte("0123456789")))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	data, err := source.(*storage).readBlockData(ctx, root)
+	require.NoError(s.T(), err)
+	node, err := blockpb.DecodeDagPB(data)
+	require.NoError(s.T(), err)
+	fs, err := blockpb.DecodeUnixFS(node.Data)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), blockpb.UnixFSFile, fs.Type)
+	require.Equal(s.T(), uint64(10), fs.FileSize)
+	require.Equal(s.T(), []uint64{4, 4, 2}, fs.BlockSizes)
+	for i, link := range node.Links {
+		leaf, err := cid.Decode(link.Hash)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), uint64(cid.Raw), leaf.Type())
+		require.Equal(s.T(), fs.BlockSizes[i], link.Tsize)
+	}
+
+	archive := &bytes.Buffer{}
+	require.NoError(s.T(), source.ExportCAR(ctx, root, archive))
+	target := s.newTestStorage()
+	roots, err := target.ImportCAR(ctx, archive)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), []cid.Cid{root}, roots)
+
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), target.ReadFile(ctx, root, content))
+	require.Equal(s.T(), "0123456789", content.String())
+}
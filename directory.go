@@ -0,0 +1,177 @@
+package blockstorage
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/util"
+	"github.com/ipfs/go-cid"
+)
+
+// CreateDirectory - creates directory block with given `name` whose entries are given links. `Name` of each link
+// is entry name, and `Hash` is cid of file root or subdirectory.
+//
+// Flow:
+// 1. Validates directory name and entries
+// 2. Sorts entries by name
+// 3. Persists directory node to permanent store (`blockpb.Block` with `BlockType_DIRECTORY` type, or UnixFS
+// directory node with `DagPBEncoding`) and announces block ownership.
+//
+// Error:
+// - When `name` is not valid returns `"", ErrBlockNameEmpty`
+// - When any entry is not valid (empty/duplicated name, name with '/', invalid cid) returns `"", ErrDirectoryEntryNotValid`
+func (s *storage) CreateDirectory(ctx context.Context, name string, entries []*blockpb.Link) (string, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return "", stopErr
+	}
+	defer done()
+	link, err := s.createDirectory(ctx, name, entries, nil)
+	if err != nil {
+		return "", err
+	}
+	return link.Hash, nil
+}
+
+// validateEntries - validates directory entries, and returns copy of entries sorted by name.
+func (s *storage) validateEntries(entries []*blockpb.Link) ([]*blockpb.Link, error) {
+	ret := make([]*blockpb.Link, 0, len(entries))
+	names := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry == nil || entry.Name == "" || entry.Name == "." || entry.Name == ".." ||
+			strings.Contains(entry.Name, "/") || names[entry.Name] {
+			return nil, ErrDirectoryEntryNotValid
+		}
+		id, err := cid.Decode(entry.Hash)
+		if err != nil {
+			return nil, ErrDirectoryEntryNotValid
+		}
+		names[entry.Name] = true
+
+		typ := entry.Type
+		// raw codec cids in dag-pb DAGs are always raw leaves
+		if s.encoding == DagPBEncoding && id.Type() == cid.Raw {
+			typ = blockpb.LinkType_RAW
+		}
+		ret = append(ret, &blockpb.Link{Hash: entry.Hash, Name: entry.Name, Tsize: entry.Tsize, Type: typ})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// createDirectory - creates directory block (see `CreateDirectory`). Returns link of directory, whose `Tsize`
+// is sum of entry sizes (`BlockPBEncoding`) or cumulative DAG size (`DagPBEncoding`). Given metadata (optional)
+// is persisted with directory node. Directory node is sealed with new file key when encryption is enabled (see
+// `sealNode`).
+func (s *storage) createDirectory(ctx context.Context, name string, entries []*blockpb.Link, meta *blockpb.Metadata) (*blockpb.Link, error) {
+	dirName := strings.TrimSpace(name)
+	if dirName == "" {
+		return nil, ErrBlockNameEmpty
+	}
+	links, err := s.validateEntries(entries)
+	if err != nil {
+		return nil, err
+	}
+	totalSize := uint64(0)
+	for _, link := range links {
+		totalSize += link.Tsize
+	}
+
+	if s.encoding == DagPBEncoding {
+		fs := &blockpb.UnixFS{Type: blockpb.UnixFSDirectory}
+		fs.SetMetadata(meta)
+		node := &blockpb.Block{
+			Links: links,
+			Data:  blockpb.EncodeUnixFS(fs),
+		}
+		data, err := blockpb.EncodeDagPB(node)
+		if err != nil {
+			return nil, err
+		}
+		id, err := s.persistNode(ctx, cid.DagProtobuf, data)
+		if err != nil {
+			return nil, err
+		}
+		return &blockpb.Link{Hash: id.String(), Tsize: totalSize + uint64(len(data))}, nil
+	}
+
+	dir := &blockpb.Block{
+		Name:  dirName,
+		Type:  blockpb.BlockType_DIRECTORY,
+		Links: links,
+		Meta:  meta,
+	}
+	key, err := s.newFileKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	link, err := s.persistBlock(ctx, dir, key)
+	if err != nil {
+		return nil, err
+	}
+	link.Tsize = totalSize
+	return link, nil
+}
+
+// GetByPath - resolves given slash separated `p` (e.g. "a/b/c.txt") relative to directory with given root cid,
+// and returns cid of the entry. Empty path (or ".") resolves to root itself.
+//
+// Flow:
+// 1. Splits path to segments (empty and "." segments are skipped)
+// 2. For each segment gets current block (must be directory), and finds entry with segment name
+// 3. Returns cid of last entry
+//
+// Error:
+// - When path has ".." segment returns `cid.Undef, ErrPathNotValid`
+// - When any intermediate block is not a directory returns `cid.Undef, ErrBlockNotDirectory`
+// - When any segment not exists returns `cid.Undef, ErrPathNotFound`
+func (s *storage) GetByPath(ctx context.Context, root cid.Cid, p string) (cid.Cid, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return cid.Undef, stopErr
+	}
+	defer done()
+	segments := strings.Split(p, "/")
+	for _, segment := range segments {
+		if segment == ".." {
+			return cid.Undef, ErrPathNotValid
+		}
+	}
+	current := root
+	for _, segment := range segments {
+		if segment == "" || segment == "." {
+			continue
+		}
+		ctxErr := util.CheckContext(ctx)
+		if ctxErr != nil {
+			return cid.Undef, ctxErr
+		}
+		block, err := s.GetBlock(ctx, current)
+		if err != nil {
+			return cid.Undef, err
+		}
+		if block.Type != blockpb.BlockType_DIRECTORY {
+			return cid.Undef, ErrBlockNotDirectory
+		}
+		found := false
+		for _, link := range block.Links {
+			if link.Name == segment {
+				next, err := cid.Decode(link.Hash)
+				if err != nil {
+					return cid.Undef, ErrBlockIdentifierNotValid
+				}
+				current = next
+				found = true
+				break
+			}
+		}
+		if !found {
+			return cid.Undef, ErrPathNotFound
+		}
+	}
+	return current, nil
+}
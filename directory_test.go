@@ -0,0 +1,111 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestDirectoryCreation() {
+	ctx := context.Background()
+	storage := s.newTestStorage()
+
+	file, err := storage.CreateBlock(ctx, "file.txt", bytes.NewReader([]byte("content")))
+	require.NoError(s.T(), err)
+
+	testCases := []struct {
+		name    string
+		dirName string
+		entries []*blockpb.Link
+		err     error
+	}{
+		{name: "valid_entries", dirName: "dir", entries: []*blockpb.Link{{Hash: file, Name: "b.txt"}, {Hash: file, Name: "a.txt"}}},
+		{name: "no_entries", dirName: "dir", entries: []*blockpb.Link{}},
+		{name: "empty_dir_name", dirName: " ", entries: []*blockpb.Link{}, err: ErrBlockNameEmpty},
+		{name: "empty_entry_name", dirName: "dir", entries: []*blockpb.Link{{Hash: file}}, err: ErrDirectoryEntryNotValid},
+		{name: "slashed_entry_name", dirName: "dir", entries: []*blockpb.Link{{Hash: file, Name: "a/b"}}, err: ErrDirectoryEntryNotValid},
+		{name: "dotdot_entry_name", dirName: "dir", entries: []*blockpb.Link{{Hash: file, Name: ".."}}, err: ErrDirectoryEntryNotValid},
+		{name: "duplicated_entry_name", dirName: "dir", entries: []*blockpb.Link{{Hash: file, Name: "a"}, {Hash: file, Name: "a"}}, err: ErrDirectoryEntryNotValid},
+		{name: "invalid_entry_cid", dirName: "dir", entries: []*blockpb.Link{{Hash: "invalid", Name: "a"}}, err: ErrDirectoryEntryNotValid},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			digest, err := storage.CreateDirectory(ctx, tc.dirName, tc.entries)
+			require.Equal(t, tc.err, err)
+			if tc.err != nil {
+				return
+			}
+			root, err := cid.Decode(digest)
+			require.NoError(t, err)
+			block, err := storage.GetBlock(ctx, root)
+			require.NoError(t, err)
+			require.Equal(t, blockpb.BlockType_DIRECTORY, block.Type)
+			require.Equal(t, tc.dirName, block.Name)
+			require.Equal(t, len(tc.entries), len(block.Links))
+			for j := 1; j < len(block.Links); j++ {
+				require.True(t, block.Links[j-1].Name < block.Links[j].Name)
+			}
+			require.Equal(t, ErrBlockIsDirectory, storage.ReadFile(ctx, root, &bytes.Buffer{}))
+		})
+	}
+}
+
+func (s *blockStorageSuite) TestGetByPath() {
+	ctx := context.Background()
+
+	for _, encoding := range []Encoding{BlockPBEncoding, DagPBEncoding} {
+		storage := s.newTestStorage(WithEncoding(encoding))
+		file, err := storage.CreateBlock(ctx, "c.txt", bytes.NewReader([]byte("content of c")))
+		require.NoError(s.T(), err)
+		inner, err := storage.CreateDirectory(ctx, "b", []*blockpb.Link{{Hash: file, Name: "c.txt"}})
+		require.NoError(s.T(), err)
+		outer, err := storage.CreateDirectory(ctx, "a", []*blockpb.Link{{Hash: inner, Name: "b"}, {Hash: file, Name: "d.txt"}})
+		require.NoError(s.T(), err)
+		root, err := storage.CreateDirectory(ctx, "root", []*blockpb.Link{{Hash: outer, Name: "a"}})
+		require.NoError(s.T(), err)
+		rootID, err := cid.Decode(root)
+		require.NoError(s.T(), err)
+
+		testCases := []struct {
+			name     string
+			path     string
+			expected string
+			err      error
+		}{
+			{name: "root", path: "", expected: root},
+			{name: "dot_root", path: ".", expected: root},
+			{name: "directory", path: "a/b", expected: inner},
+			{name: "file", path: "a/b/c.txt", expected: file},
+			{name: "redundant_slashes", path: "/a//b/./c.txt", expected: file},
+			{name: "sibling_file", path: "a/d.txt", expected: file},
+			{name: "missing_entry", path: "a/missing", err: ErrPathNotFound},
+			{name: "file_as_directory", path: "a/d.txt/x", err: ErrBlockNotDirectory},
+			{name: "escaping_path", path: "a/../a", err: ErrPathNotValid},
+		}
+
+		for i := range testCases {
+			tc := testCases[i]
+
+			s.T().Run(tc.name, func(t *testing.T) {
+				id, err := storage.GetByPath(ctx, rootID, tc.path)
+				require.Equal(t, tc.err, err)
+				if tc.err == nil {
+					require.Equal(t, tc.expected, id.String())
+				}
+			})
+		}
+
+		id, err := storage.GetByPath(ctx, rootID, "a/b/c.txt")
+		require.NoError(s.T(), err)
+		content := &bytes.Buffer{}
+		require.NoError(s.T(), storage.ReadFile(ctx, id, content))
+		require.Equal(s.T(), "content of c", content.String())
+	}
+}
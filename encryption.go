@@ -0,0 +1,256 @@
+package blockstorage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+
+	"github.com/igumus/blockstorage/blockpb"
+)
+
+// fileKeyLen - holds length of per-file (and convergent) data keys in bytes (AES-256)
+const fileKeyLen = 32
+
+// Labels of convergent key derivation, so keys and nonces derived from same secret are separated
+var (
+	convergentKeyLabel   = []byte("blockstorage/convergent/key")
+	convergentNonceLabel = []byte("blockstorage/convergent/nonce")
+	convergentWrapLabel  = []byte("blockstorage/convergent/wrap")
+)
+
+// KeyProvider - provides key-encryption keys (KEK), which wrap data keys of encrypted files (see `WithEncryption`).
+// Keys are AES keys (16, 24 or 32 bytes). Keys are addressed with ids recorded in encrypted blocks, so provider
+// should keep previous keys readable after rotation.
+type KeyProvider interface {
+	// CurrentKey - returns id and key of key-encryption key which wraps data keys of new files
+	CurrentKey(context.Context) (string, []byte, error)
+	// Key - returns key-encryption key with given id
+	Key(context.Context, string) ([]byte, error)
+}
+
+// Captures/Represents key provider with single key-encryption key
+type staticKeyProvider struct {
+	id  string
+	key []byte
+}
+
+// NewStaticKeyProvider - returns key provider which provides given key-encryption key with given id
+func NewStaticKeyProvider(id string, key []byte) KeyProvider {
+	return &staticKeyProvider{id: id, key: key}
+}
+
+func (p *staticKeyProvider) CurrentKey(_ context.Context) (string, []byte, error) {
+	return p.id, p.key, nil
+}
+
+func (p *staticKeyProvider) Key(_ context.Context, id string) ([]byte, error) {
+	if id != p.id {
+		return nil, ErrEncryptionKeyNotFound
+	}
+	return p.key, nil
+}
+
+// Captures/Represents encryption key of a file being created: key-encryption key, and random data key of the file
+// with its wrapped form. Data key is empty in convergent mode, since each leaf has own key derived from content.
+type fileKey struct {
+	kekID   string
+	kek     []byte
+	key     []byte
+	wrapped []byte
+}
+
+// encryption - returns encryption of blocks encrypted with this key (see `blockpb.Encryption`)
+func (k *fileKey) encryption() *blockpb.Encryption {
+	return &blockpb.Encryption{KeyID: k.kekID, WrappedKey: k.wrapped, Convergent: len(k.key) == 0}
+}
+
+// newFileKey - returns key of new file regarding storage's encryption (see `WithEncryption`). Returns `nil` when
+// encryption is disabled.
+func (s *storage) newFileKey(ctx context.Context) (*fileKey, error) {
+	if s.keys == nil {
+		return nil, nil
+	}
+	id, kek, err := s.keys.CurrentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := &fileKey{kekID: id, kek: kek}
+	if s.encryptionMode == ConvergentEncryption {
+		return ret, nil
+	}
+	ret.key = make([]byte, fileKeyLen)
+	if _, err := rand.Read(ret.key); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if ret.wrapped, err = seal(kek, nonce, ret.key, []byte(id)); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// restoreFileKey - restores key of file with given encryption (e.g. encryption of upload session), so content can
+// be appended to the file. Returns `nil` when encryption is `nil`.
+func (s *storage) restoreFileKey(ctx context.Context, encryption *blockpb.Encryption) (*fileKey, error) {
+	if encryption == nil {
+		return nil, nil
+	}
+	kek, err := s.keyEncryptionKey(ctx, encryption.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	ret := &fileKey{kekID: encryption.KeyID, kek: kek, wrapped: encryption.WrappedKey}
+	if encryption.Convergent {
+		return ret, nil
+	}
+	if ret.key, err = open(kek, encryption.WrappedKey, []byte(encryption.KeyID)); err != nil {
+		return nil, ErrBlockDecryptionFailed
+	}
+	return ret, nil
+}
+
+// keyEncryptionKey - returns key-encryption key with given id via storage's key provider
+//
+// Error:
+// When storage has no key provider, or provider has not the key returns `ErrEncryptionKeyNotFound`
+func (s *storage) keyEncryptionKey(ctx context.Context, id string) ([]byte, error) {
+	if s.keys == nil {
+		return nil, ErrEncryptionKeyNotFound
+	}
+	kek, err := s.keys.Key(ctx, id)
+	if err != nil {
+		return nil, ErrEncryptionKeyNotFound
+	}
+	return kek, nil
+}
+
+// encryptLeaf - encrypts `Data` of given leaf block with given file key, and records encryption to the block.
+// In convergent mode, data key and nonces are derived from content keyed with key-encryption key, so same content
+// is encrypted to same block (deduplication is preserved) while its key is not derivable without the KEK.
+func encryptLeaf(block *blockpb.Block, key *fileKey) error {
+	encryption := key.encryption()
+	dataKey := key.key
+	nonce := make([]byte, 12)
+	if encryption.Convergent {
+		dataKey = mac(key.kek, convergentKeyLabel, block.Data)
+		copy(nonce, mac(dataKey, convergentNonceLabel))
+		wrapNonce := mac(key.kek, convergentWrapLabel, dataKey)[:12]
+		wrapped, err := seal(key.kek, wrapNonce, dataKey, []byte(key.kekID))
+		if err != nil {
+			return err
+		}
+		encryption.WrappedKey = wrapped
+	} else if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data, err := seal(dataKey, nonce, block.Data, nil)
+	if err != nil {
+		return err
+	}
+	block.Data = data
+	block.Encryption = encryption
+	return nil
+}
+
+// sealNode - returns stored form of given node (file root or directory), whose encoded form is encrypted with given
+// file key as `Data` (see `encryptLeaf`), so name, metadata and entry names of the node are not readable without
+// key-encryption key (e.g. by remote peers reading the block). Stored form keeps only hashes and types of links
+// (with parity links of erasure coded files), so DAG is still traversed (e.g. exported, pushed) without keys.
+func sealNode(block *blockpb.Block, key *fileKey) (*blockpb.Block, error) {
+	data, err := blockpb.Encode(block)
+	if err != nil {
+		return nil, err
+	}
+	links := block.Links
+	if block.Erasure != nil {
+		links = append(append(make([]*blockpb.Link, 0, len(links)+len(block.Erasure.Parity)), links...), block.Erasure.Parity...)
+	}
+	ret := &blockpb.Block{Data: data, Links: make([]*blockpb.Link, 0, len(links))}
+	for _, link := range links {
+		ret.Links = append(ret.Links, &blockpb.Link{Hash: link.Hash, Type: link.Type})
+	}
+	if err := encryptLeaf(ret, key); err != nil {
+		return nil, err
+	}
+	ret.Encryption.Sealed = true
+	return ret, nil
+}
+
+// decryptBlock - decrypts `Data` of given encrypted block with key-encryption key provided by storage's key
+// provider, and decompresses it when block is compressed. Sealed nodes (see `sealNode`) are decoded from decrypted
+// data. Blocks without encrypted data are returned as is.
+//
+// Error:
+// - When key-encryption key is not available returns `nil, ErrEncryptionKeyNotFound`
+// - When data key or data can not be decrypted (e.g. wrong key, tampered block) returns `nil, ErrBlockDecryptionFailed`
+func (s *storage) decryptBlock(ctx context.Context, block *blockpb.Block) (*blockpb.Block, error) {
+	if block.Encryption == nil || len(block.Data) == 0 {
+		return block, nil
+	}
+	kek, err := s.keyEncryptionKey(ctx, block.Encryption.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := open(kek, block.Encryption.WrappedKey, []byte(block.Encryption.KeyID))
+	if err != nil {
+		return nil, ErrBlockDecryptionFailed
+	}
+	data, err := open(dataKey, block.Data, nil)
+	if err != nil {
+		return nil, ErrBlockDecryptionFailed
+	}
+	if block.Encryption.Sealed {
+		node, err := blockpb.Decode(data)
+		if err != nil {
+			return nil, ErrBlockDecryptionFailed
+		}
+		return node, nil
+	}
+	ret := &blockpb.Block{Links: block.Links, Name: block.Name, Type: block.Type, Meta: block.Meta, Data: data, Compression: block.Compression}
+	return blockpb.Decompressed(ret)
+}
+
+// seal - encrypts given plaintext with AES-GCM, and returns nonce followed by ciphertext
+func seal(key, nonce, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(append([]byte{}, nonce...), nonce, plaintext, additional), nil
+}
+
+// open - decrypts given nonce followed by ciphertext (see `seal`)
+func open(key, sealed, additional []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrBlockDecryptionFailed
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
+
+// newAEAD - returns AES-GCM with given key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// mac - returns HMAC-SHA256 of given parts keyed with given key
+func mac(key []byte, parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,227 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing/iotest"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage/blockpb"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+// leafIDs - returns cids of leaves of file with given root cid
+func (s *blockStorageSuite) leafIDs(bs BlockStorage, digest string) []cid.Cid {
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+	block, err := bs.GetBlock(context.Background(), root)
+	require.NoError(s.T(), err)
+	ret := make([]cid.Cid, 0, len(block.Links))
+	for _, link := range block.Links {
+		id, err := cid.Decode(link.Hash)
+		require.NoError(s.T(), err)
+		ret = append(ret, id)
+	}
+	return ret
+}
+
+func (s *blockStorageSuite) TestEncryption() {
+	ctx := context.Background()
+	kek := bytes.Repeat([]byte{7}, 32)
+	data := bytes.Repeat([]byte("confidential ledger entry\n"), 50000)
+
+	bs := s.newTestStorage(WithEncryption(NewStaticKeyProvider("kek-1", kek), FileKeyEncryption))
+	impl := bs.(*storage)
+	digest, err := bs.CreateBlock(ctx, "ledger.txt", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), bs.ReadFile(ctx, root, content))
+	require.Equal(s.T(), data, content.Bytes())
+
+	rootBlock, err := bs.GetBlock(ctx, root)
+	require.NoError(s.T(), err)
+	require.NotNil(s.T(), rootBlock.Encryption)
+	require.Equal(s.T(), "kek-1", rootBlock.Encryption.KeyID)
+	for _, id := range s.leafIDs(bs, digest) {
+		stored, err := impl.localStore.ReadObject(ctx, id)
+		require.NoError(s.T(), err)
+		require.False(s.T(), bytes.Contains(stored, []byte("confidential")))
+		leaf, err := bs.GetBlock(ctx, id)
+		require.NoError(s.T(), err)
+		require.True(s.T(), bytes.Contains(leaf.Data, []byte("confidential ledger entry\n")))
+	}
+
+	// same content of another file is encrypted with another data key
+	again, err := bs.CreateBlock(ctx, "ledger-copy.txt", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	require.NotEqual(s.T(), s.leafIDs(bs, digest), s.leafIDs(bs, again))
+
+	// ciphertext is carried as is, and only readable with key-encryption key
+	archive := &bytes.Buffer{}
+	require.NoError(s.T(), bs.ExportCAR(ctx, root, archive))
+	for _, tc := range []struct {
+		opts []BlockStorageOption
+		err  error
+	}{
+		{opts: nil, err: ErrEncryptionKeyNotFound},
+		{opts: []BlockStorageOption{WithEncryption(NewStaticKeyProvider("kek-2", kek), FileKeyEncryption)}, err: ErrEncryptionKeyNotFound},
+		{opts: []BlockStorageOption{WithEncryption(NewStaticKeyProvider("kek-1", bytes.Repeat([]byte{8}, 32)), FileKeyEncryption)}, err: ErrBlockDecryptionFailed},
+		{opts: []BlockStorageOption{WithEncryption(NewStaticKeyProvider("kek-1", kek), ConvergentEncryption)}},
+	} {
+		target := s.newTestStorage(tc.opts...)
+		_, err := target.ImportCAR(ctx, bytes.NewReader(archive.Bytes()))
+		require.NoError(s.T(), err)
+		content := &bytes.Buffer{}
+		err = target.ReadFile(ctx, root, content)
+		if tc.err != nil {
+			require.ErrorIs(s.T(), err, tc.err)
+			continue
+		}
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), data, content.Bytes())
+	}
+}
+
+func (s *blockStorageSuite) TestConvergentEncryption() {
+	ctx := context.Background()
+	kek := bytes.Repeat([]byte{7}, 32)
+	data := bytes.Repeat([]byte("shared dataset row\n"), 60000)
+
+	bs := s.newTestStorage(WithEncryption(NewStaticKeyProvider("kek-1", kek), ConvergentEncryption))
+	first, err := bs.CreateBlock(ctx, "first.csv", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	second, err := bs.CreateBlock(ctx, "second.csv", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), s.leafIDs(bs, first), s.leafIDs(bs, second))
+
+	other := s.newTestStorage(WithEncryption(NewStaticKeyProvider("kek-1", bytes.Repeat([]byte{8}, 32)), ConvergentEncryption))
+	third, err := other.CreateBlock(ctx, "third.csv", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	require.NotEqual(s.T(), s.leafIDs(bs, first), s.leafIDs(other, third))
+
+	for _, digest := range []string{first, second} {
+		root, err := cid.Decode(digest)
+		require.NoError(s.T(), err)
+		content := &bytes.Buffer{}
+		require.NoError(s.T(), bs.ReadFile(ctx, root, content))
+		require.Equal(s.T(), data, content.Bytes())
+	}
+}
+
+func (s *blockStorageSuite) TestEncryptedUpload() {
+	ctx := context.Background()
+	keys := NewStaticKeyProvider("kek-1", bytes.Repeat([]byte{7}, 32))
+	bs := s.newTestStorage(WithEncryption(keys, FileKeyEncryption), WithCompression(blockpb.Compression_ZSTD, CompressedAddressing))
+	data := bytes.Repeat([]byte("resumable upload line\n"), 60000)
+
+	id, err := bs.StartUpload(ctx, "upload.log", nil)
+	require.NoError(s.T(), err)
+	half := defaultChunkSize * 2
+	_, err = bs.ResumeUpload(ctx, id, 0, io.MultiReader(bytes.NewReader(data[:half]), iotest.ErrReader(errors.New("interrupted"))))
+	require.Error(s.T(), err)
+	offset, err := bs.UploadStatus(ctx, id)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(half), offset)
+	digest, err := bs.ResumeUpload(ctx, id, offset, bytes.NewReader(data[offset:]))
+	require.NoError(s.T(), err)
+
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), bs.ReadFile(ctx, root, content))
+	require.Equal(s.T(), data, content.Bytes())
+}
+
+func (s *blockStorageSuite) TestEncryptedErasureCoding() {
+	ctx := context.Background()
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	peer.EXPECT().GetRemoteBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, errors.New("block not found"))
+	keys := NewStaticKeyProvider("kek-1", bytes.Repeat([]byte{7}, 32))
+	bs, err := NewFakeBlockStorage(ctx, WithLocalStore(newMemoryStore(s.T(), s.ctrl)), WithPeer(peer),
+		WithEncryption(keys, FileKeyEncryption), WithCompression(blockpb.Compression_SNAPPY, CompressedAddressing), WithErasureCoding(2, 1))
+	require.NoError(s.T(), err)
+	impl := bs.(*storage)
+
+	buf := &bytes.Buffer{}
+	_, err = buf.ReadFrom(generateRandomByteReader(s.T(), 3*defaultChunkSize))
+	require.NoError(s.T(), err)
+	data := buf.Bytes()
+	digest, err := bs.CreateBlock(ctx, "sealed.bin", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	leaves := s.leafIDs(bs, digest)
+	require.NoError(s.T(), impl.localStore.DeleteObject(ctx, leaves[0]))
+	require.NoError(s.T(), impl.localStore.DeleteObject(ctx, leaves[2]))
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), bs.ReadFile(ctx, root, content))
+	require.Equal(s.T(), data, content.Bytes())
+	require.True(s.T(), impl.localStore.HasObject(ctx, leaves[0]))
+}
+
+func (s *blockStorageSuite) TestSealedNodes() {
+	ctx := context.Background()
+	kek := bytes.Repeat([]byte{7}, 32)
+	source := s.newTestStorage(WithEncryption(NewStaticKeyProvider("kek-1", kek), FileKeyEncryption)).(*storage)
+
+	meta := &blockpb.Metadata{ContentType: "text/x-ledger", Attributes: map[string]string{"owner": "finance-team"}}
+	file, err := source.CreateBlockWithMetadata(ctx, "quarterly-ledger.txt", meta, bytes.NewReader([]byte("ledger")))
+	require.NoError(s.T(), err)
+	dir, err := source.CreateDirectory(ctx, "accounting", []*blockpb.Link{{Hash: file, Name: "payroll-entry.txt"}})
+	require.NoError(s.T(), err)
+
+	// remote peers read stored form of blocks (see `peer.RegisterReadProtocol`)
+	newReader := func(opts ...BlockStorageOption) *storage {
+		peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+		peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+		peer.EXPECT().GetRemoteBlock(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(ctx context.Context, id cid.Cid) ([]byte, error) {
+			return source.localStore.ReadObject(ctx, id)
+		})
+		opts = append([]BlockStorageOption{WithLocalStore(newMemoryStore(s.T(), s.ctrl)), WithPeer(peer)}, opts...)
+		bs, err := NewFakeBlockStorage(ctx, opts...)
+		require.NoError(s.T(), err)
+		return bs.(*storage)
+	}
+	keyless := newReader()
+	for _, digest := range []string{file, dir} {
+		root, err := cid.Decode(digest)
+		require.NoError(s.T(), err)
+		stored, err := keyless.readBlockData(ctx, root)
+		require.NoError(s.T(), err)
+		for _, plain := range []string{"quarterly-ledger.txt", "text/x-ledger", "owner", "finance-team", "accounting", "payroll-entry.txt"} {
+			require.False(s.T(), bytes.Contains(stored, []byte(plain)), plain)
+		}
+		_, err = keyless.GetBlock(ctx, root)
+		require.ErrorIs(s.T(), err, ErrEncryptionKeyNotFound)
+	}
+
+	// DAG is traversed without keys
+	root, err := cid.Decode(dir)
+	require.NoError(s.T(), err)
+	archive := &bytes.Buffer{}
+	require.NoError(s.T(), keyless.ExportCAR(ctx, root, archive))
+	target := s.newTestStorage(WithEncryption(NewStaticKeyProvider("kek-1", kek), FileKeyEncryption))
+	_, err = target.ImportCAR(ctx, bytes.NewReader(archive.Bytes()))
+	require.NoError(s.T(), err)
+	id, err := target.GetByPath(ctx, root, "payroll-entry.txt")
+	require.NoError(s.T(), err)
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), target.ReadFile(ctx, id, content))
+	require.Equal(s.T(), "ledger", content.String())
+
+	// readers with key-encryption key read sealed nodes via peer
+	block, err := newReader(WithEncryption(NewStaticKeyProvider("kek-1", kek), FileKeyEncryption)).GetBlock(ctx, root)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), "accounting", block.Name)
+	require.Equal(s.T(), blockpb.BlockType_DIRECTORY, block.Type)
+	require.Equal(s.T(), "payroll-entry.txt", block.Links[0].Name)
+}
@@ -0,0 +1,266 @@
+package blockstorage
+
+import (
+	"context"
+	"io"
+	"log"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	"github.com/klauspost/reedsolomon"
+)
+
+// Captures/Represents erasure coding of file DAGs (see `WithErasureCoding`): leaves are grouped into stripes of
+// data shards, and parity shards of each stripe are persisted as raw blocks referenced from root. Shards are stored
+// (binary) forms of leaves, so parity of compressed/encrypted leaves not disclose content. Zero value disables
+// erasure coding.
+type erasure struct {
+	dataShards   int
+	parityShards int
+}
+
+// enabled - checks erasure coding is enabled
+func (e erasure) enabled() bool {
+	return e.dataShards > 0
+}
+
+// readLeaf - reads stored (binary) form of leaf referenced by given link
+func (s *storage) readLeaf(ctx context.Context, link *blockpb.Link) ([]byte, error) {
+	id, err := cid.Decode(link.Hash)
+	if err != nil {
+		return nil, ErrBlockIdentifierNotValid
+	}
+	return s.readBlockData(ctx, id)
+}
+
+// addStripeLeaf - adds stored form of given leaf (appended to given state) to incomplete stripe of state, and
+// persists parity of the stripe when it has data shards count of leaves (see `flushStripe`). Parity is computed
+// from stored forms kept in memory while leaves are persisted, so leaves are never read back. Does nothing when
+// erasure coding is disabled.
+func (s *storage) addStripeLeaf(ctx context.Context, state *fileState, leaf *sizedLink) error {
+	if state.erasure == nil {
+		return nil
+	}
+	state.erasure.Sizes = append(state.erasure.Sizes, uint64(len(leaf.stored)))
+	state.stripe = append(state.stripe, leaf.stored)
+	leaf.stored = nil
+	if len(state.stripe) < int(state.erasure.DataShards) {
+		return nil
+	}
+	return s.flushStripe(ctx, state)
+}
+
+// flushStripe - computes parity shards of incomplete stripe of given state, and persists them as raw blocks.
+// Returns when stripe is empty.
+//
+// Flow:
+// 1. Shard size of stripe is stored size of its largest leaf, smaller leaves (and missing leaves of last stripe)
+// are zero padded. Shard size of stripe is recorded as `Tsize` of its parity links, and largest shard size of all
+// stripes as `ShardSize` of erasure coding.
+// 2. Computes parity shards via Reed-Solomon encoding
+// 3. Persists parity shards to permanent store (see `persistNode`)
+//
+// Error:
+// When encoding or persisting parity fails, returns error cause
+func (s *storage) flushStripe(ctx context.Context, state *fileState) error {
+	if len(state.stripe) == 0 {
+		return nil
+	}
+	k, m := int(state.erasure.DataShards), int(state.erasure.ParityShards)
+	encoder, err := reedsolomon.New(k, m)
+	if err != nil {
+		return err
+	}
+	shardSize := uint64(0)
+	for _, data := range state.stripe {
+		if uint64(len(data)) > shardSize {
+			shardSize = uint64(len(data))
+		}
+	}
+	shards := make([][]byte, k+m)
+	for i := range shards {
+		shards[i] = make([]byte, shardSize)
+		if i < len(state.stripe) {
+			copy(shards[i], state.stripe[i])
+		}
+	}
+	if err := encoder.Encode(shards); err != nil {
+		return err
+	}
+	for _, parity := range shards[k:] {
+		id, err := s.persistNode(ctx, cid.Raw, parity)
+		if err != nil {
+			return err
+		}
+		state.erasure.Parity = append(state.erasure.Parity, &blockpb.Link{Hash: id.String(), Tsize: shardSize, Type: blockpb.LinkType_RAW})
+	}
+	if shardSize > state.erasure.ShardSize {
+		state.erasure.ShardSize = shardSize
+	}
+	state.stripe = nil
+	return nil
+}
+
+// restoreStripes - restores erasure coding of given state, whose leaves with stored sizes and parity of complete
+// stripes are restored from chunk records (see `ResumeUpload`). Only leaves of incomplete stripe are read back.
+// Records which not carry stored sizes and parity (written before parity was recorded) are recovered by reading
+// back all leaves.
+//
+// Error:
+// When reading leaves or persisting parity fails, returns error cause
+func (s *storage) restoreStripes(ctx context.Context, state *fileState) error {
+	k, m := int(state.erasure.DataShards), int(state.erasure.ParityShards)
+	complete := len(state.leaves) / k * k
+	recorded := len(state.erasure.Parity) == complete/k*m
+	for _, size := range state.erasure.Sizes {
+		recorded = recorded && size > 0
+	}
+	if !recorded {
+		complete = 0
+		state.erasure = &blockpb.Erasure{DataShards: uint32(k), ParityShards: uint32(m)}
+	}
+	for _, leaf := range state.leaves[complete:] {
+		data, err := s.readLeaf(ctx, leaf.link)
+		if err != nil {
+			return err
+		}
+		if recorded {
+			state.stripe = append(state.stripe, data)
+			continue
+		}
+		leaf.stored = data
+		if err := s.addStripeLeaf(ctx, state, leaf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStripes - writes content of erasure coded file with given root block to `w`, stripe by stripe. When any
+// leaf of a stripe can not be read (from permanent store or p2p network), leaves are reconstructed from readable
+// leaves and parity of the stripe (see `repairStripe`).
+//
+// Error:
+// - When erasure coding of root is not consistent with its leaves returns `ErrErasureCodingNotValid`
+// - When stripe has fewer readable shards than data shards returns `ErrBlockNotRecoverable`
+// - When decoding leaves or writing to `w` fails, returns error cause
+func (s *storage) writeStripes(ctx context.Context, root *blockpb.Block, w io.Writer) error {
+	coding := root.Erasure
+	k, m := int(coding.DataShards), int(coding.ParityShards)
+	if k < 1 || m < 1 || len(coding.Parity) != (len(root.Links)+k-1)/k*m || len(coding.Sizes) != len(root.Links) {
+		return ErrErasureCodingNotValid
+	}
+	if len(root.Data) > 0 {
+		if _, err := w.Write(root.Data); err != nil {
+			return err
+		}
+	}
+	for stripe := 0; stripe*k < len(root.Links); stripe++ {
+		end := (stripe + 1) * k
+		if end > len(root.Links) {
+			end = len(root.Links)
+		}
+		links := root.Links[stripe*k : end]
+		chunks := make([][]byte, len(links))
+		missing := false
+		for i, link := range links {
+			data, err := s.readLeaf(ctx, link)
+			if err != nil {
+				log.Printf("warn: reading stripe leaf failed: %s, %s\n", link.Hash, err.Error())
+				missing = true
+				continue
+			}
+			chunks[i] = data
+		}
+		if missing {
+			sizes := coding.Sizes[stripe*k : end]
+			if err := s.repairStripe(ctx, coding, coding.Parity[stripe*m:(stripe+1)*m], links, sizes, chunks); err != nil {
+				return err
+			}
+		}
+		for i, chunk := range chunks {
+			id, err := cid.Decode(links[i].Hash)
+			if err != nil {
+				return ErrBlockIdentifierNotValid
+			}
+			block, err := s.decodeLinkedBlock(ctx, id, links[i].Type, chunk)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(block.Data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// repairStripe - reconstructs missing chunks (nil entries) of stripe with given leaf links and stored sizes from
+// readable chunks and parity links of the stripe. Reconstructed leaves are verified against their cids and
+// re-stored to permanent store (see `importBlock`), failing to re-store is logged as content is already
+// reconstructed.
+//
+// Error:
+// When stripe has fewer readable shards than data shards, or reconstructed leaf not matches with its cid returns
+// `ErrBlockNotRecoverable`
+func (s *storage) repairStripe(ctx context.Context, coding *blockpb.Erasure, parity, links []*blockpb.Link, sizes []uint64, chunks [][]byte) error {
+	k, m := int(coding.DataShards), int(coding.ParityShards)
+	encoder, err := reedsolomon.New(k, m)
+	if err != nil {
+		return ErrErasureCodingNotValid
+	}
+	// shards of stripe are padded to size recorded as `Tsize` of its parity links
+	shardSize := parity[0].Tsize
+	for _, link := range parity {
+		if link.Tsize != shardSize || shardSize > coding.ShardSize {
+			return ErrErasureCodingNotValid
+		}
+	}
+	shards := make([][]byte, k+m)
+	for i := 0; i < k; i++ {
+		// leaves missing from last stripe are zero shards
+		if i >= len(chunks) || chunks[i] != nil {
+			shards[i] = make([]byte, shardSize)
+		}
+		if i < len(chunks) && chunks[i] != nil {
+			copy(shards[i], chunks[i])
+		}
+	}
+	for i, link := range parity {
+		data, err := s.readLeaf(ctx, link)
+		if err != nil || uint64(len(data)) != shardSize {
+			log.Printf("warn: reading stripe parity failed: %s\n", link.Hash)
+			continue
+		}
+		shards[k+i] = data
+	}
+	if err := encoder.ReconstructData(shards); err != nil {
+		log.Printf("err: reconstructing stripe failed: %s\n", err.Error())
+		return ErrBlockNotRecoverable
+	}
+
+	for i, link := range links {
+		if chunks[i] != nil {
+			continue
+		}
+		if sizes[i] > shardSize {
+			return ErrErasureCodingNotValid
+		}
+		id, err := cid.Decode(link.Hash)
+		if err != nil {
+			return ErrBlockIdentifierNotValid
+		}
+		data := shards[i][:sizes[i]]
+		if ok, err := blockpb.Verify(id, data); err != nil || !ok {
+			log.Printf("err: verifying reconstructed leaf failed: %s\n", link.Hash)
+			return ErrBlockNotRecoverable
+		}
+		chunks[i] = data
+		if _, err := s.importBlock(ctx, id, data); err != nil {
+			log.Printf("warn: re-storing reconstructed leaf failed: %s, %s\n", link.Hash, err.Error())
+			continue
+		}
+		log.Printf("info: reconstructed leaf re-stored: %s\n", link.Hash)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing/iotest"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage/blockpb"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func (s *blockStorageSuite) TestErasureCoding() {
+	ctx := context.Background()
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	peer.EXPECT().GetRemoteBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, errors.New("block not found"))
+	store := newMemoryStore(s.T(), s.ctrl)
+	bs, err := NewFakeBlockStorage(ctx, WithLocalStore(store), WithPeer(peer), WithErasureCoding(2, 1))
+	require.NoError(s.T(), err)
+	impl := bs.(*storage)
+
+	buf := &bytes.Buffer{}
+	_, err = buf.ReadFrom(generateRandomByteReader(s.T(), 5*defaultChunkSize/2))
+	require.NoError(s.T(), err)
+	data := buf.Bytes()
+	digest, err := bs.CreateBlock(ctx, "coded.bin", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	block, err := bs.GetBlock(ctx, root)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), block.Links, 3)
+	require.NotNil(s.T(), block.Erasure)
+	require.Len(s.T(), block.Erasure.Parity, 2)
+
+	stat, err := bs.Stat(ctx, root)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(len(data)), stat.Size)
+
+	deleteLink := func(link *blockpb.Link) {
+		id, err := cid.Decode(link.Hash)
+		require.NoError(s.T(), err)
+		require.NoError(s.T(), impl.localStore.DeleteObject(ctx, id))
+	}
+
+	// one leaf of each stripe is lost, so both stripes are reconstructed and leaves are re-stored
+	deleteLink(block.Links[1])
+	deleteLink(block.Links[2])
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), bs.ReadFile(ctx, root, content))
+	require.Equal(s.T(), data, content.Bytes())
+	for _, link := range block.Links {
+		id, err := cid.Decode(link.Hash)
+		require.NoError(s.T(), err)
+		require.True(s.T(), impl.localStore.HasObject(ctx, id))
+	}
+
+	// losing leaf and parity of same stripe exceeds parity shards
+	deleteLink(block.Links[0])
+	deleteLink(block.Erasure.Parity[0])
+	require.ErrorIs(s.T(), bs.ReadFile(ctx, root, &bytes.Buffer{}), ErrBlockNotRecoverable)
+}
+
+// countingStore - in-memory object store which counts object reads
+type countingStore struct {
+	*memoryStore
+	reads int32
+}
+
+func (c *countingStore) ReadObject(ctx context.Context, id cid.Cid) ([]byte, error) {
+	atomic.AddInt32(&c.reads, 1)
+	return c.memoryStore.ReadObject(ctx, id)
+}
+
+func (s *blockStorageSuite) TestErasureCodingWithoutReadBack() {
+	ctx := context.Background()
+	readErr := errors.New("connection dropped")
+	store := &countingStore{memoryStore: newMemoryStore(s.T(), s.ctrl)}
+	datastore := dssync.MutexWrap(ds.NewMapDatastore())
+	newStorage := func() *storage {
+		bs := s.newTestStorage(WithLocalStore(store), WithDatastore(datastore), WithErasureCoding(2, 1)).(*storage)
+		bs.chunkSize = 16
+		return bs
+	}
+	bs := newStorage()
+	data, err := ioutil.ReadAll(generateRandomByteReader(s.T(), 100))
+	require.NoError(s.T(), err)
+
+	// parity is computed from leaves as they are persisted
+	digest, err := bs.CreateBlock(ctx, "coded.bin", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), int32(0), atomic.LoadInt32(&store.reads))
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+	expected, err := bs.GetBlock(ctx, root)
+	require.NoError(s.T(), err)
+	// shards of each stripe are padded to its largest leaf
+	require.Len(s.T(), expected.Erasure.Parity, 4)
+	require.Less(s.T(), expected.Erasure.Parity[3].Tsize, expected.Erasure.ShardSize)
+
+	// stream breaks in the middle of second stripe, so only its persisted leaf is read back after restart
+	id, err := bs.StartUpload(ctx, "coded.bin", nil)
+	require.NoError(s.T(), err)
+	_, err = bs.ResumeUpload(ctx, id, 0, io.MultiReader(bytes.NewReader(data[:56]), iotest.ErrReader(readErr)))
+	require.Equal(s.T(), readErr, err)
+	restarted := newStorage()
+	atomic.StoreInt32(&store.reads, 0)
+	digest, err = restarted.ResumeUpload(ctx, id, 48, bytes.NewReader(data[48:]))
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), int32(1), atomic.LoadInt32(&store.reads))
+
+	root, err = cid.Decode(digest)
+	require.NoError(s.T(), err)
+	block, err := restarted.GetBlock(ctx, root)
+	require.NoError(s.T(), err)
+	require.True(s.T(), proto.Equal(expected.Erasure, block.Erasure))
+	require.Equal(s.T(), len(expected.Links), len(block.Links))
+}
@@ -2,6 +2,7 @@ package blockstorage
 
 import (
 	"errors"
+	"strings"
 )
 
 // ErrBlockNameEmpty is return, when persisting new block name is empty.
@@ -15,3 +16,102 @@ var ErrBlockIdentifierNotValid = errors.New("blockstorage: block identifier not
 
 // ErrBlockProviderNotFound is return, when there is no owner of specified block.
 var ErrBlockProviderNotFound = errors.New("blockstorage: not found any provider for block")
+
+// ErrBlockIntegrityViolated is return, when block data not matches with its cid (aka content identifier)
+var ErrBlockIntegrityViolated = errors.New("blockstorage: block data not matches with block identifier")
+
+// ErrBlockHashNotSupported is return, when block cid hash function is not known
+var ErrBlockHashNotSupported = errors.New("blockstorage: block identifier hash function not supported")
+
+// ErrBlockNotDirectory is return, when block is expected to be directory but not
+var ErrBlockNotDirectory = errors.New("blockstorage: block is not a directory")
+
+// ErrBlockIsDirectory is return, when block is expected to be file but directory
+var ErrBlockIsDirectory = errors.New("blockstorage: block is a directory")
+
+// ErrDirectoryEntryNotValid is return, when directory entry has empty/invalid/duplicated name or invalid cid
+var ErrDirectoryEntryNotValid = errors.New("blockstorage: directory entry not valid")
+
+// ErrPathNotValid is return, when path is not valid (e.g. escapes root) or conflicts with existing entry
+var ErrPathNotValid = errors.New("blockstorage: path not valid")
+
+// ErrPathNotFound is return, when there is no entry with given path
+var ErrPathNotFound = errors.New("blockstorage: path not found")
+
+// ErrMetadataNotSupported is return, when metadata can not be represented with storage encoding (e.g. attributes
+// with `DagPBEncoding`)
+var ErrMetadataNotSupported = errors.New("blockstorage: metadata not supported by encoding")
+
+// ErrChecksumMismatch is return, when content checksum supplied by client not matches with received content
+var ErrChecksumMismatch = errors.New("blockstorage: content checksum mismatch")
+
+// ErrUploadNotFound is return, when there is no upload session with given id (or the session expired)
+var ErrUploadNotFound = errors.New("blockstorage: upload session not found")
+
+// ErrUploadOffsetMismatch is return, when resume offset not matches with committed offset of upload session
+var ErrUploadOffsetMismatch = errors.New("blockstorage: upload offset not matches with session offset")
+
+// ErrUploadBusy is return, when upload session is already being written by another stream
+var ErrUploadBusy = errors.New("blockstorage: upload session is busy")
+
+// ErrFileTooLarge is return, when file content exceeds max file size (see `WithMaxFileSize`)
+var ErrFileTooLarge = errors.New("blockstorage: file exceeds max file size")
+
+// ErrQuotaExceeded is return, when caller exceeds its byte or object quota (see `WithQuota`)
+var ErrQuotaExceeded = errors.New("blockstorage: caller quota exceeded")
+
+// ErrReplicationFactorNotValid is return, when replication factor of root is negative
+var ErrReplicationFactorNotValid = errors.New("blockstorage: replication factor should not be negative")
+
+// ErrReplicationNotFound is return, when root is not designated for replication (see `Replicate`)
+var ErrReplicationNotFound = errors.New("blockstorage: replication of root not found")
+
+// ErrReplicationIncomplete is return, when remote replicas of root are fewer than its replication factor
+var ErrReplicationIncomplete = errors.New("blockstorage: replication factor not satisfied")
+
+// ErrErasureCodingNotValid is return, when erasure coding of file root is not consistent with its leaves
+var ErrErasureCodingNotValid = errors.New("blockstorage: erasure coding of block not valid")
+
+// ErrBlockNotRecoverable is return, when leaves of erasure coded file can not be read or reconstructed from parity
+var ErrBlockNotRecoverable = errors.New("blockstorage: block not recoverable from erasure coding")
+
+// ErrEncryptionKeyNotFound is return, when key-encryption key of encrypted block is not provided (see `KeyProvider`)
+var ErrEncryptionKeyNotFound = errors.New("blockstorage: encryption key of block not found")
+
+// ErrBlockDecryptionFailed is return, when encrypted block can not be decrypted with provided key
+var ErrBlockDecryptionFailed = errors.New("blockstorage: decrypting block failed")
+
+// ErrStageIDNotValid is return, when stage id is empty, too long or contains characters other than letters, digits,
+// '-' and '_'
+var ErrStageIDNotValid = errors.New("blockstorage: stage id not valid")
+
+// ErrStageNotFound is return, when stage with given id is created by another caller
+var ErrStageNotFound = errors.New("blockstorage: stage not found")
+
+// ErrStorageStopped is return, when storage is used after it is stopped (see `Stop`)
+var ErrStorageStopped = errors.New("blockstorage: storage stopped")
+
+// StopError is return by `Stop`, when draining in-flight operations times out or closing any resource fails.
+// Errors holds all error causes in occurrence order.
+type StopError struct {
+	Errors []error
+}
+
+func (e *StopError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return "blockstorage: stopping storage failed: " + strings.Join(messages, "; ")
+}
+
+// Is - reports whether any error cause matches with target, so `errors.Is(err, context.DeadlineExceeded)` holds
+// when draining timed out
+func (e *StopError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/igumus/blockstorage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationHeader - holds metadata key of bearer token sent by client
+const authorizationHeader = "authorization"
+
+// bearerPrefix - holds prefix of bearer token in authorization header
+const bearerPrefix = "bearer "
+
+// wildcard - holds identity of policy rule which applies to identities without own rule, and method name which
+// matches every method in rule
+const wildcard = "*"
+
+// privilegedMethods - holds RPC methods which are not allowed by `*` method of static policy rules. Importing CAR
+// persists arbitrary blocks (e.g. named blocks of any name) bypassing file creation.
+var privilegedMethods = map[string]bool{"ImportCAR": true}
+
+// ErrUnauthenticated is return, when credentials of caller are missing or not valid
+var ErrUnauthenticated = errors.New("blockstorage: caller not authenticated")
+
+// ErrPermissionDenied is return, when policy does not allow caller to call RPC or read block
+var ErrPermissionDenied = errors.New("blockstorage: caller not permitted")
+
+// Authenticator - authenticates caller of RPC, and returns its identity
+//
+// Error:
+// When credentials of caller are missing or not valid, returns `ErrUnauthenticated`
+type Authenticator interface {
+	Authenticate(ctx context.Context) (string, error)
+}
+
+// Captures/Represents authenticator of static bearer tokens. Holds identities by tokens.
+type tokenAuthenticator struct {
+	tokens map[string]string
+}
+
+// NewTokenAuthenticator - returns authenticator which accepts bearer tokens (`authorization: Bearer <token>`
+// metadata) of given token to identity map.
+func NewTokenAuthenticator(tokens map[string]string) Authenticator {
+	ret := &tokenAuthenticator{tokens: make(map[string]string, len(tokens))}
+	for token, identity := range tokens {
+		ret.tokens[token] = identity
+	}
+	return ret
+}
+
+func (a *tokenAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	for _, value := range md.Get(authorizationHeader) {
+		if len(value) <= len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+			continue
+		}
+		given := []byte(value[len(bearerPrefix):])
+		// every token is compared in constant time, so comparison does not leak token content
+		identity := ""
+		for token, id := range a.tokens {
+			if subtle.ConstantTimeCompare(given, []byte(token)) == 1 {
+				identity = id
+			}
+		}
+		if identity != "" {
+			return identity, nil
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+// Captures/Represents authenticator of mutual TLS client certificates
+type certAuthenticator struct{}
+
+// NewCertAuthenticator - returns authenticator which accepts verified client certificates of mutual TLS
+// connections, and identifies caller by common name of certificate subject. Server should be configured to
+// verify client certificates (e.g. `tls.RequireAndVerifyClientCert`).
+func NewCertAuthenticator() Authenticator {
+	return &certAuthenticator{}
+}
+
+func (a *certAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	if identity := certIdentity(ctx); identity != "" {
+		return identity, nil
+	}
+	return "", ErrUnauthenticated
+}
+
+// certIdentity - returns common name of verified client certificate of given context, or empty string when
+// connection does not use mutual TLS
+func certIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ""
+	}
+	for _, chain := range tlsInfo.State.VerifiedChains {
+		if len(chain) > 0 && chain[0].Subject.CommonName != "" {
+			return chain[0].Subject.CommonName
+		}
+	}
+	return ""
+}
+
+// Captures/Represents authenticator which tries authenticators in order
+type chainAuthenticator struct {
+	authenticators []Authenticator
+}
+
+// ChainAuthenticators - returns authenticator which accepts caller, when any of given authenticators (tried in
+// order) accepts it (e.g. mutual TLS for services, bearer tokens for users).
+func ChainAuthenticators(authenticators ...Authenticator) Authenticator {
+	return &chainAuthenticator{authenticators: authenticators}
+}
+
+func (a *chainAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	for _, authenticator := range a.authenticators {
+		identity, err := authenticator.Authenticate(ctx)
+		if err == nil {
+			return identity, nil
+		}
+		if err != ErrUnauthenticated {
+			return "", err
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+// Policy - decides which RPCs (method name, e.g. `WriteBlock`) identity may call, and which named blocks (files and
+// directories) identity may read. Unnamed blocks (e.g. chunks) are readable within exported DAGs of readable
+// roots, but they are not read directly (`GetBlock`) and DAGs with unnamed roots (e.g. `DagPBEncoding` files) are
+// not exported, as their readers can not be decided. Every named block of exported DAG is checked.
+type Policy interface {
+	AllowMethod(identity string, method string) bool
+	AllowRead(identity string, name string) bool
+}
+
+// Rule - captures/represents permissions of identity in static policy
+type Rule struct {
+	// Methods holds RPC method names (e.g. `GetBlock`) identity may call. `*` allows every method, except privileged
+	// methods which should be listed explicitly (see `privilegedMethods`).
+	Methods []string
+	// ReadPrefixes holds name prefixes of blocks identity may read. Empty prefix allows every block.
+	ReadPrefixes []string
+}
+
+// Captures/Represents policy with static rules of identities
+type staticPolicy struct {
+	rules map[string]Rule
+}
+
+// NewStaticPolicy - returns policy of given rules by identity. Rule of `*` identity applies to identities without
+// own rule, and identities without any rule are denied.
+func NewStaticPolicy(rules map[string]Rule) Policy {
+	ret := &staticPolicy{rules: make(map[string]Rule, len(rules))}
+	for identity, rule := range rules {
+		ret.rules[identity] = rule
+	}
+	return ret
+}
+
+// rule - returns rule of given identity, or rule of `*` identity when there is not any
+func (p *staticPolicy) rule(identity string) (Rule, bool) {
+	if rule, ok := p.rules[identity]; ok {
+		return rule, true
+	}
+	rule, ok := p.rules[wildcard]
+	return rule, ok
+}
+
+func (p *staticPolicy) AllowMethod(identity string, method string) bool {
+	rule, ok := p.rule(identity)
+	if !ok {
+		return false
+	}
+	for _, allowed := range rule.Methods {
+		if allowed == method || (allowed == wildcard && !privilegedMethods[method]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *staticPolicy) AllowRead(identity string, name string) bool {
+	rule, ok := p.rule(identity)
+	if !ok {
+		return false
+	}
+	for _, prefix := range rule.ReadPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Captures/Represents authenticated caller with policy applied to its requests
+type authInfo struct {
+	identity string
+	policy   Policy
+}
+
+// authInfoKey - context key of authenticated caller
+type authInfoKey struct{}
+
+// authInfoFrom - returns authenticated caller of given context, or `nil` when endpoint does not use authentication
+func authInfoFrom(ctx context.Context) *authInfo {
+	info, _ := ctx.Value(authInfoKey{}).(*authInfo)
+	return info
+}
+
+// authorize - authenticates caller of given RPC method (full method name, e.g.
+// `/blockpb.BlockStorageGrpcService/WriteBlock`) and checks policy (when given) allows the caller to call it.
+// Returns context which carries authenticated caller.
+//
+// Error:
+// - When caller is not authenticated returns `ErrUnauthenticated` with code `codes.Unauthenticated`
+// - When policy denies method returns `ErrPermissionDenied` with code `codes.PermissionDenied`
+func authorize(ctx context.Context, auth Authenticator, policy Policy, fullMethod string) (context.Context, error) {
+	identity, err := auth.Authenticate(ctx)
+	if err == ErrUnauthenticated {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if policy != nil && !policy.AllowMethod(identity, path.Base(fullMethod)) {
+		return nil, status.Error(codes.PermissionDenied, ErrPermissionDenied.Error())
+	}
+	return context.WithValue(ctx, authInfoKey{}, &authInfo{identity: identity, policy: policy}), nil
+}
+
+// UnaryAuthInterceptor - returns unary server interceptor which authenticates caller via given authenticator, and
+// authorizes RPC via given policy (`nil` allows every authenticated caller). Authenticated identity is used as
+// caller of storage operations (see `blockstorage.WithCaller`).
+func UnaryAuthInterceptor(auth Authenticator, policy Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		authCtx, err := authorize(ctx, auth, policy, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(authCtx, req)
+	}
+}
+
+// Captures/Represents server stream whose context carries authenticated caller
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamAuthInterceptor - returns stream server interceptor which authenticates caller via given authenticator,
+// and authorizes RPC via given policy (`nil` allows every authenticated caller) (see `UnaryAuthInterceptor`).
+func StreamAuthInterceptor(auth Authenticator, policy Policy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		authCtx, err := authorize(ss.Context(), auth, policy, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: authCtx})
+	}
+}
+
+// withReadAuthorizer - returns context whose storage operations check policy of authenticated caller of given
+// context allows reading every named block they visit (see `blockstorage.WithReadAuthorizer`). Returns given
+// context when endpoint does not use authorization policy.
+func withReadAuthorizer(ctx context.Context) context.Context {
+	info := authInfoFrom(ctx)
+	if info == nil || info.policy == nil {
+		return ctx
+	}
+	return blockstorage.WithReadAuthorizer(ctx, func(name string) error {
+		return authorizeRead(ctx, name)
+	})
+}
+
+// authorizeRead - checks policy of authenticated caller of given context allows reading block with given name.
+// Unnamed blocks, and requests of endpoints without authentication, are always allowed.
+//
+// Error:
+// When policy denies reading returns `ErrPermissionDenied` with code `codes.PermissionDenied`
+func authorizeRead(ctx context.Context, name string) error {
+	info := authInfoFrom(ctx)
+	if info == nil || info.policy == nil || name == "" {
+		return nil
+	}
+	if !info.policy.AllowRead(info.identity, name) {
+		return status.Error(codes.PermissionDenied, ErrPermissionDenied.Error())
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage"
+	"github.com/igumus/blockstorage/blockpb"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// withToken - returns outgoing context which sends given bearer token
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, authorizationHeader, "Bearer "+token)
+}
+
+// requireCode - asserts given error is grpc status error with given code
+func requireCode(t *testing.T, code codes.Code, err error) {
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, code, st.Code())
+}
+
+func (s *grpcSuite) TestAuthViaGrpc() {
+	ctx := context.Background()
+	auth := NewTokenAuthenticator(map[string]string{"writer-token": "writer", "reader-token": "reader"})
+	policy := NewStaticPolicy(map[string]Rule{
+		"writer": {Methods: []string{"*"}, ReadPrefixes: []string{""}},
+		"reader": {Methods: []string{"GetBlock", "Stat", "ListBlocks", "ExportCAR", "ExportTar", "GetUsage"}, ReadPrefixes: []string{"public/", "docs"}},
+	})
+	server, lis, setup, teardown := makeGrpcServer(
+		grpc.UnaryInterceptor(UnaryAuthInterceptor(auth, policy)),
+		grpc.StreamInterceptor(StreamAuthInterceptor(auth, policy)),
+	)
+
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	peer.EXPECT().GetRemoteBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, errors.New("block not found"))
+
+	storage, err := blockstorage.NewFakeBlockStorage(ctx, blockstorage.WithLocalStore(newMemoryStore(s.T(), s.ctrl)), blockstorage.WithPeer(peer))
+	require.NoError(s.T(), err)
+
+	endpoint, err := NewBlockStorageServiceEndpoint(ctx, storage)
+	require.NoError(s.T(), err)
+	blockpb.RegisterBlockStorageGrpcServiceServer(server, endpoint)
+
+	bufDialer := bufDialerFunc(lis)
+	go setup()
+	defer teardown()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err)
+	defer conn.Close()
+	client := blockpb.NewBlockStorageGrpcServiceClient(conn)
+
+	writerCtx := withToken(ctx, "writer-token")
+	readerCtx := withToken(ctx, "reader-token")
+
+	write := func(ctx context.Context, name string) (string, error) {
+		stream, err := client.WriteBlock(ctx)
+		require.NoError(s.T(), err)
+		return toGrpcStream(name, generateRandomByteReader(s.T(), 1024), stream)
+	}
+
+	public, err := write(writerCtx, "public/a.txt")
+	require.NoError(s.T(), err)
+	private, err := write(writerCtx, "private/b.txt")
+	require.NoError(s.T(), err)
+
+	s.T().Run("unauthenticated", func(t *testing.T) {
+		_, err := client.GetBlock(ctx, &blockpb.GetBlockRequest{Cid: public})
+		requireCode(t, codes.Unauthenticated, err)
+		_, err = client.GetBlock(withToken(ctx, "unknown-token"), &blockpb.GetBlockRequest{Cid: public})
+		requireCode(t, codes.Unauthenticated, err)
+		_, err = write(ctx, "anonymous.txt")
+		requireCode(t, codes.Unauthenticated, err)
+	})
+
+	s.T().Run("method_denied", func(t *testing.T) {
+		_, err := write(readerCtx, "public/c.txt")
+		requireCode(t, codes.PermissionDenied, err)
+		_, err = client.StartUpload(readerCtx, &blockpb.StartUploadRequest{Name: "public/c.txt"})
+		requireCode(t, codes.PermissionDenied, err)
+		// importing car is not allowed by wildcard method
+		stream, err := client.ImportCAR(writerCtx)
+		require.NoError(t, err)
+		_, err = stream.CloseAndRecv()
+		requireCode(t, codes.PermissionDenied, err)
+	})
+
+	s.T().Run("read_denied", func(t *testing.T) {
+		block, err := client.GetBlock(readerCtx, &blockpb.GetBlockRequest{Cid: public})
+		require.NoError(t, err)
+		require.Equal(t, "public/a.txt", block.GetName())
+		// unnamed chunks are only read within exported DAGs, as exports of unnamed roots are denied
+		_, err = client.GetBlock(readerCtx, &blockpb.GetBlockRequest{Cid: block.GetLinks()[0].GetHash()})
+		requireCode(t, codes.PermissionDenied, err)
+		_, err = client.GetBlock(writerCtx, &blockpb.GetBlockRequest{Cid: block.GetLinks()[0].GetHash()})
+		requireCode(t, codes.PermissionDenied, err)
+		// storage errors are returned as status errors
+		_, err = client.GetBlock(readerCtx, &blockpb.GetBlockRequest{Cid: "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"})
+		requireCode(t, codes.Internal, err)
+
+		_, err = client.GetBlock(readerCtx, &blockpb.GetBlockRequest{Cid: private})
+		requireCode(t, codes.PermissionDenied, err)
+		_, err = client.Stat(readerCtx, &blockpb.StatRequest{Cid: private})
+		requireCode(t, codes.PermissionDenied, err)
+		export, err := client.ExportCAR(readerCtx, &blockpb.ExportCARRequest{Cid: private})
+		require.NoError(t, err)
+		_, err = export.Recv()
+		requireCode(t, codes.PermissionDenied, err)
+
+		_, err = client.GetBlock(writerCtx, &blockpb.GetBlockRequest{Cid: private})
+		require.NoError(t, err)
+	})
+
+	s.T().Run("list_filtered", func(t *testing.T) {
+		for _, tc := range []struct {
+			ctx   context.Context
+			names []string
+		}{
+			{ctx: readerCtx, names: []string{"public/a.txt"}},
+			{ctx: writerCtx, names: []string{"private/b.txt", "public/a.txt"}},
+		} {
+			stream, err := client.ListBlocks(tc.ctx, &blockpb.ListBlocksRequest{})
+			require.NoError(t, err)
+			names := make([]string, 0)
+			for {
+				stat, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				names = append(names, stat.GetName())
+			}
+			require.Equal(t, tc.names, names)
+		}
+	})
+
+	s.T().Run("caller_identity", func(t *testing.T) {
+		usage, err := client.GetUsage(writerCtx, &blockpb.UsageRequest{})
+		require.NoError(t, err)
+		require.Equal(t, "writer", usage.GetCaller())
+		require.Equal(t, uint64(2048), usage.GetBytes())
+	})
+
+	s.T().Run("traversal_denied", func(t *testing.T) {
+		writeTree := func(name string, files map[string]string) string {
+			stream, err := client.WriteTree(writerCtx)
+			require.NoError(t, err)
+			root, err := toGrpcStream(name, generateTar(t, files), stream)
+			require.NoError(t, err)
+			return root
+		}
+		drain := func(recv func() error) error {
+			for {
+				if err := recv(); err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+			}
+		}
+		exportCAR := func(root string) error {
+			stream, err := client.ExportCAR(readerCtx, &blockpb.ExportCARRequest{Cid: root})
+			require.NoError(t, err)
+			return drain(func() error { _, err := stream.Recv(); return err })
+		}
+		exportTar := func(root string) error {
+			stream, err := client.ExportTar(readerCtx, &blockpb.ExportTarRequest{Cid: root})
+			require.NoError(t, err)
+			return drain(func() error { _, err := stream.Recv(); return err })
+		}
+
+		readable := writeTree("public/readable", map[string]string{"docs.txt": "docs"})
+		require.NoError(t, exportCAR(readable))
+		require.NoError(t, exportTar(readable))
+
+		// root is readable, but one of its entries is not
+		mixed := writeTree("public/mixed", map[string]string{"docs.txt": "docs", "secret.txt": "secret"})
+		requireCode(t, codes.PermissionDenied, exportCAR(mixed))
+		requireCode(t, codes.PermissionDenied, exportTar(mixed))
+
+		// unnamed root (e.g. chunk) has no readers under policy
+		block, err := client.GetBlock(readerCtx, &blockpb.GetBlockRequest{Cid: public})
+		require.NoError(t, err)
+		requireCode(t, codes.PermissionDenied, exportCAR(block.GetLinks()[0].GetHash()))
+	})
+}
+
+func TestCertAuthenticator(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9000}
+	verified := credentials.TLSInfo{State: tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "service-a"}}}},
+	}}
+	auth := ChainAuthenticators(NewCertAuthenticator(), NewTokenAuthenticator(map[string]string{"token": "user"}))
+
+	testCases := []struct {
+		name     string
+		ctx      context.Context
+		identity string
+		err      error
+	}{
+		{name: "verified_cert", ctx: peer.NewContext(context.Background(), &peer.Peer{Addr: addr, AuthInfo: verified}), identity: "service-a"},
+		{name: "unverified_cert", ctx: peer.NewContext(context.Background(), &peer.Peer{Addr: addr, AuthInfo: credentials.TLSInfo{}}), err: ErrUnauthenticated},
+		{name: "insecure", ctx: peer.NewContext(context.Background(), &peer.Peer{Addr: addr}), err: ErrUnauthenticated},
+		{name: "token_fallback", ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(authorizationHeader, "bearer token")), identity: "user"},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			identity, err := auth.Authenticate(tc.ctx)
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.identity, identity)
+		})
+	}
+}
+
+func TestStaticPolicy(t *testing.T) {
+	policy := NewStaticPolicy(map[string]Rule{
+		"admin": {Methods: []string{"*"}, ReadPrefixes: []string{""}},
+		"*":     {Methods: []string{"GetBlock"}, ReadPrefixes: []string{"public/", "shared/"}},
+	})
+
+	require.True(t, policy.AllowMethod("admin", "WriteBlock"))
+	require.True(t, policy.AllowRead("admin", "private/a.txt"))
+	require.True(t, policy.AllowMethod("guest", "GetBlock"))
+	require.False(t, policy.AllowMethod("guest", "WriteBlock"))
+	require.True(t, policy.AllowRead("guest", "shared/a.txt"))
+	require.False(t, policy.AllowRead("guest", "private/a.txt"))
+	// privileged methods are allowed when listed explicitly
+	require.False(t, policy.AllowMethod("admin", "ImportCAR"))
+	importer := NewStaticPolicy(map[string]Rule{"importer": {Methods: []string{"*", "ImportCAR"}}})
+	require.True(t, importer.AllowMethod("importer", "ImportCAR"))
+
+	strict := NewStaticPolicy(map[string]Rule{"admin": {Methods: []string{"*"}}})
+	require.False(t, strict.AllowMethod("guest", "GetBlock"))
+	require.False(t, strict.AllowRead("admin", "public/a.txt"))
+}
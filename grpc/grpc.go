@@ -1,20 +1,41 @@
 package grpc
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"io"
 	"log"
+	"net"
 	"strings"
 
 	"github.com/igumus/blockstorage"
 	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/car"
 	"github.com/igumus/blockstorage/util"
 	"github.com/ipfs/go-cid"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
+// exportChunkSize - holds max size of CAR/tar chunk sent to client
+const exportChunkSize = 512 << 10
+
+// ErrMetadataNotExpected is return, when metadata message of write request stream is not sent right after name
+var ErrMetadataNotExpected = errors.New("blockstorage: metadata should follow name in request stream")
+
+// ErrChecksumNotExpected is return, when checksum message of write request stream is not the last message
+var ErrChecksumNotExpected = errors.New("blockstorage: checksum should be last message of request stream")
+
+// ErrResumeNotExpected is return, when resume message of upload stream is missing or is not the first message
+var ErrResumeNotExpected = errors.New("blockstorage: resume should be first message of upload stream")
+
 // Captures/Respresents grpc server endpoint information
 type storageGrpc struct {
 	blockpb.UnimplementedBlockStorageGrpcServiceServer
@@ -33,9 +54,106 @@ func (s *storageGrpc) rpcError(code codes.Code, err error) error {
 	return status.Error(code, err.Error())
 }
 
+// authorizeRoot - checks caller of given context may read root block with given cid (e.g. root of exported DAG),
+// when endpoint uses authorization policy (see `authorizeRead`). Unnamed roots are denied under policy, as their
+// readers can not be decided. Named descendants are checked while DAG is traversed (see `withReadAuthorizer`).
+func (s *storageGrpc) authorizeRoot(ctx context.Context, root cid.Cid) error {
+	info := authInfoFrom(ctx)
+	if info == nil || info.policy == nil {
+		return nil
+	}
+	block, err := s.storage.GetBlock(ctx, root)
+	if err != nil {
+		log.Printf("err: reading root block failed: %s, %s\n", root, err.Error())
+		return s.rpcError(codes.Internal, err)
+	}
+	return authorizeRootBlock(ctx, block)
+}
+
+// authorizeRootBlock - checks caller of given context may read given block, which is read directly or as root of
+// a DAG (see `authorizeRoot`). Unnamed blocks are denied under policy.
+func authorizeRootBlock(ctx context.Context, block *blockpb.Block) error {
+	info := authInfoFrom(ctx)
+	if info == nil || info.policy == nil {
+		return nil
+	}
+	if block.GetName() == "" {
+		return status.Error(codes.PermissionDenied, ErrPermissionDenied.Error())
+	}
+	return authorizeRead(ctx, block.GetName())
+}
+
+// callerIdentity - returns identity of grpc peer of given context: identity authenticated by auth interceptor
+// (see `UnaryAuthInterceptor`), common name of verified client certificate when connection uses mutual TLS,
+// otherwise host of peer address.
+func callerIdentity(ctx context.Context) string {
+	if info := authInfoFrom(ctx); info != nil {
+		return info.identity
+	}
+	if identity := certIdentity(ctx); identity != "" {
+		return identity
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// withCaller - returns context which carries identity of grpc peer of given context as caller, so usage of
+// storage operations is accounted to the peer (see `blockstorage.WithQuota`)
+func withCaller(ctx context.Context) context.Context {
+	return blockstorage.WithCaller(ctx, callerIdentity(ctx))
+}
+
+// pipeStream - pipes data received from client stream via `recv` to returned reader. Reader
+// returns `io.EOF` when client closes stream, otherwise receive/context error.
+func pipeStream(ctx context.Context, recv func() ([]byte, error)) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		var retErr error = nil
+		for {
+			ctxErr := util.CheckContext(ctx)
+			if ctxErr != nil {
+				retErr = ctxErr
+				break
+			}
+			data, err := recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Printf("err: receiving chunk failed: %v\n", err)
+				retErr = err
+				break
+			}
+			if len(data) < 1 {
+				continue
+			}
+			_, err = pw.Write(data)
+			if err != nil {
+				retErr = err
+				break
+			}
+		}
+		if retErr != nil {
+			pw.CloseWithError(retErr)
+		} else {
+			pw.Close()
+		}
+	}()
+	return pr
+}
+
 // GetBlock - is a RPC function defined in `store.proto` file. Accepts `blockpb.GetBlockRequest` which contains
 // block cid as string. After decoding block cid string to actual cid, asks to underlying `BlockStorage` instance
-// to get block
+// to get block. Block is authorized as exported roots are (see `authorizeRoot`), so when block is not readable by
+// caller (see `Policy`), e.g. unnamed block under policy, returns `ErrPermissionDenied` error with code
+// `codes.PermissionDenied`. Other errors are converted regarding `writeError`.
 func (s *storageGrpc) GetBlock(ctx context.Context, req *blockpb.GetBlockRequest) (*blockpb.Block, error) {
 	ctxErr := util.CheckContext(ctx)
 	if ctxErr != nil {
@@ -47,18 +165,262 @@ func (s *storageGrpc) GetBlock(ctx context.Context, req *blockpb.GetBlockRequest
 		return nil, s.rpcError(codes.InvalidArgument, blockstorage.ErrBlockIdentifierNotValid)
 	}
 
-	return s.storage.GetBlock(ctx, cid)
+	block, err := s.storage.GetBlock(ctx, cid)
+	if err != nil {
+		log.Printf("err: reading block failed: %s, %s\n", cid, err.Error())
+		return nil, s.writeError(err)
+	}
+	if err := authorizeRootBlock(ctx, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// Captures/Represents client stream of `blockpb.WriteBlockRequest` messages (e.g. `WriteBlock`, `WriteTree`)
+type writeRequestStream interface {
+	Context() context.Context
+	Recv() (*blockpb.WriteBlockRequest, error)
+}
+
+// receiveNamedStream - receives name (first message) and metadata (optional second message) of given client
+// stream, and returns name and metadata with reader that pipes rest of the stream (chunk data).
+//
+// When client sends SHA-256 checksum of content as last message, reader verifies piped content against the
+// checksum, and fails with `ErrChecksumMismatch` instead of `io.EOF` on mismatch. Reader also fails with
+// `ErrMetadataNotExpected` (metadata after chunk data) or `ErrChecksumNotExpected` (message after checksum).
+func (s *storageGrpc) receiveNamedStream(stream writeRequestStream) (string, *blockpb.Metadata, *io.PipeReader, error) {
+	ctx := stream.Context()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return "", nil, nil, s.rpcError(codes.Aborted, ctxErr)
+	}
+	request, requestErr := stream.Recv()
+	if requestErr != nil {
+		log.Printf("err: receiving request failed: %s\n", requestErr.Error())
+		return "", nil, nil, status.Error(codes.Aborted, "cannot receive request")
+	}
+
+	fname := request.GetName()
+	fileName := strings.TrimSpace(fname)
+	if fileName == "" {
+		return "", nil, nil, s.rpcError(codes.InvalidArgument, blockstorage.ErrBlockNameEmpty)
+	}
+
+	// second message is either metadata or first chunk of data
+	var meta *blockpb.Metadata
+	pending, pendingErr := stream.Recv()
+	if pendingErr == nil && pending.GetMetadata() != nil {
+		meta = pending.GetMetadata()
+		pending = nil
+	}
+
+	hasher := sha256.New()
+	var checksum []byte
+	pr := pipeStream(ctx, func() ([]byte, error) {
+		var req *blockpb.WriteBlockRequest
+		var err error
+		if pending != nil || pendingErr != nil {
+			req, err = pending, pendingErr
+			pending, pendingErr = nil, nil
+		} else {
+			req, err = stream.Recv()
+		}
+		switch {
+		case err == io.EOF && checksum != nil && !bytes.Equal(checksum, hasher.Sum(nil)):
+			return nil, blockstorage.ErrChecksumMismatch
+		case err != nil:
+			return nil, err
+		case checksum != nil:
+			return nil, ErrChecksumNotExpected
+		case req.GetMetadata() != nil:
+			return nil, ErrMetadataNotExpected
+		case req.GetSha256() != nil:
+			checksum = req.GetSha256()
+			return nil, nil
+		}
+		hasher.Write(req.GetChunkData())
+		return req.GetChunkData(), nil
+	})
+	return fileName, meta, pr, nil
+}
+
+// writeError - converts given error of write request stream handling to grpc status error.
+func (s *storageGrpc) writeError(err error) error {
+	switch err {
+	case blockstorage.ErrChecksumMismatch:
+		return s.rpcError(codes.DataLoss, err)
+	case blockstorage.ErrUploadNotFound:
+		return s.rpcError(codes.NotFound, err)
+	case blockstorage.ErrUploadOffsetMismatch:
+		return s.rpcError(codes.FailedPrecondition, err)
+	case blockstorage.ErrUploadBusy:
+		return s.rpcError(codes.Aborted, err)
+	case blockstorage.ErrFileTooLarge, blockstorage.ErrQuotaExceeded:
+		return s.rpcError(codes.ResourceExhausted, err)
+	case ErrMetadataNotExpected, ErrChecksumNotExpected, ErrResumeNotExpected, blockstorage.ErrBlockNameEmpty,
+		blockstorage.ErrMetadataNotSupported,
+		tar.ErrHeader, tar.ErrFieldTooLong, io.ErrUnexpectedEOF, gzip.ErrHeader, gzip.ErrChecksum,
+		zip.ErrFormat, zip.ErrAlgorithm, zip.ErrChecksum, blockstorage.ErrPathNotValid:
+		return s.rpcError(codes.InvalidArgument, err)
+	default:
+		return s.rpcError(codes.Internal, err)
+	}
 }
 
 // WriteBlock - is a rpc function defined in `store.proto` file. Accepts client stream which contains
-// document name and raw chunks of document content and writes to permanent object store.
+// document name, metadata (optional, right after name) and raw chunks of document content and writes to
+// permanent object store.
 //
 // On successful function call, returns `nil` with code `codes.OK`. Otherwise;
 // - On context error: returns associated context error with code `codes.Aborted`
 // - On receive error: returns associated error with code `codes.Aborted`
 // - On empty document name err: returns `ErrBlockNameEmpty` error with code `codes.InvalidArgument`
+// - On misplaced or unsupported metadata: returns associated error with code `codes.InvalidArgument`
+// - On checksum (optional last message) mismatch: returns `ErrChecksumMismatch` error with code `codes.DataLoss`
+// - On max file size or caller quota exceeded: returns associated error with code `codes.ResourceExhausted`
 // - On other errors: returns associated error with code `codes.Internal`
 func (s *storageGrpc) WriteBlock(stream blockpb.BlockStorageGrpcService_WriteBlockServer) error {
+	fileName, meta, pr, err := s.receiveNamedStream(stream)
+	if err != nil {
+		return err
+	}
+
+	digest, err := s.storage.CreateBlockWithMetadata(withCaller(stream.Context()), fileName, meta, pr)
+	pr.Close()
+	if err != nil {
+		log.Printf("err: writing block failed: %s, %s\n", fileName, err.Error())
+		return s.writeError(err)
+	}
+
+	return stream.SendAndClose(&blockpb.WriteBlockResponse{
+		Cid: digest,
+	})
+}
+
+// WriteTree - is a rpc function defined in `store.proto` file. Accepts client stream which contains
+// root directory name and raw chunks of tar stream, and writes directory DAG of tar entries to permanent object store.
+//
+// On successful function call, returns cid of root directory with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On receive error: returns associated error with code `codes.Aborted`
+// - On empty directory name err: returns `ErrBlockNameEmpty` error with code `codes.InvalidArgument`
+// - On metadata message (not supported for trees): returns `ErrMetadataNotSupported` error with code `codes.InvalidArgument`
+// - On checksum (optional last message) mismatch: returns `ErrChecksumMismatch` error with code `codes.DataLoss`
+// - On malformed tar stream or entry path: returns associated error with code `codes.InvalidArgument`
+// - On max file size or caller quota exceeded: returns associated error with code `codes.ResourceExhausted`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) WriteTree(stream blockpb.BlockStorageGrpcService_WriteTreeServer) error {
+	dirName, meta, pr, err := s.receiveNamedStream(stream)
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		pr.Close()
+		return s.rpcError(codes.InvalidArgument, blockstorage.ErrMetadataNotSupported)
+	}
+
+	digest, err := s.storage.AddTar(withCaller(stream.Context()), dirName, pr)
+	pr.Close()
+	if err != nil {
+		log.Printf("err: writing tree failed: %s, %s\n", dirName, err.Error())
+		return s.writeError(err)
+	}
+
+	return stream.SendAndClose(&blockpb.WriteBlockResponse{
+		Cid: digest,
+	})
+}
+
+// WriteArchive - is a rpc function defined in `store.proto` file. Accepts client stream which contains
+// root directory name and raw chunks of archive stream (tar, gzip compressed tar or zip), and writes directory DAG
+// of archive entries (with mode and modification time metadata) to permanent object store.
+//
+// On successful function call, returns cid of root directory with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On receive error: returns associated error with code `codes.Aborted`
+// - On empty directory name err: returns `ErrBlockNameEmpty` error with code `codes.InvalidArgument`
+// - On metadata message (not supported for trees): returns `ErrMetadataNotSupported` error with code `codes.InvalidArgument`
+// - On checksum (optional last message) mismatch: returns `ErrChecksumMismatch` error with code `codes.DataLoss`
+// - On malformed archive stream or entry path: returns associated error with code `codes.InvalidArgument`
+// - On max file size or caller quota exceeded: returns associated error with code `codes.ResourceExhausted`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) WriteArchive(stream blockpb.BlockStorageGrpcService_WriteArchiveServer) error {
+	dirName, meta, pr, err := s.receiveNamedStream(stream)
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		pr.Close()
+		return s.rpcError(codes.InvalidArgument, blockstorage.ErrMetadataNotSupported)
+	}
+
+	digest, err := s.storage.AddArchive(withCaller(stream.Context()), dirName, pr)
+	pr.Close()
+	if err != nil {
+		log.Printf("err: writing archive failed: %s, %s\n", dirName, err.Error())
+		return s.writeError(err)
+	}
+
+	return stream.SendAndClose(&blockpb.WriteBlockResponse{
+		Cid: digest,
+	})
+}
+
+// StartUpload - is a rpc function defined in `store.proto` file. Accepts `blockpb.StartUploadRequest` which
+// contains document name and metadata (optional), and starts resumable upload session of the document.
+//
+// On successful function call, returns session id with zero offset with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On empty document name err: returns `ErrBlockNameEmpty` error with code `codes.InvalidArgument`
+// - On unsupported metadata: returns `ErrMetadataNotSupported` error with code `codes.InvalidArgument`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) StartUpload(ctx context.Context, req *blockpb.StartUploadRequest) (*blockpb.UploadStatus, error) {
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return nil, s.rpcError(codes.Aborted, ctxErr)
+	}
+	id, err := s.storage.StartUpload(withCaller(ctx), req.GetName(), req.GetMetadata())
+	if err != nil {
+		log.Printf("err: starting upload failed: %s, %s\n", req.GetName(), err.Error())
+		return nil, s.writeError(err)
+	}
+	return &blockpb.UploadStatus{SessionId: id}, nil
+}
+
+// GetUploadStatus - is a rpc function defined in `store.proto` file. Accepts `blockpb.UploadStatusRequest` which
+// contains upload session id, and returns committed offset of the session, where client should resume upload from.
+//
+// On successful function call, returns session id with offset with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On unknown or expired session: returns `ErrUploadNotFound` error with code `codes.NotFound`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) GetUploadStatus(ctx context.Context, req *blockpb.UploadStatusRequest) (*blockpb.UploadStatus, error) {
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return nil, s.rpcError(codes.Aborted, ctxErr)
+	}
+	offset, err := s.storage.UploadStatus(withCaller(ctx), req.GetSessionId())
+	if err != nil {
+		return nil, s.writeError(err)
+	}
+	return &blockpb.UploadStatus{SessionId: req.GetSessionId(), Offset: offset}, nil
+}
+
+// WriteUpload - is a rpc function defined in `store.proto` file. Accepts client stream which contains session id
+// and offset to resume from (first message) and raw chunks of document content starting from the offset. Content
+// received until stream breaks is kept in session (see `GetUploadStatus`), and document is written to permanent
+// object store when client closes stream.
+//
+// On successful function call, returns cid of document with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On receive error: returns associated error with code `codes.Aborted`
+// - On missing or misplaced resume message: returns `ErrResumeNotExpected` error with code `codes.InvalidArgument`
+// - On unknown or expired session: returns `ErrUploadNotFound` error with code `codes.NotFound`
+// - On offset not matches with session: returns `ErrUploadOffsetMismatch` error with code `codes.FailedPrecondition`
+// - On session written by another stream: returns `ErrUploadBusy` error with code `codes.Aborted`
+// - On max file size or caller quota exceeded: returns associated error with code `codes.ResourceExhausted`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) WriteUpload(stream blockpb.BlockStorageGrpcService_WriteUploadServer) error {
 	ctx := stream.Context()
 	ctxErr := util.CheckContext(ctx)
 	if ctxErr != nil {
@@ -69,51 +431,254 @@ func (s *storageGrpc) WriteBlock(stream blockpb.BlockStorageGrpcService_WriteBlo
 		log.Printf("err: receiving request failed: %s\n", requestErr.Error())
 		return status.Error(codes.Aborted, "cannot receive request")
 	}
+	resume := request.GetResume()
+	if resume == nil {
+		return s.rpcError(codes.InvalidArgument, ErrResumeNotExpected)
+	}
 
-	fname := request.GetName()
-	fileName := strings.TrimSpace(fname)
-	if fileName == "" {
-		return s.rpcError(codes.InvalidArgument, blockstorage.ErrBlockNameEmpty)
+	pr := pipeStream(ctx, func() ([]byte, error) {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if req.GetResume() != nil {
+			return nil, ErrResumeNotExpected
+		}
+		return req.GetChunkData(), nil
+	})
+	digest, err := s.storage.ResumeUpload(withCaller(ctx), resume.GetSessionId(), resume.GetOffset(), pr)
+	pr.Close()
+	if err != nil {
+		log.Printf("err: writing upload failed: %s, %s\n", resume.GetSessionId(), err.Error())
+		return s.writeError(err)
 	}
 
-	pr, pw := io.Pipe()
-	go func() {
-		var retErr error = nil
-		for {
-			ctxErr := util.CheckContext(ctx)
-			if ctxErr != nil {
-				retErr = ctxErr
-			}
-			req, err := stream.Recv()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				log.Printf("err: receiving chunk failed: %v\n", err)
-				retErr = err
-				break
-			}
-			_, err = pw.Write(req.GetChunkData())
-			if err != nil {
-				retErr = err
-				break
-			}
+	return stream.SendAndClose(&blockpb.WriteBlockResponse{
+		Cid: digest,
+	})
+}
+
+// GetUsage - is a rpc function defined in `store.proto` file. Returns persisted usage (bytes and objects) of
+// calling peer (see `callerIdentity`) with its quota limits.
+//
+// On successful function call, returns `blockpb.Usage` with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) GetUsage(ctx context.Context, req *blockpb.UsageRequest) (*blockpb.Usage, error) {
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return nil, s.rpcError(codes.Aborted, ctxErr)
+	}
+	usage, err := s.storage.Usage(ctx, callerIdentity(ctx))
+	if err != nil {
+		log.Printf("err: reading usage failed: %s\n", err.Error())
+		return nil, s.rpcError(codes.Internal, err)
+	}
+	return usage, nil
+}
+
+// Captures/Represents writer which sends written content in chunks (at most `exportChunkSize`) via `send`
+// function (e.g. as `blockpb.CARChunk` messages to server stream)
+type chunkWriter struct {
+	send func([]byte) error
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + exportChunkSize
+		if end > len(p) {
+			end = len(p)
 		}
-		if retErr != nil {
-			pw.CloseWithError(retErr)
-		} else {
-			pw.Close()
+		if err := w.send(p[written:end]); err != nil {
+			return written, err
 		}
+		written = end
+	}
+	return written, nil
+}
 
-	}()
+// ExportCAR - is a rpc function defined in `store.proto` file. Accepts `blockpb.ExportCARRequest` which contains
+// root block cid as string, and streams CARv1 archive of the DAG to client in chunks.
+//
+// On successful function call, returns `nil` with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On invalid cid: returns `ErrBlockIdentifierNotValid` error with code `codes.InvalidArgument`
+// - On root block, or any named block of the DAG, not readable by caller (see `Policy`): returns `ErrPermissionDenied`
+// error with code `codes.PermissionDenied`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) ExportCAR(req *blockpb.ExportCARRequest, stream blockpb.BlockStorageGrpcService_ExportCARServer) error {
+	ctx := stream.Context()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return s.rpcError(codes.Aborted, ctxErr)
+	}
+	root, decodeErr := cid.Decode(req.GetCid())
+	if decodeErr != nil {
+		return s.rpcError(codes.InvalidArgument, blockstorage.ErrBlockIdentifierNotValid)
+	}
+
+	if err := s.authorizeRoot(ctx, root); err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriterSize(&chunkWriter{send: func(data []byte) error {
+		return stream.Send(&blockpb.CARChunk{Data: data})
+	}}, exportChunkSize)
+	if err := s.storage.ExportCAR(withReadAuthorizer(ctx), root, writer); err != nil {
+		log.Printf("err: exporting car failed: %s, %s\n", root, err.Error())
+		if status.Code(err) == codes.PermissionDenied {
+			return err
+		}
+		return s.rpcError(codes.Internal, err)
+	}
+	if err := writer.Flush(); err != nil {
+		return s.rpcError(codes.Aborted, err)
+	}
+	return nil
+}
+
+// ExportTar - is a rpc function defined in `store.proto` file. Accepts `blockpb.ExportTarRequest` which contains
+// root directory cid as string, and streams tar archive of the directory DAG to client in chunks.
+//
+// On successful function call, returns `nil` with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On invalid cid: returns `ErrBlockIdentifierNotValid` error with code `codes.InvalidArgument`
+// - On root block is not a directory: returns `ErrBlockNotDirectory` error with code `codes.InvalidArgument`
+// - On root block, or any named block of the DAG, not readable by caller (see `Policy`): returns `ErrPermissionDenied`
+// error with code `codes.PermissionDenied`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) ExportTar(req *blockpb.ExportTarRequest, stream blockpb.BlockStorageGrpcService_ExportTarServer) error {
+	ctx := stream.Context()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return s.rpcError(codes.Aborted, ctxErr)
+	}
+	root, decodeErr := cid.Decode(req.GetCid())
+	if decodeErr != nil {
+		return s.rpcError(codes.InvalidArgument, blockstorage.ErrBlockIdentifierNotValid)
+	}
+
+	if err := s.authorizeRoot(ctx, root); err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriterSize(&chunkWriter{send: func(data []byte) error {
+		return stream.Send(&blockpb.TarChunk{Data: data})
+	}}, exportChunkSize)
+	if err := s.storage.ExportTar(withReadAuthorizer(ctx), root, writer); err != nil {
+		log.Printf("err: exporting tar failed: %s, %s\n", root, err.Error())
+		if err == blockstorage.ErrBlockNotDirectory {
+			return s.rpcError(codes.InvalidArgument, err)
+		}
+		if status.Code(err) == codes.PermissionDenied {
+			return err
+		}
+		return s.rpcError(codes.Internal, err)
+	}
+	if err := writer.Flush(); err != nil {
+		return s.rpcError(codes.Aborted, err)
+	}
+	return nil
+}
+
+// Stat - is a rpc function defined in `store.proto` file. Accepts `blockpb.StatRequest` which contains
+// block cid as string, and returns name, type, size and metadata of the block.
+//
+// On successful function call, returns `blockpb.BlockStat` with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On invalid cid: returns `ErrBlockIdentifierNotValid` error with code `codes.InvalidArgument`
+// - On block not readable by caller (see `Policy`): returns `ErrPermissionDenied` error with code `codes.PermissionDenied`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) Stat(ctx context.Context, req *blockpb.StatRequest) (*blockpb.BlockStat, error) {
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return nil, s.rpcError(codes.Aborted, ctxErr)
+	}
+	id, decodeErr := cid.Decode(req.GetCid())
+	if decodeErr != nil {
+		return nil, s.rpcError(codes.InvalidArgument, blockstorage.ErrBlockIdentifierNotValid)
+	}
+	stat, err := s.storage.Stat(ctx, id)
+	if err != nil {
+		log.Printf("err: stat failed: %s, %s\n", id, err.Error())
+		return nil, s.rpcError(codes.Internal, err)
+	}
+	if err := authorizeRead(ctx, stat.GetName()); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
 
-	digest, err := s.storage.CreateBlock(ctx, fileName, pr)
+// ListBlocks - is a rpc function defined in `store.proto` file. Accepts `blockpb.ListBlocksRequest` which contains
+// filter (name prefix, content type and attributes), and streams stats of matching files to client.
+// Files not readable by caller (see `Policy`) are skipped.
+//
+// On successful function call, returns `nil` with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) ListBlocks(req *blockpb.ListBlocksRequest, stream blockpb.BlockStorageGrpcService_ListBlocksServer) error {
+	ctx := stream.Context()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return s.rpcError(codes.Aborted, ctxErr)
+	}
+	stats, err := s.storage.ListBlocks(ctx, blockstorage.BlockFilter{
+		NamePrefix:  req.GetNamePrefix(),
+		ContentType: req.GetContentType(),
+		Attributes:  req.GetAttributes(),
+	})
 	if err != nil {
-		log.Printf("err: writing block failed: %s, %s\n", fileName, err.Error())
+		log.Printf("err: listing blocks failed: %s\n", err.Error())
 		return s.rpcError(codes.Internal, err)
 	}
+	for _, stat := range stats {
+		// files not readable by caller are skipped, as if they not exist
+		if authorizeRead(ctx, stat.GetName()) != nil {
+			continue
+		}
+		if err := stream.Send(stat); err != nil {
+			return s.rpcError(codes.Aborted, err)
+		}
+	}
+	return nil
+}
 
-	return stream.SendAndClose(&blockpb.WriteBlockResponse{
-		Cid: digest,
+// ImportCAR - is a rpc function defined in `store.proto` file. Accepts client stream which contains
+// chunks of CARv1 archive, and imports its blocks to permanent object store. As imported blocks bypass file
+// creation, under authorization policy the method must be allowed explicitly (see `Rule`).
+//
+// On successful function call, returns root cids of archive with code `codes.OK`. Otherwise;
+// - On context error: returns associated context error with code `codes.Aborted`
+// - On malformed archive or block integrity error: returns associated error with code `codes.InvalidArgument`
+// - On other errors: returns associated error with code `codes.Internal`
+func (s *storageGrpc) ImportCAR(stream blockpb.BlockStorageGrpcService_ImportCARServer) error {
+	ctx := stream.Context()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return s.rpcError(codes.Aborted, ctxErr)
+	}
+
+	pr := pipeStream(ctx, func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetData(), err
 	})
+	roots, err := s.storage.ImportCAR(ctx, pr)
+	pr.Close()
+	if err != nil {
+		log.Printf("err: importing car failed: %s\n", err.Error())
+		switch err {
+		case car.ErrHeaderMalformed, car.ErrSectionMalformed, car.ErrRootsNotSpecified, car.ErrVersionNotSupported,
+			blockstorage.ErrBlockIntegrityViolated, blockstorage.ErrBlockHashNotSupported:
+			return s.rpcError(codes.InvalidArgument, err)
+		default:
+			return s.rpcError(codes.Internal, err)
+		}
+	}
+
+	resp := &blockpb.ImportCARResponse{Roots: make([]string, 0, len(roots))}
+	for _, root := range roots {
+		resp.Roots = append(resp.Roots, root.String())
+	}
+	return stream.SendAndClose(resp)
 }
@@ -1,11 +1,15 @@
 package grpc
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"io"
 	"io/ioutil"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/igumus/blockstorage"
@@ -14,6 +18,8 @@ import (
 	"github.com/igumus/go-objectstore-lib"
 	"github.com/igumus/go-objectstore-lib/mock"
 	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -117,3 +123,646 @@ func (s *grpcSuite) TestBlockCreationViaGrpc() {
 	}
 
 }
+
+func (s *grpcSuite) TestCARViaGrpc() {
+	ctx := context.Background()
+	server, lis, setup, teardown := makeGrpcServer()
+
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	peer.EXPECT().GetRemoteBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, blockstorage.ErrBlockProviderNotFound)
+
+	storage, err := blockstorage.NewFakeBlockStorage(ctx,
+		blockstorage.WithLocalStore(newMemoryStore(s.T(), s.ctrl)),
+		blockstorage.WithPeer(peer),
+	)
+	require.NoError(s.T(), err)
+
+	endpoint, err := NewBlockStorageServiceEndpoint(ctx, storage)
+	require.NoError(s.T(), err)
+	blockpb.RegisterBlockStorageGrpcServiceServer(server, endpoint)
+
+	bufDialer := bufDialerFunc(lis)
+	go setup()
+	defer teardown()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err)
+	defer conn.Close()
+	client := blockpb.NewBlockStorageGrpcServiceClient(conn)
+
+	stream, err := client.WriteBlock(ctx)
+	require.NoError(s.T(), err)
+	digest, err := toGrpcStream("archived.bin", generateRandomByteReader(s.T(), 700<<10), stream)
+	require.NoError(s.T(), err)
+
+	exportStream, err := client.ExportCAR(ctx, &blockpb.ExportCARRequest{Cid: digest})
+	require.NoError(s.T(), err)
+	archive := make([]byte, 0)
+	for {
+		chunk, err := exportStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(s.T(), err)
+		archive = append(archive, chunk.GetData()...)
+	}
+
+	importStream, err := client.ImportCAR(ctx)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), importStream.Send(&blockpb.CARChunk{Data: archive}))
+	resp, err := importStream.CloseAndRecv()
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), []string{digest}, resp.GetRoots())
+
+	testCases := []struct {
+		name string
+		cid  string
+		code codes.Code
+	}{
+		{
+			name: "invalid_cid",
+			cid:  "invalid",
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "not_existing_cid",
+			cid:  "bafkreicbhkvymvquwrtgsxbed6imq5ec6526it55c3kp5lxpcjujyg7a4m",
+			code: codes.Internal,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			exportStream, err := client.ExportCAR(ctx, &blockpb.ExportCARRequest{Cid: tc.cid})
+			require.NoError(t, err)
+			_, err = exportStream.Recv()
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			require.Equal(t, tc.code, st.Code())
+		})
+	}
+
+	importStream, err = client.ImportCAR(ctx)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), importStream.Send(&blockpb.CARChunk{Data: []byte("not a car archive")}))
+	_, err = importStream.CloseAndRecv()
+	st, ok := status.FromError(err)
+	require.True(s.T(), ok)
+	require.Equal(s.T(), codes.InvalidArgument, st.Code())
+}
+
+// generateTar - generates tar stream which contains given files
+func generateTar(t *testing.T, files map[string]string) io.Reader {
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+	for name, content := range files {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(content))}))
+		_, err := writer.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return buf
+}
+
+func (s *grpcSuite) TestWriteTreeViaGrpc() {
+	ctx := context.Background()
+	server, lis, setup, teardown := makeGrpcServer()
+
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+
+	storage, err := blockstorage.NewFakeBlockStorage(ctx,
+		blockstorage.WithLocalStore(newMemoryStore(s.T(), s.ctrl)),
+		blockstorage.WithPeer(peer),
+	)
+	require.NoError(s.T(), err)
+
+	endpoint, err := NewBlockStorageServiceEndpoint(ctx, storage)
+	require.NoError(s.T(), err)
+	blockpb.RegisterBlockStorageGrpcServiceServer(server, endpoint)
+
+	bufDialer := bufDialerFunc(lis)
+	go setup()
+	defer teardown()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err)
+	defer conn.Close()
+	client := blockpb.NewBlockStorageGrpcServiceClient(conn)
+
+	testCases := []struct {
+		name  string
+		files map[string]string
+		code  codes.Code
+	}{
+		{name: "tree", files: map[string]string{"a/b/c.txt": "c", "d.txt": "d"}, code: codes.OK},
+		{name: "escaping_tree", files: map[string]string{"../c.txt": "c"}, code: codes.InvalidArgument},
+		{name: " ", files: map[string]string{"c.txt": "c"}, code: codes.InvalidArgument},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			stream, err := client.WriteTree(ctx)
+			require.NoError(t, err)
+			digest, err := toGrpcStream(tc.name, generateTar(t, tc.files), stream)
+			if tc.code != codes.OK {
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, tc.code, st.Code())
+				return
+			}
+			require.NoError(t, err)
+
+			root, err := cid.Decode(digest)
+			require.NoError(t, err)
+			for p, expected := range tc.files {
+				id, err := storage.GetByPath(ctx, root, p)
+				require.NoError(t, err)
+				content := &bytes.Buffer{}
+				require.NoError(t, storage.ReadFile(ctx, id, content))
+				require.Equal(t, expected, content.String())
+			}
+		})
+	}
+}
+
+func (s *grpcSuite) TestArchiveViaGrpc() {
+	ctx := context.Background()
+	server, lis, setup, teardown := makeGrpcServer()
+
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+
+	storage, err := blockstorage.NewFakeBlockStorage(ctx,
+		blockstorage.WithLocalStore(newMemoryStore(s.T(), s.ctrl)),
+		blockstorage.WithPeer(peer),
+	)
+	require.NoError(s.T(), err)
+
+	endpoint, err := NewBlockStorageServiceEndpoint(ctx, storage)
+	require.NoError(s.T(), err)
+	blockpb.RegisterBlockStorageGrpcServiceServer(server, endpoint)
+
+	bufDialer := bufDialerFunc(lis)
+	go setup()
+	defer teardown()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err)
+	defer conn.Close()
+	client := blockpb.NewBlockStorageGrpcServiceClient(conn)
+
+	files := map[string]string{"a/b/c.txt": "c"}
+	writeStream, err := client.WriteArchive(ctx)
+	require.NoError(s.T(), err)
+	digest, err := toGrpcStream("archive", generateTar(s.T(), files), writeStream)
+	require.NoError(s.T(), err)
+
+	exportStream, err := client.ExportTar(ctx, &blockpb.ExportTarRequest{Cid: digest})
+	require.NoError(s.T(), err)
+	archive := make([]byte, 0)
+	for {
+		chunk, err := exportStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(s.T(), err)
+		archive = append(archive, chunk.GetData()...)
+	}
+	reader := tar.NewReader(bytes.NewReader(archive))
+	names := make([]string, 0)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(s.T(), err)
+		names = append(names, header.Name)
+		if header.Typeflag == tar.TypeReg {
+			require.Equal(s.T(), int64(0644), header.Mode)
+			content, err := ioutil.ReadAll(reader)
+			require.NoError(s.T(), err)
+			require.Equal(s.T(), files[header.Name], string(content))
+		}
+	}
+	require.Equal(s.T(), []string{"a/", "a/b/", "a/b/c.txt"}, names)
+
+	writeCases := []struct {
+		name    string
+		archive io.Reader
+		code    codes.Code
+	}{
+		{name: "escaping_archive", archive: generateTar(s.T(), map[string]string{"../c.txt": "c"}), code: codes.InvalidArgument},
+		{name: "corrupted_gzip", archive: bytes.NewReader([]byte{0x1f, 0x8b, 0x00, 0x00}), code: codes.InvalidArgument},
+		{name: "corrupted_zip", archive: bytes.NewReader([]byte("PK\x03\x04corrupted")), code: codes.InvalidArgument},
+	}
+	for i := range writeCases {
+		tc := writeCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			stream, err := client.WriteArchive(ctx)
+			require.NoError(t, err)
+			_, err = toGrpcStream(tc.name, tc.archive, stream)
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			require.Equal(t, tc.code, st.Code())
+		})
+	}
+
+	exportCases := []struct {
+		name string
+		cid  string
+		code codes.Code
+	}{
+		{name: "invalid_cid", cid: "invalid", code: codes.InvalidArgument},
+		{name: "file_cid", cid: func() string {
+			root, err := cid.Decode(digest)
+			require.NoError(s.T(), err)
+			id, err := storage.GetByPath(ctx, root, "a/b/c.txt")
+			require.NoError(s.T(), err)
+			return id.String()
+		}(), code: codes.InvalidArgument},
+	}
+	for i := range exportCases {
+		tc := exportCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			stream, err := client.ExportTar(ctx, &blockpb.ExportTarRequest{Cid: tc.cid})
+			require.NoError(t, err)
+			_, err = stream.Recv()
+			st, ok := status.FromError(err)
+			require.True(t, ok)
+			require.Equal(t, tc.code, st.Code())
+		})
+	}
+}
+
+func (s *grpcSuite) TestMetadataViaGrpc() {
+	ctx := context.Background()
+	server, lis, setup, teardown := makeGrpcServer()
+
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+
+	storage, err := blockstorage.NewFakeBlockStorage(ctx,
+		blockstorage.WithLocalStore(newMemoryStore(s.T(), s.ctrl)),
+		blockstorage.WithPeer(peer),
+	)
+	require.NoError(s.T(), err)
+
+	endpoint, err := NewBlockStorageServiceEndpoint(ctx, storage)
+	require.NoError(s.T(), err)
+	blockpb.RegisterBlockStorageGrpcServiceServer(server, endpoint)
+
+	bufDialer := bufDialerFunc(lis)
+	go setup()
+	defer teardown()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err)
+	defer conn.Close()
+	client := blockpb.NewBlockStorageGrpcServiceClient(conn)
+
+	name := &blockpb.WriteBlockRequest{Data: &blockpb.WriteBlockRequest_Name{Name: "report.json"}}
+	meta := &blockpb.WriteBlockRequest{Data: &blockpb.WriteBlockRequest_Metadata{Metadata: &blockpb.Metadata{
+		ContentType: "application/json",
+		Attributes:  map[string]string{"owner": "alice"},
+	}}}
+	chunk := &blockpb.WriteBlockRequest{Data: &blockpb.WriteBlockRequest_ChunkData{ChunkData: []byte(`{"ok":true}`)}}
+
+	testCases := []struct {
+		name     string
+		requests []*blockpb.WriteBlockRequest
+		code     codes.Code
+	}{
+		{name: "metadata_after_name", requests: []*blockpb.WriteBlockRequest{name, meta, chunk}, code: codes.OK},
+		{name: "metadata_after_chunk", requests: []*blockpb.WriteBlockRequest{name, chunk, meta}, code: codes.InvalidArgument},
+	}
+
+	var digest string
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			stream, err := client.WriteBlock(ctx)
+			require.NoError(t, err)
+			for _, req := range tc.requests {
+				require.NoError(t, stream.Send(req))
+			}
+			resp, err := stream.CloseAndRecv()
+			if tc.code != codes.OK {
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, tc.code, st.Code())
+				return
+			}
+			require.NoError(t, err)
+			digest = resp.GetCid()
+		})
+	}
+
+	stat, err := client.Stat(ctx, &blockpb.StatRequest{Cid: digest})
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), "report.json", stat.GetName())
+	require.Equal(s.T(), uint64(11), stat.GetSize())
+	require.Equal(s.T(), "application/json", stat.GetMeta().GetContentType())
+	require.Equal(s.T(), "alice", stat.GetMeta().GetAttributes()["owner"])
+	require.NotZero(s.T(), stat.GetMeta().GetCtime())
+
+	_, err = client.Stat(ctx, &blockpb.StatRequest{Cid: "invalid"})
+	st, ok := status.FromError(err)
+	require.True(s.T(), ok)
+	require.Equal(s.T(), codes.InvalidArgument, st.Code())
+
+	listCases := []struct {
+		name     string
+		request  *blockpb.ListBlocksRequest
+		expected []string
+	}{
+		{name: "matching", request: &blockpb.ListBlocksRequest{ContentType: "application/json", Attributes: map[string]string{"owner": "alice"}}, expected: []string{digest}},
+		{name: "not_matching", request: &blockpb.ListBlocksRequest{NamePrefix: "other"}, expected: []string{}},
+	}
+	for i := range listCases {
+		tc := listCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			stream, err := client.ListBlocks(ctx, tc.request)
+			require.NoError(t, err)
+			cids := make([]string, 0)
+			for {
+				stat, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				cids = append(cids, stat.GetCid())
+			}
+			require.Equal(t, tc.expected, cids)
+		})
+	}
+}
+
+func (s *grpcSuite) TestChecksumViaGrpc() {
+	ctx := context.Background()
+	server, lis, setup, teardown := makeGrpcServer()
+
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+
+	storage, err := blockstorage.NewFakeBlockStorage(ctx,
+		blockstorage.WithLocalStore(newMemoryStore(s.T(), s.ctrl)),
+		blockstorage.WithPeer(peer),
+	)
+	require.NoError(s.T(), err)
+
+	endpoint, err := NewBlockStorageServiceEndpoint(ctx, storage)
+	require.NoError(s.T(), err)
+	blockpb.RegisterBlockStorageGrpcServiceServer(server, endpoint)
+
+	bufDialer := bufDialerFunc(lis)
+	go setup()
+	defer teardown()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err)
+	defer conn.Close()
+	client := blockpb.NewBlockStorageGrpcServiceClient(conn)
+
+	content := []byte("checksummed content")
+	valid := sha256.Sum256(content)
+	invalid := sha256.Sum256([]byte("other content"))
+	name := &blockpb.WriteBlockRequest{Data: &blockpb.WriteBlockRequest_Name{Name: "checksum.txt"}}
+	chunk := &blockpb.WriteBlockRequest{Data: &blockpb.WriteBlockRequest_ChunkData{ChunkData: content}}
+	checksum := func(sum [sha256.Size]byte) *blockpb.WriteBlockRequest {
+		return &blockpb.WriteBlockRequest{Data: &blockpb.WriteBlockRequest_Sha256{Sha256: sum[:]}}
+	}
+
+	testCases := []struct {
+		name     string
+		requests []*blockpb.WriteBlockRequest
+		code     codes.Code
+	}{
+		{name: "without_checksum", requests: []*blockpb.WriteBlockRequest{name, chunk}, code: codes.OK},
+		{name: "valid_checksum", requests: []*blockpb.WriteBlockRequest{name, chunk, checksum(valid)}, code: codes.OK},
+		{name: "invalid_checksum", requests: []*blockpb.WriteBlockRequest{name, chunk, checksum(invalid)}, code: codes.DataLoss},
+		{name: "chunk_after_checksum", requests: []*blockpb.WriteBlockRequest{name, chunk, checksum(valid), chunk}, code: codes.InvalidArgument},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			stream, err := client.WriteBlock(ctx)
+			require.NoError(t, err)
+			for _, req := range tc.requests {
+				require.NoError(t, stream.Send(req))
+			}
+			resp, err := stream.CloseAndRecv()
+			if tc.code != codes.OK {
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, tc.code, st.Code())
+				return
+			}
+			require.NoError(t, err)
+			root, err := cid.Decode(resp.GetCid())
+			require.NoError(t, err)
+			buf := &bytes.Buffer{}
+			require.NoError(t, storage.ReadFile(ctx, root, buf))
+			require.Equal(t, content, buf.Bytes())
+		})
+	}
+
+	// checksum of tree stream covers tar content
+	stream, err := client.WriteTree(ctx)
+	require.NoError(s.T(), err)
+	archive, err := ioutil.ReadAll(generateTar(s.T(), map[string]string{"a.txt": "a"}))
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), stream.Send(&blockpb.WriteBlockRequest{Data: &blockpb.WriteBlockRequest_Name{Name: "tree"}}))
+	require.NoError(s.T(), stream.Send(&blockpb.WriteBlockRequest{Data: &blockpb.WriteBlockRequest_ChunkData{ChunkData: archive}}))
+	require.NoError(s.T(), stream.Send(checksum(invalid)))
+	_, err = stream.CloseAndRecv()
+	st, ok := status.FromError(err)
+	require.True(s.T(), ok)
+	require.Equal(s.T(), codes.DataLoss, st.Code())
+}
+
+func (s *grpcSuite) TestResumableUploadViaGrpc() {
+	ctx := context.Background()
+	server, lis, setup, teardown := makeGrpcServer()
+
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+
+	storage, err := blockstorage.NewFakeBlockStorage(ctx,
+		blockstorage.WithLocalStore(newMemoryStore(s.T(), s.ctrl)),
+		blockstorage.WithPeer(peer),
+	)
+	require.NoError(s.T(), err)
+
+	endpoint, err := NewBlockStorageServiceEndpoint(ctx, storage)
+	require.NoError(s.T(), err)
+	blockpb.RegisterBlockStorageGrpcServiceServer(server, endpoint)
+
+	bufDialer := bufDialerFunc(lis)
+	go setup()
+	defer teardown()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err)
+	defer conn.Close()
+	client := blockpb.NewBlockStorageGrpcServiceClient(conn)
+
+	content, err := ioutil.ReadAll(generateRandomByteReader(s.T(), 3*exportChunkSize+100))
+	require.NoError(s.T(), err)
+	resume := func(id string, offset uint64) *blockpb.UploadRequest {
+		return &blockpb.UploadRequest{Data: &blockpb.UploadRequest_Resume{Resume: &blockpb.UploadStatus{SessionId: id, Offset: offset}}}
+	}
+	chunk := func(data []byte) *blockpb.UploadRequest {
+		return &blockpb.UploadRequest{Data: &blockpb.UploadRequest_ChunkData{ChunkData: data}}
+	}
+	code := func(err error) codes.Code {
+		st, ok := status.FromError(err)
+		require.True(s.T(), ok)
+		return st.Code()
+	}
+
+	session, err := client.StartUpload(ctx, &blockpb.StartUploadRequest{Name: "upload.bin"})
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(0), session.GetOffset())
+
+	// connection drops after two chunks
+	dropped, cancel := context.WithCancel(ctx)
+	stream, err := client.WriteUpload(dropped)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), stream.Send(resume(session.GetSessionId(), 0)))
+	require.NoError(s.T(), stream.Send(chunk(content[:2*exportChunkSize+10])))
+	cancel()
+
+	// resume from committed offset, once server releases dropped stream
+	var resp *blockpb.WriteBlockResponse
+	for attempt := 0; attempt < 100 && resp == nil; attempt++ {
+		current, err := client.GetUploadStatus(ctx, &blockpb.UploadStatusRequest{SessionId: session.GetSessionId()})
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), uint64(0), current.GetOffset()%exportChunkSize)
+
+		stream, err := client.WriteUpload(ctx)
+		require.NoError(s.T(), err)
+		require.NoError(s.T(), stream.Send(resume(current.GetSessionId(), current.GetOffset())))
+		require.NoError(s.T(), stream.Send(chunk(content[current.GetOffset():])))
+		resp, err = stream.CloseAndRecv()
+		if err != nil {
+			require.Contains(s.T(), []codes.Code{codes.Aborted, codes.FailedPrecondition}, code(err))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	require.NotNil(s.T(), resp)
+	root, err := cid.Decode(resp.GetCid())
+	require.NoError(s.T(), err)
+	buf := &bytes.Buffer{}
+	require.NoError(s.T(), storage.ReadFile(ctx, root, buf))
+	require.Equal(s.T(), content, buf.Bytes())
+
+	// completed session is removed
+	_, err = client.GetUploadStatus(ctx, &blockpb.UploadStatusRequest{SessionId: session.GetSessionId()})
+	require.Equal(s.T(), codes.NotFound, code(err))
+
+	session, err = client.StartUpload(ctx, &blockpb.StartUploadRequest{Name: "other.bin"})
+	require.NoError(s.T(), err)
+	testCases := []struct {
+		name     string
+		requests []*blockpb.UploadRequest
+		code     codes.Code
+	}{
+		{name: "without_resume", requests: []*blockpb.UploadRequest{chunk(content)}, code: codes.InvalidArgument},
+		{name: "unknown_session", requests: []*blockpb.UploadRequest{resume("unknown", 0), chunk(content)}, code: codes.NotFound},
+		{name: "offset_mismatch", requests: []*blockpb.UploadRequest{resume(session.GetSessionId(), 10), chunk(content)}, code: codes.FailedPrecondition},
+		{name: "misplaced_resume", requests: []*blockpb.UploadRequest{resume(session.GetSessionId(), 0), chunk(content), resume(session.GetSessionId(), 0)}, code: codes.InvalidArgument},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			stream, err := client.WriteUpload(ctx)
+			require.NoError(t, err)
+			for _, req := range tc.requests {
+				if err := stream.Send(req); err != nil {
+					break
+				}
+			}
+			_, err = stream.CloseAndRecv()
+			require.Equal(t, tc.code, code(err))
+		})
+	}
+}
+
+func (s *grpcSuite) TestQuotaViaGrpc() {
+	ctx := context.Background()
+	server, lis, setup, teardown := makeGrpcServer()
+
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+
+	storage, err := blockstorage.NewFakeBlockStorage(ctx,
+		blockstorage.WithLocalStore(newMemoryStore(s.T(), s.ctrl)),
+		blockstorage.WithPeer(peer),
+		blockstorage.WithMaxFileSize(1<<20),
+		blockstorage.WithQuota(3<<19, 0),
+		blockstorage.WithDatastore(dssync.MutexWrap(ds.NewMapDatastore())),
+	)
+	require.NoError(s.T(), err)
+
+	endpoint, err := NewBlockStorageServiceEndpoint(ctx, storage)
+	require.NoError(s.T(), err)
+	blockpb.RegisterBlockStorageGrpcServiceServer(server, endpoint)
+
+	bufDialer := bufDialerFunc(lis)
+	go setup()
+	defer teardown()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err)
+	defer conn.Close()
+	client := blockpb.NewBlockStorageGrpcServiceClient(conn)
+
+	testCases := []struct {
+		name  string
+		size  int
+		code  codes.Code
+		usage uint64
+	}{
+		{name: "within_limits", size: 1 << 20, code: codes.OK, usage: 1 << 20},
+		{name: "file_too_large", size: 1<<20 + 1, code: codes.ResourceExhausted, usage: 1 << 20},
+		{name: "quota_exceeded", size: 1<<19 + 1, code: codes.ResourceExhausted, usage: 1 << 20},
+		{name: "quota_reached", size: 1 << 19, code: codes.OK, usage: 3 << 19},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			stream, err := client.WriteBlock(ctx)
+			require.NoError(t, err)
+			_, err = toGrpcStream(tc.name, generateRandomByteReader(t, tc.size), stream)
+			if tc.code != codes.OK {
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, tc.code, st.Code())
+			} else {
+				require.NoError(t, err)
+			}
+
+			usage, err := client.GetUsage(ctx, &blockpb.UsageRequest{})
+			require.NoError(t, err)
+			require.Equal(t, "bufconn", usage.GetCaller())
+			require.Equal(t, tc.usage, usage.GetBytes())
+			require.Equal(t, uint64(3<<19), usage.GetBytesLimit())
+		})
+	}
+}
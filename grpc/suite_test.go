@@ -5,12 +5,17 @@ import (
 	"context"
 	"crypto/rand"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
+	"sync"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/go-objectstore-lib"
+	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"google.golang.org/grpc"
@@ -19,8 +24,8 @@ import (
 
 const bufSize = 1024 * 1024
 
-func makeGrpcServer() (*grpc.Server, *bufconn.Listener, func(), func()) {
-	s := grpc.NewServer()
+func makeGrpcServer(opts ...grpc.ServerOption) (*grpc.Server, *bufconn.Listener, func(), func()) {
+	s := grpc.NewServer(opts...)
 	lis := bufconn.Listen(bufSize)
 	return s, lis, func() {
 			if err := s.Serve(lis); err != nil {
@@ -37,7 +42,14 @@ func bufDialerFunc(lis *bufconn.Listener) func(context.Context, string) (net.Con
 	}
 }
 
-func toGrpcStream(filename string, reader io.Reader, stream blockpb.BlockStorageGrpcService_WriteBlockClient) (string, error) {
+// Captures/Represents client stream of `blockpb.WriteBlockRequest` messages (e.g. `WriteBlock`, `WriteTree`)
+type writeRequestClient interface {
+	Send(*blockpb.WriteBlockRequest) error
+	CloseAndRecv() (*blockpb.WriteBlockResponse, error)
+	RecvMsg(interface{}) error
+}
+
+func toGrpcStream(filename string, reader io.Reader, stream writeRequestClient) (string, error) {
 	if sendErr := stream.Send(&blockpb.WriteBlockRequest{
 		Data: &blockpb.WriteBlockRequest_Name{
 			Name: filename,
@@ -75,6 +87,40 @@ func toGrpcStream(filename string, reader io.Reader, stream blockpb.BlockStorage
 	return resp.Cid, nil
 }
 
+// newMemoryStore - creates mock object store which keeps objects in memory
+func newMemoryStore(t *testing.T, ctrl *gomock.Controller) *mock.MockObjectStore {
+	lock := sync.Mutex{}
+	lookup := make(map[cid.Cid][]byte)
+
+	store := mock.NewMockObjectStore(ctrl)
+	store.EXPECT().HasObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		_, ok := lookup[id]
+		return ok
+	})
+	store.EXPECT().CreateObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, r io.Reader) (cid.Cid, error) {
+		data, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		id, err := objectstore.DigestPrefix.Sum(data)
+		require.NoError(t, err)
+		lock.Lock()
+		defer lock.Unlock()
+		lookup[id] = data
+		return id, nil
+	})
+	store.EXPECT().ReadObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		data, ok := lookup[id]
+		if !ok {
+			return nil, objectstore.ErrObjectNotExists
+		}
+		return data, nil
+	})
+	return store
+}
+
 type grpcSuite struct {
 	suite.Suite
 	*require.Assertions
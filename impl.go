@@ -1,13 +1,13 @@
 package blockstorage
 
 import (
-	"bytes"
 	"context"
 	"io"
 	"log"
 	"strings"
 
 	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/util"
 	"github.com/ipfs/go-cid"
 )
 
@@ -18,66 +18,267 @@ import (
 // 	1.1. checks permanent object store already has block with given cid, If exists reads from permanent object store.
 // 	1.2. checks temporary object store already has block with given cid, If exists reads from temporary object store.
 // 	1.3. asks p2p network to provide block with given cid, If founds any provider, stores block to temporary object store.
-// 2. Decodes/Unmarshals binary form of block to proto object instance.
-// 3. Returns proto instance (`blockpb.Block`) without error
+// 2. Decodes/Unmarshals binary form of block to proto object instance regarding codec of cid (see `blockpb.DecodeNode`).
+// 3. Decrypts data of encrypted block with storage's key provider (see `WithEncryption`)
+// 4. Returns proto instance (`blockpb.Block`) without error
+// Decoded blocks are cached when block cache is enabled (see `WithBlockCache`), so steps 1-2 are skipped for
+// recently read blocks.
 //
 // Error:
-// When any of the flow operations fail, returns `nil` with error cause
+// - When key of encrypted block is not provided returns `nil, ErrEncryptionKeyNotFound`
+// - When any of the flow operations fail, returns `nil` with error cause
 func (s *storage) GetBlock(ctx context.Context, cid cid.Cid) (*blockpb.Block, error) {
-	var data []byte
-	var err error
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	defer done()
+	return s.loadBlock(ctx, cid, s.rootLinkType(cid))
+}
+
+// rootLinkType - returns link type which block with given cid is read with, when it is not referenced by a link
+// (e.g. `GetBlock`). When raw leaves are enabled, raw cids are read as raw leaves, since nodes of the storage are
+// addressed with `blockpb.BlockCodec` (see `nodeCodec`).
+func (s *storage) rootLinkType(id cid.Cid) blockpb.LinkType {
+	if s.rawLeaves && id.Type() == cid.Raw {
+		return blockpb.LinkType_RAW
+	}
+	return blockpb.LinkType_BLOCK
+}
 
-	if s.localStore.HasObject(ctx, cid) {
-		data, err = s.localStore.ReadObject(ctx, cid)
-	} else {
-		data, err = s.peer.GetRemoteBlock(ctx, cid)
+// readBlockData - reads binary form of block with given cid from permanent store, or from p2p network
+// (via temporary store) when permanent store has not the block.
+func (s *storage) readBlockData(ctx context.Context, id cid.Cid) ([]byte, error) {
+	if s.localStore.HasObject(ctx, id) {
+		return s.localStore.ReadObject(ctx, id)
 	}
+	return s.peer.GetRemoteBlock(ctx, id)
+}
+
+// ReadFile - writes content of the file whose root block has given cid (aka content identifier) to `w`.
+//
+// Flow:
+// 1. Gets root block via `GetBlock`
+// 2. Writes `Data` of block to `w`
+// 3. Repeats same flow for each link of block in order (DAG traversal, depth first). Linked blocks are decoded
+// regarding link type, so raw leaves and `blockpb.Block` leaves are handled transparently. Leaves of erasure
+// coded files (see `WithErasureCoding`) which can not be read are reconstructed from parity of their stripe.
+//
+// Error:
+// - When root block is a directory returns `ErrBlockIsDirectory`
+// - When any of the flow operations fail, returns error cause. Content written to `w` until failure is not reverted.
+func (s *storage) ReadFile(ctx context.Context, id cid.Cid, w io.Writer) error {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return stopErr
+	}
+	defer done()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return ctxErr
+	}
+	block, err := s.GetBlock(ctx, id)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if block.Type == blockpb.BlockType_DIRECTORY {
+		return ErrBlockIsDirectory
+	}
+	return s.writeBlock(ctx, block, w)
+}
+
+// writeBlock - writes `Data` of given block, and content of its linked blocks to `w`. Content of erasure coded
+// blocks is written stripe by stripe, so unavailable leaves are reconstructed (see `writeStripes`).
+func (s *storage) writeBlock(ctx context.Context, block *blockpb.Block, w io.Writer) error {
+	if block.Erasure != nil {
+		return s.writeStripes(ctx, block, w)
+	}
+	if len(block.Data) > 0 {
+		if _, err := w.Write(block.Data); err != nil {
+			return err
+		}
+	}
+	for _, link := range block.Links {
+		ctxErr := util.CheckContext(ctx)
+		if ctxErr != nil {
+			return ctxErr
+		}
+		child, err := s.getLinkedBlock(ctx, link)
+		if err != nil {
+			return err
+		}
+		if err := s.writeBlock(ctx, child, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getLinkedBlock - reads and decodes block referenced by given link regarding link type, and decrypts it when
+// block is encrypted (see `loadBlock`).
+func (s *storage) getLinkedBlock(ctx context.Context, link *blockpb.Link) (*blockpb.Block, error) {
+	id, err := cid.Decode(link.Hash)
+	if err != nil {
+		return nil, ErrBlockIdentifierNotValid
 	}
+	return s.loadBlock(ctx, id, link.Type)
+}
 
-	return blockpb.Decode(data)
+// decodeLinkedBlock - decodes binary form of block with given cid referenced with given link type (see
+// `blockpb.DecodeLinkedNode`), and decrypts it when block is encrypted.
+func (s *storage) decodeLinkedBlock(ctx context.Context, id cid.Cid, typ blockpb.LinkType, data []byte) (*blockpb.Block, error) {
+	block, err := blockpb.DecodeLinkedNode(id, typ, data)
+	if err != nil {
+		return nil, err
+	}
+	return s.decryptBlock(ctx, block)
 }
 
-// persistBlock - is a helper function that persists given block instance to permanent store.
+// persistBlock - is a helper function that persists given block instance to permanent store, sealed with given
+// file key (optional, see `sealNode`).
 //
 // Flow:
-// 1. Encodes/Marshals block proto object instance to binary
-// 2. Persists binary content to permanent store.
+// 1. Seals block when file key is given, and encodes/marshals block proto object instance to binary
+// 2. Persists binary content to permanent store with cid computed by storage's cid prefix (see `persistNode`).
 // 3. Announces block ownership to p2p network.
 // 4. Returns proto object instance reference (`blockpb.Link`)
 //
 // Error:
 // When any of the flow operations fail, returns `nil` with error cause
-func (s *storage) persistBlock(ctx context.Context, block *blockpb.Block) (*blockpb.Link, error) {
-	blockBin, encodeErr := blockpb.Encode(block)
+func (s *storage) persistBlock(ctx context.Context, block *blockpb.Block, key *fileKey) (*blockpb.Link, error) {
+	stored := block
+	if key != nil {
+		sealed, sealErr := sealNode(block, key)
+		if sealErr != nil {
+			return nil, sealErr
+		}
+		stored = sealed
+	}
+	blockBin, encodeErr := blockpb.Encode(stored)
 	if encodeErr != nil {
 		return nil, encodeErr
 	}
 
-	digest, persistErr := s.localStore.CreateObject(ctx, bytes.NewReader(blockBin))
+	digest, persistErr := s.persistNode(ctx, s.nodeCodec(), blockBin)
 	if persistErr != nil {
 		return nil, persistErr
 	}
 
-	if s.debug {
-		log.Printf("debug: wrote block with digest: %s, %d\n", digest.String(), len(block.Data))
-	}
-
-	s.peer.AnnounceBlock(ctx, digest)
-
 	return &blockpb.Link{
 		Hash:  digest.String(),
 		Tsize: uint64(len(block.Data)),
 	}, nil
 }
 
-// persistBlockWithData - creates and persists block which only have `Data` field with given byte slice.
-func (s *storage) persistBlockWithData(ctx context.Context, data []byte) (*blockpb.Link, error) {
-	block := &blockpb.Block{
-		Data: data,
+// persistNode - computes cid of given binary form of node with storage's cid prefix and given codec, persists
+// node to permanent store (recording it to operation's write set, see `transaction`), and announces block
+// ownership to p2p network (deferred until operation commits, when node is newly persisted by operation).
+// Returns cid of node.
+func (s *storage) persistNode(ctx context.Context, codec uint64, data []byte) (cid.Cid, error) {
+	id, sumErr := s.nodeID(codec, data)
+	if sumErr != nil {
+		return cid.Undef, sumErr
+	}
+	return s.persistNodeWithID(ctx, id, data)
+}
+
+// nodeID - computes cid of given binary form of node with storage's cid prefix and given codec
+func (s *storage) nodeID(codec uint64, data []byte) (cid.Cid, error) {
+	prefix := s.prefix
+	prefix.Codec = codec
+	if codec != cid.DagProtobuf {
+		prefix.Version = 1
+	}
+	return prefix.Sum(data)
+}
+
+// persistNodeWithID - persists given binary form of node addressed with given cid (see `persistNode`). Binary form
+// is not verified against the cid.
+func (s *storage) persistNodeWithID(ctx context.Context, id cid.Cid, data []byte) (cid.Cid, error) {
+	claimed, claimErr := s.claimNode(ctx, writeSetFrom(ctx), id, data)
+	if claimErr != nil {
+		return cid.Undef, claimErr
+	}
+	if persistErr := s.localStore.PutObject(ctx, id, data); persistErr != nil {
+		return cid.Undef, persistErr
+	}
+
+	if s.debug {
+		log.Printf("debug: wrote node with digest: %s, %d\n", id.String(), len(data))
+	}
+
+	if !claimed {
+		s.peer.AnnounceBlock(ctx, id)
+	}
+	return id, nil
+}
+
+// nodeCodec - returns codec of cids of `Block` nodes. Nodes are addressed with `blockpb.BlockCodec` when raw leaves
+// are enabled (see `EnableRawLeaves`), so they are told apart from raw leaves by their cids, otherwise with
+// `cid.Raw` as blocks were always addressed.
+func (s *storage) nodeCodec() uint64 {
+	if s.rawLeaves {
+		return blockpb.BlockCodec
+	}
+	return cid.Raw
+}
+
+// persistBlockWithData - creates and persists leaf block with given byte slice. When raw leaves enabled, persists
+// byte slice as is (CIDv1 raw), otherwise persists block which only have `Data` field with given byte slice
+// (compressed and encrypted with given file key when enabled, see `persistEncodedLeaf`). Returns link of leaf with
+// its stored (binary) form.
+func (s *storage) persistBlockWithData(ctx context.Context, data []byte, key *fileKey) (*blockpb.Link, []byte, error) {
+	if s.rawLeaves {
+		id, err := s.persistNode(ctx, cid.Raw, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &blockpb.Link{
+			Hash:  id.String(),
+			Tsize: uint64(len(data)),
+			Type:  blockpb.LinkType_RAW,
+		}, data, nil
+	}
+	if s.compression != blockpb.Compression_NONE || key != nil {
+		return s.persistEncodedLeaf(ctx, data, key)
+	}
+	stored, err := blockpb.Encode(&blockpb.Block{Data: data})
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := s.persistNode(ctx, s.nodeCodec(), stored)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &blockpb.Link{Hash: id.String(), Tsize: uint64(len(data))}, stored, nil
+}
+
+// readChunks - reads up to `chunkSize` of data from `reader` on each read, and calls `fn` with each chunk in
+// order. Chunk boundaries follow reads of `reader`, so cids of leaves are same as before. Returns count of chunks
+// read.
+func (s *storage) readChunks(ctx context.Context, reader io.Reader, fn func([]byte) error) (int, error) {
+	count := 0
+	for {
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		buf := make([]byte, s.chunkSize)
+		n, err := reader.Read(buf)
+		if err != nil && err != io.EOF {
+			return count, err
+		}
+		if err == io.EOF && n == 0 {
+			return count, nil
+		}
+
+		if fnErr := fn(buf[:n]); fnErr != nil {
+			return count, fnErr
+		}
+		count++
+		if err == io.EOF {
+			return count, nil
+		}
 	}
-	return s.persistBlock(ctx, block)
 }
 
 // CreateBlock - creates block with given `name` in underlying objectstore.
@@ -86,54 +287,130 @@ func (s *storage) persistBlockWithData(ctx context.Context, data []byte) (*block
 // 1. Validates file name
 // 2. Reads `chunkSize` (default: 512KB) of data from `reader`
 //	2.1 On each reading step persists DAG (Directed Acyclic Graph) leaf nodes to permanent store.
-// 3. Creates root node to associate with leaf nodes.
-// 4. Persists root of DAG to permanent store.
+// 3. Creates root node to associate with leaf nodes. Root carries sniffed content type and creation time
+// (see `CreateBlockWithMetadata`).
+// 4. Persists root of DAG to permanent store, and adds root to file index (see `ListBlocks`).
+//
+// When storage configured with `DagPBEncoding`, DAG is created in IPFS compatible form (see `createDagPBRoot`),
+// and `name` is not part of the DAG.
 //
 // Error:
 // - When `fname` is not valid returns `"", ErrBlockNameEmpty`
 // - When reading from `reader` fails returns `"", <Reader Failure Error>`
 // - When reader not contains any data, returns `"",ErrBlockDataEmpty`
+// - When content exceeds max file size returns `"", ErrFileTooLarge`
+// - When caller (see `WithCaller`) exceeds its quota returns `"", ErrQuotaExceeded`
+// Nodes persisted until failure are removed from permanent store (see `transaction`).
 func (s *storage) CreateBlock(ctx context.Context, fname string, reader io.Reader) (string, error) {
-	name := strings.TrimSpace(fname)
-	if name == "" {
-		return "", ErrBlockNameEmpty
-	}
-	root := &blockpb.Block{
-		Name: name,
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return "", stopErr
 	}
-	links := make([]*blockpb.Link, 0)
-	totalSize := uint64(0)
-	var buf []byte
-	for {
-		if ctx.Err() != nil {
-			return "", ctx.Err()
-		}
-		buf = make([]byte, s.chunkSize)
-		n, err := reader.Read(buf)
-		if err != nil {
-			if err != io.EOF {
-				return "", err
-			}
-			break
-		}
+	defer done()
+	return s.CreateBlockWithMetadata(ctx, fname, nil, reader)
+}
 
-		link, linkErr := s.persistBlockWithData(ctx, buf[:n])
-		if linkErr != nil {
-			return "", linkErr
-		}
+// Captures/Represents state of file DAG being created: persisted leaves in content order. State can be kept
+// across streams (see `ResumeUpload`). Key encrypts leaves of the file when encryption is enabled.
+type fileState struct {
+	leaves []*sizedLink
+	key    *fileKey
+	// erasure coding of persisted leaves with parity of complete stripes, and stored forms of leaves of incomplete
+	// stripe (see `addStripeLeaf`). Erasure is `nil` when erasure coding is disabled.
+	erasure *blockpb.Erasure
+	stripe  [][]byte
+}
 
-		links = append(links, link)
-		totalSize += uint64(n)
+// newFileState - returns state of file DAG without leaves, whose leaves are encrypted with given file key
+// (optional)
+func (s *storage) newFileState(key *fileKey) *fileState {
+	ret := &fileState{key: key}
+	if s.erasure.enabled() {
+		ret.erasure = &blockpb.Erasure{DataShards: uint32(s.erasure.dataShards), ParityShards: uint32(s.erasure.parityShards)}
 	}
+	return ret
+}
 
-	if len(links) < 1 {
-		return "", ErrBlockDataEmpty
+// size - returns size of content under persisted leaves
+func (f *fileState) size() uint64 {
+	ret := uint64(0)
+	for _, leaf := range f.leaves {
+		ret += leaf.fileSize
 	}
+	return ret
+}
 
-	root.Links = append(root.Links, links...)
-	rootLink, rootLinkErr := s.persistBlock(ctx, root)
+// persistLeaf - persists given chunk as leaf of file DAG regarding storage's encoding, encrypted with given file
+// key (optional). Stored form of leaf is kept with returned link when erasure coding is enabled.
+func (s *storage) persistLeaf(ctx context.Context, chunk []byte, key *fileKey) (*sizedLink, error) {
+	if s.encoding == DagPBEncoding {
+		return s.persistDagPBLeaf(ctx, chunk)
+	}
+	link, stored, err := s.persistBlockWithData(ctx, chunk, key)
+	if err != nil {
+		return nil, err
+	}
+	ret := &sizedLink{link: link, fileSize: uint64(len(chunk))}
+	if s.erasure.enabled() {
+		ret.stored = stored
+	}
+	return ret, nil
+}
+
+// persistFileRoot - creates and persists root of file DAG with given `name` and leaves of given state. Returns link
+// of root, whose `Tsize` is content size (`BlockPBEncoding`) or cumulative DAG size (`DagPBEncoding`). Parity of
+// leaves is referenced from root when erasure coding is enabled (see `flushStripe`). Root is sealed with file key of
+// given state when encryption is enabled (see `sealNode`).
+func (s *storage) persistFileRoot(ctx context.Context, name string, state *fileState, allowEmpty bool, meta *blockpb.Metadata) (*blockpb.Link, error) {
+	if s.encoding == DagPBEncoding {
+		return s.createDagPBRoot(ctx, state.leaves, allowEmpty, meta)
+	}
+	if len(state.leaves) < 1 && !allowEmpty {
+		return nil, ErrBlockDataEmpty
+	}
+	root := &blockpb.Block{
+		Name:  name,
+		Meta:  meta,
+		Links: make([]*blockpb.Link, 0, len(state.leaves)),
+	}
+	for _, leaf := range state.leaves {
+		root.Links = append(root.Links, leaf.link)
+	}
+	if state.erasure != nil && len(state.leaves) > 0 {
+		if err := s.flushStripe(ctx, state); err != nil {
+			return nil, err
+		}
+		root.Erasure = state.erasure
+	}
+	if state.key != nil {
+		root.Encryption = state.key.encryption()
+	}
+	rootLink, rootLinkErr := s.persistBlock(ctx, root, state.key)
 	if rootLinkErr != nil {
-		return "", rootLinkErr
+		return nil, rootLinkErr
+	}
+	rootLink.Tsize = state.size()
+	return rootLink, nil
+}
+
+// createFile - creates file DAG with given `name` and content of `reader` (see `CreateBlock`). Returns link
+// of root (see `persistFileRoot`). When `allowEmpty` is set, empty content creates root without links instead
+// of `ErrBlockDataEmpty` error. Given metadata (optional) is persisted with root.
+func (s *storage) createFile(ctx context.Context, fname string, reader io.Reader, allowEmpty bool, meta *blockpb.Metadata) (*blockpb.Link, error) {
+	name := strings.TrimSpace(fname)
+	if name == "" {
+		return nil, ErrBlockNameEmpty
+	}
+	if err := s.reserve(ctx, writeSetFrom(ctx), 0, 1); err != nil {
+		return nil, err
+	}
+	key, err := s.newFileKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	state := s.newFileState(key)
+	if err := s.persistLeaves(ctx, s.limitReader(ctx, reader, 0), state, nil); err != nil {
+		return nil, err
 	}
-	return rootLink.Hash, nil
+	return s.persistFileRoot(ctx, name, state, allowEmpty, meta)
 }
@@ -1,16 +1,22 @@
 package blockstorage
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"io/ioutil"
 	"testing"
+	"testing/iotest"
 
 	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage/blockpb"
 	mockpeer "github.com/igumus/blockstorage/peer/mock"
 	"github.com/igumus/go-objectstore-lib"
 	"github.com/igumus/go-objectstore-lib/mock"
 	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
 )
 
@@ -128,3 +134,234 @@ func (s *blockStorageSuite) TestBlockCreation() {
 		})
 	}
 }
+
+func (s *blockStorageSuite) TestChunkBoundaries() {
+	ctx := context.Background()
+	bs := s.newTestStorage()
+	bs.(*storage).chunkSize = 16
+	data := bytes.Repeat([]byte("0123456789"), 4)
+
+	testCases := []struct {
+		name   string
+		create func() (string, error)
+		sizes  []uint64
+	}{
+		{"full_reads", func() (string, error) {
+			return bs.CreateBlock(ctx, "full.txt", bytes.NewReader(data))
+		}, []uint64{16, 16, 8}},
+		// chunks follow reads of reader, so cids of files are same as before
+		{"short_reads", func() (string, error) {
+			return bs.CreateBlock(ctx, "short.txt", iotest.HalfReader(bytes.NewReader(data)))
+		}, []uint64{8, 8, 8, 8, 8}},
+		// content read ahead for content type sniffing not changes chunks
+		{"sniffed", func() (string, error) {
+			return bs.CreateBlockWithMetadata(ctx, "sniffed.txt", nil, bytes.NewReader(data))
+		}, []uint64{16, 16, 8}},
+	}
+	for _, tc := range testCases {
+		s.T().Run(tc.name, func(t *testing.T) {
+			digest, err := tc.create()
+			require.NoError(t, err)
+			root, err := cid.Decode(digest)
+			require.NoError(t, err)
+			rootBlock, err := bs.GetBlock(ctx, root)
+			require.NoError(t, err)
+			sizes := make([]uint64, 0, len(rootBlock.Links))
+			for _, link := range rootBlock.Links {
+				sizes = append(sizes, link.Tsize)
+			}
+			require.Equal(t, tc.sizes, sizes)
+		})
+	}
+}
+
+func (s *blockStorageSuite) TestRawLeafBlockCreation() {
+	ctx := context.Background()
+	storage := s.newTestStorage(EnableRawLeaves())
+
+	data := make([]byte, 0)
+	for i := 0; i < 3; i++ {
+		chunk, err := ioutil.ReadAll(generateRandomByteReader(s.T(), 300<<10))
+		require.NoError(s.T(), err)
+		data = append(data, chunk...)
+	}
+	digest, err := storage.CreateBlock(ctx, "raw.bin", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	rootBlock, err := storage.GetBlock(ctx, root)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), "raw.bin", rootBlock.Name)
+	require.Equal(s.T(), 2, len(rootBlock.Links))
+
+	offset := 0
+	for _, link := range rootBlock.Links {
+		require.Equal(s.T(), blockpb.LinkType_RAW, link.Type)
+		chunk := data[offset : offset+int(link.Tsize)]
+		expected, err := objectstore.DigestPrefix.Sum(chunk)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), expected.String(), link.Hash)
+
+		leaf, err := storage.GetBlock(ctx, expected)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), chunk, leaf.Data)
+		offset += int(link.Tsize)
+	}
+
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), storage.ReadFile(ctx, root, content))
+	require.Equal(s.T(), data, content.Bytes())
+}
+
+func (s *blockStorageSuite) TestRawLeafParsableAsBlock() {
+	ctx := context.Background()
+	storage := s.newTestStorage(EnableRawLeaves())
+
+	// chunk is also a valid binary form of `blockpb.Block`, but raw leaves are never decoded as blocks
+	data := []byte("\x12\x03abc")
+	digest, err := storage.CreateBlock(ctx, "ambiguous.bin", bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), blockpb.BlockCodec, root.Type())
+
+	rootBlock, err := storage.GetBlock(ctx, root)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 1, len(rootBlock.Links))
+	leafID, err := cid.Decode(rootBlock.Links[0].Hash)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(cid.Raw), leafID.Type())
+	leaf, err := storage.GetBlock(ctx, leafID)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), data, leaf.Data)
+	require.Equal(s.T(), 0, len(leaf.Links))
+}
+
+func (s *blockStorageSuite) TestBaselineDAG() {
+	ctx := context.Background()
+	store := newMemoryStore(s.T(), s.ctrl)
+
+	// DAG as written by earlier versions: `blockpb.Block` leaves and root, keyed by store digests (raw cids)
+	chunks := [][]byte{[]byte("first chunk "), []byte("second chunk")}
+	root := &blockpb.Block{Name: "baseline.txt"}
+	for _, chunk := range chunks {
+		bin, err := blockpb.Encode(&blockpb.Block{Data: chunk})
+		require.NoError(s.T(), err)
+		id, err := store.CreateObject(ctx, bytes.NewReader(bin))
+		require.NoError(s.T(), err)
+		root.Links = append(root.Links, &blockpb.Link{Hash: id.String(), Tsize: uint64(len(chunk))})
+	}
+	bin, err := blockpb.Encode(root)
+	require.NoError(s.T(), err)
+	rootID, err := store.CreateObject(ctx, bytes.NewReader(bin))
+	require.NoError(s.T(), err)
+
+	bs := s.newTestStorage(WithLocalStore(store))
+	block, err := bs.GetBlock(ctx, rootID)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), "baseline.txt", block.Name)
+	require.Equal(s.T(), 2, len(block.Links))
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), bs.ReadFile(ctx, rootID, content))
+	require.Equal(s.T(), bytes.Join(chunks, nil), content.Bytes())
+
+	// same chunks are addressed with same cids as before
+	bs.(*storage).chunkSize = len(chunks[0])
+	digest, err := bs.CreateBlock(ctx, "baseline.txt", bytes.NewReader(bytes.Join(chunks, nil)))
+	require.NoError(s.T(), err)
+	id, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(cid.Raw), id.Type())
+	created, err := bs.GetBlock(ctx, id)
+	require.NoError(s.T(), err)
+	for i, link := range created.Links {
+		require.Equal(s.T(), root.Links[i].Hash, link.Hash)
+	}
+}
+
+func (s *blockStorageSuite) TestCidPrefix() {
+	ctx := context.Background()
+	blake3Prefix := cid.Prefix{Version: 1, MhType: mh.BLAKE3, MhLength: -1}
+	v0Prefix := cid.Prefix{Version: 0, MhType: mh.SHA2_256, MhLength: -1}
+
+	testCases := []struct {
+		name     string
+		options  []BlockStorageOption
+		data     string
+		expected string
+		version  uint64
+		mhType   uint64
+	}{
+		{name: "default_prefix", data: "hello world\n", version: 1, mhType: mh.SHA2_256},
+		{name: "blake3_prefix", options: []BlockStorageOption{WithCidPrefix(blake3Prefix)}, data: "hello world\n", version: 1, mhType: mh.BLAKE3},
+		{name: "blake3_raw_leaves", options: []BlockStorageOption{WithCidPrefix(blake3Prefix), EnableRawLeaves()}, data: "hello world\n", version: 1, mhType: mh.BLAKE3},
+		{name: "blake3_dagpb", options: []BlockStorageOption{WithCidPrefix(blake3Prefix), WithEncoding(DagPBEncoding)}, data: "hello world\n", version: 1, mhType: mh.BLAKE3},
+		{
+			name:     "cidv0_dagpb",
+			options:  []BlockStorageOption{WithCidPrefix(v0Prefix), WithEncoding(DagPBEncoding)},
+			data:     "hello world\n",
+			expected: "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o",
+			version:  0,
+			mhType:   mh.SHA2_256,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			storage := s.newTestStorage(append(tc.options, WithDatastore(dssync.MutexWrap(ds.NewMapDatastore())))...)
+			digest, err := storage.CreateBlock(ctx, tc.name, bytes.NewReader([]byte(tc.data)))
+			require.NoError(t, err)
+			if tc.expected != "" {
+				require.Equal(t, tc.expected, digest)
+			}
+			root, err := cid.Decode(digest)
+			require.NoError(t, err)
+			require.Equal(t, tc.version, root.Version())
+			require.Equal(t, tc.mhType, root.Prefix().MhType)
+
+			block, err := storage.GetBlock(ctx, root)
+			require.NoError(t, err)
+			for _, link := range block.Links {
+				child, err := cid.Decode(link.Hash)
+				require.NoError(t, err)
+				require.Equal(t, tc.mhType, child.Prefix().MhType)
+			}
+
+			content := &bytes.Buffer{}
+			require.NoError(t, storage.ReadFile(ctx, root, content))
+			require.Equal(t, tc.data, content.String())
+		})
+	}
+}
+
+func (s *blockStorageSuite) TestMixedCidPrefixes() {
+	ctx := context.Background()
+	store := newMemoryStore(s.T(), s.ctrl)
+	datastore := dssync.MutexWrap(ds.NewMapDatastore())
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+
+	sha256Storage, err := NewFakeBlockStorage(ctx, WithLocalStore(store), WithPeer(peer), WithDatastore(datastore))
+	require.NoError(s.T(), err)
+	blake3Storage, err := NewFakeBlockStorage(ctx, WithLocalStore(store), WithPeer(peer), WithDatastore(datastore),
+		WithCidPrefix(cid.Prefix{Version: 1, MhType: mh.BLAKE3, MhLength: -1}))
+	require.NoError(s.T(), err)
+
+	sha256Digest, err := sha256Storage.CreateBlock(ctx, "sha256.txt", bytes.NewReader([]byte("sha256 content")))
+	require.NoError(s.T(), err)
+	blake3Digest, err := blake3Storage.CreateBlock(ctx, "blake3.txt", bytes.NewReader([]byte("blake3 content")))
+	require.NoError(s.T(), err)
+
+	for _, storage := range []BlockStorage{sha256Storage, blake3Storage} {
+		for digest, expected := range map[string]string{sha256Digest: "sha256 content", blake3Digest: "blake3 content"} {
+			root, err := cid.Decode(digest)
+			require.NoError(s.T(), err)
+			content := &bytes.Buffer{}
+			require.NoError(s.T(), storage.ReadFile(ctx, root, content))
+			require.Equal(s.T(), expected, content.String())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package blockstorage
+
+import (
+	"context"
+	"io"
+	"log"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// lifecycleKey - context key which marks context of public operation already recorded as in-flight
+type lifecycleKey struct{}
+
+// enter - records public operation as in-flight, which `Stop` drains. Returned context marks the operation, so
+// public operations called by it (e.g. `GetBlock` in `ReadFile`) are not recorded again and are not refused while
+// storage is stopping. Returned context is also cancelled when `Stop` gives up draining, so operations stop using
+// resources before they are closed. Caller should call returned function when operation completes.
+//
+// Error:
+// When storage is stopped returns `ErrStorageStopped`
+func (s *storage) enter(ctx context.Context) (context.Context, func(), error) {
+	if ctx.Value(lifecycleKey{}) == s {
+		return ctx, func() {}, nil
+	}
+	s.lifecycleLock.Lock()
+	defer s.lifecycleLock.Unlock()
+	if s.stopped {
+		return ctx, nil, ErrStorageStopped
+	}
+	s.inflight.Add(1)
+	opCtx, cancel := context.WithCancel(context.WithValue(ctx, lifecycleKey{}, s))
+	go func() {
+		select {
+		case <-s.operations.Done():
+			cancel()
+		case <-opCtx.Done():
+		}
+	}()
+	return opCtx, func() {
+		cancel()
+		s.inflight.Done()
+	}, nil
+}
+
+// Stop - stops storage, further operations fail with `ErrStorageStopped`.
+//
+// Flow:
+// 1. Refuses new operations, and cancels background services (e.g. replication checks, see `Replicate`)
+// 2. Waits for in-flight operations (e.g. `CreateBlock`, `GetBlock`) and background services until given context
+// is done. Then operations still in-flight are cancelled, and waited until they return, so resources are not
+// closed under them.
+// 3. Closes peer, which unregisters read protocol and waits for served streams and block fetches (see `peer.Close`)
+// 4. Syncs and closes datastore
+// 5. Closes local object store, when it is closable
+//
+// Error:
+// - When storage is already stopped returns `ErrStorageStopped`
+// - When given context is done before in-flight operations complete, or any resource fails to close, returns
+// `*StopError` with all error causes. Resources are closed anyway, after cancelled operations return.
+func (s *storage) Stop(ctx context.Context) error {
+	s.lifecycleLock.Lock()
+	if s.stopped {
+		s.lifecycleLock.Unlock()
+		return ErrStorageStopped
+	}
+	s.stopped = true
+	s.lifecycleLock.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	var errs []error
+	drained := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		s.background.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Printf("warn: draining in-flight operations failed, cancelling them: %s\n", ctx.Err().Error())
+		errs = append(errs, ctx.Err())
+		s.cancelOperations()
+		<-drained
+	}
+
+	if s.peer != nil {
+		if err := s.peer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if s.datastore != nil {
+		// resources are closed even when draining timed out, so closing is not bound to given context
+		if err := s.datastore.Sync(context.Background(), ds.NewKey("/")); err != nil {
+			errs = append(errs, err)
+		}
+		if err := s.datastore.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if closer, ok := s.lstore.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &StopError{Errors: errs}
+	}
+	log.Println("info: blockstorage service stopped")
+	return nil
+}
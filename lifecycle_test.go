@@ -0,0 +1,136 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingReader - reader which signals its first read, and blocks until released
+type blockingReader struct {
+	reading chan struct{}
+	release chan struct{}
+	r       io.Reader
+}
+
+func newBlockingReader(data []byte) *blockingReader {
+	return &blockingReader{reading: make(chan struct{}), release: make(chan struct{}), r: bytes.NewReader(data)}
+}
+
+func (b *blockingReader) Read(p []byte) (int, error) {
+	select {
+	case <-b.reading:
+	default:
+		close(b.reading)
+	}
+	<-b.release
+	return b.r.Read(p)
+}
+
+// newStoppableStorage - creates storage with mock peer which expects to be closed once
+func (s *blockStorageSuite) newStoppableStorage() BlockStorage {
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	peer.EXPECT().Close().Times(1).Return(nil)
+	return s.newTestStorage(WithPeer(peer))
+}
+
+func (s *blockStorageSuite) TestStop() {
+	ctx := context.Background()
+	bs := s.newStoppableStorage()
+	digest, err := bs.CreateBlock(ctx, "existing.txt", bytes.NewReader([]byte("selam")))
+	require.NoError(s.T(), err)
+	id, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	reader := newBlockingReader([]byte("in-flight"))
+	created := make(chan error)
+	go func() {
+		_, err := bs.CreateBlock(ctx, "inflight.txt", reader)
+		created <- err
+	}()
+	<-reader.reading
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- bs.Stop(ctx)
+	}()
+	select {
+	case <-stopped:
+		s.T().Fatal("stop returned before in-flight operation completed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// new operations are refused while in-flight operations are drained
+	_, err = bs.GetBlock(ctx, id)
+	require.Equal(s.T(), ErrStorageStopped, err)
+	_, err = bs.CreateBlock(ctx, "refused.txt", bytes.NewReader([]byte("refused")))
+	require.Equal(s.T(), ErrStorageStopped, err)
+
+	close(reader.release)
+	require.NoError(s.T(), <-created)
+	require.NoError(s.T(), <-stopped)
+
+	require.Equal(s.T(), ErrStorageStopped, bs.ReadFile(ctx, id, ioutil.Discard))
+	require.Equal(s.T(), ErrStorageStopped, bs.Stop(ctx))
+}
+
+func (s *blockStorageSuite) TestStopTimeout() {
+	ctx := context.Background()
+	bs := s.newStoppableStorage()
+
+	reader := newBlockingReader([]byte("in-flight"))
+	created := make(chan error)
+	go func() {
+		_, err := bs.CreateBlock(ctx, "inflight.txt", reader)
+		created <- err
+	}()
+	<-reader.reading
+
+	// peer and stores are closed, even when draining times out, but only after cancelled operation returns
+	stopCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	stopped := make(chan error)
+	go func() {
+		stopped <- bs.Stop(stopCtx)
+	}()
+	select {
+	case <-stopped:
+		s.T().Fatal("stop returned before cancelled operation returned")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	close(reader.release)
+	require.True(s.T(), errors.Is(<-created, context.Canceled))
+	err := <-stopped
+	require.Error(s.T(), err)
+	require.True(s.T(), errors.Is(err, context.DeadlineExceeded))
+	stopErr := &StopError{}
+	require.True(s.T(), errors.As(err, &stopErr))
+	require.Len(s.T(), stopErr.Errors, 1)
+}
+
+func (s *blockStorageSuite) TestNewBlockStorageWithoutDatastore() {
+	ctx := context.Background()
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	peer.EXPECT().RegisterReadProtocol(gomock.Any(), gomock.Any()).Times(1)
+	peer.EXPECT().RegisterPushProtocol(gomock.Any(), gomock.Any()).Times(1)
+	peer.EXPECT().Start(gomock.Any()).Times(1).Return(nil)
+	peer.EXPECT().Close().Times(1).Return(nil)
+
+	// state which should survive restart is not configured, so in-memory datastore is enough
+	bs, err := NewBlockStorage(ctx, WithLocalStore(newMemoryStore(s.T(), s.ctrl)), WithPeer(peer))
+	require.NoError(s.T(), err)
+	_, err = bs.CreateBlock(ctx, "memory.txt", bytes.NewReader([]byte("selam")))
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), bs.Stop(ctx))
+}
@@ -0,0 +1,263 @@
+package blockstorage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/util"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"google.golang.org/protobuf/proto"
+)
+
+// filesNamespace - holds datastore namespace of file index (roots created via `CreateBlock`)
+const filesNamespace = "/blockstorage/files"
+
+// sniffLen - holds max length of content used to sniff content type (same as `http.DetectContentType`)
+const sniffLen = 512
+
+// BlockFilter - captures/represents filter of `ListBlocks`. Empty fields match any file.
+type BlockFilter struct {
+	// NamePrefix - matches files whose name starts with given prefix
+	NamePrefix string
+	// ContentType - matches files with given media type (parameters are ignored, e.g. "text/plain" matches
+	// "text/plain; charset=utf-8"). Type ending with "/" matches all subtypes (e.g. "image/").
+	ContentType string
+	// Attributes - matches files which have all given attributes with same values
+	Attributes map[string]string
+}
+
+// Match - checks given file stat matches with filter
+func (f BlockFilter) Match(stat *blockpb.BlockStat) bool {
+	if !strings.HasPrefix(stat.GetName(), f.NamePrefix) {
+		return false
+	}
+	if f.ContentType != "" {
+		contentType := stat.GetMeta().GetContentType()
+		if strings.HasSuffix(f.ContentType, "/") {
+			if !strings.HasPrefix(contentType, f.ContentType) {
+				return false
+			}
+		} else if mediaType(contentType) != mediaType(f.ContentType) {
+			return false
+		}
+	}
+	attributes := stat.GetMeta().GetAttributes()
+	for key, value := range f.Attributes {
+		if actual, ok := attributes[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// mediaType - returns media type of given content type without parameters
+func mediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// hasExtendedMetadata - checks given metadata has fields which can not be represented in UnixFS
+func hasExtendedMetadata(meta *blockpb.Metadata) bool {
+	return len(meta.GetAttributes()) > 0 || meta.GetContentType() != "" || meta.GetCtime() != 0 || meta.GetCtimeNsecs() != 0
+}
+
+// fileIndexKey - returns datastore key of file index entry of given root cid
+func fileIndexKey(id cid.Cid) ds.Key {
+	return ds.NewKey(filesNamespace).ChildString(id.String())
+}
+
+// fileMetadata - validates given metadata is representable with storage's encoding, and returns its copy. With
+// `BlockPBEncoding` creation time of copy is set to current time when not given.
+func (s *storage) fileMetadata(meta *blockpb.Metadata) (*blockpb.Metadata, error) {
+	if s.encoding == DagPBEncoding && hasExtendedMetadata(meta) {
+		return nil, ErrMetadataNotSupported
+	}
+	if meta != nil {
+		meta = proto.Clone(meta).(*blockpb.Metadata)
+	}
+	if s.encoding == BlockPBEncoding {
+		if meta == nil {
+			meta = &blockpb.Metadata{}
+		}
+		if meta.Ctime == 0 && meta.CtimeNsecs == 0 {
+			now := time.Now()
+			meta.Ctime = now.Unix()
+			meta.CtimeNsecs = uint32(now.Nanosecond())
+		}
+	}
+	return meta, nil
+}
+
+// sniffContentType - sets content type of given metadata from given leading content (see
+// `http.DetectContentType`), when metadata has no content type (`BlockPBEncoding` only).
+func (s *storage) sniffContentType(meta *blockpb.Metadata, head []byte) {
+	if s.encoding != BlockPBEncoding || meta.ContentType != "" || len(head) < 1 {
+		return
+	}
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	meta.ContentType = http.DetectContentType(head)
+}
+
+// Captures/Represents reader which sniffs content type from first read content (see `sniffContentType`). Content
+// is not read ahead, so chunk boundaries are same as reading underlying reader directly.
+type sniffReader struct {
+	reader io.Reader
+	sniff  func([]byte)
+}
+
+func (r *sniffReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 && r.sniff != nil {
+		r.sniff(p[:n])
+		r.sniff = nil
+	}
+	return n, err
+}
+
+// indexFile - adds file with given root link to file index (see `ListBlocks`)
+func (s *storage) indexFile(ctx context.Context, link *blockpb.Link) error {
+	id, err := cid.Decode(link.Hash)
+	if err != nil {
+		return err
+	}
+	return s.datastore.Put(ctx, fileIndexKey(id), []byte{})
+}
+
+// CreateBlockWithMetadata - creates file with given `name`, metadata and content (see `CreateBlock`).
+//
+// Flow:
+// 1. Validates metadata is representable with storage's encoding
+// 2. Completes metadata (`BlockPBEncoding` only)
+// 	2.1. sniffs content type (see `http.DetectContentType`) from first chunk of content when not given
+// 	2.2. sets creation time to current time when not given
+// 3. Creates file DAG, whose root carries metadata
+// 4. Adds root to file index (see `ListBlocks`)
+//
+// Error:
+// - When `DagPBEncoding` used with attributes, content type or creation time returns `"", ErrMetadataNotSupported`
+// - Otherwise returns `CreateBlock` errors
+// Nodes persisted until failure are removed from permanent store (see `transaction`).
+func (s *storage) CreateBlockWithMetadata(ctx context.Context, fname string, meta *blockpb.Metadata, reader io.Reader) (string, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return "", stopErr
+	}
+	defer done()
+	meta, err := s.fileMetadata(meta)
+	if err != nil {
+		return "", err
+	}
+	if s.encoding == BlockPBEncoding && meta.ContentType == "" {
+		reader = &sniffReader{reader: reader, sniff: func(head []byte) {
+			s.sniffContentType(meta, head)
+		}}
+	}
+
+	link, err := s.transaction(ctx, func(ctx context.Context) (*blockpb.Link, error) {
+		link, err := s.createFile(ctx, fname, reader, false, meta)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.indexFile(ctx, link); err != nil {
+			return nil, err
+		}
+		return link, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return link.Hash, nil
+}
+
+// Stat - returns stat (name, type, size and metadata) of block with given cid. Size is content size for files,
+// and sum of entry sizes for directories.
+//
+// Error:
+// When reading block fails returns `nil` with error cause (see `GetBlock`)
+func (s *storage) Stat(ctx context.Context, id cid.Cid) (*blockpb.BlockStat, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	defer done()
+	block, err := s.GetBlock(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ret := &blockpb.BlockStat{
+		Cid:  id.String(),
+		Name: block.Name,
+		Type: block.Type,
+		Meta: block.Meta,
+	}
+	if block.Type == blockpb.BlockType_DIRECTORY {
+		for _, link := range block.Links {
+			ret.Size += link.Tsize
+		}
+		return ret, nil
+	}
+	ret.Size, err = s.fileSize(ctx, id, block)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListBlocks - returns stats of files created via `CreateBlock` (or `CreateBlockWithMetadata`) and named roots
+// imported via `ImportCAR`, which match given filter, ordered by name (and cid for same names).
+//
+// Flow:
+// 1. Iterates file index in datastore
+// 2. Reads stat of each file (see `Stat`), and collects stats matching with filter
+//
+// Error:
+// When querying datastore or reading any file fails returns `nil` with error cause
+func (s *storage) ListBlocks(ctx context.Context, filter BlockFilter) ([]*blockpb.BlockStat, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	defer done()
+	results, err := s.datastore.Query(ctx, query.Query{Prefix: filesNamespace, KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	ret := make([]*blockpb.BlockStat, 0)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		ctxErr := util.CheckContext(ctx)
+		if ctxErr != nil {
+			return nil, ctxErr
+		}
+		id, err := cid.Decode(ds.RawKey(result.Key).BaseNamespace())
+		if err != nil {
+			return nil, ErrBlockIdentifierNotValid
+		}
+		stat, err := s.Stat(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if filter.Match(stat) {
+			ret = append(ret, stat)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Name != ret[j].Name {
+			return ret[i].Name < ret[j].Name
+		}
+		return ret[i].Cid < ret[j].Cid
+	})
+	return ret, nil
+}
@@ -0,0 +1,180 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestCreateBlockWithMetadata() {
+	ctx := context.Background()
+	ctime := time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	testCases := []struct {
+		name        string
+		options     []BlockStorageOption
+		data        []byte
+		meta        *blockpb.Metadata
+		contentType string
+		attributes  map[string]string
+		ctime       *time.Time
+		err         error
+	}{
+		{name: "sniffed_text", data: []byte("hello world\n"), contentType: "text/plain; charset=utf-8"},
+		{name: "sniffed_png", data: append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 600)...), contentType: "image/png"},
+		{
+			name:        "client_provided",
+			data:        []byte("{}"),
+			meta:        &blockpb.Metadata{ContentType: "application/json", Attributes: map[string]string{"owner": "alice"}, Ctime: ctime.Unix(), CtimeNsecs: 6},
+			contentType: "application/json",
+			attributes:  map[string]string{"owner": "alice"},
+			ctime:       &ctime,
+		},
+		{
+			name:    "dagpb_mode_mtime",
+			options: []BlockStorageOption{WithEncoding(DagPBEncoding)},
+			data:    []byte("hello world\n"),
+			meta:    &blockpb.Metadata{Mode: 0600, Mtime: ctime.Unix()},
+		},
+		{
+			name:    "dagpb_attributes",
+			options: []BlockStorageOption{WithEncoding(DagPBEncoding)},
+			data:    []byte("hello world\n"),
+			meta:    &blockpb.Metadata{Attributes: map[string]string{"owner": "alice"}},
+			err:     ErrMetadataNotSupported,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			bs := s.newTestStorage(tc.options...)
+			bs.(*storage).chunkSize = 256
+			before := time.Now()
+			digest, err := bs.CreateBlockWithMetadata(ctx, tc.name, tc.meta, bytes.NewReader(tc.data))
+			require.Equal(t, tc.err, err)
+			if tc.err != nil {
+				return
+			}
+			id, err := cid.Decode(digest)
+			require.NoError(t, err)
+
+			block, err := bs.GetBlock(ctx, id)
+			require.NoError(t, err)
+			require.NotNil(t, block.Meta)
+			require.Equal(t, tc.meta.GetMode(), block.Meta.Mode)
+			require.Equal(t, tc.meta.GetMtime(), block.Meta.Mtime)
+			require.Equal(t, tc.contentType, block.Meta.ContentType)
+			require.Equal(t, len(tc.attributes), len(block.Meta.Attributes))
+			for key, value := range tc.attributes {
+				require.Equal(t, value, block.Meta.Attributes[key])
+			}
+			switch {
+			case tc.ctime != nil:
+				require.True(t, tc.ctime.Equal(time.Unix(block.Meta.Ctime, int64(block.Meta.CtimeNsecs))))
+			case bs.(*storage).encoding == BlockPBEncoding:
+				created := time.Unix(block.Meta.Ctime, int64(block.Meta.CtimeNsecs))
+				require.False(t, created.Before(before.Truncate(time.Second)))
+			default:
+				require.Equal(t, int64(0), block.Meta.Ctime)
+			}
+
+			content := &bytes.Buffer{}
+			require.NoError(t, bs.ReadFile(ctx, id, content))
+			require.Equal(t, tc.data, content.Bytes())
+		})
+	}
+}
+
+func (s *blockStorageSuite) TestStat() {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, encoding := range []Encoding{BlockPBEncoding, DagPBEncoding} {
+		bs := s.newTestStorage(WithEncoding(encoding))
+		bs.(*storage).chunkSize = 64
+
+		digest, err := bs.CreateBlock(ctx, "file.txt", bytes.NewReader(data))
+		require.NoError(s.T(), err)
+		file, err := cid.Decode(digest)
+		require.NoError(s.T(), err)
+
+		stat, err := bs.Stat(ctx, file)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), digest, stat.Cid)
+		require.Equal(s.T(), blockpb.BlockType_FILE, stat.Type)
+		require.Equal(s.T(), uint64(len(data)), stat.Size)
+		if encoding == BlockPBEncoding {
+			require.Equal(s.T(), "file.txt", stat.Name)
+			require.Equal(s.T(), "text/plain; charset=utf-8", stat.Meta.ContentType)
+		}
+
+		dirDigest, err := bs.CreateDirectory(ctx, "dir", []*blockpb.Link{{Hash: digest, Name: "file.txt", Tsize: 10}})
+		require.NoError(s.T(), err)
+		dir, err := cid.Decode(dirDigest)
+		require.NoError(s.T(), err)
+		stat, err = bs.Stat(ctx, dir)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), blockpb.BlockType_DIRECTORY, stat.Type)
+		require.Equal(s.T(), uint64(10), stat.Size)
+	}
+}
+
+func (s *blockStorageSuite) TestListBlocks() {
+	ctx := context.Background()
+	bs := s.newTestStorage()
+
+	files := []struct {
+		name string
+		data string
+		meta *blockpb.Metadata
+	}{
+		{name: "docs/a.txt", data: "a", meta: &blockpb.Metadata{Attributes: map[string]string{"owner": "alice", "team": "core"}}},
+		{name: "docs/b.json", data: "{}", meta: &blockpb.Metadata{ContentType: "application/json", Attributes: map[string]string{"owner": "bob"}}},
+		{name: "images/c.png", data: "\x89PNG\x0D\x0A\x1A\x0A", meta: &blockpb.Metadata{Attributes: map[string]string{"owner": "alice"}}},
+	}
+	digests := make(map[string]string)
+	for _, f := range files {
+		digest, err := bs.CreateBlockWithMetadata(ctx, f.name, f.meta, bytes.NewReader([]byte(f.data)))
+		require.NoError(s.T(), err)
+		digests[f.name] = digest
+	}
+	// directories and tree members are not part of file index
+	_, err := bs.CreateDirectory(ctx, "docs", []*blockpb.Link{{Hash: digests["docs/a.txt"], Name: "a.txt"}})
+	require.NoError(s.T(), err)
+
+	testCases := []struct {
+		name     string
+		filter   BlockFilter
+		expected []string
+	}{
+		{name: "all", expected: []string{"docs/a.txt", "docs/b.json", "images/c.png"}},
+		{name: "name_prefix", filter: BlockFilter{NamePrefix: "docs/"}, expected: []string{"docs/a.txt", "docs/b.json"}},
+		{name: "content_type", filter: BlockFilter{ContentType: "text/plain"}, expected: []string{"docs/a.txt"}},
+		{name: "content_type_prefix", filter: BlockFilter{ContentType: "image/"}, expected: []string{"images/c.png"}},
+		{name: "attribute", filter: BlockFilter{Attributes: map[string]string{"owner": "alice"}}, expected: []string{"docs/a.txt", "images/c.png"}},
+		{name: "attributes", filter: BlockFilter{Attributes: map[string]string{"owner": "alice", "team": "core"}}, expected: []string{"docs/a.txt"}},
+		{name: "combined", filter: BlockFilter{NamePrefix: "images/", Attributes: map[string]string{"owner": "bob"}}, expected: []string{}},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			stats, err := bs.ListBlocks(ctx, tc.filter)
+			require.NoError(t, err)
+			names := make([]string, 0, len(stats))
+			for _, stat := range stats {
+				require.Equal(t, digests[stat.Name], stat.Cid)
+				names = append(names, stat.Name)
+			}
+			require.Equal(t, tc.expected, names)
+		})
+	}
+}
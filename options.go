@@ -2,9 +2,15 @@ package blockstorage
 
 import (
 	"errors"
+	"time"
 
+	"github.com/igumus/blockstorage/blockpb"
 	"github.com/igumus/blockstorage/peer"
 	"github.com/igumus/go-objectstore-lib"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
 )
 
 // ErrLocalObjectStoreNotDefined is return when local objectstore not specified while constructing `BlockStorage` service
@@ -13,9 +19,99 @@ var ErrLocalObjectStoreNotDefined = errors.New("[blockstorage] block storage con
 // ErrPeerNotSpecified is return when peer not specified while constructing `BlockStorage` service
 var ErrPeerNotSpecified = errors.New("[blockstorage] block storage configuration failed: peer instance not specified")
 
+// ErrEncodingNotSupported is return when specified block encoding is not known
+var ErrEncodingNotSupported = errors.New("[blockstorage] block storage configuration failed: encoding not supported")
+
+// ErrCidPrefixNotSupported is return when specified cid prefix not supported (e.g. unknown hash function,
+// or CIDv0 without `DagPBEncoding`)
+var ErrCidPrefixNotSupported = errors.New("[blockstorage] block storage configuration failed: cid prefix not supported")
+
+// ErrDatastoreNotSpecified is return when datastore option is used with nil datastore
+var ErrDatastoreNotSpecified = errors.New("[blockstorage] block storage configuration failed: datastore not specified")
+
+// ErrDatastoreNotPersistent is return when configuration keeps state which should survive restart (e.g. cid
+// mappings of blocks addressed differently from permanent store, caller usage of quotas) without datastore
+// specified via `WithDatastore`
+var ErrDatastoreNotPersistent = errors.New("[blockstorage] block storage configuration failed: persistent datastore not specified")
+
+// ErrUploadTTLNotValid is return when specified upload session ttl is not positive
+var ErrUploadTTLNotValid = errors.New("[blockstorage] block storage configuration failed: upload ttl should be positive")
+
+// ErrWorkersNotValid is return when specified chunk persistence worker count is not positive
+var ErrWorkersNotValid = errors.New("[blockstorage] block storage configuration failed: worker count should be positive")
+
+// ErrReplicationIntervalNotValid is return when specified replication check interval is not positive
+var ErrReplicationIntervalNotValid = errors.New("[blockstorage] block storage configuration failed: replication interval should be positive")
+
+// ErrErasureShardsNotValid is return when specified erasure coding shard counts are not valid
+var ErrErasureShardsNotValid = errors.New("[blockstorage] block storage configuration failed: erasure coding shards not valid")
+
+// ErrErasureCodingNotSupported is return when erasure coding is used with `DagPBEncoding`
+var ErrErasureCodingNotSupported = errors.New("[blockstorage] block storage configuration failed: erasure coding not supported by encoding")
+
+// ErrCompressionNotValid is return when specified compression codec or addressing is not known
+var ErrCompressionNotValid = errors.New("[blockstorage] block storage configuration failed: compression not valid")
+
+// ErrCompressionNotSupported is return when compression is used with raw leaves or `DagPBEncoding`, whose leaves
+// can not record compression codec
+var ErrCompressionNotSupported = errors.New("[blockstorage] block storage configuration failed: compression not supported by leaf encoding")
+
+// ErrEncryptionNotValid is return when encryption is enabled without key provider, or with unknown mode
+var ErrEncryptionNotValid = errors.New("[blockstorage] block storage configuration failed: encryption not valid")
+
+// ErrEncryptionNotSupported is return when encryption is used with raw leaves or `DagPBEncoding`, whose leaves
+// can not record encryption
+var ErrEncryptionNotSupported = errors.New("[blockstorage] block storage configuration failed: encryption not supported by leaf encoding")
+
+// maxErasureShards handles max total count of data and parity shards of a stripe (Reed-Solomon over GF(2^8))
+const maxErasureShards = 256
+
 // defaultChunkSize handles default size in KB
 const defaultChunkSize = 512 << 10
 
+// defaultWorkers handles default count of workers which persist chunks of a file in parallel
+const defaultWorkers = 4
+
+// defaultUploadTTL handles default inactivity duration after which upload sessions expire
+const defaultUploadTTL = 24 * time.Hour
+
+// defaultReplicationInterval handles default interval of checking replicas of designated roots
+const defaultReplicationInterval = 10 * time.Minute
+
+// Encoding - represents binary form of blocks created by `BlockStorage`
+type Encoding int
+
+const (
+	// BlockPBEncoding - blocks are encoded as `blockpb.Block`, and addressed with CIDv1 raw cids (nodes of DAGs with
+	// raw leaves with cids of `blockpb.BlockCodec`, see `EnableRawLeaves`) (default)
+	BlockPBEncoding Encoding = iota
+	// DagPBEncoding - IPFS compatible encoding. Leaves are raw blocks (dag-pb nodes with CIDv0), other nodes are
+	// dag-pb nodes with UnixFS data, composed in balanced layout.
+	DagPBEncoding
+)
+
+// Addressing - represents which binary form of compressed leaves is addressed by their cids
+type Addressing int
+
+const (
+	// CompressedAddressing - cids of leaves are digests of stored (compressed) blocks (default)
+	CompressedAddressing Addressing = iota
+	// OriginalAddressing - cids of leaves are digests of blocks before compression, so DAGs are addressed with same
+	// cids regardless of compression. Stored blocks are verified after decompression (see `blockpb.Verify`).
+	OriginalAddressing
+)
+
+// EncryptionMode - represents how data keys of encrypted leaves are chosen
+type EncryptionMode int
+
+const (
+	// FileKeyEncryption - each file is encrypted with own random data key (default)
+	FileKeyEncryption EncryptionMode = iota
+	// ConvergentEncryption - each leaf is encrypted with data key derived from its content (keyed with key-encryption
+	// key), so same content is stored as same block and deduplication is preserved
+	ConvergentEncryption
+)
+
 // A BlockStorageOption sets options.
 type BlockStorageOption func(*blockstorageConfig)
 
@@ -24,7 +120,46 @@ type blockstorageConfig struct {
 	lstore    objectstore.ObjectStore
 	debugMode bool
 	chunkSize int
+	encoding  Encoding
+	rawLeaves bool
+	prefix    cid.Prefix
+	datastore ds.Datastore
+	uploadTTL time.Duration
+	workers   int
+	maxSize   uint64
+	quota     quota
 	peer      peer.BlockStoragePeer
+
+	replicationInterval time.Duration
+	erasure             erasure
+	compression         blockpb.Compression
+	addressing          Addressing
+	encryption          bool
+	keys                KeyProvider
+	encryptionMode      EncryptionMode
+	cacheSize           uint64
+	// datastore is specified via `WithDatastore`, otherwise it is in-memory
+	persistent bool
+}
+
+// validatePrefix - validates cid prefix is usable with given encoding. CIDv0 is only defined for dag-pb
+// (sha2-256) nodes, and hash function should be registered to multihash library.
+func validatePrefix(p cid.Prefix, e Encoding) error {
+	switch p.Version {
+	case 0:
+		if e != DagPBEncoding || p.MhType != mh.SHA2_256 {
+			return ErrCidPrefixNotSupported
+		}
+		p.Codec = cid.DagProtobuf
+	case 1:
+		p.Codec = cid.Raw
+	default:
+		return ErrCidPrefixNotSupported
+	}
+	if _, err := p.Sum([]byte{}); err != nil {
+		return ErrCidPrefixNotSupported
+	}
+	return nil
 }
 
 // validate - validates given `blockstorageConfig` instance
@@ -35,6 +170,61 @@ func validate(s *blockstorageConfig) error {
 	if s.peer == nil {
 		return ErrPeerNotSpecified
 	}
+	if s.encoding != BlockPBEncoding && s.encoding != DagPBEncoding {
+		return ErrEncodingNotSupported
+	}
+	if s.datastore == nil {
+		return ErrDatastoreNotSpecified
+	}
+	if s.uploadTTL <= 0 {
+		return ErrUploadTTLNotValid
+	}
+	if s.workers < 1 {
+		return ErrWorkersNotValid
+	}
+	if s.replicationInterval <= 0 {
+		return ErrReplicationIntervalNotValid
+	}
+	if s.erasure.enabled() {
+		if s.erasure.parityShards < 1 || s.erasure.dataShards+s.erasure.parityShards > maxErasureShards {
+			return ErrErasureShardsNotValid
+		}
+		if s.encoding == DagPBEncoding {
+			return ErrErasureCodingNotSupported
+		}
+	} else if s.erasure.parityShards != 0 || s.erasure.dataShards < 0 {
+		return ErrErasureShardsNotValid
+	}
+	if _, ok := blockpb.Compression_name[int32(s.compression)]; !ok {
+		return ErrCompressionNotValid
+	}
+	if s.addressing != CompressedAddressing && s.addressing != OriginalAddressing {
+		return ErrCompressionNotValid
+	}
+	if s.compression != blockpb.Compression_NONE && (s.rawLeaves || s.encoding == DagPBEncoding) {
+		return ErrCompressionNotSupported
+	}
+	if s.encryption {
+		if s.keys == nil || (s.encryptionMode != FileKeyEncryption && s.encryptionMode != ConvergentEncryption) {
+			return ErrEncryptionNotValid
+		}
+		if s.rawLeaves || s.encoding == DagPBEncoding {
+			return ErrEncryptionNotSupported
+		}
+	}
+	if err := validatePrefix(s.prefix, s.encoding); err != nil {
+		return err
+	}
+	// mappings of cids to permanent store keys are kept in datastore, blocks are unreadable after restart without them
+	mapped := s.prefix.MhType != objectstore.DigestPrefix.MhType ||
+		(s.compression != blockpb.Compression_NONE && s.addressing == OriginalAddressing)
+	if mapped && !s.persistent {
+		return ErrDatastoreNotPersistent
+	}
+	// usage of callers would reset on restart
+	if (s.quota.bytes > 0 || s.quota.objects > 0) && !s.persistent {
+		return ErrDatastoreNotPersistent
+	}
 	return nil
 }
 
@@ -45,6 +235,14 @@ func defaultBlockstorageConfig() *blockstorageConfig {
 		peer:      nil,
 		debugMode: false,
 		chunkSize: defaultChunkSize,
+		encoding:  BlockPBEncoding,
+		rawLeaves: false,
+		prefix:    objectstore.DigestPrefix,
+		datastore: dssync.MutexWrap(ds.NewMapDatastore()),
+		uploadTTL: defaultUploadTTL,
+		workers:   defaultWorkers,
+
+		replicationInterval: defaultReplicationInterval,
 	}
 }
 
@@ -79,3 +277,142 @@ func EnableDebugMode() BlockStorageOption {
 		bc.debugMode = true
 	}
 }
+
+// WithEncoding returns a BlockStorageOption that specifies binary form of created blocks.
+// If not specified default value is `BlockPBEncoding`
+func WithEncoding(e Encoding) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.encoding = e
+	}
+}
+
+// EnableRawLeaves returns a BlockStorageOption that stores leaf blocks (chunks) as raw bytes, so leaf cid is digest
+// of chunk itself. Only interior/root nodes are encoded as `blockpb.Block`, and addressed with cids of
+// `blockpb.BlockCodec`, so raw cids given to `GetBlock` are read as raw leaves. Has no effect with `DagPBEncoding`,
+// since its leaves are always raw.
+func EnableRawLeaves() BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.rawLeaves = true
+	}
+}
+
+// WithCidPrefix returns a BlockStorageOption that specifies cid version and hash function of created blocks
+// (e.g. sha2-256 vs. blake3, CIDv0 vs. CIDv1). Codec of prefix is ignored, since it is determined by kind of
+// block (raw vs. dag-pb). CIDv0 is only supported with `DagPBEncoding`, in which case leaves are dag-pb nodes.
+// If not specified default value is `objectstore.DigestPrefix` (CIDv1, sha2-256)
+func WithCidPrefix(p cid.Prefix) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.prefix = p
+	}
+}
+
+// WithDatastore returns a BlockStorageOption that specifies persistent datastore which keeps mappings of cids to
+// permanent store keys, for blocks whose hash function differs from permanent store's (see `WithCidPrefix`) or
+// which are addressed with original form (see `OriginalAddressing`), upload sessions (see `StartUpload`),
+// write-ahead log of operations (see `recoverWriteSets`) and usage of callers (see `WithQuota`). Required by quotas
+// and mapped cids, so such state survives restart.
+// If not specified, datastore is in-memory (upload sessions and write-ahead log do not survive restart)
+func WithDatastore(d ds.Datastore) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.datastore = d
+		bc.persistent = true
+	}
+}
+
+// WithUploadTTL returns a BlockStorageOption that specifies inactivity duration after which upload sessions
+// (see `StartUpload`) expire, and their persisted chunks are released.
+// If not specified default value is 24 hours
+func WithUploadTTL(d time.Duration) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.uploadTTL = d
+	}
+}
+
+// WithWorkers returns a BlockStorageOption that specifies count of workers which hash and persist chunks of a file
+// in parallel (see `persistLeaves`). Chunks kept in memory per file are bounded to about twice the worker count.
+// Single worker persists chunks sequentially.
+// If not specified default value is 4
+func WithWorkers(n int) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.workers = n
+	}
+}
+
+// WithMaxFileSize returns a BlockStorageOption that specifies max content size of a file in bytes. Files exceeding
+// the size are rejected with `ErrFileTooLarge` as content arrives.
+// If not specified (or zero) file size is unlimited
+func WithMaxFileSize(n uint64) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.maxSize = n
+	}
+}
+
+// WithQuota returns a BlockStorageOption that specifies byte and object (file) quota of each caller (see
+// `WithCaller`). Operations exceeding the quota are rejected with `ErrQuotaExceeded` as content arrives. Zero
+// limit means unlimited. Operations without caller are not limited. Usage is kept in datastore, so quotas require
+// `WithDatastore`.
+// If not specified quotas are unlimited
+func WithQuota(bytes, objects uint64) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.quota = quota{bytes: bytes, objects: objects}
+	}
+}
+
+// WithReplicationInterval returns a BlockStorageOption that specifies how often replicas of designated roots (see
+// `Replicate`) are checked via provider queries, and roots missing replicas are re-replicated.
+// If not specified default value is 10 minutes
+func WithReplicationInterval(d time.Duration) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.replicationInterval = d
+	}
+}
+
+// WithErasureCoding returns a BlockStorageOption that enables erasure coding of files created via `CreateBlock`.
+// Leaves are grouped into stripes of given data shard count, and given count of Reed-Solomon parity blocks are
+// persisted per stripe and referenced from root. Content is read even when up to parity shard count of leaves of
+// each stripe are unavailable, and reconstructed leaves are re-stored. Not supported with `DagPBEncoding`.
+// If not specified erasure coding is disabled
+func WithErasureCoding(dataShards, parityShards int) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.erasure = erasure{dataShards: dataShards, parityShards: parityShards}
+	}
+}
+
+// WithCompression returns a BlockStorageOption that compresses `Data` of leaf blocks with given codec, and records
+// the codec in the block, so content is decompressed transparently on reading. Leaves are stored uncompressed when
+// compression does not reduce size. Given addressing specifies whether cids of leaves address compressed or
+// original blocks. Not supported with raw leaves (`EnableRawLeaves`) and `DagPBEncoding`.
+// If not specified leaves are not compressed
+func WithCompression(codec blockpb.Compression, addressing Addressing) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.compression = codec
+		bc.addressing = addressing
+	}
+}
+
+// WithEncryption returns a BlockStorageOption that encrypts `Data` of leaf blocks with AES-GCM, so permanent store and
+// remote peers only see ciphertext. File roots and directories are sealed as well, so their names, metadata and entry
+// names are not readable either (only hashes of their links are). Data keys are wrapped with key-encryption keys of
+// given provider and recorded in blocks, so `ReadFile`/`GetBlock` decrypt transparently with the provider. Given mode
+// specifies whether data keys are per file or derived from content (`ConvergentEncryption`). Encrypted leaves are
+// addressed with their stored form regardless of `Addressing`. Not supported with raw leaves (`EnableRawLeaves`) and
+// `DagPBEncoding`.
+// If not specified leaves are not encrypted
+func WithEncryption(keys KeyProvider, mode EncryptionMode) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.encryption = true
+		bc.keys = keys
+		bc.encryptionMode = mode
+	}
+}
+
+// WithBlockCache returns a BlockStorageOption that caches decoded blocks read via `GetBlock` and `ReadFile` in
+// memory, limited with given total size of blocks in bytes. Least recently used blocks are evicted when limit is
+// exceeded, and blocks removed from permanent store are invalidated. Encrypted blocks are cached encrypted, and
+// decrypted with key provider on each read. Counters are exposed via `CacheStats`.
+// If not specified block cache is disabled
+func WithBlockCache(maxBytes uint64) BlockStorageOption {
+	return func(bc *blockstorageConfig) {
+		bc.cacheSize = maxBytes
+	}
+}
@@ -3,8 +3,13 @@ package blockstorage
 import (
 	"testing"
 
+	"github.com/igumus/blockstorage/blockpb"
 	mockpeer "github.com/igumus/blockstorage/peer/mock"
 	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,6 +34,114 @@ func (s *blockStorageSuite) TestBlockStorageConfigCreation() {
 			shouldFail: true,
 			err:        ErrPeerNotSpecified,
 		},
+		{
+			name:       "cidv0_without_dagpb",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithCidPrefix(cid.Prefix{Version: 0, MhType: mh.SHA2_256, MhLength: -1})),
+			shouldFail: true,
+			err:        ErrCidPrefixNotSupported,
+		},
+		{
+			name:       "unknown_hash_function",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithCidPrefix(cid.Prefix{Version: 1, MhType: 0x300001, MhLength: -1})),
+			shouldFail: true,
+			err:        ErrCidPrefixNotSupported,
+		},
+		{
+			name:       "nil_datastore",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithDatastore(nil)),
+			shouldFail: true,
+			err:        ErrDatastoreNotSpecified,
+		},
+		{
+			name:       "non_positive_upload_ttl",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithUploadTTL(0)),
+			shouldFail: true,
+			err:        ErrUploadTTLNotValid,
+		},
+		{
+			name:       "non_positive_workers",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithWorkers(0)),
+			shouldFail: true,
+			err:        ErrWorkersNotValid,
+		},
+		{
+			name:       "non_positive_replication_interval",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithReplicationInterval(0)),
+			shouldFail: true,
+			err:        ErrReplicationIntervalNotValid,
+		},
+		{
+			name:       "erasure_without_parity",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithErasureCoding(4, 0)),
+			shouldFail: true,
+			err:        ErrErasureShardsNotValid,
+		},
+		{
+			name:       "erasure_too_many_shards",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithErasureCoding(200, 57)),
+			shouldFail: true,
+			err:        ErrErasureShardsNotValid,
+		},
+		{
+			name:       "erasure_with_dagpb",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithEncoding(DagPBEncoding), WithErasureCoding(4, 2)),
+			shouldFail: true,
+			err:        ErrErasureCodingNotSupported,
+		},
+		{
+			name:       "unknown_compression",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithCompression(blockpb.Compression(42), CompressedAddressing)),
+			shouldFail: true,
+			err:        ErrCompressionNotValid,
+		},
+		{
+			name:       "compression_with_raw_leaves",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), EnableRawLeaves(), WithCompression(blockpb.Compression_ZSTD, OriginalAddressing)),
+			shouldFail: true,
+			err:        ErrCompressionNotSupported,
+		},
+		{
+			name:       "encryption_without_key_provider",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithEncryption(nil, FileKeyEncryption)),
+			shouldFail: true,
+			err:        ErrEncryptionNotValid,
+		},
+		{
+			name:       "encryption_with_dagpb",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithEncoding(DagPBEncoding), WithEncryption(NewStaticKeyProvider("kek", make([]byte, 32)), ConvergentEncryption)),
+			shouldFail: true,
+			err:        ErrEncryptionNotSupported,
+		},
+		{
+			name:       "blake3_without_datastore",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithCidPrefix(cid.Prefix{Version: 1, MhType: mh.BLAKE3, MhLength: -1})),
+			shouldFail: true,
+			err:        ErrDatastoreNotPersistent,
+		},
+		{
+			name:       "original_addressing_without_datastore",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithCompression(blockpb.Compression_ZSTD, OriginalAddressing)),
+			shouldFail: true,
+			err:        ErrDatastoreNotPersistent,
+		},
+		{
+			name:       "original_addressing_with_datastore",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithCompression(blockpb.Compression_ZSTD, OriginalAddressing), WithDatastore(dssync.MutexWrap(ds.NewMapDatastore()))),
+			shouldFail: false,
+			err:        nil,
+		},
+		{
+			name:       "quota_without_datastore",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithQuota(100, 0)),
+			shouldFail: true,
+			err:        ErrDatastoreNotPersistent,
+		},
+		{
+			name:       "cidv0_with_dagpb",
+			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer), WithEncoding(DagPBEncoding), WithCidPrefix(cid.Prefix{Version: 0, MhType: mh.SHA2_256, MhLength: -1})),
+			shouldFail: false,
+			err:        nil,
+		},
 		{
 			name:       "valid_options",
 			options:    append([]BlockStorageOption{}, WithLocalStore(store), WithPeer(peer)),
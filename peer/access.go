@@ -0,0 +1,89 @@
+package peer
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// SharingPolicy - decides whether block with given cid is shared with remote peer with given id via read protocol
+type SharingPolicy func(ctx context.Context, remote libpeer.ID, id cid.Cid) bool
+
+// PushTarget - represents store which blocks pushed by remote peer are persisted to (see `BlockPushProtocolID`)
+type PushTarget int
+
+const (
+	// PushDenied - push is refused
+	PushDenied PushTarget = iota
+	// PushToTempStore - pushed blocks are persisted to temporary store (e.g. warm-up of cached blocks)
+	PushToTempStore
+	// PushToPermanentStore - pushed blocks are persisted to permanent store, and announced (e.g. replicas, migrations)
+	PushToPermanentStore
+)
+
+// PushPolicy - decides whether DAG with given root cid pushed by remote peer with given id is accepted, and which
+// store its blocks are persisted to
+type PushPolicy func(ctx context.Context, remote libpeer.ID, root cid.Cid) PushTarget
+
+// AllowPush - returns push policy which persists DAGs pushed by given peers to given store, and refuses other
+// peers. When no peer is given, DAGs of every peer are accepted.
+func AllowPush(target PushTarget, ids ...libpeer.ID) PushPolicy {
+	allowed := make(map[libpeer.ID]bool, len(ids))
+	for _, id := range ids {
+		allowed[id] = true
+	}
+	return func(_ context.Context, remote libpeer.ID, _ cid.Cid) PushTarget {
+		if len(allowed) > 0 && !allowed[remote] {
+			return PushDenied
+		}
+		return target
+	}
+}
+
+// Captures/Represents access control of read and push protocols: allowed peers of read protocol (empty allows
+// every peer), denied peers of both protocols, optional sharing policy of blocks and push policy.
+type accessControl struct {
+	allowed map[libpeer.ID]bool
+	denied  map[libpeer.ID]bool
+	policy  SharingPolicy
+	push    PushPolicy
+}
+
+// newAccessControl - creates access control with given allowlist, denylist, sharing policy and push policy
+func newAccessControl(allowed, denied []libpeer.ID, policy SharingPolicy, push PushPolicy) *accessControl {
+	ret := &accessControl{
+		allowed: make(map[libpeer.ID]bool, len(allowed)),
+		denied:  make(map[libpeer.ID]bool, len(denied)),
+		policy:  policy,
+		push:    push,
+	}
+	for _, id := range allowed {
+		ret.allowed[id] = true
+	}
+	for _, id := range denied {
+		ret.denied[id] = true
+	}
+	return ret
+}
+
+// allow - checks whether block with given cid may be served to remote peer with given id. Denylist takes
+// precedence over allowlist, and sharing policy is only asked for peers passing both lists.
+func (a *accessControl) allow(ctx context.Context, remote libpeer.ID, id cid.Cid) bool {
+	if a.denied[remote] {
+		return false
+	}
+	if len(a.allowed) > 0 && !a.allowed[remote] {
+		return false
+	}
+	return a.policy == nil || a.policy(ctx, remote, id)
+}
+
+// allowPush - decides target store of DAG with given root pushed by remote peer with given id. Denylist takes
+// precedence over push policy, and pushes are refused when there is no push policy.
+func (a *accessControl) allowPush(ctx context.Context, remote libpeer.ID, root cid.Cid) PushTarget {
+	if a.denied[remote] || a.push == nil {
+		return PushDenied
+	}
+	return a.push(ctx, remote, root)
+}
@@ -0,0 +1,73 @@
+package peer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessControl(t *testing.T) {
+	ctx := context.Background()
+	shared, err := cid.Decode(notExistsCid)
+	require.NoError(t, err)
+	private, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: 0x12, MhLength: -1}.Sum([]byte("private"))
+	require.NoError(t, err)
+
+	alice, bob, carol := libpeer.ID("alice"), libpeer.ID("bob"), libpeer.ID("carol")
+	policy := func(_ context.Context, remote libpeer.ID, id cid.Cid) bool {
+		return id.Equals(shared) || remote == alice
+	}
+
+	testCases := []struct {
+		name    string
+		access  *accessControl
+		remote  libpeer.ID
+		id      cid.Cid
+		allowed bool
+	}{
+		{name: "open", access: newAccessControl(nil, nil, nil, nil), remote: carol, id: private, allowed: true},
+		{name: "denied", access: newAccessControl(nil, []libpeer.ID{bob}, nil, nil), remote: bob, id: shared, allowed: false},
+		{name: "denied_over_allowed", access: newAccessControl([]libpeer.ID{bob}, []libpeer.ID{bob}, nil, nil), remote: bob, id: shared, allowed: false},
+		{name: "not_allowed", access: newAccessControl([]libpeer.ID{alice}, nil, nil, nil), remote: carol, id: shared, allowed: false},
+		{name: "allowed", access: newAccessControl([]libpeer.ID{alice}, nil, nil, nil), remote: alice, id: private, allowed: true},
+		{name: "policy_shared", access: newAccessControl(nil, nil, policy, nil), remote: carol, id: shared, allowed: true},
+		{name: "policy_private", access: newAccessControl(nil, nil, policy, nil), remote: carol, id: private, allowed: false},
+		{name: "policy_owner", access: newAccessControl(nil, nil, policy, nil), remote: alice, id: private, allowed: true},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.allowed, tc.access.allow(ctx, tc.remote, tc.id))
+		})
+	}
+}
+
+func TestPushAccessControl(t *testing.T) {
+	ctx := context.Background()
+	root, err := cid.Decode(notExistsCid)
+	require.NoError(t, err)
+
+	alice, bob, carol := libpeer.ID("alice"), libpeer.ID("bob"), libpeer.ID("carol")
+	testCases := []struct {
+		name   string
+		access *accessControl
+		remote libpeer.ID
+		target PushTarget
+	}{
+		{name: "no_policy", access: newAccessControl(nil, nil, nil, nil), remote: alice, target: PushDenied},
+		{name: "any_peer", access: newAccessControl(nil, nil, nil, AllowPush(PushToTempStore)), remote: carol, target: PushToTempStore},
+		{name: "allowed", access: newAccessControl(nil, nil, nil, AllowPush(PushToPermanentStore, alice)), remote: alice, target: PushToPermanentStore},
+		{name: "not_allowed", access: newAccessControl(nil, nil, nil, AllowPush(PushToPermanentStore, alice)), remote: carol, target: PushDenied},
+		{name: "denied_over_policy", access: newAccessControl(nil, []libpeer.ID{bob}, nil, AllowPush(PushToPermanentStore, bob)), remote: bob, target: PushDenied},
+		{name: "read_allowlist_ignored", access: newAccessControl([]libpeer.ID{alice}, nil, nil, AllowPush(PushToTempStore)), remote: carol, target: PushToTempStore},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.target, tc.access.allowPush(ctx, tc.remote, root))
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	routedhost "github.com/libp2p/go-libp2p/p2p/host/routed"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+)
+
+var ErrPeerHostNotExpected = errors.New("[blockstorage] peer configuration failed: host and content router are created by default peer")
+
+// defaultListenAddr - holds listen address of default peer host (all interfaces, random port)
+const defaultListenAddr = "/ip4/0.0.0.0/tcp/0"
+
+// Watermarks and grace period of default peer connection manager
+const (
+	defaultConnLowWater    = 100
+	defaultConnHighWater   = 400
+	defaultConnGracePeriod = time.Minute
+)
+
+// bootstrapConnectTimeout - holds timeout of connecting to each bootstrap peer
+const bootstrapConnectTimeout = 30 * time.Second
+
+// loadIdentity - loads private key of peer identity from given file. When file not exists, generates Ed25519 key
+// and persists it to the file, so peer id survives restarts. Empty path generates ephemeral key.
+//
+// Error:
+// When reading, decoding or persisting key fails, returns `nil` with error cause
+func loadIdentity(path string) (crypto.PrivKey, error) {
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			return crypto.UnmarshalPrivateKey(data)
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	sk, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return sk, nil
+	}
+	data, err := crypto.MarshalPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	log.Printf("info: generated peer identity: %s\n", path)
+	return sk, nil
+}
+
+// newDefaultHost - creates libp2p host (with connection manager) and kad-dht of given configuration, and connects
+// host to bootstrap peers. Returned host is routed via DHT, so peers are dialed with addresses found in DHT.
+//
+// Flow:
+// 1. Loads (or generates) identity key
+// 2. Creates host, which is private (see `NewSwarmHost`) when swarm key is specified
+// 3. Creates DHT with protocol prefix and mode
+// 4. Connects bootstrap peers, and bootstraps DHT. Unreachable bootstrap peers are logged, as they may come up later.
+//
+// Error:
+// When any of the flow operations fail (except connecting bootstrap peers), returns error cause and created
+// resources are closed
+func newDefaultHost(ctx context.Context, cfg *peerConfig) (host.Host, *dht.IpfsDHT, error) {
+	bootstrapPeers := make([]libpeer.AddrInfo, 0, len(cfg.bootstrapPeers))
+	for _, addr := range cfg.bootstrapPeers {
+		info, err := libpeer.AddrInfoFromString(addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		bootstrapPeers = append(bootstrapPeers, *info)
+	}
+	sk, err := loadIdentity(cfg.identityKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cm, err := connmgr.NewConnManager(defaultConnLowWater, defaultConnHighWater, connmgr.WithGracePeriod(defaultConnGracePeriod))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := []libp2p.Option{
+		libp2p.Identity(sk),
+		libp2p.ListenAddrStrings(cfg.listenAddrs...),
+		libp2p.ConnectionManager(cm),
+	}
+	var h host.Host
+	if cfg.swarmKey != nil {
+		h, err = NewSwarmHost(cfg.swarmKey, options...)
+	} else {
+		h, err = libp2p.New(append(options, libp2p.DefaultTransports)...)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	idht, err := NewSwarmDHT(ctx, h, cfg.dhtProtocolPrefix, dht.Mode(cfg.dhtMode), dht.BootstrapPeers(bootstrapPeers...))
+	if err != nil {
+		h.Close()
+		return nil, nil, err
+	}
+
+	connected := 0
+	for _, info := range bootstrapPeers {
+		connectCtx, cancel := context.WithTimeout(ctx, bootstrapConnectTimeout)
+		if err := h.Connect(connectCtx, info); err != nil {
+			log.Printf("warn: connecting bootstrap peer failed: %s, %s\n", info.ID, err.Error())
+		} else {
+			connected++
+		}
+		cancel()
+	}
+	if len(bootstrapPeers) > 0 && connected == 0 {
+		log.Printf("warn: not connected any bootstrap peer\n")
+	}
+	if err := idht.Bootstrap(ctx); err != nil {
+		log.Printf("warn: dht bootstrapping failed: %s\n", err.Error())
+	}
+	return routedhost.Wrap(h, idht), idht, nil
+}
+
+// NewDefaultBlockStoragePeer - creates peer which owns its libp2p host, connection manager and kad-dht, created
+// from given options (e.g. `WithIdentityKeyFile`, `WithListenAddrs`, `WithBootstrapPeers`, `WithDHTMode`,
+// `WithSwarmKey`). Host and DHT are closed when peer is closed (see `Close`).
+//
+// Error:
+// - When host or content router option is specified, returns `ErrPeerHostNotExpected`
+// - When peer configuration is not valid or creating host/DHT fails, returns error cause
+func NewDefaultBlockStoragePeer(ctx context.Context, opts ...PeerOption) (BlockStoragePeer, error) {
+	cfg := defaultPeerConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.host != nil || cfg.contentRouter != nil {
+		return nil, ErrPeerHostNotExpected
+	}
+	h, idht, err := newDefaultHost(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := newBlockStoragePeer(ctx, append(opts, WithHost(h), WithContentRouter(idht))...)
+	if err != nil {
+		idht.Close()
+		h.Close()
+		return nil, err
+	}
+	// dht is closed before host, as it uses host while shutting down
+	ret.closers = append(ret.closers, idht, h)
+	return ret, nil
+}
@@ -0,0 +1,85 @@
+package peer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/libp2p/go-libp2p-core/network"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/stretchr/testify/require"
+)
+
+// defaultTestListenAddr - holds listen address of default test peers (random port)
+const defaultTestListenAddr = "/ip4/127.0.0.1/tcp/0"
+
+// p2pAddr - returns first listen multiaddr (with peer id) of given peer
+func p2pAddr(p *peer) string {
+	return fmt.Sprintf("%s/p2p/%s", p.host.Addrs()[0], p.host.ID())
+}
+
+func TestDefaultPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	keyFile := filepath.Join(t.TempDir(), "identity.key")
+	psk := generateSwarmKey(t)
+	newPeer := func(opts ...PeerOption) *peer {
+		options := append([]PeerOption{WithTempStore(mock.NewMockObjectStore(ctrl)), WithListenAddrs(defaultTestListenAddr), WithSwarmKey(psk)}, opts...)
+		ret, err := NewDefaultBlockStoragePeer(ctx, options...)
+		require.NoError(t, err)
+		return ret.(*peer)
+	}
+
+	t.Run("persisted_identity", func(t *testing.T) {
+		first := newPeer(WithIdentityKeyFile(keyFile))
+		id := first.host.ID()
+		require.NoError(t, first.Close())
+
+		second := newPeer(WithIdentityKeyFile(keyFile))
+		defer second.Close()
+		require.Equal(t, id, second.host.ID())
+
+		ephemeral := newPeer()
+		defer ephemeral.Close()
+		require.NotEqual(t, id, ephemeral.host.ID())
+	})
+
+	t.Run("bootstrap", func(t *testing.T) {
+		bootstrap := newPeer(WithDHTMode(dht.ModeServer))
+		member := newPeer(WithBootstrapPeers(p2pAddr(bootstrap)))
+		defer member.Close()
+		require.Equal(t, network.Connected, member.host.Network().Connectedness(bootstrap.host.ID()))
+
+		// closed peer tears down its host, so it can not be dialed anymore
+		info := libpeer.AddrInfo{ID: bootstrap.host.ID(), Addrs: bootstrap.host.Addrs()}
+		require.NoError(t, bootstrap.Close())
+		require.Eventually(t, func() bool {
+			return member.host.Network().Connectedness(info.ID) != network.Connected
+		}, 5*time.Second, 50*time.Millisecond)
+		member.host.Peerstore().ClearAddrs(info.ID)
+		dialCtx, dialCancel := context.WithTimeout(ctx, 2*time.Second)
+		defer dialCancel()
+		require.Error(t, member.host.Connect(dialCtx, info))
+	})
+
+	t.Run("invalid_options", func(t *testing.T) {
+		external := newPeer()
+		defer external.Close()
+		_, err := NewDefaultBlockStoragePeer(ctx, WithTempStore(mock.NewMockObjectStore(ctrl)), WithHost(external.host))
+		require.Equal(t, ErrPeerHostNotExpected, err)
+
+		_, err = NewDefaultBlockStoragePeer(ctx, WithTempStore(mock.NewMockObjectStore(ctrl)), WithBootstrapPeers("/ip4/127.0.0.1/tcp/1"))
+		require.Error(t, err)
+
+		_, err = NewDefaultBlockStoragePeer(ctx, WithListenAddrs(defaultTestListenAddr))
+		require.Equal(t, ErrPeerTemporaryStoreNotSpecified, err)
+	})
+}
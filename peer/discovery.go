@@ -0,0 +1,114 @@
+package peer
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
+)
+
+// DefaultDiscoveryNamespace - holds namespace (mDNS service name, rendezvous point) under which blockstorage peers
+// find each other
+const DefaultDiscoveryNamespace = "blockstorage"
+
+// defaultDiscoveryInterval - holds how often rendezvous discovery searches peers
+const defaultDiscoveryInterval = time.Minute
+
+// discoveryConnectTimeout - holds timeout of connecting to discovered peer
+const discoveryConnectTimeout = 10 * time.Second
+
+// Captures/Represents discovery services of peer, which connect discovered peers to host, so routing table of
+// content router stays populated without bootstrap lists.
+type discovery struct {
+	p         *peer
+	namespace string
+	interval  time.Duration
+	// ctx holds lifetime of discovery services, which is used by mDNS notifications
+	ctx context.Context
+}
+
+// startDiscovery - starts discovery services enabled by configuration of peer (`EnableMDNS`, `EnableRendezvous`).
+// Services run until given context is done, and are waited by `Close` as in-flight operations.
+//
+// Error:
+// When mDNS service can not be started, returns error cause
+func (p *peer) startDiscovery(ctx context.Context) error {
+	cfg := p.cfg
+	d := &discovery{p: p, namespace: cfg.discoveryNamespace, interval: cfg.discoveryInterval, ctx: ctx}
+	if cfg.mdns {
+		service := mdns.NewMdnsService(p.host, d.namespace, d)
+		if err := service.Start(); err != nil {
+			return err
+		}
+		p.inflight.Add(1)
+		go func() {
+			defer p.inflight.Done()
+			<-ctx.Done()
+			service.Close()
+		}()
+	}
+	if cfg.rendezvous {
+		rendezvous := drouting.NewRoutingDiscovery(p.contentRouter)
+		dutil.Advertise(ctx, rendezvous, d.namespace)
+		p.inflight.Add(1)
+		go func() {
+			defer p.inflight.Done()
+			d.discoverLoop(ctx, rendezvous)
+		}()
+	}
+	return nil
+}
+
+// HandlePeerFound - connects to peer found by mDNS service
+func (d *discovery) HandlePeerFound(info libpeer.AddrInfo) {
+	d.connect(d.ctx, info)
+}
+
+// discoverLoop - searches peers advertised under rendezvous namespace periodically (see `WithDiscoveryInterval`),
+// and connects to them until given context is done.
+func (d *discovery) discoverLoop(ctx context.Context, rendezvous *drouting.RoutingDiscovery) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.discover(ctx, rendezvous)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// discover - searches peers advertised under rendezvous namespace once, and connects to them
+func (d *discovery) discover(ctx context.Context, rendezvous *drouting.RoutingDiscovery) {
+	found, err := rendezvous.FindPeers(ctx, d.namespace)
+	if err != nil {
+		log.Printf("warn: finding rendezvous peers failed: %s, %s\n", d.namespace, err.Error())
+		return
+	}
+	for info := range found {
+		d.connect(ctx, info)
+	}
+}
+
+// connect - connects host to discovered peer, unless the peer is host itself or already connected
+func (d *discovery) connect(ctx context.Context, info libpeer.AddrInfo) {
+	host := d.p.host
+	if info.ID == host.ID() || len(info.Addrs) < 1 || host.Network().Connectedness(info.ID) == network.Connected {
+		return
+	}
+	connectCtx, cancel := context.WithTimeout(ctx, discoveryConnectTimeout)
+	defer cancel()
+	if err := host.Connect(connectCtx, info); err != nil {
+		if d.p.debug {
+			log.Printf("debug: connecting discovered peer failed: %s, %s\n", info.ID, err.Error())
+		}
+		return
+	}
+	log.Printf("info: connected discovered peer: %s\n", info.ID)
+}
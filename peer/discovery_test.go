@@ -0,0 +1,125 @@
+package peer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// Captures/Represents in-memory content router shared by test peers, which keeps providers of cids
+type memoryRouter struct {
+	lock      sync.Mutex
+	host      host.Host
+	providers map[cid.Cid]map[libpeer.ID]libpeer.AddrInfo
+}
+
+// routerOf - returns content router of given host, which shares provider records of given router
+func (r *memoryRouter) routerOf(h host.Host) *memoryRouter {
+	return &memoryRouter{host: h, providers: r.providers}
+}
+
+func (r *memoryRouter) Provide(_ context.Context, id cid.Cid, _ bool) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.providers[id]; !ok {
+		r.providers[id] = make(map[libpeer.ID]libpeer.AddrInfo)
+	}
+	r.providers[id][r.host.ID()] = libpeer.AddrInfo{ID: r.host.ID(), Addrs: r.host.Addrs()}
+	return nil
+}
+
+func (r *memoryRouter) FindProvidersAsync(_ context.Context, id cid.Cid, _ int) <-chan libpeer.AddrInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ret := make(chan libpeer.AddrInfo, len(r.providers[id]))
+	for _, info := range r.providers[id] {
+		ret <- info
+	}
+	close(ret)
+	return ret
+}
+
+func (s *peerSuite) TestRendezvousDiscovery() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shared := &memoryRouter{providers: make(map[cid.Cid]map[libpeer.ID]libpeer.AddrInfo)}
+	hosts := make([]host.Host, 0, 3)
+	for i := 0; i < 3; i++ {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(s.T(), err)
+		defer h.Close()
+		hosts = append(hosts, h)
+	}
+
+	namespaces := []string{DefaultDiscoveryNamespace, DefaultDiscoveryNamespace, "other"}
+	for i, h := range hosts {
+		p, err := newBlockStoragePeer(ctx, EnableDebugMode(), WithHost(h), WithContentRouter(shared.routerOf(h)),
+			WithTempStore(mock.NewMockObjectStore(s.ctrl)), EnableRendezvous(), WithDiscoveryNamespace(namespaces[i]),
+			WithDiscoveryInterval(50*time.Millisecond))
+		require.NoError(s.T(), err)
+		require.NoError(s.T(), p.Start(ctx))
+		defer p.Close()
+	}
+
+	// peers of same namespace find each other, while peer of other namespace is not connected
+	require.Eventually(s.T(), func() bool {
+		return hosts[0].Network().Connectedness(hosts[1].ID()) == network.Connected
+	}, 5*time.Second, 50*time.Millisecond)
+	require.NotEqual(s.T(), network.Connected, hosts[2].Network().Connectedness(hosts[0].ID()))
+	require.NotEqual(s.T(), network.Connected, hosts[2].Network().Connectedness(hosts[1].ID()))
+}
+
+func TestDiscoveryConnect(t *testing.T) {
+	ctx := context.Background()
+	h1, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h1.Close()
+	h2, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h2.Close()
+
+	d := &discovery{p: &peer{host: h1}, namespace: DefaultDiscoveryNamespace, interval: time.Minute, ctx: ctx}
+
+	// peers found by mDNS are connected, except host itself
+	d.HandlePeerFound(libpeer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()})
+	require.Equal(t, 0, len(h1.Network().Peers()))
+	d.HandlePeerFound(libpeer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()})
+	require.Equal(t, network.Connected, h1.Network().Connectedness(h2.ID()))
+}
+
+func (s *peerSuite) TestMDNSDiscovery() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// namespace is unique to test run, so peers of other runs on local network are not discovered
+	namespace := fmt.Sprintf("blockstorage-test-%d", time.Now().UnixNano())
+	hosts := make([]host.Host, 0, 2)
+	for i := 0; i < 2; i++ {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(s.T(), err)
+		defer h.Close()
+		hosts = append(hosts, h)
+
+		router := &memoryRouter{host: h, providers: make(map[cid.Cid]map[libpeer.ID]libpeer.AddrInfo)}
+		p, err := newBlockStoragePeer(ctx, EnableDebugMode(), WithHost(h), WithContentRouter(router),
+			WithTempStore(mock.NewMockObjectStore(s.ctrl)), EnableMDNS(), WithDiscoveryNamespace(namespace))
+		require.NoError(s.T(), err)
+		require.NoError(s.T(), p.Start(ctx))
+		defer p.Close()
+	}
+
+	require.Eventually(s.T(), func() bool {
+		return hosts[0].Network().Connectedness(hosts[1].ID()) == network.Connected
+	}, 10*time.Second, 100*time.Millisecond)
+}
@@ -0,0 +1,105 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+// ErrPeerClosed is return, when peer is used after it is closed.
+var ErrPeerClosed = errors.New("blockstorage: peer stopped")
+
+// Start - starts background services of peer (e.g. discovery, see `EnableMDNS` and `EnableRendezvous`), which run
+// until peer is closed or given context is done. Starting started peer has no effect.
+//
+// Error:
+// - When peer is closed returns `ErrPeerClosed`
+// - When any of the services can not be started, returns error cause
+func (p *peer) Start(ctx context.Context) error {
+	p.lifecycleLock.Lock()
+	defer p.lifecycleLock.Unlock()
+	if p.closed {
+		return ErrPeerClosed
+	}
+	if p.started {
+		return nil
+	}
+	serviceCtx, cancel := context.WithCancel(ctx)
+	if err := p.startDiscovery(serviceCtx); err != nil {
+		cancel()
+		return err
+	}
+	p.cancel = cancel
+	p.started = true
+	return nil
+}
+
+// enter - records in-flight operation (e.g. block fetch), which `Close` waits for. Caller should call
+// `inflight.Done` when operation completes.
+//
+// Error:
+// When peer is closed returns `ErrPeerClosed`
+func (p *peer) enter() error {
+	p.lifecycleLock.Lock()
+	defer p.lifecycleLock.Unlock()
+	if p.closed {
+		return ErrPeerClosed
+	}
+	p.inflight.Add(1)
+	return nil
+}
+
+// trackStream - returns stream handler which records streams served by given handler as in-flight operations, and
+// resets streams opened while peer is closing.
+func (p *peer) trackStream(handler network.StreamHandler) network.StreamHandler {
+	return func(stream network.Stream) {
+		if p.enter() != nil {
+			stream.Reset()
+			return
+		}
+		defer p.inflight.Done()
+		handler(stream)
+	}
+}
+
+// Close - closes peer, further operations fail with `ErrPeerClosed`. Closing closed peer has no effect.
+//
+// Flow:
+// 1. Unregisters read and push protocols, so remote peers can not open new streams
+// 2. Stops background services (see `Start`)
+// 3. Waits for in-flight block fetches, announcements, pushes and served streams
+// 4. Closes resources owned by peer (host and DHT of peer created via `NewDefaultBlockStoragePeer`). Host and
+// content router given via options are not closed.
+//
+// Error:
+// When closing any resource fails, returns first error cause (remaining resources are closed anyway)
+func (p *peer) Close() error {
+	p.lifecycleLock.Lock()
+	if p.closed {
+		p.lifecycleLock.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.lifecycleLock.Unlock()
+
+	p.host.RemoveStreamHandler(BlockReadProtocolID)
+	p.host.RemoveStreamHandler(BlockPushProtocolID)
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.inflight.Wait()
+
+	var ret error
+	for _, closer := range p.closers {
+		if err := closer.Close(); err != nil {
+			log.Printf("err: closing peer resource failed: %s\n", err.Error())
+			if ret == nil {
+				ret = err
+			}
+		}
+	}
+	p.closers = nil
+	return ret
+}
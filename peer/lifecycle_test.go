@@ -0,0 +1,79 @@
+package peer
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerClose(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	data := []byte("selam")
+	blockID, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: 0x12, MhLength: -1}.Sum(data)
+	require.NoError(t, err)
+
+	h1, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h1.Close()
+	h2, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h2.Close()
+	require.NoError(t, h2.Connect(ctx, libpeer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}))
+
+	// served stream blocks in permanent store until released
+	reading, release := make(chan struct{}), make(chan struct{})
+	permanentStore := mock.NewMockObjectStore(ctrl)
+	permanentStore.EXPECT().ReadObject(gomock.Any(), blockID).Times(1).DoAndReturn(func(_ context.Context, _ cid.Cid) ([]byte, error) {
+		close(reading)
+		<-release
+		return data, nil
+	})
+	p, err := newBlockStoragePeer(ctx, WithHost(h1), WithContentRouter(&memoryRouter{host: h1}), WithTempStore(mock.NewMockObjectStore(ctrl)))
+	require.NoError(t, err)
+	require.NoError(t, p.Start(ctx))
+	p.RegisterReadProtocol(ctx, permanentStore)
+
+	stream, err := h2.NewStream(ctx, h1.ID(), BlockReadProtocolID)
+	require.NoError(t, err)
+	bin, err := blockID.MarshalBinary()
+	require.NoError(t, err)
+	_, err = stream.Write(bin)
+	require.NoError(t, err)
+	<-reading
+
+	closed := make(chan error)
+	go func() {
+		closed <- p.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("close returned before in-flight stream completed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	require.NoError(t, <-closed)
+
+	// in-flight stream is served completely, while new streams are refused
+	response, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	require.Equal(t, append([]byte{readStatusOK}, data...), response)
+	_, err = h2.NewStream(ctx, h1.ID(), BlockReadProtocolID)
+	require.Error(t, err)
+
+	_, err = p.GetRemoteBlock(ctx, blockID)
+	require.Equal(t, ErrPeerClosed, err)
+	require.False(t, p.AnnounceBlock(ctx, blockID))
+	require.Equal(t, ErrPeerClosed, p.Start(ctx))
+	require.NoError(t, p.Close())
+}
@@ -9,8 +9,10 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	peer "github.com/igumus/blockstorage/peer"
 	objectstore "github.com/igumus/go-objectstore-lib"
 	cid "github.com/ipfs/go-cid"
+	peer0 "github.com/libp2p/go-libp2p-core/peer"
 )
 
 // MockBlockStoragePeer is a mock of BlockStoragePeer interface.
@@ -50,6 +52,35 @@ func (mr *MockBlockStoragePeerMockRecorder) AnnounceBlock(arg0, arg1 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AnnounceBlock", reflect.TypeOf((*MockBlockStoragePeer)(nil).AnnounceBlock), arg0, arg1)
 }
 
+// Close mocks base method.
+func (m *MockBlockStoragePeer) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockBlockStoragePeerMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockBlockStoragePeer)(nil).Close))
+}
+
+// FindProviders mocks base method.
+func (m *MockBlockStoragePeer) FindProviders(arg0 context.Context, arg1 cid.Cid, arg2 int) ([]peer0.ID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindProviders", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]peer0.ID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindProviders indicates an expected call of FindProviders.
+func (mr *MockBlockStoragePeerMockRecorder) FindProviders(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindProviders", reflect.TypeOf((*MockBlockStoragePeer)(nil).FindProviders), arg0, arg1, arg2)
+}
+
 // GetRemoteBlock mocks base method.
 func (m *MockBlockStoragePeer) GetRemoteBlock(arg0 context.Context, arg1 cid.Cid) ([]byte, error) {
 	m.ctrl.T.Helper()
@@ -65,6 +96,47 @@ func (mr *MockBlockStoragePeerMockRecorder) GetRemoteBlock(arg0, arg1 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRemoteBlock", reflect.TypeOf((*MockBlockStoragePeer)(nil).GetRemoteBlock), arg0, arg1)
 }
 
+// Push mocks base method.
+func (m *MockBlockStoragePeer) Push(arg0 context.Context, arg1 peer0.ID, arg2 peer.DAGWriter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Push", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Push indicates an expected call of Push.
+func (mr *MockBlockStoragePeerMockRecorder) Push(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockBlockStoragePeer)(nil).Push), arg0, arg1, arg2)
+}
+
+// PushPeers mocks base method.
+func (m *MockBlockStoragePeer) PushPeers() []peer0.ID {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushPeers")
+	ret0, _ := ret[0].([]peer0.ID)
+	return ret0
+}
+
+// PushPeers indicates an expected call of PushPeers.
+func (mr *MockBlockStoragePeerMockRecorder) PushPeers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushPeers", reflect.TypeOf((*MockBlockStoragePeer)(nil).PushPeers))
+}
+
+// RegisterPushProtocol mocks base method.
+func (m *MockBlockStoragePeer) RegisterPushProtocol(arg0 context.Context, arg1 peer.BlockReceiver) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RegisterPushProtocol", arg0, arg1)
+}
+
+// RegisterPushProtocol indicates an expected call of RegisterPushProtocol.
+func (mr *MockBlockStoragePeerMockRecorder) RegisterPushProtocol(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterPushProtocol", reflect.TypeOf((*MockBlockStoragePeer)(nil).RegisterPushProtocol), arg0, arg1)
+}
+
 // RegisterReadProtocol mocks base method.
 func (m *MockBlockStoragePeer) RegisterReadProtocol(arg0 context.Context, arg1 objectstore.ObjectStore) {
 	m.ctrl.T.Helper()
@@ -76,3 +148,17 @@ func (mr *MockBlockStoragePeerMockRecorder) RegisterReadProtocol(arg0, arg1 inte
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterReadProtocol", reflect.TypeOf((*MockBlockStoragePeer)(nil).RegisterReadProtocol), arg0, arg1)
 }
+
+// Start mocks base method.
+func (m *MockBlockStoragePeer) Start(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockBlockStoragePeerMockRecorder) Start(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockBlockStoragePeer)(nil).Start), arg0)
+}
@@ -2,10 +2,17 @@ package peer
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/igumus/go-objectstore-lib"
+	ds "github.com/ipfs/go-datastore"
 	"github.com/libp2p/go-libp2p-core/host"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
+	"github.com/libp2p/go-libp2p-core/protocol"
 	"github.com/libp2p/go-libp2p-core/routing"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
 )
 
 var ErrPeerHostNotSpecified = errors.New("[blockstorage] peer configuration failed: host not specified")
@@ -14,6 +21,8 @@ var ErrPeerContentRouterNotSpecified = errors.New("[blockstorage] peer configura
 
 var ErrPeerMaxProviderCountInvalid = errors.New("[blockstorage] peer configuration failed: max provider count should be at least 1")
 
+var ErrPeerDiscoveryNamespaceNotValid = errors.New("[blockstorage] peer configuration failed: discovery namespace not specified")
+var ErrPeerDiscoveryIntervalNotValid = errors.New("[blockstorage] peer configuration failed: discovery interval should be positive")
 var ErrPeerTemporaryStoreNotSpecified = errors.New("[blockstorage] peer configuration failed: temporary store not specified")
 
 // defaultMaxProviderCount holds how many provider to ask max while finding block provider
@@ -26,9 +35,27 @@ type PeerOption func(*peerConfig)
 type peerConfig struct {
 	debugMode        bool
 	store            objectstore.ObjectStore
+	datastore        ds.Datastore
 	host             host.Host
 	contentRouter    routing.ContentRouting
 	maxProviderCount int
+	allowedPeers     []libpeer.ID
+	deniedPeers      []libpeer.ID
+	sharingPolicy    SharingPolicy
+	pushPolicy       PushPolicy
+
+	mdns               bool
+	rendezvous         bool
+	discoveryNamespace string
+	discoveryInterval  time.Duration
+
+	// host and content router construction of default peer (see `NewDefaultBlockStoragePeer`)
+	identityKeyFile   string
+	listenAddrs       []string
+	bootstrapPeers    []string
+	dhtMode           dht.ModeOpt
+	swarmKey          pnet.PSK
+	dhtProtocolPrefix protocol.ID
 }
 
 // validate - validates given `peerConfig` instance
@@ -45,6 +72,12 @@ func validate(s *peerConfig) error {
 	if s.store == nil {
 		return ErrPeerTemporaryStoreNotSpecified
 	}
+	if strings.TrimSpace(s.discoveryNamespace) == "" {
+		return ErrPeerDiscoveryNamespaceNotValid
+	}
+	if s.discoveryInterval <= 0 {
+		return ErrPeerDiscoveryIntervalNotValid
+	}
 	return nil
 }
 
@@ -56,6 +89,13 @@ func defaultPeerConfig() *peerConfig {
 		contentRouter:    nil,
 		maxProviderCount: defaultMaxProviderCount,
 		debugMode:        false,
+
+		discoveryNamespace: DefaultDiscoveryNamespace,
+		discoveryInterval:  defaultDiscoveryInterval,
+
+		listenAddrs:       []string{defaultListenAddr},
+		dhtMode:           dht.ModeAuto,
+		dhtProtocolPrefix: DefaultDHTProtocolPrefix,
 	}
 }
 
@@ -86,6 +126,16 @@ func WithTempStore(s objectstore.ObjectStore) PeerOption {
 	}
 }
 
+// WithTempDatastore returns a PeerOption that specifies persistent datastore which keeps mappings of cids to
+// temporary store keys, for fetched blocks addressed differently from temporary store (e.g. other hash functions).
+// Mappings are kept under own namespace, so datastore can be shared with block storage (see `WithDatastore`).
+// If not specified, mappings are kept in memory, so such blocks are fetched again after restart.
+func WithTempDatastore(d ds.Datastore) PeerOption {
+	return func(bc *peerConfig) {
+		bc.datastore = d
+	}
+}
+
 // WithHost returns a PeerOption that specifies libp2p host.
 func WithHost(h host.Host) PeerOption {
 	return func(pc *peerConfig) {
@@ -106,3 +156,118 @@ func EnableDebugMode() PeerOption {
 		pc.debugMode = true
 	}
 }
+
+// WithAllowedPeers returns a PeerOption that specifies peers which are allowed to read blocks via read protocol.
+// If not specified any, every peer (except denied peers) is allowed.
+func WithAllowedPeers(ids ...libpeer.ID) PeerOption {
+	return func(pc *peerConfig) {
+		pc.allowedPeers = append(pc.allowedPeers, ids...)
+	}
+}
+
+// WithDeniedPeers returns a PeerOption that specifies peers which are refused to read blocks via read protocol.
+// Denied peers are refused even if they are allowed.
+func WithDeniedPeers(ids ...libpeer.ID) PeerOption {
+	return func(pc *peerConfig) {
+		pc.deniedPeers = append(pc.deniedPeers, ids...)
+	}
+}
+
+// WithSharingPolicy returns a PeerOption that specifies which blocks are shared with which peers via read protocol.
+// If not specified, every block is shared with allowed peers.
+func WithSharingPolicy(policy SharingPolicy) PeerOption {
+	return func(pc *peerConfig) {
+		pc.sharingPolicy = policy
+	}
+}
+
+// WithPushPolicy returns a PeerOption that specifies push policy, which authorizes DAGs pushed by remote peers
+// via push protocol (see `AllowPush`) and decides their target store. Denied peers (see `WithDeniedPeers`) are
+// refused regardless of policy.
+// If not specified any, every push is refused.
+func WithPushPolicy(policy PushPolicy) PeerOption {
+	return func(pc *peerConfig) {
+		pc.pushPolicy = policy
+	}
+}
+
+// EnableMDNS returns a PeerOption that enables mDNS discovery, which connects peers of local network advertising
+// same discovery namespace.
+func EnableMDNS() PeerOption {
+	return func(pc *peerConfig) {
+		pc.mdns = true
+	}
+}
+
+// EnableRendezvous returns a PeerOption that enables rendezvous discovery, which advertises peer under discovery
+// namespace via content router (e.g. DHT), and periodically connects peers advertised under same namespace.
+func EnableRendezvous() PeerOption {
+	return func(pc *peerConfig) {
+		pc.rendezvous = true
+	}
+}
+
+// WithDiscoveryNamespace returns a PeerOption that specifies namespace of mDNS and rendezvous discovery.
+// If not specified default value is `blockstorage`
+func WithDiscoveryNamespace(ns string) PeerOption {
+	return func(pc *peerConfig) {
+		pc.discoveryNamespace = ns
+	}
+}
+
+// WithDiscoveryInterval returns a PeerOption that specifies how often rendezvous discovery searches peers.
+// If not specified default value is 1 minute
+func WithDiscoveryInterval(d time.Duration) PeerOption {
+	return func(pc *peerConfig) {
+		pc.discoveryInterval = d
+	}
+}
+
+// WithIdentityKeyFile returns a PeerOption that specifies file of peer identity key, used by default peer (see
+// `NewDefaultBlockStoragePeer`). Key is generated and persisted to the file when file not exists.
+// If not specified, default peer uses ephemeral identity.
+func WithIdentityKeyFile(path string) PeerOption {
+	return func(pc *peerConfig) {
+		pc.identityKeyFile = path
+	}
+}
+
+// WithListenAddrs returns a PeerOption that specifies listen multiaddrs of default peer host.
+// If not specified default value is `/ip4/0.0.0.0/tcp/0`
+func WithListenAddrs(addrs ...string) PeerOption {
+	return func(pc *peerConfig) {
+		pc.listenAddrs = addrs
+	}
+}
+
+// WithBootstrapPeers returns a PeerOption that specifies multiaddrs (with `/p2p/<peer id>`) of peers which default
+// peer connects on creation to join DHT.
+func WithBootstrapPeers(addrs ...string) PeerOption {
+	return func(pc *peerConfig) {
+		pc.bootstrapPeers = append(pc.bootstrapPeers, addrs...)
+	}
+}
+
+// WithDHTMode returns a PeerOption that specifies DHT mode (client, server, auto) of default peer.
+// If not specified default value is `dht.ModeAuto`
+func WithDHTMode(mode dht.ModeOpt) PeerOption {
+	return func(pc *peerConfig) {
+		pc.dhtMode = mode
+	}
+}
+
+// WithSwarmKey returns a PeerOption that specifies pre-shared key of private network (see `NewSwarmHost`) which
+// default peer host joins. If not specified, default peer host joins public network.
+func WithSwarmKey(psk pnet.PSK) PeerOption {
+	return func(pc *peerConfig) {
+		pc.swarmKey = psk
+	}
+}
+
+// WithDHTProtocolPrefix returns a PeerOption that specifies DHT protocol prefix of default peer (see
+// `NewSwarmDHT`). If not specified default value is `/blockstorage`
+func WithDHTProtocolPrefix(prefix protocol.ID) PeerOption {
+	return func(pc *peerConfig) {
+		pc.dhtProtocolPrefix = prefix
+	}
+}
@@ -2,10 +2,18 @@ package peer
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
 	"testing"
 
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
 )
 
@@ -64,6 +72,18 @@ func (s *peerSuite) TestPeerConfigCreation() {
 			shouldFail: true,
 			err:        ErrPeerMaxProviderCountInvalid,
 		},
+		{
+			name:       "with_empty_discoveryNamespace",
+			options:    append(makeConfigTestPeer(s.T(), true), WithTempStore(mock.NewMockObjectStore(s.ctrl)), WithDiscoveryNamespace(" ")),
+			shouldFail: true,
+			err:        ErrPeerDiscoveryNamespaceNotValid,
+		},
+		{
+			name:       "with_zero_discoveryInterval",
+			options:    append(makeConfigTestPeer(s.T(), true), WithTempStore(mock.NewMockObjectStore(s.ctrl)), WithDiscoveryInterval(0)),
+			shouldFail: true,
+			err:        ErrPeerDiscoveryIntervalNotValid,
+		},
 	}
 
 	for i := range testCases {
@@ -79,3 +99,35 @@ func (s *peerSuite) TestPeerConfigCreation() {
 	}
 
 }
+
+func (s *peerSuite) TestTempDatastore() {
+	ctx := context.Background()
+	datastore := dssync.MutexWrap(ds.NewMapDatastore())
+	objects := make(map[cid.Cid][]byte)
+	store := mock.NewMockObjectStore(s.ctrl)
+	store.EXPECT().CreateObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, r io.Reader) (cid.Cid, error) {
+		data, err := ioutil.ReadAll(r)
+		require.NoError(s.T(), err)
+		key, err := s.digestPrefix.Sum(data)
+		require.NoError(s.T(), err)
+		objects[key] = data
+		return key, nil
+	})
+	store.EXPECT().HasObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, key cid.Cid) bool {
+		_, ok := objects[key]
+		return ok
+	})
+
+	data := []byte("fetched block")
+	id, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.BLAKE3, MhLength: -1}.Sum(data)
+	require.NoError(s.T(), err)
+	options := append(makeConfigTestPeer(s.T(), true), WithTempStore(store), WithTempDatastore(datastore))
+	fetching, err := newBlockStoragePeer(ctx, options...)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), fetching.store.PutObject(ctx, id, data))
+
+	// mapping of temporary block survives restart
+	restarted, err := newBlockStoragePeer(ctx, options...)
+	require.NoError(s.T(), err)
+	require.True(s.T(), restarted.store.HasObject(ctx, id))
+}
@@ -2,9 +2,9 @@
 package peer
 
 import (
-	"bytes"
 	"context"
 	"errors"
+	"io"
 	"io/ioutil"
 	"log"
 	"sync"
@@ -13,6 +13,8 @@ import (
 	"github.com/igumus/blockstorage/util"
 	"github.com/igumus/go-objectstore-lib"
 	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	"github.com/libp2p/go-libp2p-core/host"
 	libpeer "github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/routing"
@@ -21,18 +23,43 @@ import (
 // ErrBlockProviderNotFound is return, when there is no owner of specified block.
 var ErrBlockProviderNotFound = errors.New("blockstorage: not found any provider for block")
 
+// ErrBlockAccessDenied is return, when remote peer refuses to share requested block.
+var ErrBlockAccessDenied = errors.New("blockstorage: remote peer denied access to block")
+
+// ErrBlockDataCorrupted is return, when block data received from remote peer not matches with requested cid.
+var ErrBlockDataCorrupted = errors.New("blockstorage: remote block data not matches with cid")
+
+// tempMappingNamespace - holds datastore namespace of cid mappings of temporary store (see `WithTempDatastore`)
+const tempMappingNamespace = "/blockstorage/peer"
+
 type BlockStoragePeer interface {
+	Start(context.Context) error
 	RegisterReadProtocol(context.Context, objectstore.ObjectStore)
 	AnnounceBlock(context.Context, cid.Cid) bool
 	GetRemoteBlock(context.Context, cid.Cid) ([]byte, error)
+	RegisterPushProtocol(context.Context, BlockReceiver)
+	Push(context.Context, libpeer.ID, DAGWriter) (int, error)
+	FindProviders(context.Context, cid.Cid, int) ([]libpeer.ID, error)
+	PushPeers() []libpeer.ID
+	Close() error
 }
 
 type peer struct {
 	debug            bool
 	host             host.Host
 	contentRouter    routing.ContentRouting
-	store            objectstore.ObjectStore
+	store            util.CidStore
 	maxProviderCount int
+	access           *accessControl
+	cfg              *peerConfig
+	// lifecycle state of peer (see `Start`, `Close`): in-flight fetches and served streams, function which stops
+	// discovery services, and resources owned by peer (see `NewDefaultBlockStoragePeer`)
+	lifecycleLock sync.Mutex
+	started       bool
+	closed        bool
+	inflight      sync.WaitGroup
+	cancel        context.CancelFunc
+	closers       []io.Closer
 }
 
 func newBlockStoragePeer(ctx context.Context, opts ...PeerOption) (*peer, error) {
@@ -44,23 +71,51 @@ func newBlockStoragePeer(ctx context.Context, opts ...PeerOption) (*peer, error)
 		debug:            cfg.debugMode,
 		host:             cfg.host,
 		contentRouter:    cfg.contentRouter,
-		store:            cfg.store,
+		store:            util.WrapObjectStore(cfg.store, tempMapping(cfg.datastore)),
 		maxProviderCount: cfg.maxProviderCount,
+		access:           newAccessControl(cfg.allowedPeers, cfg.deniedPeers, cfg.sharingPolicy, cfg.pushPolicy),
+		cfg:              cfg,
 	}
 	return ret, nil
 }
 
+// tempMapping - returns namespace of given datastore which keeps mappings of temporary store (see
+// `WithTempDatastore`), or `nil` when datastore is not specified
+func tempMapping(d ds.Datastore) ds.Datastore {
+	if d == nil {
+		return nil
+	}
+	return namespace.Wrap(d, ds.NewKey(tempMappingNamespace))
+}
+
+// NewBlockStoragePeer - creates peer of given host and content router (see `PeerOption`). When host and content
+// router are not specified but swarm key is (see `WithSwarmKey`), peer owns host and DHT of private swarm (see
+// `NewDefaultBlockStoragePeer`). Background services of peer (e.g. discovery) run after peer is started (see
+// `Start`).
 func NewBlockStoragePeer(ctx context.Context, opts ...PeerOption) (BlockStoragePeer, error) {
+	cfg := defaultPeerConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.host == nil && cfg.contentRouter == nil && cfg.swarmKey != nil {
+		return NewDefaultBlockStoragePeer(ctx, opts...)
+	}
 	return newBlockStoragePeer(ctx, opts...)
 }
 
+// RegisterReadProtocol - serves blocks of given store to remote peers via `BlockReadProtocolID`, until peer is
+// closed (see `Close`)
 func (p *peer) RegisterReadProtocol(ctx context.Context, store objectstore.ObjectStore) {
-	p.host.SetStreamHandler(BlockReadProtocolID, generateReadProtocol(store))
+	p.host.SetStreamHandler(BlockReadProtocolID, p.trackStream(generateReadProtocol(store, p.access)))
 }
 
 // AnnounceBlock - announces ownership of given cid (aka content identifier) to the p2p network.
-// Returns `true` in successful announcement, otherwise `false`
+// Returns `true` in successful announcement, otherwise `false` (e.g. peer is closed)
 func (p *peer) AnnounceBlock(ctx context.Context, blockID cid.Cid) bool {
+	if p.enter() != nil {
+		return false
+	}
+	defer p.inflight.Done()
 	if err := p.contentRouter.Provide(ctx, blockID, true); err != nil {
 		log.Printf("warn: announcing block failed: %s, %s\n", blockID, err.Error())
 		return false
@@ -94,7 +149,9 @@ func (p *peer) findBlockProvider(ctx context.Context, blockID cid.Cid) ([]libpee
 }
 
 // fetchRemoteBlock - fetches given cid (aka content identifier) from remote peer
-// While fetching creates 1:1 stream with the remote peer.
+// While fetching creates 1:1 stream with the remote peer. Response starts with status byte; when remote peer
+// refuses to share the block returns `ErrBlockAccessDenied`. Received content is verified with prefix
+// (version, codec, hash function) of given cid, and persisted to temporary store.
 // On succesful communication returns, byte content of desired block, otherwise returns cause error
 func (p *peer) fetchRemoteBlock(ctx context.Context, blockID cid.Cid, peerAddr libpeer.AddrInfo) ([]byte, error) {
 	ctxErr := util.CheckContext(ctx)
@@ -119,33 +176,55 @@ func (p *peer) fetchRemoteBlock(ctx context.Context, blockID cid.Cid, peerAddr l
 		return nil, err
 	}
 
-	data, err := ioutil.ReadAll(stream)
+	response, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(response) > 0 && response[0] == readStatusDenied:
+		log.Printf("warn: remote peer denied block: %s, %s\n", blockID, peerAddr.ID)
+		return nil, ErrBlockAccessDenied
+	case len(response) < 1 || response[0] != readStatusOK:
+		log.Printf("err: unexpected read response status: %s, %s\n", blockID, peerAddr.ID)
+		return nil, ErrBlockDataCorrupted
+	}
+	data := response[1:]
 
-	newCid, createErr := p.store.CreateObject(ctx, bytes.NewReader(data))
+	if ok, err := blockpb.Verify(blockID, data); err != nil || !ok {
+		log.Printf("err: verifying remote block failed: %s, %s\n", blockID, peerAddr.ID)
+		return nil, ErrBlockDataCorrupted
+	}
+
+	createErr := p.store.PutObject(ctx, blockID, data)
 	if createErr != nil {
 		log.Printf("err: storing remote block to temp store failed: %s, %s\n", blockID, createErr.Error())
 	} else {
-		log.Printf("info: requested block:%s, received block: %s\n", blockID, newCid)
+		log.Printf("info: requested block:%s, received block: %d bytes\n", blockID, len(data))
 	}
 
-	return data, err
+	return data, nil
 }
 
 // GetRemoteBlock - gets remote block with given cid (aka content identifier) from p2p network.
 //
 // Flow:
 // 1. Finds provider for given block cid
-// 2. Fetches block from found provider (currently first provider) via `/blockstorage/block/read/1.0.0` peer protocol
+// 2. Fetches block from found provider (currently first provider) via `/blockstorage/block/read/1.1.0` peer protocol
 // 3. Persists fetched block to temporary object store.
 // 4. Returns encoded/marshalled block
 //
 // Error:
-// When any of the flow operations fail, returns `nil` with error cause
+// - When peer is closed returns `ErrPeerClosed`
+// - When any of the flow operations fail, returns `nil` with error cause
 func (p *peer) GetRemoteBlock(ctx context.Context, blockID cid.Cid) ([]byte, error) {
 	ctxErr := util.CheckContext(ctx)
 	if ctxErr != nil {
 		return nil, ctxErr
 	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.inflight.Done()
 
 	if p.store.HasObject(ctx, blockID) {
 		if p.debug {
@@ -165,7 +244,7 @@ func (p *peer) GetRemoteBlock(ctx context.Context, blockID cid.Cid) ([]byte, err
 		return nil, err
 	}
 
-	block, blockErr := blockpb.Decode(data)
+	block, blockErr := blockpb.DecodeNode(blockID, data)
 	if blockErr != nil {
 		log.Printf("err: decoding block failed: %s, %s\n", blockID, blockErr.Error())
 		return nil, blockErr
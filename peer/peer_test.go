@@ -2,29 +2,18 @@ package peer
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"sync"
 	"testing"
-	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/igumus/blockstorage/blockpb"
 	"github.com/igumus/go-objectstore-lib/mock"
 	"github.com/ipfs/go-cid"
-	"github.com/libp2p/go-libp2p"
-	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
-
-	libpeer "github.com/libp2p/go-libp2p-core/peer"
-	"github.com/libp2p/go-libp2p-core/peerstore"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
-	routedhost "github.com/libp2p/go-libp2p/p2p/host/routed"
-	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
-	ma "github.com/multiformats/go-multiaddr"
 	mh "github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -37,107 +26,18 @@ const bootstrapPeerFormat = bootstrapListenAddrString + "/p2p/%s"
 const basePeerPort = 5000
 const peerListenAddrStringFormat = "/ip4/127.0.0.1/tcp/%d"
 
-func generateKeyPair(ctx context.Context) (crypto.PrivKey, error) {
-	sk, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
-	if err != nil {
-		return nil, err
-	}
-	return sk, nil
-}
-
-func convertPeers(peers []string) []libpeer.AddrInfo {
-	pinfos := make([]libpeer.AddrInfo, len(peers))
-	for i, addr := range peers {
-		maddr := ma.StringCast(addr)
-		p, err := libpeer.AddrInfoFromP2pAddr(maddr)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		pinfos[i] = *p
+// makeTestHost - creates host and DHT of test peer via default peer construction (see `newDefaultHost`)
+func makeTestHost(ctx context.Context, opts ...PeerOption) (host.Host, *dht.IpfsDHT, error) {
+	cfg := defaultPeerConfig()
+	for _, opt := range opts {
+		opt(cfg)
 	}
-	return pinfos
-}
-
-func makeHost(ctx context.Context, listenAddr string) (host.Host, error) {
-	sk, err := generateKeyPair(ctx)
-	if err != nil {
-		log.Printf("err: generation key pair failed: %s\n", err.Error())
-		return nil, err
-	}
-	connmgr, err := connmgr.NewConnManager(
-		100,
-		400,
-		connmgr.WithGracePeriod(time.Minute),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	host, err := libp2p.New(
-		libp2p.Identity(sk),
-		libp2p.ListenAddrStrings(listenAddr),
-		libp2p.ConnectionManager(connmgr),
-		libp2p.DefaultTransports,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return host, nil
+	return newDefaultHost(ctx, cfg)
 }
 
 func makeBootstrapPeer(ctx context.Context) (host.Host, error) {
-	host, err := makeHost(ctx, bootstrapListenAddrString)
-	if err != nil {
-		return nil, err
-	}
-
-	idht, err := dht.New(ctx, host, dht.Mode(dht.ModeServer))
-	if err != nil {
-		return host, err
-	}
-
-	if err := idht.Bootstrap(ctx); err != nil {
-		log.Printf("warn: dht bootstrapping failed: %s\n", err.Error())
-	}
-	rhost := routedhost.Wrap(host, idht)
-
-	return rhost, nil
-}
-
-func connectBootstrapPeer(ctx context.Context, ph host.Host, peers ...libpeer.AddrInfo) error {
-	if len(peers) < 1 {
-		return errors.New("not enough bootstrap peers")
-	}
-
-	errs := make(chan error, len(peers))
-	var wg sync.WaitGroup
-	for _, p := range peers {
-		wg.Add(1)
-		go func(p libpeer.AddrInfo) {
-			defer wg.Done()
-			ph.Peerstore().AddAddrs(p.ID, p.Addrs, peerstore.PermanentAddrTTL)
-			if err := ph.Connect(ctx, p); err != nil {
-				log.Println(ctx, "bootstrapDialFailed", p.ID)
-				log.Printf("failed to bootstrap with %v: %s", p.ID, err)
-				errs <- err
-				return
-			}
-		}(p)
-	}
-	wg.Wait()
-
-	close(errs)
-	count := 0
-	var err error
-	for err = range errs {
-		if err != nil {
-			count++
-		}
-	}
-	if count == len(peers) {
-		return fmt.Errorf("failed to bootstrap. %s", err)
-	}
-	return nil
+	host, _, err := makeTestHost(ctx, WithListenAddrs(bootstrapListenAddrString), WithDHTMode(dht.ModeServer))
+	return host, err
 }
 
 func makePeer(ctx context.Context, peerSeq int, bootstrapID string) (host.Host, *dht.IpfsDHT, error) {
@@ -145,30 +45,10 @@ func makePeer(ctx context.Context, peerSeq int, bootstrapID string) (host.Host,
 	listenAddr := fmt.Sprintf(peerListenAddrStringFormat, port)
 	log.Printf("info: new peer with listen addr: %s\n", listenAddr)
 
-	host, err := makeHost(ctx, listenAddr)
-	if err != nil {
-		return nil, nil, err
-	}
 	bootstrapAddr := fmt.Sprintf(bootstrapPeerFormat, bootstrapID)
 	log.Printf("info: bootstrap peer addr: %s\n", bootstrapAddr)
 
-	bootstrapHosts := convertPeers([]string{bootstrapAddr})
-
-	idht, err := dht.New(ctx, host, dht.BootstrapPeersFunc(func() []libpeer.AddrInfo {
-		return bootstrapHosts
-	}))
-	if err != nil {
-		return host, nil, err
-	}
-
-	connectBootstrapPeer(ctx, host, bootstrapHosts...)
-
-	if err := idht.Bootstrap(ctx); err != nil {
-		log.Printf("warn: dht bootstrapping failed: %s\n", err.Error())
-	}
-
-	rhost := routedhost.Wrap(host, idht)
-	return rhost, idht, nil
+	return makeTestHost(ctx, WithListenAddrs(listenAddr), WithBootstrapPeers(bootstrapAddr))
 }
 
 type peerSuite struct {
@@ -178,6 +58,7 @@ type peerSuite struct {
 	ctrl          *gomock.Controller
 	bootstrapHost host.Host
 	digestPrefix  cid.Prefix
+	nodePrefix    cid.Prefix
 }
 
 func TestPeerSuite(t *testing.T) {
@@ -196,6 +77,8 @@ func (s *peerSuite) SetupTest() {
 		MhType:   mh.SHA2_256,
 		MhLength: -1,
 	}
+	s.nodePrefix = s.digestPrefix
+	s.nodePrefix.Codec = blockpb.BlockCodec
 }
 
 func (s *peerSuite) TearDownTest() {
@@ -298,13 +181,13 @@ func (s *peerSuite) TestFetchingSubNodes() {
 	child1 := &blockpb.Block{Data: []byte("selam1")}
 	bin1, err := blockpb.Encode(child1)
 	require.NoError(s.T(), err)
-	child1_ID, err := s.digestPrefix.Sum(bin1)
+	child1_ID, err := s.nodePrefix.Sum(bin1)
 	require.NoError(s.T(), err)
 
 	child2 := &blockpb.Block{Data: []byte("selam2")}
 	bin2, err := blockpb.Encode(child2)
 	require.NoError(s.T(), err)
-	child2_ID, err := s.digestPrefix.Sum(bin2)
+	child2_ID, err := s.nodePrefix.Sum(bin2)
 	require.NoError(s.T(), err)
 
 	links := append([]*blockpb.Link{}, &blockpb.Link{Hash: child1_ID.String()}, &blockpb.Link{Hash: child2_ID.String()})
@@ -312,7 +195,7 @@ func (s *peerSuite) TestFetchingSubNodes() {
 	block := &blockpb.Block{Name: "selams.txt", Links: links}
 	bin, err := blockpb.Encode(block)
 	require.NoError(s.T(), err)
-	blockID, err := s.digestPrefix.Sum(bin)
+	blockID, err := s.nodePrefix.Sum(bin)
 	require.NoError(s.T(), err)
 
 	h1, dht1, err := makePeer(ctx, 1, s.bootstrapHost.ID().String())
@@ -364,3 +247,115 @@ func (s *peerSuite) TestFetchingSubNodes() {
 	require.True(s.T(), peer2.store.HasObject(ctx, child1_ID))
 	require.True(s.T(), peer2.store.HasObject(ctx, child2_ID))
 }
+
+func (s *peerSuite) TestFetchingRawLeaves() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leaf1 := []byte("selam1")
+	leaf1_ID, err := s.digestPrefix.Sum(leaf1)
+	require.NoError(s.T(), err)
+	leaf2 := []byte("selam2")
+	leaf2_ID, err := s.digestPrefix.Sum(leaf2)
+	require.NoError(s.T(), err)
+
+	links := append([]*blockpb.Link{},
+		&blockpb.Link{Hash: leaf1_ID.String(), Tsize: uint64(len(leaf1)), Type: blockpb.LinkType_RAW},
+		&blockpb.Link{Hash: leaf2_ID.String(), Tsize: uint64(len(leaf2)), Type: blockpb.LinkType_RAW})
+
+	block := &blockpb.Block{Name: "selams.txt", Links: links}
+	bin, err := blockpb.Encode(block)
+	require.NoError(s.T(), err)
+	blockID, err := s.nodePrefix.Sum(bin)
+	require.NoError(s.T(), err)
+
+	h1, dht1, err := makePeer(ctx, 1, s.bootstrapHost.ID().String())
+	require.NoError(s.T(), err)
+	defer dht1.Close()
+	defer h1.Close()
+
+	permanentStore1 := mock.NewMockObjectStore(s.ctrl)
+	temporaryStore1 := mock.NewMockObjectStore(s.ctrl)
+	peer1, err := newBlockStoragePeer(ctx, EnableDebugMode(), WithMaxProviderCount(1), WithContentRouter(dht1), WithHost(h1), WithTempStore(temporaryStore1))
+	require.NoError(s.T(), err)
+	peer1.RegisterReadProtocol(ctx, permanentStore1)
+	require.True(s.T(), peer1.AnnounceBlock(ctx, blockID))
+
+	permanentStore1.EXPECT().ReadObject(gomock.Any(), leaf1_ID).Times(1).Return(leaf1, nil)
+	permanentStore1.EXPECT().ReadObject(gomock.Any(), leaf2_ID).Times(1).Return(leaf2, nil)
+	permanentStore1.EXPECT().ReadObject(gomock.Any(), blockID).Times(1).Return(bin, nil)
+
+	h2, dht2, err := makePeer(ctx, 2, s.bootstrapHost.ID().String())
+	require.NoError(s.T(), err)
+	defer dht2.Close()
+	defer h2.Close()
+	fsmap := make(map[cid.Cid][]byte)
+
+	temporaryStore2 := mock.NewMockObjectStore(s.ctrl)
+	temporaryStore2.EXPECT().HasObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) bool {
+		_, ok := fsmap[id]
+		return ok
+	})
+	temporaryStore2.EXPECT().ReadObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) ([]byte, error) {
+		return fsmap[id], nil
+	})
+	temporaryStore2.EXPECT().CreateObject(gomock.Any(), gomock.Any()).Times(3).DoAndReturn(func(_ context.Context, r io.Reader) (cid.Cid, error) {
+		data, err := ioutil.ReadAll(r)
+		require.NoError(s.T(), err)
+		id, err := s.digestPrefix.Sum(data)
+		require.NoError(s.T(), err)
+
+		fsmap[id] = data
+		return id, nil
+	})
+	peer2, err := newBlockStoragePeer(ctx, EnableDebugMode(), WithMaxProviderCount(1), WithContentRouter(dht2), WithHost(h2), WithTempStore(temporaryStore2))
+	require.NoError(s.T(), err)
+
+	_, err = peer2.GetRemoteBlock(ctx, blockID)
+	require.Nil(s.T(), err)
+
+	data, err := peer2.GetRemoteBlock(ctx, leaf1_ID)
+	require.Nil(s.T(), err)
+	require.Equal(s.T(), leaf1, data)
+	data, err = peer2.GetRemoteBlock(ctx, leaf2_ID)
+	require.Nil(s.T(), err)
+	require.Equal(s.T(), leaf2, data)
+}
+
+func (s *peerSuite) TestDeniedPeer() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	block := &blockpb.Block{Data: []byte("selam")}
+	bin, err := blockpb.Encode(block)
+	require.NoError(s.T(), err)
+	blockID, err := s.digestPrefix.Sum(bin)
+	require.NoError(s.T(), err)
+
+	h1, dht1, err := makePeer(ctx, 1, s.bootstrapHost.ID().String())
+	require.NoError(s.T(), err)
+	defer dht1.Close()
+	defer h1.Close()
+
+	h2, dht2, err := makePeer(ctx, 2, s.bootstrapHost.ID().String())
+	require.NoError(s.T(), err)
+	defer dht2.Close()
+	defer h2.Close()
+
+	// denied peer is refused before block is read, so permanent store expects no read
+	permanentStore1 := mock.NewMockObjectStore(s.ctrl)
+	temporaryStore1 := mock.NewMockObjectStore(s.ctrl)
+	peer1, err := newBlockStoragePeer(ctx, EnableDebugMode(), WithMaxProviderCount(1), WithContentRouter(dht1), WithHost(h1), WithTempStore(temporaryStore1), WithDeniedPeers(h2.ID()))
+	require.NoError(s.T(), err)
+	peer1.RegisterReadProtocol(ctx, permanentStore1)
+	require.True(s.T(), peer1.AnnounceBlock(ctx, blockID))
+
+	temporaryStore2 := mock.NewMockObjectStore(s.ctrl)
+	temporaryStore2.EXPECT().HasObject(gomock.Any(), blockID).AnyTimes().Return(false)
+	peer2, err := newBlockStoragePeer(ctx, EnableDebugMode(), WithMaxProviderCount(1), WithContentRouter(dht2), WithHost(h2), WithTempStore(temporaryStore2))
+	require.NoError(s.T(), err)
+
+	_, err = peer2.GetRemoteBlock(ctx, blockID)
+	require.Equal(s.T(), ErrBlockAccessDenied, err)
+	require.False(s.T(), peer2.store.HasObject(ctx, blockID))
+}
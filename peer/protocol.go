@@ -5,6 +5,7 @@ import (
 	"context"
 	"log"
 
+	"github.com/igumus/blockstorage/blockpb"
 	"github.com/igumus/go-objectstore-lib"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/network"
@@ -12,40 +13,64 @@ import (
 )
 
 // BlockReadProtocol - holds libp2p protocol identifier for reading block from remote peer
-const BlockReadProtocolID = protocol.ID("/blockstorage/block/read/1.0.0")
+const BlockReadProtocolID = protocol.ID("/blockstorage/block/read/1.1.0")
+
+// Status bytes of read protocol response: block content follows `readStatusOK`, while `readStatusDenied` is sent
+// alone when remote peer is not allowed to read the block.
+const (
+	readStatusOK     byte = 0
+	readStatusDenied byte = 1
+)
 
 type ReadProtocol network.StreamHandler
 
-func generateReadProtocol(store objectstore.ObjectStore) func(network.Stream) {
+// generateReadProtocol - generates stream handler which serves blocks of given store. Remote peer and requested
+// cid are checked with given access control before block is read, and refused peers receive denial status.
+// Served block content is verified with prefix (version, codec, hash function) of requested cid, stream is reset
+// on any other failure.
+func generateReadProtocol(store objectstore.ObjectStore, access *accessControl) func(network.Stream) {
 	return func(stream network.Stream) {
 		reader := bufio.NewReader(stream)
 		_, cid, err := cid.CidFromReader(reader)
 		if err != nil {
 			log.Printf("err: decoding cid failed: %s\n", err.Error())
 			stream.Reset()
+			return
+		}
+
+		remote := stream.Conn().RemotePeer()
+		log.Printf("info: incoming cid is : %s, %s\n", cid, remote)
+		if !access.allow(context.Background(), remote, cid) {
+			log.Printf("warn: denied block to peer: %s, %s\n", cid, remote)
+			if _, err := stream.Write([]byte{readStatusDenied}); err != nil {
+				stream.Reset()
+				return
+			}
+			stream.CloseWrite()
+			return
 		}
 
-		log.Printf("info: incoming cid is : %s\n", cid)
 		data, err := store.ReadObject(context.Background(), cid)
 		if err != nil {
 			log.Printf("err: reading block object failed in stream: %s, %s\n", cid, err.Error())
 			stream.Reset()
+			return
 		}
 
-		newCid, err := objectstore.DigestPrefix.Sum(data)
-		if err != nil {
-			log.Printf("warn: digesting block data failed: %s\n", err.Error())
-		} else {
-			log.Printf("info: compare digests: %s, %s, %t\n", cid, newCid, newCid.Equals(cid))
+		if ok, err := blockpb.Verify(cid, data); err != nil || !ok {
+			log.Printf("err: verifying block object failed in stream: %s\n", cid)
+			stream.Reset()
+			return
 		}
 
-		n, err := stream.Write(data)
+		n, err := stream.Write(append([]byte{readStatusOK}, data...))
 		if err != nil {
 			log.Printf("err: writing block content to stream failed: %s, %s\n", cid, err.Error())
 			stream.Reset()
+			return
 		}
 
-		log.Printf("info: written block content to stream successfully: %d bytes\n", n)
+		log.Printf("info: written block content to stream successfully: %d bytes\n", n-1)
 		stream.CloseWrite()
 	}
 }
@@ -0,0 +1,275 @@
+package peer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/car"
+	"github.com/igumus/blockstorage/util"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/network"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// BlockPushProtocolID - holds libp2p protocol identifier for pushing DAG to remote peer (e.g. replication,
+// migration, warm-up of new nodes)
+const BlockPushProtocolID = protocol.ID("/blockstorage/block/push/1.0.0")
+
+// ErrBlockPushFailed is return, when remote peer fails to store pushed block.
+var ErrBlockPushFailed = errors.New("blockstorage: remote peer failed to store pushed block")
+
+// ErrBlockPushNotPersisted is return, when remote peer stores pushed blocks to its temporary store, so blocks are
+// neither persisted permanently nor announced (e.g. warm-up).
+var ErrBlockPushNotPersisted = errors.New("blockstorage: remote peer stored pushed blocks to temporary store")
+
+// Status bytes of push protocol. Receiver answers CAR header with `pushStatusOK` (permanent store),
+// `pushStatusCached` (temporary store) or `pushStatusDenied`, and each block with status followed by cid of the
+// block. Receiver stops reading after first failed block.
+const (
+	pushStatusOK        byte = 0
+	pushStatusDenied    byte = 1
+	pushStatusCorrupted byte = 2
+	pushStatusFailed    byte = 3
+	pushStatusCached    byte = 4
+)
+
+// BlockReceiver - persists verified block pushed by remote peer with given id to permanent store
+type BlockReceiver func(ctx context.Context, remote libpeer.ID, id cid.Cid, data []byte) error
+
+// DAGWriter - writes DAG to `w` in CARv1 format (see `car` package), with root of the DAG in header
+type DAGWriter func(w io.Writer) error
+
+// generatePushProtocol - generates stream handler which stores DAGs pushed by remote peers. Root of pushed DAG
+// is checked with push policy of given access control, and refused peers receive denial status. Each block is
+// verified against its cid, and persisted to temporary store or passed to given receiver regarding policy.
+func (p *peer) generatePushProtocol(receiver BlockReceiver) func(network.Stream) {
+	return func(stream network.Stream) {
+		remote := stream.Conn().RemotePeer()
+		reader, err := car.NewReader(stream)
+		if err != nil {
+			log.Printf("err: decoding pushed car header failed: %s, %s\n", remote, err.Error())
+			stream.Reset()
+			return
+		}
+
+		root := reader.Roots[0]
+		target := p.access.allowPush(context.Background(), remote, root)
+		if target == PushDenied {
+			log.Printf("warn: denied push of peer: %s, %s\n", root, remote)
+			if _, err := stream.Write([]byte{pushStatusDenied}); err != nil {
+				stream.Reset()
+				return
+			}
+			stream.Close()
+			return
+		}
+		accepted := pushStatusOK
+		if target != PushToPermanentStore {
+			accepted = pushStatusCached
+		}
+		if _, err := stream.Write([]byte{accepted}); err != nil {
+			stream.Reset()
+			return
+		}
+
+		count := 0
+		for {
+			id, data, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Printf("err: decoding pushed block failed: %s, %s\n", remote, err.Error())
+				stream.Reset()
+				return
+			}
+
+			status := pushStatusOK
+			if ok, err := blockpb.Verify(id, data); err != nil || !ok {
+				log.Printf("err: verifying pushed block failed: %s, %s\n", id, remote)
+				status = pushStatusCorrupted
+			} else if err := p.storePushed(context.Background(), target, receiver, remote, id, data); err != nil {
+				log.Printf("err: storing pushed block failed: %s, %s\n", id, err.Error())
+				status = pushStatusFailed
+			}
+			bin, err := id.MarshalBinary()
+			if err != nil {
+				stream.Reset()
+				return
+			}
+			if _, err := stream.Write(append([]byte{status}, bin...)); err != nil {
+				stream.Reset()
+				return
+			}
+			if status != pushStatusOK {
+				// rest of the DAG is not read, so reading side is closed as well
+				stream.Close()
+				return
+			}
+			count++
+		}
+
+		log.Printf("info: stored pushed dag: %s, %d blocks, %s\n", root, count, remote)
+		stream.Close()
+	}
+}
+
+// storePushed - persists verified pushed block to temporary store, or passes it to given receiver when policy
+// targets permanent store. Existing blocks of temporary store are not rewritten.
+func (p *peer) storePushed(ctx context.Context, target PushTarget, receiver BlockReceiver, remote libpeer.ID, id cid.Cid, data []byte) error {
+	if target == PushToPermanentStore {
+		return receiver(ctx, remote, id, data)
+	}
+	if p.store.HasObject(ctx, id) {
+		return nil
+	}
+	return p.store.PutObject(ctx, id, data)
+}
+
+// RegisterPushProtocol - stores DAGs pushed by remote peers (see `Push`) via `BlockPushProtocolID`, until peer is
+// closed (see `Close`). Pushes are authorized with push policy (see `WithPushPolicy`), and blocks targeting
+// permanent store are passed to given receiver.
+func (p *peer) RegisterPushProtocol(ctx context.Context, receiver BlockReceiver) {
+	p.host.SetStreamHandler(BlockPushProtocolID, p.trackStream(p.generatePushProtocol(receiver)))
+}
+
+// Push - pushes DAG written by given writer to remote peer with given id via `BlockPushProtocolID`. Blocks are
+// written while acknowledgements of remote peer are read, and returns count of blocks acknowledged by remote peer.
+//
+// Error:
+// - When peer is closed returns `0, ErrPeerClosed`
+// - When remote peer refuses push returns `0, ErrBlockAccessDenied`
+// - When remote peer reports block not matching with its cid returns `ErrBlockDataCorrupted`
+// - When remote peer fails to store a block returns `ErrBlockPushFailed`
+// - When remote peer stores blocks to its temporary store returns count with `ErrBlockPushNotPersisted`, so
+// remote peer is not a holder of the DAG (e.g. replica)
+// - When opening stream, writing DAG or reading acknowledgements fails returns error cause
+// Blocks acknowledged until failure are kept by remote peer.
+func (p *peer) Push(ctx context.Context, target libpeer.ID, writer DAGWriter) (int, error) {
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return 0, ctxErr
+	}
+	if err := p.enter(); err != nil {
+		return 0, err
+	}
+	defer p.inflight.Done()
+
+	stream, err := p.host.NewStream(ctx, target, BlockPushProtocolID)
+	if err != nil {
+		log.Printf("err: creating stream failed: %s, %s\n", target, err.Error())
+		return 0, err
+	}
+	defer stream.Close()
+
+	written := make(chan error, 1)
+	go func() {
+		err := writer(stream)
+		// closing writing side ends DAG, so remote peer stops (truncated DAG is refused) and closes stream
+		if closeErr := stream.CloseWrite(); err == nil {
+			err = closeErr
+		}
+		written <- err
+	}()
+
+	count, err := readPushAcks(bufio.NewReader(stream))
+	if err != nil {
+		stream.Reset()
+	}
+	writeErr := <-written
+	switch err {
+	case ErrBlockAccessDenied, ErrBlockDataCorrupted, ErrBlockPushFailed:
+	default:
+		// failure reported by remote peer is the cause, otherwise reading fails when writing fails
+		if writeErr != nil {
+			err = writeErr
+		}
+	}
+	if err != nil {
+		log.Printf("warn: pushing dag to peer failed: %s, %d blocks, %s\n", target, count, err.Error())
+		return count, err
+	}
+	log.Printf("info: pushed dag to peer: %s, %d blocks\n", target, count)
+	return count, nil
+}
+
+// readPushAcks - reads header status and block acknowledgements of push protocol until remote peer closes stream,
+// and returns count of acknowledged blocks. When header status reports temporary store, acknowledged blocks are
+// returned with `ErrBlockPushNotPersisted`.
+func readPushAcks(reader *bufio.Reader) (int, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if header == pushStatusDenied {
+		return 0, ErrBlockAccessDenied
+	}
+	count := 0
+	for {
+		status, err := reader.ReadByte()
+		if err == io.EOF {
+			if header == pushStatusCached {
+				return count, ErrBlockPushNotPersisted
+			}
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		_, id, err := cid.CidFromReader(reader)
+		if err != nil {
+			return count, err
+		}
+		switch status {
+		case pushStatusOK:
+			count++
+		case pushStatusCorrupted:
+			log.Printf("err: remote peer reported corrupted block: %s\n", id)
+			return count, ErrBlockDataCorrupted
+		default:
+			log.Printf("err: remote peer failed to store block: %s\n", id)
+			return count, ErrBlockPushFailed
+		}
+	}
+}
+
+// FindProviders - returns up to given count of remote peers which announced ownership of given cid (aka content
+// identifier). Host itself is not included, so returned peers hold remote copies of the block.
+//
+// Error:
+// When search is interrupted by context returns `nil` with error cause. Having no remote provider is not an error.
+func (p *peer) FindProviders(ctx context.Context, blockID cid.Cid, count int) ([]libpeer.ID, error) {
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
+	ret := make([]libpeer.ID, 0, count)
+	// host may be one of the providers, so one more provider is asked
+	for provider := range p.contentRouter.FindProvidersAsync(ctx, blockID, count+1) {
+		if provider.ID != p.host.ID() && len(ret) < count {
+			ret = append(ret, provider.ID)
+		}
+	}
+	ctxErr = util.CheckContext(ctx)
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
+	return ret, nil
+}
+
+// PushPeers - returns connected peers which support push protocol, so DAGs (e.g. replicas) can be pushed to them
+func (p *peer) PushPeers() []libpeer.ID {
+	ret := make([]libpeer.ID, 0)
+	for _, id := range p.host.Network().Peers() {
+		protocols, err := p.host.Peerstore().SupportsProtocols(id, string(BlockPushProtocolID))
+		if err == nil && len(protocols) > 0 {
+			ret = append(ret, id)
+		}
+	}
+	return ret
+}
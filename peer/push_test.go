@@ -0,0 +1,145 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage/car"
+	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *peerSuite) TestPush() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	blocks := make([]cid.Cid, 0, 3)
+	contents := make(map[cid.Cid][]byte)
+	for _, data := range []string{"root", "first", "second"} {
+		id, err := s.digestPrefix.Sum([]byte(data))
+		require.NoError(s.T(), err)
+		blocks = append(blocks, id)
+		contents[id] = []byte(data)
+	}
+	failing, err := s.digestPrefix.Sum([]byte("failing"))
+	require.NoError(s.T(), err)
+	// writerOf - returns writer of DAG with given blocks, first block is root. Block with nil content is written
+	// with corrupted content.
+	writerOf := func(ids ...cid.Cid) DAGWriter {
+		return func(w io.Writer) error {
+			writer, err := car.NewWriter(w, ids[0])
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				data, ok := contents[id]
+				if !ok {
+					data = []byte("corrupted")
+				}
+				if err := writer.WriteBlock(id, data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	// temporary store of warm-up peer
+	lock := sync.Mutex{}
+	cached := make(map[cid.Cid][]byte)
+	tempStore := mock.NewMockObjectStore(s.ctrl)
+	tempStore.EXPECT().HasObject(gomock.Any(), gomock.Any()).AnyTimes().Return(false)
+	tempStore.EXPECT().CreateObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, r io.Reader) (cid.Cid, error) {
+		data, err := ioutil.ReadAll(r)
+		require.NoError(s.T(), err)
+		id, err := s.digestPrefix.Sum(data)
+		require.NoError(s.T(), err)
+		lock.Lock()
+		defer lock.Unlock()
+		cached[id] = data
+		return id, nil
+	})
+
+	shared := &memoryRouter{providers: make(map[cid.Cid]map[libpeer.ID]libpeer.AddrInfo)}
+	hosts := make([]host.Host, 0, 3)
+	for i := 0; i < 3; i++ {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(s.T(), err)
+		defer h.Close()
+		hosts = append(hosts, h)
+	}
+	// sender, permanent receiver which only accepts sender, and warm-up receiver which accepts every peer
+	policies := []PushPolicy{nil, AllowPush(PushToPermanentStore, hosts[0].ID()), AllowPush(PushToTempStore)}
+	tempStores := []*mock.MockObjectStore{mock.NewMockObjectStore(s.ctrl), mock.NewMockObjectStore(s.ctrl), tempStore}
+	peers := make([]*peer, 0, 3)
+	for i, h := range hosts {
+		p, err := newBlockStoragePeer(ctx, WithHost(h), WithContentRouter(shared.routerOf(h)), WithTempStore(tempStores[i]), WithPushPolicy(policies[i]))
+		require.NoError(s.T(), err)
+		defer p.Close()
+		peers = append(peers, p)
+	}
+
+	received := make(map[cid.Cid][]byte)
+	receiver := func(ctx context.Context, remote libpeer.ID, id cid.Cid, data []byte) error {
+		if id.Equals(failing) {
+			return errors.New("storing block failed")
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		received[id] = data
+		return nil
+	}
+	peers[1].RegisterPushProtocol(ctx, receiver)
+	peers[2].RegisterPushProtocol(ctx, receiver)
+	for _, h := range hosts[1:] {
+		require.NoError(s.T(), hosts[0].Connect(ctx, libpeer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}))
+	}
+	require.NoError(s.T(), hosts[2].Connect(ctx, libpeer.AddrInfo{ID: hosts[1].ID(), Addrs: hosts[1].Addrs()}))
+	require.Eventually(s.T(), func() bool {
+		return len(peers[0].PushPeers()) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// every block is acknowledged, and persisted regarding push policy of receiver
+	count, err := peers[0].Push(ctx, hosts[1].ID(), writerOf(blocks...))
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 3, count)
+	require.Equal(s.T(), contents, received)
+	// warm-up receiver keeps blocks in temporary store, so it is not reported as holder
+	count, err = peers[0].Push(ctx, hosts[2].ID(), writerOf(blocks...))
+	require.Equal(s.T(), ErrBlockPushNotPersisted, err)
+	require.Equal(s.T(), 3, count)
+	require.Equal(s.T(), contents, cached)
+
+	// pushing stops at first block which is not verified or stored
+	count, err = peers[0].Push(ctx, hosts[1].ID(), writerOf(blocks[0], blocks[1], failing, blocks[2]))
+	require.Equal(s.T(), ErrBlockDataCorrupted, err)
+	require.Equal(s.T(), 2, count)
+	contents[failing] = []byte("failing")
+	count, err = peers[0].Push(ctx, hosts[1].ID(), writerOf(blocks[0], failing, blocks[2]))
+	require.Equal(s.T(), ErrBlockPushFailed, err)
+	require.Equal(s.T(), 1, count)
+
+	// peer not authorized by push policy is refused
+	count, err = peers[2].Push(ctx, hosts[1].ID(), writerOf(blocks...))
+	require.Equal(s.T(), ErrBlockAccessDenied, err)
+	require.Equal(s.T(), 0, count)
+
+	// host itself is not counted as holder of its own block
+	require.True(s.T(), peers[0].AnnounceBlock(ctx, blocks[0]))
+	require.NoError(s.T(), shared.routerOf(hosts[1]).Provide(ctx, blocks[0], true))
+	holders, err := peers[0].FindProviders(ctx, blocks[0], 3)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), []libpeer.ID{hosts[1].ID()}, holders)
+	holders, err = peers[0].FindProviders(ctx, blocks[1], 3)
+	require.NoError(s.T(), err)
+	require.Empty(s.T(), holders)
+}
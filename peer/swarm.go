@@ -0,0 +1,68 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/pnet"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	ws "github.com/libp2p/go-libp2p/p2p/transport/websocket"
+)
+
+var ErrSwarmKeyNotValid = errors.New("[blockstorage] peer configuration failed: swarm key should be 32 bytes")
+var ErrDHTProtocolPrefixNotValid = errors.New("[blockstorage] peer configuration failed: dht protocol prefix should start with /")
+
+// swarmKeyLen - holds length of private network pre-shared key in bytes
+const swarmKeyLen = 32
+
+// DefaultDHTProtocolPrefix - holds kad-dht protocol prefix of blockstorage swarm, which separates routing tables
+// of blockstorage nodes from public DHT (`/ipfs`)
+const DefaultDHTProtocolPrefix = protocol.ID("/blockstorage")
+
+// DecodeSwarmKey - decodes private network pre-shared key from given reader, which holds swarm key file in
+// `/key/swarm/psk/1.0.0/` format (e.g. IPFS `swarm.key` file).
+//
+// Error:
+// When swarm key file is malformed or holds less than 32 bytes, returns `nil` with error cause
+func DecodeSwarmKey(r io.Reader) (pnet.PSK, error) {
+	return pnet.DecodeV1PSK(r)
+}
+
+// NewSwarmHost - creates libp2p host which only connects to peers sharing given pre-shared key, so nodes outside
+// of swarm can not dial host (or be dialed by it) and can not open any protocol stream (e.g. `BlockReadProtocolID`).
+// Host uses TCP and websocket transports, as QUIC does not support private networks. Given options (e.g. identity,
+// listen addresses) are applied after private network options.
+//
+// Error:
+// When key is not 32 bytes returns `ErrSwarmKeyNotValid`, otherwise host creation error cause
+func NewSwarmHost(psk pnet.PSK, opts ...libp2p.Option) (host.Host, error) {
+	if len(psk) != swarmKeyLen {
+		return nil, ErrSwarmKeyNotValid
+	}
+	options := []libp2p.Option{
+		libp2p.PrivateNetwork(psk),
+		libp2p.Transport(tcp.NewTCPTransport),
+		libp2p.Transport(ws.New),
+	}
+	return libp2p.New(append(options, opts...)...)
+}
+
+// NewSwarmDHT - creates kad-dht of given host with given protocol prefix (e.g. `DefaultDHTProtocolPrefix`), so
+// routing table and provider records are only shared with nodes using same prefix. Given options (e.g. mode,
+// bootstrap peers) are applied after protocol prefix.
+//
+// Error:
+// When prefix does not start with `/` returns `ErrDHTProtocolPrefixNotValid`, otherwise dht creation error cause
+func NewSwarmDHT(ctx context.Context, h host.Host, prefix protocol.ID, opts ...dht.Option) (*dht.IpfsDHT, error) {
+	if !strings.HasPrefix(string(prefix), "/") {
+		return nil, ErrDHTProtocolPrefixNotValid
+	}
+	options := []dht.Option{dht.ProtocolPrefix(prefix)}
+	return dht.New(ctx, h, append(options, opts...)...)
+}
@@ -0,0 +1,197 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/pnet"
+	"github.com/stretchr/testify/require"
+)
+
+// swarmListenAddr - holds listen address of swarm test hosts (random port)
+const swarmListenAddr = "/ip4/127.0.0.1/tcp/0"
+
+// generateSwarmKey - generates random pre-shared key of private network
+func generateSwarmKey(t *testing.T) pnet.PSK {
+	psk := make([]byte, swarmKeyLen)
+	_, err := rand.Read(psk)
+	require.NoError(t, err)
+	return psk
+}
+
+// makeSwarmHost - creates host of private network with given key, or public host when key is `nil`
+func makeSwarmHost(t *testing.T, psk pnet.PSK) host.Host {
+	var h host.Host
+	var err error
+	if psk == nil {
+		h, err = libp2p.New(libp2p.ListenAddrStrings(swarmListenAddr))
+	} else {
+		h, err = NewSwarmHost(psk, libp2p.ListenAddrStrings(swarmListenAddr))
+	}
+	require.NoError(t, err)
+	return h
+}
+
+func TestDecodeSwarmKey(t *testing.T) {
+	psk := generateSwarmKey(t)
+	decoded, err := DecodeSwarmKey(bytes.NewReader([]byte("/key/swarm/psk/1.0.0/\n/base16/\n" + hex.EncodeToString(psk))))
+	require.NoError(t, err)
+	require.Equal(t, psk, decoded)
+
+	for _, file := range []string{
+		"/key/swarm/psk/1.0.0/\n/base16/\n" + hex.EncodeToString(psk[:16]),
+		"not a swarm key",
+	} {
+		_, err = DecodeSwarmKey(bytes.NewReader([]byte(file)))
+		require.Error(t, err)
+	}
+	_, err = NewSwarmHost(psk[:16])
+	require.Equal(t, ErrSwarmKeyNotValid, err)
+}
+
+func (s *peerSuite) TestPrivateSwarm() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	block := &blockpb.Block{Data: []byte("selam")}
+	bin, err := blockpb.Encode(block)
+	require.NoError(s.T(), err)
+	blockID, err := s.digestPrefix.Sum(bin)
+	require.NoError(s.T(), err)
+
+	psk := generateSwarmKey(s.T())
+	h1 := makeSwarmHost(s.T(), psk)
+	defer h1.Close()
+	_, err = NewSwarmDHT(ctx, h1, "blockstorage")
+	require.Equal(s.T(), ErrDHTProtocolPrefixNotValid, err)
+	dht1, err := NewSwarmDHT(ctx, h1, DefaultDHTProtocolPrefix)
+	require.NoError(s.T(), err)
+	defer dht1.Close()
+
+	permanentStore1 := mock.NewMockObjectStore(s.ctrl)
+	permanentStore1.EXPECT().ReadObject(gomock.Any(), blockID).Times(1).Return(bin, nil)
+	peer1, err := newBlockStoragePeer(ctx, EnableDebugMode(), WithContentRouter(dht1), WithHost(h1), WithTempStore(mock.NewMockObjectStore(s.ctrl)))
+	require.NoError(s.T(), err)
+	peer1.RegisterReadProtocol(ctx, permanentStore1)
+	provider := libpeer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}
+
+	s.T().Run("swarm_member", func(t *testing.T) {
+		h2 := makeSwarmHost(t, psk)
+		defer h2.Close()
+		dht2, err := NewSwarmDHT(ctx, h2, DefaultDHTProtocolPrefix)
+		require.NoError(t, err)
+		defer dht2.Close()
+
+		temporaryStore2 := mock.NewMockObjectStore(s.ctrl)
+		temporaryStore2.EXPECT().CreateObject(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(func(_ context.Context, _ io.Reader) (cid.Cid, error) {
+			return blockID, nil
+		})
+		peer2, err := newBlockStoragePeer(ctx, EnableDebugMode(), WithContentRouter(dht2), WithHost(h2), WithTempStore(temporaryStore2))
+		require.NoError(t, err)
+		require.NoError(t, h2.Connect(ctx, provider))
+
+		data, err := peer2.fetchRemoteBlock(ctx, blockID, provider)
+		require.NoError(t, err)
+		require.Equal(t, bin, data)
+	})
+
+	outsiders := []struct {
+		name string
+		psk  pnet.PSK
+	}{
+		{name: "public_host", psk: nil},
+		{name: "other_swarm", psk: generateSwarmKey(s.T())},
+	}
+	for i := range outsiders {
+		tc := outsiders[i]
+		s.T().Run(tc.name, func(t *testing.T) {
+			outsider := makeSwarmHost(t, tc.psk)
+			defer outsider.Close()
+
+			// handshake of outsider never completes, so dialing is bounded
+			dialCtx, dialCancel := context.WithTimeout(ctx, 2*time.Second)
+			defer dialCancel()
+			require.Error(t, outsider.Connect(dialCtx, provider))
+			_, err := outsider.NewStream(dialCtx, h1.ID(), BlockReadProtocolID)
+			require.Error(t, err)
+		})
+	}
+}
+
+func (s *peerSuite) TestSwarmPeerFetch() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	block := &blockpb.Block{Data: []byte("swarm")}
+	bin, err := blockpb.Encode(block)
+	require.NoError(s.T(), err)
+	blockID, err := s.digestPrefix.Sum(bin)
+	require.NoError(s.T(), err)
+
+	psk := generateSwarmKey(s.T())
+	// peer which owns host and DHT of private swarm with given key, or of public network when key is `nil`
+	newSwarmPeer := func(t *testing.T, psk pnet.PSK, store *mock.MockObjectStore) *peer {
+		var ret BlockStoragePeer
+		var err error
+		if psk == nil {
+			ret, err = NewDefaultBlockStoragePeer(ctx, WithTempStore(store), WithListenAddrs(swarmListenAddr))
+		} else {
+			ret, err = NewBlockStoragePeer(ctx, WithTempStore(store), WithListenAddrs(swarmListenAddr), WithSwarmKey(psk))
+		}
+		require.NoError(t, err)
+		return ret.(*peer)
+	}
+
+	permanentStore := mock.NewMockObjectStore(s.ctrl)
+	permanentStore.EXPECT().ReadObject(gomock.Any(), blockID).Times(1).Return(bin, nil)
+	provider := newSwarmPeer(s.T(), psk, mock.NewMockObjectStore(s.ctrl))
+	defer provider.Close()
+	provider.RegisterReadProtocol(ctx, permanentStore)
+	info := libpeer.AddrInfo{ID: provider.host.ID(), Addrs: provider.host.Addrs()}
+
+	s.T().Run("swarm_member", func(t *testing.T) {
+		temporaryStore := mock.NewMockObjectStore(s.ctrl)
+		temporaryStore.EXPECT().CreateObject(gomock.Any(), gomock.Any()).Times(1).Return(blockID, nil)
+		member := newSwarmPeer(t, psk, temporaryStore)
+		defer member.Close()
+		require.NoError(t, member.host.Connect(ctx, info))
+
+		data, err := member.fetchRemoteBlock(ctx, blockID, info)
+		require.NoError(t, err)
+		require.Equal(t, bin, data)
+	})
+
+	outsiders := []struct {
+		name string
+		psk  pnet.PSK
+	}{
+		{name: "public_peer", psk: nil},
+		{name: "other_swarm", psk: generateSwarmKey(s.T())},
+	}
+	for i := range outsiders {
+		tc := outsiders[i]
+		s.T().Run(tc.name, func(t *testing.T) {
+			outsider := newSwarmPeer(t, tc.psk, mock.NewMockObjectStore(s.ctrl))
+			defer outsider.Close()
+
+			// handshake of outsider never completes, so dialing and fetching are bounded
+			fetchCtx, fetchCancel := context.WithTimeout(ctx, 2*time.Second)
+			defer fetchCancel()
+			require.Error(t, outsider.host.Connect(fetchCtx, info))
+			_, err := outsider.fetchRemoteBlock(fetchCtx, blockID, info)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package blockstorage
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Captures/Represents chunk submitted to leaf persistence pipeline, and result of its persistence. `done` is
+// closed when result is set.
+type leafJob struct {
+	chunk []byte
+	leaf  *sizedLink
+	err   error
+	done  chan struct{}
+}
+
+// persistLeaves - reads chunks of `reader` (see `readChunks`), persists each chunk as leaf and appends it to
+// given state in content order. `onLeaf` (optional) is called with chunk after each leaf is appended.
+//
+// Flow:
+// 1. Reader loop submits each chunk to workers (see `WithWorkers`), which hash and persist chunks in parallel,
+// and to ordered queue
+// 2. Collector waits results in queue order, so leaves are appended (and `onLeaf` is called) in content order.
+// Parity of each complete stripe is persisted before `onLeaf` of its last leaf (see `addStripeLeaf`).
+// 3. Queue is bounded by worker count, so reader loop blocks (backpressure) when persistence is slower
+//
+// Error:
+// - When persisting any leaf (or `onLeaf`) fails, pipeline is cancelled and error cause is returned
+// - When reading fails, leaves of chunks read until failure are persisted and read error is returned
+func (s *storage) persistLeaves(ctx context.Context, reader io.Reader, state *fileState, onLeaf func([]byte) error) error {
+	pipeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *leafJob)
+	queue := make(chan *leafJob, s.workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if job.err = pipeCtx.Err(); job.err == nil {
+					job.leaf, job.err = s.persistLeaf(pipeCtx, job.chunk, state.key)
+				}
+				close(job.done)
+			}
+		}()
+	}
+
+	collected := make(chan error, 1)
+	go func() {
+		var err error
+		for job := range queue {
+			<-job.done
+			if err != nil {
+				continue
+			}
+			if err = job.err; err == nil {
+				state.leaves = append(state.leaves, job.leaf)
+				err = s.addStripeLeaf(pipeCtx, state, job.leaf)
+			}
+			if err == nil && onLeaf != nil {
+				err = onLeaf(job.chunk)
+			}
+			if err != nil {
+				cancel()
+			}
+		}
+		collected <- err
+	}()
+
+	_, readErr := s.readChunks(pipeCtx, reader, func(chunk []byte) error {
+		job := &leafJob{chunk: chunk, done: make(chan struct{})}
+		select {
+		case queue <- job:
+		case <-pipeCtx.Done():
+			return pipeCtx.Err()
+		}
+		jobs <- job
+		return nil
+	})
+	close(jobs)
+	close(queue)
+	wg.Wait()
+
+	// pipeline failure cancels reader loop, so its error is the cause
+	if err := <-collected; err != nil {
+		return err
+	}
+	return readErr
+}
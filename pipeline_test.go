@@ -0,0 +1,178 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+// latencyStore - wraps in-memory object store with latency (and optional failure) injected to object creation,
+// and latency injected to existence checks
+type latencyStore struct {
+	*memoryStore
+	latency func() time.Duration
+	fail    func([]byte) error
+}
+
+func (l *latencyStore) CreateObject(ctx context.Context, r io.Reader) (cid.Cid, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return cid.Undef, err
+	}
+	time.Sleep(l.latency())
+	if l.fail != nil {
+		if err := l.fail(data); err != nil {
+			return cid.Undef, err
+		}
+	}
+	return l.memoryStore.CreateObject(ctx, bytes.NewReader(data))
+}
+
+func (l *latencyStore) HasObject(ctx context.Context, id cid.Cid) bool {
+	time.Sleep(l.latency())
+	return l.memoryStore.HasObject(ctx, id)
+}
+
+// latencyDatastore - wraps datastore with latency injected to every read and write
+type latencyDatastore struct {
+	ds.Datastore
+	latency func() time.Duration
+}
+
+func (l *latencyDatastore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	time.Sleep(l.latency())
+	return l.Datastore.Get(ctx, key)
+}
+
+func (l *latencyDatastore) Has(ctx context.Context, key ds.Key) (bool, error) {
+	time.Sleep(l.latency())
+	return l.Datastore.Has(ctx, key)
+}
+
+func (l *latencyDatastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	time.Sleep(l.latency())
+	return l.Datastore.Put(ctx, key, value)
+}
+
+func (l *latencyDatastore) Delete(ctx context.Context, key ds.Key) error {
+	time.Sleep(l.latency())
+	return l.Datastore.Delete(ctx, key)
+}
+
+func (l *latencyDatastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	time.Sleep(l.latency())
+	return l.Datastore.Query(ctx, q)
+}
+
+func (s *blockStorageSuite) TestPersistLeavesOrder() {
+	ctx := context.Background()
+	data, err := ioutil.ReadAll(generateRandomByteReader(s.T(), 1000))
+	require.NoError(s.T(), err)
+
+	for _, encoding := range []Encoding{BlockPBEncoding, DagPBEncoding} {
+		// file roots without creation time, so digests are comparable
+		sequential := s.newTestStorage(WithEncoding(encoding), WithWorkers(1)).(*storage)
+		sequential.chunkSize = 16
+		expected, err := sequential.createFile(ctx, "file.bin", bytes.NewReader(data), false, nil)
+		require.NoError(s.T(), err)
+
+		// chunks complete out of order
+		store := &latencyStore{
+			memoryStore: newMemoryStore(s.T(), s.ctrl),
+			latency:     func() time.Duration { return time.Duration(rand.Intn(500)) * time.Microsecond },
+		}
+		parallel := s.newTestStorage(WithLocalStore(store), WithEncoding(encoding), WithWorkers(8)).(*storage)
+		parallel.chunkSize = 16
+		link, err := parallel.createFile(ctx, "file.bin", bytes.NewReader(data), false, nil)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), expected.Hash, link.Hash)
+
+		root, err := cid.Decode(link.Hash)
+		require.NoError(s.T(), err)
+		content := &bytes.Buffer{}
+		require.NoError(s.T(), parallel.ReadFile(ctx, root, content))
+		require.Equal(s.T(), data, content.Bytes())
+	}
+}
+
+func (s *blockStorageSuite) TestPersistLeavesFailure() {
+	ctx := context.Background()
+	storeErr := errors.New("store failed")
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	failing := []byte("failing chunk!!!")
+
+	store := &latencyStore{
+		memoryStore: newMemoryStore(s.T(), s.ctrl),
+		latency:     func() time.Duration { return time.Duration(rand.Intn(200)) * time.Microsecond },
+		fail: func(chunk []byte) error {
+			if bytes.Contains(chunk, failing) {
+				return storeErr
+			}
+			return nil
+		},
+	}
+	bs := s.newTestStorage(WithLocalStore(store), WithWorkers(4), EnableRawLeaves())
+	bs.(*storage).chunkSize = 16
+
+	reader := io.MultiReader(bytes.NewReader(data), bytes.NewReader(failing), bytes.NewReader(data))
+	_, err := bs.CreateBlock(ctx, "file.bin", reader)
+	require.Equal(s.T(), storeErr, err)
+	require.Equal(s.T(), 0, store.objectCount())
+	require.Equal(s.T(), 0, len(bs.(*storage).pending))
+
+	// upload session records only leaves persisted in content order
+	id, err := bs.StartUpload(ctx, "upload.bin", nil)
+	require.NoError(s.T(), err)
+	_, err = bs.ResumeUpload(ctx, id, 0, io.MultiReader(bytes.NewReader(data), bytes.NewReader(failing), bytes.NewReader(data)))
+	require.Equal(s.T(), storeErr, err)
+	offset, err := bs.UploadStatus(ctx, id)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(len(data)), offset)
+}
+
+func BenchmarkCreateBlock(b *testing.B) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(b)
+	defer ctrl.Finish()
+	data := make([]byte, 2<<20)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			peer := mockpeer.NewMockBlockStoragePeer(ctrl)
+			peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+			// object store and datastore (mappings, write-ahead log) are remote
+			latency := func() time.Duration { return time.Millisecond }
+			store := &latencyStore{memoryStore: newMemoryStore(b, ctrl), latency: latency}
+			datastore := &latencyDatastore{Datastore: dssync.MutexWrap(ds.NewMapDatastore()), latency: latency}
+			bs, err := NewFakeBlockStorage(ctx, WithLocalStore(store), WithDatastore(datastore), WithPeer(peer), WithWorkers(workers))
+			require.NoError(b, err)
+			bs.(*storage).chunkSize = 64 << 10
+
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// random content per iteration, so chunks are not deduplicated
+				b.StopTimer()
+				rand.Read(data)
+				b.StartTimer()
+				if _, err := bs.CreateBlock(ctx, "bench.bin", bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package blockstorage
+
+import (
+	"context"
+	"io"
+	"log"
+
+	"github.com/ipfs/go-cid"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Push - pushes DAG with given root cid (aka content identifier) to remote peer with given id via push protocol
+// (see `peer.BlockPushProtocolID`), e.g. to migrate content or warm up new nodes without them discovering and
+// pulling blocks. Remote peer verifies every block, stores blocks regarding its push policy (see
+// `peer.WithPushPolicy`) and acknowledges them. Returns count of acknowledged blocks.
+//
+// Error:
+// - When remote peer refuses push returns `0, peer.ErrBlockAccessDenied`
+// - When remote peer fails to verify or store a block returns `peer.ErrBlockDataCorrupted` or
+// `peer.ErrBlockPushFailed`. Blocks acknowledged until failure are kept by remote peer.
+// - When remote peer stores blocks to its temporary store returns count with `peer.ErrBlockPushNotPersisted`
+// - When reading DAG (see `ExportCAR`) or pushing fails returns error cause
+func (s *storage) Push(ctx context.Context, root cid.Cid, target libpeer.ID) (int, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return 0, stopErr
+	}
+	defer done()
+	return s.peer.Push(ctx, target, func(w io.Writer) error {
+		return s.ExportCAR(ctx, root, w)
+	})
+}
+
+// receivePushed - persists verified block pushed by remote peer to permanent store, when push policy of peer
+// targets permanent store (see `peer.RegisterPushProtocol`)
+func (s *storage) receivePushed(ctx context.Context, remote libpeer.ID, id cid.Cid, data []byte) error {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return stopErr
+	}
+	defer done()
+	if _, err := s.importBlock(ctx, id, data); err != nil {
+		return err
+	}
+	if s.debug {
+		log.Printf("debug: stored pushed block: %s, %s\n", id, remote)
+	}
+	return nil
+}
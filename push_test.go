@@ -0,0 +1,68 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage/car"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/ipfs/go-cid"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestPush() {
+	ctx := context.Background()
+	target := libpeer.ID("target")
+	source := s.newTestStorage()
+	source.(*storage).chunkSize = 16
+	content := bytes.Repeat([]byte("pushed"), 10)
+	digest, err := source.CreateBlock(ctx, "pushed.txt", bytes.NewReader(content))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	// blocks pushed by source are received by target one by one, and announced by target
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	announced := make(map[cid.Cid]bool)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) bool {
+		announced[id] = true
+		return true
+	})
+	receiving := s.newTestStorage(WithPeer(peer))
+	sourcePeer := source.(*storage).peer.(*mockpeer.MockBlockStoragePeer)
+	sourcePeer.EXPECT().Push(gomock.Any(), target, gomock.Any()).Times(1).DoAndReturn(func(ctx context.Context, _ libpeer.ID, writer func(io.Writer) error) (int, error) {
+		buf := &bytes.Buffer{}
+		if err := writer(buf); err != nil {
+			return 0, err
+		}
+		reader, err := car.NewReader(buf)
+		if err != nil {
+			return 0, err
+		}
+		count := 0
+		for {
+			id, data, err := reader.Next()
+			if err == io.EOF {
+				return count, nil
+			}
+			if err != nil {
+				return count, err
+			}
+			if err := receiving.(*storage).receivePushed(ctx, "source", id, data); err != nil {
+				return count, err
+			}
+			count++
+		}
+	})
+
+	count, err := source.Push(ctx, root, target)
+	require.NoError(s.T(), err)
+	require.Greater(s.T(), count, 1)
+	require.Len(s.T(), announced, count)
+	out := &bytes.Buffer{}
+	require.NoError(s.T(), receiving.ReadFile(ctx, root, out))
+	require.Equal(s.T(), content, out.Bytes())
+}
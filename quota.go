@@ -0,0 +1,209 @@
+package blockstorage
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+
+	"github.com/igumus/blockstorage/blockpb"
+	ds "github.com/ipfs/go-datastore"
+	"google.golang.org/protobuf/proto"
+)
+
+// usageNamespace - holds datastore namespace of caller usages
+const usageNamespace = "/blockstorage/usage"
+
+// Captures/Represents byte and object (file) limits of each caller. Zero limit means unlimited.
+type quota struct {
+	bytes   uint64
+	objects uint64
+}
+
+// callerKey - context key of caller identity
+type callerKey struct{}
+
+// WithCaller - returns context which carries given caller identity (e.g. grpc peer identity). Usage of operations
+// run with the context is accounted to the caller, and limited by caller quota (see `WithQuota`).
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// callerFrom - returns caller identity carried by given context, or empty string when there is not any
+func callerFrom(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// usageKey - returns datastore key of usage of given caller. Caller is hex encoded, as identity may contain
+// key separators.
+func usageKey(caller string) ds.Key {
+	return ds.NewKey(usageNamespace).ChildString(hex.EncodeToString([]byte(caller)))
+}
+
+// Usage - returns persisted usage (bytes and objects of created files) of given caller with caller limits (see
+// `WithQuota`). Usage of in-flight operations is not included.
+//
+// Error:
+// When reading usage from datastore fails, returns `nil` with error cause
+func (s *storage) Usage(ctx context.Context, caller string) (*blockpb.Usage, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	defer done()
+	s.usageLock.Lock()
+	defer s.usageLock.Unlock()
+	used, err := s.loadUsage(ctx, caller)
+	if err != nil {
+		return nil, err
+	}
+	ret := proto.Clone(used).(*blockpb.Usage)
+	ret.BytesLimit = s.quota.bytes
+	ret.ObjectsLimit = s.quota.objects
+	return ret, nil
+}
+
+// loadUsage - returns persisted usage of given caller, which is cached after first read. Caller should hold
+// `usageLock`.
+func (s *storage) loadUsage(ctx context.Context, caller string) (*blockpb.Usage, error) {
+	if used, ok := s.usage[caller]; ok {
+		return used, nil
+	}
+	used := &blockpb.Usage{Caller: caller}
+	data, err := s.datastore.Get(ctx, usageKey(caller))
+	switch {
+	case err == ds.ErrNotFound:
+	case err != nil:
+		return nil, err
+	default:
+		if err := proto.Unmarshal(data, used); err != nil {
+			return nil, err
+		}
+	}
+	s.usage[caller] = used
+	return used, nil
+}
+
+// reservedUsage - returns usage reserved by in-flight operations of given caller. Caller should hold `usageLock`.
+func (s *storage) reservedUsage(caller string) *blockpb.Usage {
+	reserved, ok := s.reserved[caller]
+	if !ok {
+		reserved = &blockpb.Usage{Caller: caller}
+		s.reserved[caller] = reserved
+	}
+	return reserved
+}
+
+// reserve - reserves given bytes and objects for caller of given write set, when persisted and reserved usage of
+// the caller with them does not exceed caller quota. Reservation is added to caller usage when write set commits,
+// and released when it rolls back. Operations without caller (or write set) are not limited.
+//
+// Error:
+// - When quota of caller is exceeded returns `ErrQuotaExceeded`
+// - When reading usage from datastore fails returns error cause
+func (s *storage) reserve(ctx context.Context, ws *writeSet, bytes, objects uint64) error {
+	if ws == nil || ws.caller == "" {
+		return nil
+	}
+	s.usageLock.Lock()
+	defer s.usageLock.Unlock()
+	used, err := s.loadUsage(ctx, ws.caller)
+	if err != nil {
+		return err
+	}
+	reserved := s.reservedUsage(ws.caller)
+	if bytes > 0 && s.quota.bytes > 0 && used.Bytes+reserved.Bytes+bytes > s.quota.bytes {
+		return ErrQuotaExceeded
+	}
+	if objects > 0 && s.quota.objects > 0 && used.Objects+reserved.Objects+objects > s.quota.objects {
+		return ErrQuotaExceeded
+	}
+	reserved.Bytes += bytes
+	reserved.Objects += objects
+	ws.bytes += bytes
+	ws.objects += objects
+	return nil
+}
+
+// setReservation - replaces reservation of given write set with given bytes and objects, without checking quota
+// (e.g. reservation of upload session is set to its committed offset, see `ResumeUpload`).
+func (s *storage) setReservation(ws *writeSet, bytes, objects uint64) {
+	if ws.caller == "" {
+		return
+	}
+	s.usageLock.Lock()
+	defer s.usageLock.Unlock()
+	reserved := s.reservedUsage(ws.caller)
+	reserved.Bytes = reserved.Bytes - ws.bytes + bytes
+	reserved.Objects = reserved.Objects - ws.objects + objects
+	ws.bytes = bytes
+	ws.objects = objects
+}
+
+// commitUsage - adds reservation of given write set to persisted usage of its caller.
+//
+// Error:
+// When persisting usage fails returns error cause, and reservation is kept (released on rollback)
+func (s *storage) commitUsage(ctx context.Context, ws *writeSet) error {
+	if ws.caller == "" || (ws.bytes == 0 && ws.objects == 0) {
+		return nil
+	}
+	s.usageLock.Lock()
+	defer s.usageLock.Unlock()
+	used, err := s.loadUsage(ctx, ws.caller)
+	if err != nil {
+		return err
+	}
+	updated := proto.Clone(used).(*blockpb.Usage)
+	updated.Bytes += ws.bytes
+	updated.Objects += ws.objects
+	data, err := proto.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	if err := s.datastore.Put(ctx, usageKey(ws.caller), data); err != nil {
+		return err
+	}
+	s.usage[ws.caller] = updated
+	reserved := s.reservedUsage(ws.caller)
+	reserved.Bytes -= ws.bytes
+	reserved.Objects -= ws.objects
+	ws.bytes = 0
+	ws.objects = 0
+	return nil
+}
+
+// releaseUsage - releases reservation of given write set
+func (s *storage) releaseUsage(ws *writeSet) {
+	s.setReservation(ws, 0, 0)
+}
+
+// Captures/Represents reader which enforces max file size, and reserves bytes for caller of write set (see
+// `reserve`) as content arrives. `size` holds size of file content read so far.
+type quotaReader struct {
+	s      *storage
+	ctx    context.Context
+	ws     *writeSet
+	reader io.Reader
+	size   uint64
+}
+
+func (r *quotaReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.size += uint64(n)
+		if r.s.maxFileSize > 0 && r.size > r.s.maxFileSize {
+			return 0, ErrFileTooLarge
+		}
+		if quotaErr := r.s.reserve(r.ctx, r.ws, uint64(n), 0); quotaErr != nil {
+			return 0, quotaErr
+		}
+	}
+	return n, err
+}
+
+// limitReader - returns reader of file content which enforces max file size and caller quota (see `quotaReader`).
+// `offset` is size of file content received before (e.g. by resumed upload session).
+func (s *storage) limitReader(ctx context.Context, reader io.Reader, offset uint64) io.Reader {
+	return &quotaReader{s: s, ctx: ctx, ws: writeSetFrom(ctx), reader: reader, size: offset}
+}
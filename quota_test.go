@@ -0,0 +1,106 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing/iotest"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestMaxFileSize() {
+	ctx := context.Background()
+	store := newMemoryStore(s.T(), s.ctrl)
+	bs := s.newTestStorage(WithLocalStore(store), WithMaxFileSize(100))
+	bs.(*storage).chunkSize = 16
+
+	_, err := bs.CreateBlock(ctx, "limit.txt", bytes.NewReader(bytes.Repeat([]byte("a"), 100)))
+	require.NoError(s.T(), err)
+	count := store.objectCount()
+
+	_, err = bs.CreateBlock(ctx, "large.txt", bytes.NewReader(bytes.Repeat([]byte("0123456789"), 11)))
+	require.Equal(s.T(), ErrFileTooLarge, err)
+	require.Equal(s.T(), count, store.objectCount())
+
+	// size of resumed upload covers content of previous streams
+	id, err := bs.StartUpload(ctx, "upload.txt", nil)
+	require.NoError(s.T(), err)
+	_, err = bs.ResumeUpload(ctx, id, 0, io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("u"), 64)), iotest.ErrReader(errors.New("dropped"))))
+	require.Error(s.T(), err)
+	_, err = bs.ResumeUpload(ctx, id, 64, bytes.NewReader(bytes.Repeat([]byte("v"), 40)))
+	require.Equal(s.T(), ErrFileTooLarge, err)
+	offset, err := bs.UploadStatus(ctx, id)
+	require.NoError(s.T(), err)
+	_, err = bs.ResumeUpload(ctx, id, offset, bytes.NewReader(bytes.Repeat([]byte("v"), int(100-offset))))
+	require.NoError(s.T(), err)
+}
+
+func (s *blockStorageSuite) TestQuota() {
+	ctx := context.Background()
+	alice := WithCaller(ctx, "alice")
+	bob := WithCaller(ctx, "bob")
+	store := newMemoryStore(s.T(), s.ctrl)
+	datastore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := s.newTestStorage(WithLocalStore(store), WithDatastore(datastore), WithQuota(100, 3))
+	bs.(*storage).chunkSize = 16
+
+	_, err := bs.CreateBlock(alice, "a.txt", bytes.NewReader(bytes.Repeat([]byte("a"), 60)))
+	require.NoError(s.T(), err)
+	count := store.objectCount()
+
+	// byte quota is enforced as content arrives, and failed operation is not accounted
+	_, err = bs.CreateBlock(alice, "b.txt", bytes.NewReader(bytes.Repeat([]byte("0123456789"), 5)))
+	require.Equal(s.T(), ErrQuotaExceeded, err)
+	require.Equal(s.T(), count, store.objectCount())
+	usage, err := bs.Usage(ctx, "alice")
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(60), usage.Bytes)
+	require.Equal(s.T(), uint64(1), usage.Objects)
+	require.Equal(s.T(), uint64(100), usage.BytesLimit)
+	require.Equal(s.T(), uint64(3), usage.ObjectsLimit)
+
+	// quotas are per caller, and operations without caller are not limited
+	_, err = bs.CreateBlock(bob, "b.txt", bytes.NewReader(bytes.Repeat([]byte("b"), 100)))
+	require.NoError(s.T(), err)
+	_, err = bs.CreateBlock(ctx, "c.txt", bytes.NewReader(bytes.Repeat([]byte("c"), 200)))
+	require.NoError(s.T(), err)
+	usage, err = bs.Usage(ctx, "")
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(0), usage.Bytes)
+
+	// content of in-flight upload is reserved
+	id, err := bs.StartUpload(alice, "upload.txt", nil)
+	require.NoError(s.T(), err)
+	_, err = bs.UploadStatus(bob, id)
+	require.Equal(s.T(), ErrUploadNotFound, err)
+	_, err = bs.ResumeUpload(alice, id, 0, io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("u"), 32)), iotest.ErrReader(errors.New("dropped"))))
+	require.Error(s.T(), err)
+	_, err = bs.CreateBlock(alice, "d.txt", bytes.NewReader(bytes.Repeat([]byte("d"), 16)))
+	require.Equal(s.T(), ErrQuotaExceeded, err)
+	_, err = bs.ResumeUpload(alice, id, 32, bytes.NewReader([]byte("done")))
+	require.NoError(s.T(), err)
+
+	// object quota
+	_, err = bs.CreateBlock(alice, "e.txt", bytes.NewReader([]byte("e")))
+	require.NoError(s.T(), err)
+	_, err = bs.CreateBlock(alice, "f.txt", bytes.NewReader([]byte("f")))
+	require.Equal(s.T(), ErrQuotaExceeded, err)
+
+	// usage survives restart
+	restarted := s.newTestStorage(WithLocalStore(store), WithDatastore(datastore), WithQuota(100, 3))
+	usage, err = restarted.Usage(ctx, "alice")
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), "alice", usage.Caller)
+	require.Equal(s.T(), uint64(60+36+1), usage.Bytes)
+	require.Equal(s.T(), uint64(3), usage.Objects)
+	usage, err = restarted.Usage(ctx, "bob")
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(100), usage.Bytes)
+	require.Equal(s.T(), uint64(1), usage.Objects)
+	require.Equal(s.T(), uint64(0), bs.(*storage).reserved["alice"].Bytes)
+	require.Equal(s.T(), uint64(0), bs.(*storage).reserved["alice"].Objects)
+}
@@ -0,0 +1,197 @@
+package blockstorage
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// replicationNamespace - holds datastore namespace of roots designated for replication
+const replicationNamespace = "/blockstorage/replication"
+
+// replicationKey - returns datastore key of replication of root with given cid
+func replicationKey(root cid.Cid) ds.Key {
+	return ds.NewKey(replicationNamespace).ChildString(root.String())
+}
+
+// Replicate - designates root with given cid (aka content identifier) to be kept with given count of remote
+// replicas, and replicates its DAG until replica count is satisfied. Designated roots are checked periodically
+// (see `WithReplicationInterval`), so replicas which disappear are replaced. Zero factor removes designation.
+//
+// Flow:
+// 1. Persists designation of root to datastore
+// 2. Finds remote peers holding root via provider queries
+// 3. When holders are fewer than factor, pushes DAG (CARv1, see `ExportCAR`) to connected peers which support
+// push protocol (see `Push`) until factor is satisfied. Only peers which persist DAG to permanent store are
+// counted, peers keeping it in temporary store (see `peer.ErrBlockPushNotPersisted`) do not announce it.
+// 4. Persists found holders with check time (see `ReplicationStatus`)
+//
+// Error:
+// - When `factor` is negative returns `ErrReplicationFactorNotValid`
+// - When replicas are fewer than factor returns `ErrReplicationIncomplete`. Designation is kept, so root is
+// re-replicated on next check.
+// - When persisting designation or searching providers fails returns error cause
+func (s *storage) Replicate(ctx context.Context, root cid.Cid, factor int) error {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return stopErr
+	}
+	defer done()
+	if factor < 0 {
+		return ErrReplicationFactorNotValid
+	}
+	if factor == 0 {
+		return s.datastore.Delete(ctx, replicationKey(root))
+	}
+	replication := &blockpb.Replication{Root: root.String(), Factor: uint32(factor)}
+	if err := s.putReplication(ctx, replication); err != nil {
+		return err
+	}
+	return s.ensureReplicas(ctx, root, replication)
+}
+
+// ReplicationStatus - returns replication of designated root with given cid: replica factor, and remote peers
+// holding the root at last check.
+//
+// Error:
+// - When root is not designated (see `Replicate`) returns `nil, ErrReplicationNotFound`
+// - When reading replication fails returns `nil` with error cause
+func (s *storage) ReplicationStatus(ctx context.Context, root cid.Cid) (*blockpb.Replication, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	defer done()
+	data, err := s.datastore.Get(ctx, replicationKey(root))
+	if err == ds.ErrNotFound {
+		return nil, ErrReplicationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	replication := &blockpb.Replication{}
+	if err := proto.Unmarshal(data, replication); err != nil {
+		return nil, err
+	}
+	return replication, nil
+}
+
+// putReplication - persists given replication to datastore
+func (s *storage) putReplication(ctx context.Context, replication *blockpb.Replication) error {
+	data, err := proto.Marshal(replication)
+	if err != nil {
+		return err
+	}
+	root, err := cid.Decode(replication.Root)
+	if err != nil {
+		return ErrBlockIdentifierNotValid
+	}
+	return s.datastore.Put(ctx, replicationKey(root), data)
+}
+
+// ensureReplicas - finds remote holders of given root, pushes its DAG to other push peers until holders
+// satisfy replica factor, and persists holders to given replication (see `Replicate`).
+func (s *storage) ensureReplicas(ctx context.Context, root cid.Cid, replication *blockpb.Replication) error {
+	factor := int(replication.Factor)
+	holders, err := s.peer.FindProviders(ctx, root, factor)
+	if err != nil {
+		return err
+	}
+	holding := make(map[libpeer.ID]bool, len(holders))
+	for _, id := range holders {
+		holding[id] = true
+	}
+
+	for _, id := range s.peer.PushPeers() {
+		if len(holders) >= factor {
+			break
+		}
+		if holding[id] {
+			continue
+		}
+		if _, err := s.Push(ctx, root, id); err != nil {
+			log.Printf("warn: replicating root to peer failed: %s, %s, %s\n", root, id, err.Error())
+			continue
+		}
+		holders = append(holders, id)
+		holding[id] = true
+	}
+
+	replication.Replicas = make([]string, 0, len(holders))
+	for _, id := range holders {
+		replication.Replicas = append(replication.Replicas, id.String())
+	}
+	replication.Checked = time.Now().UnixNano()
+	if err := s.putReplication(ctx, replication); err != nil {
+		return err
+	}
+	if len(holders) < factor {
+		log.Printf("warn: replication factor not satisfied: %s, %d/%d\n", root, len(holders), factor)
+		return ErrReplicationIncomplete
+	}
+	if s.debug {
+		log.Printf("debug: replication factor satisfied: %s, %d\n", root, factor)
+	}
+	return nil
+}
+
+// replicateRoots - ensures replicas of all designated roots, failures are logged so other roots are still checked
+func (s *storage) replicateRoots(ctx context.Context) {
+	results, err := s.datastore.Query(ctx, query.Query{Prefix: replicationNamespace})
+	if err != nil {
+		log.Printf("err: querying replications failed: %s\n", err.Error())
+		return
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		log.Printf("err: querying replications failed: %s\n", err.Error())
+		return
+	}
+	for _, entry := range entries {
+		replication := &blockpb.Replication{}
+		if err := proto.Unmarshal(entry.Value, replication); err != nil {
+			log.Printf("err: decoding replication failed: %s, %s\n", entry.Key, err.Error())
+			continue
+		}
+		root, err := cid.Decode(replication.Root)
+		if err != nil {
+			log.Printf("err: decoding replication root failed: %s\n", entry.Key)
+			continue
+		}
+		// failure is logged by ensureReplicas
+		_ = s.ensureReplicas(ctx, root, replication)
+	}
+}
+
+// startReplication - checks replicas of designated roots periodically (see `WithReplicationInterval`) until
+// given context is done or storage is stopped.
+func (s *storage) startReplication(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		ticker := time.NewTicker(s.replicationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			passCtx, done, err := s.enter(ctx)
+			if err != nil {
+				return
+			}
+			s.replicateRoots(passCtx)
+			done()
+		}
+	}()
+}
@@ -0,0 +1,83 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/golang/mock/gomock"
+	blockpeer "github.com/igumus/blockstorage/peer"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/ipfs/go-cid"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestReplicate() {
+	ctx := context.Background()
+	warm, holder, second, third := libpeer.ID("warm"), libpeer.ID("holder"), libpeer.ID("second"), libpeer.ID("third")
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	peer.EXPECT().PushPeers().AnyTimes().Return([]libpeer.ID{warm, holder, second, third})
+	bs := s.newTestStorage(WithPeer(peer))
+	bs.(*storage).chunkSize = 16
+
+	content := bytes.Repeat([]byte("replicated"), 10)
+	digest, err := bs.CreateBlock(ctx, "replicated.txt", bytes.NewReader(content))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+
+	// pushed replica holds whole DAG of root, warm-up peer keeps it in temporary store
+	replicas := make(map[libpeer.ID]BlockStorage)
+	peer.EXPECT().Push(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(ctx context.Context, id libpeer.ID, writer func(io.Writer) error) (int, error) {
+		buf := &bytes.Buffer{}
+		if err := writer(buf); err != nil {
+			return 0, err
+		}
+		if id == warm {
+			return 1, blockpeer.ErrBlockPushNotPersisted
+		}
+		replica := s.newTestStorage()
+		roots, err := replica.ImportCAR(ctx, buf)
+		if err != nil {
+			return 0, err
+		}
+		replicas[id] = replica
+		return len(roots), nil
+	})
+
+	require.Equal(s.T(), ErrReplicationFactorNotValid, bs.Replicate(ctx, root, -1))
+	_, err = bs.ReplicationStatus(ctx, root)
+	require.Equal(s.T(), ErrReplicationNotFound, err)
+
+	// existing holder is counted, so replica is pushed to one more peer which persists it
+	peer.EXPECT().FindProviders(gomock.Any(), root, 2).Times(1).Return([]libpeer.ID{holder}, nil)
+	require.NoError(s.T(), bs.Replicate(ctx, root, 2))
+	require.Len(s.T(), replicas, 1)
+	out := &bytes.Buffer{}
+	require.NoError(s.T(), replicas[second].ReadFile(ctx, root, out))
+	require.Equal(s.T(), content, out.Bytes())
+	status, err := bs.ReplicationStatus(ctx, root)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint32(2), status.Factor)
+	require.Equal(s.T(), []string{holder.String(), second.String()}, status.Replicas)
+
+	// replicas which disappear are replaced on periodic check
+	peer.EXPECT().FindProviders(gomock.Any(), root, 2).Times(1).Return([]libpeer.ID{second}, nil)
+	bs.(*storage).replicateRoots(ctx)
+	status, err = bs.ReplicationStatus(ctx, root)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), []string{second.String(), holder.String()}, status.Replicas)
+
+	// factor is not satisfied with available peers
+	peer.EXPECT().FindProviders(gomock.Any(), root, 4).Times(1).Return([]libpeer.ID{holder, second}, nil)
+	require.Equal(s.T(), ErrReplicationIncomplete, bs.Replicate(ctx, root, 4))
+	status, err = bs.ReplicationStatus(ctx, root)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), status.Replicas, 3)
+
+	require.NoError(s.T(), bs.Replicate(ctx, root, 0))
+	_, err = bs.ReplicationStatus(ctx, root)
+	require.Equal(s.T(), ErrReplicationNotFound, err)
+}
@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errMalformedChunk is return, when aws-chunked payload not well-formed
+var errMalformedChunk = errors.New("blockstorage: malformed aws-chunked payload")
+
+// isChunkedPayload - checks request payload uses `aws-chunked` content encoding, which is used by
+// S3 clients while streaming (signed or unsigned) payloads.
+func isChunkedPayload(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked")
+}
+
+// Captures/Represents decoder of `aws-chunked` payload. Chunk signatures and trailing headers are
+// skipped, only chunk data passed to reader.
+type chunkedReader struct {
+	reader    *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func newChunkedReader(r io.Reader) io.Reader {
+	return &chunkedReader{reader: bufio.NewReader(r)}
+}
+
+// readLine - reads single CRLF terminated line without line terminator
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// nextChunk - reads chunk header and prepares chunk data to read. On last chunk consumes trailers.
+func (c *chunkedReader) nextChunk() error {
+	header, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if i := strings.IndexByte(header, ';'); i >= 0 {
+		header = header[:i]
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(header), 16, 64)
+	if err != nil || size < 0 {
+		return errMalformedChunk
+	}
+	if size > 0 {
+		c.remaining = size
+		return nil
+	}
+
+	c.done = true
+	for {
+		trailer, err := c.readLine()
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if trailer == "" {
+			return nil
+		}
+	}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+		if c.done {
+			return 0, io.EOF
+		}
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.reader.Read(p)
+	c.remaining -= int64(n)
+	if err == io.EOF && c.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	if c.remaining == 0 {
+		line, lineErr := c.readLine()
+		if lineErr != nil {
+			return n, lineErr
+		}
+		if line != "" {
+			return n, errMalformedChunk
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,224 @@
+package s3
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// Datastore namespaces of the index. Object keys are hex encoded, so that arbitrary S3 keys
+// (which may contain `/`, `..` etc.) become valid datastore keys while keeping lexicographic order.
+const (
+	bucketNamespace = "/s3/buckets"
+	objectNamespace = "/s3/objects"
+	uploadNamespace = "/s3/uploads"
+)
+
+// errIndexEntryNotFound is return, when requested bucket/object/upload not exists in index
+var errIndexEntryNotFound = errors.New("blockstorage: s3 index entry not found")
+
+// Captures/Represents bucket information kept in index
+type bucketInfo struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// Captures/Represents object information kept in index. `Cid` holds root block cid of object content.
+// Zero sized objects have no content, so their `Cid` is empty.
+type objectInfo struct {
+	Key          string    `json:"key"`
+	Cid          string    `json:"cid"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	ContentType  string    `json:"contentType"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Captures/Represents uploaded part of multipart upload
+type partInfo struct {
+	Cid  string `json:"cid"`
+	Size int64  `json:"size"`
+	ETag string `json:"etag"`
+}
+
+// Captures/Represents in progress multipart upload
+type uploadInfo struct {
+	ID          string            `json:"id"`
+	Bucket      string            `json:"bucket"`
+	Key         string            `json:"key"`
+	ContentType string            `json:"contentType"`
+	Initiated   time.Time         `json:"initiated"`
+	Parts       map[int]*partInfo `json:"parts"`
+}
+
+// Captures/Represents bucket/key index over datastore
+type index struct {
+	store ds.Datastore
+}
+
+func bucketKey(bucket string) ds.Key {
+	return ds.NewKey(bucketNamespace).ChildString(bucket)
+}
+
+func objectPrefix(bucket string) string {
+	return ds.NewKey(objectNamespace).ChildString(bucket).String() + "/"
+}
+
+func objectKey(bucket, key string) ds.Key {
+	return ds.RawKey(objectPrefix(bucket) + hex.EncodeToString([]byte(key)))
+}
+
+func uploadKey(id string) ds.Key {
+	return ds.NewKey(uploadNamespace).ChildString(id)
+}
+
+// get - reads and decodes index entry with given key to `v`.
+func (i *index) get(ctx context.Context, key ds.Key, v interface{}) error {
+	data, err := i.store.Get(ctx, key)
+	if err != nil {
+		if err == ds.ErrNotFound {
+			return errIndexEntryNotFound
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// put - encodes and writes given `v` to index entry with given key.
+func (i *index) put(ctx context.Context, key ds.Key, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return i.store.Put(ctx, key, data)
+}
+
+func (i *index) hasBucket(ctx context.Context, bucket string) (bool, error) {
+	return i.store.Has(ctx, bucketKey(bucket))
+}
+
+func (i *index) putBucket(ctx context.Context, info *bucketInfo) error {
+	return i.put(ctx, bucketKey(info.Name), info)
+}
+
+func (i *index) deleteBucket(ctx context.Context, bucket string) error {
+	return i.store.Delete(ctx, bucketKey(bucket))
+}
+
+// listBuckets - returns all buckets ordered by name.
+func (i *index) listBuckets(ctx context.Context) ([]*bucketInfo, error) {
+	results, err := i.store.Query(ctx, dsq.Query{
+		Prefix: bucketNamespace,
+		Orders: []dsq.Order{dsq.OrderByKey{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	ret := make([]*bucketInfo, 0)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		var info bucketInfo
+		if err := json.Unmarshal(result.Value, &info); err != nil {
+			return nil, err
+		}
+		ret = append(ret, &info)
+	}
+	return ret, nil
+}
+
+func (i *index) getObject(ctx context.Context, bucket, key string) (*objectInfo, error) {
+	var info objectInfo
+	if err := i.get(ctx, objectKey(bucket, key), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (i *index) putObject(ctx context.Context, bucket string, info *objectInfo) error {
+	return i.put(ctx, objectKey(bucket, info.Key), info)
+}
+
+func (i *index) deleteObject(ctx context.Context, bucket, key string) error {
+	return i.store.Delete(ctx, objectKey(bucket, key))
+}
+
+// isBucketEmpty - checks whether bucket has any object
+func (i *index) isBucketEmpty(ctx context.Context, bucket string) (bool, error) {
+	results, err := i.store.Query(ctx, dsq.Query{
+		Prefix:   objectPrefix(bucket),
+		KeysOnly: true,
+		Limit:    1,
+	})
+	if err != nil {
+		return false, err
+	}
+	defer results.Close()
+	for result := range results.Next() {
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// listObjects - returns objects of bucket whose key starts with `prefix` and greater than `after`
+// ordered by key. Iteration stops when `fn` returns false.
+func (i *index) listObjects(ctx context.Context, bucket, prefix, after string, fn func(*objectInfo) bool) error {
+	base := objectPrefix(bucket)
+	filters := []dsq.Filter{dsq.FilterKeyPrefix{Prefix: base + hex.EncodeToString([]byte(prefix))}}
+	if after != "" {
+		filters = append(filters, dsq.FilterKeyCompare{Op: dsq.GreaterThan, Key: base + hex.EncodeToString([]byte(after))})
+	}
+	results, err := i.store.Query(ctx, dsq.Query{
+		Prefix:  base,
+		Filters: filters,
+		Orders:  []dsq.Order{dsq.OrderByKey{}},
+	})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for result := range results.Next() {
+		if result.Error != nil {
+			return result.Error
+		}
+		var info objectInfo
+		if err := json.Unmarshal(result.Value, &info); err != nil {
+			return err
+		}
+		if !fn(&info) {
+			break
+		}
+	}
+	return nil
+}
+
+func (i *index) getUpload(ctx context.Context, id string) (*uploadInfo, error) {
+	var info uploadInfo
+	if err := i.get(ctx, uploadKey(id), &info); err != nil {
+		return nil, err
+	}
+	if info.Parts == nil {
+		info.Parts = make(map[int]*partInfo)
+	}
+	return &info, nil
+}
+
+func (i *index) putUpload(ctx context.Context, info *uploadInfo) error {
+	return i.put(ctx, uploadKey(info.ID), info)
+}
+
+func (i *index) deleteUpload(ctx context.Context, id string) error {
+	return i.store.Delete(ctx, uploadKey(id))
+}
@@ -0,0 +1,236 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igumus/blockstorage"
+	"github.com/ipfs/go-cid"
+)
+
+// S3 multipart upload part number boundaries
+const (
+	minPartNumber = 1
+	maxPartNumber = 10000
+)
+
+func (e *endpoint) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	upload := &uploadInfo{
+		ID:          newRequestID() + newRequestID(),
+		Bucket:      bucket,
+		Key:         key,
+		ContentType: contentType,
+		Initiated:   time.Now(),
+		Parts:       make(map[int]*partInfo),
+	}
+	if err := e.index.putUpload(r.Context(), upload); err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: upload.ID,
+	})
+}
+
+// findUpload - reads multipart upload with given id and checks it belongs to given bucket/key
+func (e *endpoint) findUpload(ctx context.Context, bucket, key, uploadID string) (*uploadInfo, error) {
+	upload, err := e.index.getUpload(ctx, uploadID)
+	if err != nil {
+		if err == errIndexEntryNotFound {
+			return nil, errNoSuchUpload
+		}
+		return nil, err
+	}
+	if upload.Bucket != bucket || upload.Key != key {
+		return nil, errNoSuchUpload
+	}
+	return upload, nil
+}
+
+// uploadPart - writes part content to block storage as separate file staged with upload id (see
+// `BlockStorage.CreateStagedBlock`), and records part to upload entry. Uploading part with same number again
+// replaces previous one. Part files are removed when upload completes or is aborted.
+func (e *endpoint) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) {
+	ctx := r.Context()
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < minPartNumber || partNumber > maxPartNumber {
+		writeError(w, r, errInvalidArgument)
+		return
+	}
+	if _, err := e.findUpload(ctx, bucket, key, uploadID); err != nil {
+		e.writeFailure(w, r, err)
+		return
+	}
+
+	digest, size, etag, err := e.writeContent(ctx, r, fmt.Sprintf("%s/%s.part%d", bucket, key, partNumber), uploadID)
+	if err != nil {
+		e.writeFailure(w, r, err)
+		return
+	}
+
+	e.uploadLock.Lock()
+	defer e.uploadLock.Unlock()
+	upload, err := e.findUpload(ctx, bucket, key, uploadID)
+	if err != nil {
+		// upload is completed or aborted while part is written
+		e.discardParts(ctx, uploadID)
+		e.writeFailure(w, r, err)
+		return
+	}
+	upload.Parts[partNumber] = &partInfo{Cid: digest, Size: size, ETag: etag}
+	if err := e.index.putUpload(ctx, upload); err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", quoteETag(etag))
+	w.WriteHeader(http.StatusOK)
+}
+
+// readParts - writes contents of given parts to `w` in order
+func (e *endpoint) readParts(ctx context.Context, parts []*partInfo, w io.Writer) error {
+	for _, part := range parts {
+		if part.Cid == "" {
+			continue
+		}
+		id, err := cid.Decode(part.Cid)
+		if err != nil {
+			return err
+		}
+		if err := e.storage.ReadFile(ctx, id, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeMultipartUpload - validates requested part list and joins contents of parts into single file, then
+// removes part files (see `discardParts`). Joined file shares leaves with part files, so they are kept.
+// Object etag computed as S3 does: md5 digest of concatenated part digests suffixed with part count. Parts are not
+// recorded while upload is completed.
+func (e *endpoint) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) {
+	ctx := r.Context()
+	e.uploadLock.Lock()
+	defer e.uploadLock.Unlock()
+	upload, err := e.findUpload(ctx, bucket, key, uploadID)
+	if err != nil {
+		e.writeFailure(w, r, err)
+		return
+	}
+
+	var request completeMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Parts) == 0 {
+		writeError(w, r, errMalformedXML)
+		return
+	}
+
+	parts := make([]*partInfo, 0, len(request.Parts))
+	digests := md5.New()
+	size := int64(0)
+	for i, requested := range request.Parts {
+		if i > 0 && requested.PartNumber <= request.Parts[i-1].PartNumber {
+			writeError(w, r, errInvalidPartOrder)
+			return
+		}
+		part, ok := upload.Parts[requested.PartNumber]
+		if !ok || strings.Trim(requested.ETag, `"`) != part.ETag {
+			writeError(w, r, errInvalidPart)
+			return
+		}
+		raw, err := hex.DecodeString(part.ETag)
+		if err != nil {
+			e.internalError(w, r, err)
+			return
+		}
+		digests.Write(raw)
+		size += part.Size
+		parts = append(parts, part)
+	}
+
+	digest := ""
+	if size > 0 {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(e.readParts(ctx, parts, pw))
+		}()
+		digest, err = e.storage.CreateBlock(ctx, bucket+"/"+key, pr)
+		pr.Close()
+		if err != nil && err != blockstorage.ErrBlockDataEmpty {
+			e.writeFailure(w, r, err)
+			return
+		}
+	}
+
+	etag := fmt.Sprintf("%s-%d", hex.EncodeToString(digests.Sum(nil)), len(parts))
+	info := &objectInfo{
+		Key:          key,
+		Cid:          digest,
+		Size:         size,
+		ETag:         etag,
+		ContentType:  upload.ContentType,
+		LastModified: time.Now(),
+	}
+	if err := e.index.putObject(ctx, bucket, info); err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	if err := e.index.deleteUpload(ctx, uploadID); err != nil {
+		log.Printf("warn: removing completed s3 upload failed: %s, %s\n", uploadID, err.Error())
+	}
+	e.discardParts(ctx, uploadID)
+	if e.debug {
+		log.Printf("debug: s3 multipart object written: %s/%s, %s, %d parts, %d bytes\n", bucket, key, digest, len(parts), size)
+	}
+
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     quoteETag(etag),
+	})
+}
+
+// abortMultipartUpload - drops upload entry, and removes part files written for the upload (see `discardParts`).
+func (e *endpoint) abortMultipartUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	ctx := r.Context()
+	e.uploadLock.Lock()
+	defer e.uploadLock.Unlock()
+	if _, err := e.index.getUpload(ctx, uploadID); err != nil {
+		if err == errIndexEntryNotFound {
+			writeError(w, r, errNoSuchUpload)
+			return
+		}
+		e.internalError(w, r, err)
+		return
+	}
+	if err := e.index.deleteUpload(ctx, uploadID); err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	e.discardParts(ctx, uploadID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// discardParts - removes part files staged with given upload id from block storage, unless their nodes are shared
+// with other files. Failures are logged, as upload entry is already removed.
+func (e *endpoint) discardParts(ctx context.Context, uploadID string) {
+	if err := e.storage.DiscardStage(ctx, uploadID); err != nil {
+		log.Printf("warn: removing parts of s3 upload failed: %s, %s\n", uploadID, err.Error())
+	}
+}
@@ -0,0 +1,101 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// initiateUpload - creates multipart upload for given key and returns upload id
+func (s *s3Suite) initiateUpload(key string) string {
+	resp, body := s.do(http.MethodPost, "/bucket/"+key+"?uploads", nil, nil)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	var result initiateMultipartUploadResult
+	s.NoError(xml.Unmarshal(body, &result))
+	s.Equal(key, result.Key)
+	s.NotEmpty(result.UploadID)
+	return result.UploadID
+}
+
+// completeRequest - builds complete multipart upload request body with given part numbers and etags
+func completeRequest(numbers []int, etags []string) []byte {
+	request := completeMultipartUpload{}
+	for i := range numbers {
+		request.Parts = append(request.Parts, completedPart{PartNumber: numbers[i], ETag: etags[i]})
+	}
+	data, _ := xml.Marshal(&request)
+	return data
+}
+
+func (s *s3Suite) TestMultipartUpload() {
+	resp, _ := s.do(http.MethodPut, "/bucket", nil, nil)
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	uploadID := s.initiateUpload("multi.bin")
+	parts := [][]byte{generateRandomBytes(s.T(), 700<<10), generateRandomBytes(s.T(), 300<<10)}
+	etags := make([]string, 0, len(parts))
+	digests := md5.New()
+	for i, part := range parts {
+		resp, _ := s.do(http.MethodPut, fmt.Sprintf("/bucket/multi.bin?partNumber=%d&uploadId=%s", i+1, uploadID), part, nil)
+		s.Equal(http.StatusOK, resp.StatusCode)
+		etags = append(etags, resp.Header.Get("ETag"))
+		digest := md5.Sum(part)
+		digests.Write(digest[:])
+	}
+
+	resp, _ = s.do(http.MethodPost, "/bucket/multi.bin?uploadId="+uploadID, completeRequest([]int{2, 1}, []string{etags[1], etags[0]}), nil)
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = s.do(http.MethodPost, "/bucket/multi.bin?uploadId="+uploadID, completeRequest([]int{1, 3}, etags), nil)
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	resp, body := s.do(http.MethodPost, "/bucket/multi.bin?uploadId="+uploadID, completeRequest([]int{1, 2}, etags), nil)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	var result completeMultipartUploadResult
+	s.NoError(xml.Unmarshal(body, &result))
+	expectedETag := fmt.Sprintf(`"%s-2"`, hex.EncodeToString(digests.Sum(nil)))
+	s.Equal(expectedETag, result.ETag)
+
+	resp, body = s.do(http.MethodGet, "/bucket/multi.bin", nil, nil)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(expectedETag, resp.Header.Get("ETag"))
+	s.True(bytes.Equal(append(parts[0], parts[1]...), body))
+
+	resp, _ = s.do(http.MethodPost, "/bucket/multi.bin?uploadId="+uploadID, completeRequest([]int{1, 2}, etags), nil)
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+
+	// part files are removed, joined object keeps leaves shared with them (three leaves and root)
+	s.Equal(3+1, s.store.objectCount())
+}
+
+func (s *s3Suite) TestAbortMultipartUpload() {
+	resp, _ := s.do(http.MethodPut, "/bucket", nil, nil)
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	uploadID := s.initiateUpload("aborted.bin")
+	resp, _ = s.do(http.MethodPut, "/bucket/aborted.bin?partNumber=1&uploadId="+uploadID, []byte("part"), nil)
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	resp, _ = s.do(http.MethodPut, "/bucket/other.bin?partNumber=1&uploadId="+uploadID, []byte("part"), nil)
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = s.do(http.MethodPut, "/bucket/aborted.bin?partNumber=0&uploadId="+uploadID, []byte("part"), nil)
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	s.Equal(2, s.store.objectCount())
+
+	resp, _ = s.do(http.MethodDelete, "/bucket/aborted.bin?uploadId="+uploadID, nil, nil)
+	s.Equal(http.StatusNoContent, resp.StatusCode)
+	s.Equal(0, s.store.objectCount())
+
+	resp, body := s.do(http.MethodPut, "/bucket/aborted.bin?partNumber=2&uploadId="+uploadID, []byte("part"), nil)
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+	s.True(strings.Contains(string(body), "NoSuchUpload"))
+
+	resp, _ = s.do(http.MethodGet, "/bucket/aborted.bin", nil, nil)
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,76 @@
+package s3
+
+import (
+	"errors"
+
+	"github.com/igumus/blockstorage"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+// ErrStorageNotSpecified is return when block storage not specified while constructing S3 endpoint
+var ErrStorageNotSpecified = errors.New("[blockstorage] s3 endpoint configuration failed: block storage instance not specified")
+
+// A S3Option sets options.
+type S3Option func(*s3Config)
+
+// Captures/Represents S3 endpoint's configuration information.
+type s3Config struct {
+	debugMode bool
+	storage   blockstorage.BlockStorage
+	datastore ds.Datastore
+}
+
+// validate - validates given `s3Config` instance
+func validate(c *s3Config) error {
+	if c.storage == nil {
+		return ErrStorageNotSpecified
+	}
+	return nil
+}
+
+// defaultS3Config - returns instance of `s3Config` with initial values.
+func defaultS3Config() *s3Config {
+	return &s3Config{
+		debugMode: false,
+		storage:   nil,
+		datastore: nil,
+	}
+}
+
+// createConfig - creates new `s3Config` with given options.
+// Creates default configuration and applys options to configuration.
+// When datastore not specified, uses thread safe in-memory datastore.
+// Returns configuration instance and validation result.
+func createConfig(opts ...S3Option) (*s3Config, error) {
+	cfg := defaultS3Config()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.datastore == nil {
+		cfg.datastore = dssync.MutexWrap(ds.NewMapDatastore())
+	}
+	return cfg, validate(cfg)
+}
+
+// WithStorage returns a S3Option that specifies block storage which keeps object contents.
+func WithStorage(s blockstorage.BlockStorage) S3Option {
+	return func(c *s3Config) {
+		c.storage = s
+	}
+}
+
+// WithDatastore returns a S3Option that specifies datastore which keeps bucket/key index.
+// If not specified, index kept in memory (which has no persistence).
+func WithDatastore(d ds.Datastore) S3Option {
+	return func(c *s3Config) {
+		c.datastore = d
+	}
+}
+
+// EnableDebugMode returns a S3Option that enables debug mode
+func EnableDebugMode() S3Option {
+	return func(c *s3Config) {
+		c.debugMode = true
+	}
+}
@@ -0,0 +1,551 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igumus/blockstorage"
+	"github.com/igumus/blockstorage/util"
+	"github.com/ipfs/go-cid"
+)
+
+// defaultContentType is used, when client not specified object content type
+const defaultContentType = "binary/octet-stream"
+
+// defaultMaxKeys is the maximum number of keys returned in single listing response
+const defaultMaxKeys = 1000
+
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// Captures/Represents S3 compatible http endpoint information
+type endpoint struct {
+	debug   bool
+	storage blockstorage.BlockStorage
+	index   *index
+	// uploadLock serializes read-modify-write updates of multipart upload entries
+	uploadLock sync.Mutex
+}
+
+// NewS3Endpoint - creates http handler which serves subset of S3 api (path-style addressing) on top of
+// given `BlockStorage` instance. Object contents are written via `CreateBlock`, and bucket/key to
+// root block mapping kept in index over configured datastore.
+//
+// Supported operations: ListBuckets, CreateBucket, HeadBucket, DeleteBucket, ListObjectsV2, PutObject,
+// GetObject, HeadObject, DeleteObject, CreateMultipartUpload, UploadPart, CompleteMultipartUpload and
+// AbortMultipartUpload. Request signatures not verified.
+func NewS3Endpoint(ctx context.Context, s blockstorage.BlockStorage, opts ...S3Option) (http.Handler, error) {
+	cfg, cfgErr := createConfig(append([]S3Option{WithStorage(s)}, opts...)...)
+	if cfgErr != nil {
+		return nil, cfgErr
+	}
+	return &endpoint{
+		debug:   cfg.debugMode,
+		storage: cfg.storage,
+		index:   &index{store: cfg.datastore},
+	}, nil
+}
+
+// newRequestID - generates random request identifier to tag responses
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return strings.ToUpper(hex.EncodeToString(buf))
+}
+
+// splitPath - splits path-style request path to bucket and object key
+func splitPath(p string) (string, string) {
+	p = strings.TrimPrefix(p, "/")
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("x-amz-request-id", newRequestID())
+	if e.debug {
+		log.Printf("debug: s3 request: %s %s\n", r.Method, r.URL.String())
+	}
+
+	bucket, key := splitPath(r.URL.Path)
+	switch {
+	case bucket == "":
+		e.serveService(w, r)
+	case key == "":
+		e.serveBucket(w, r, bucket)
+	default:
+		e.serveObject(w, r, bucket, key)
+	}
+}
+
+func (e *endpoint) serveService(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, errMethodNotAllowed)
+		return
+	}
+	e.listBuckets(w, r)
+}
+
+func (e *endpoint) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	if !bucketNamePattern.MatchString(bucket) || strings.Contains(bucket, "..") {
+		writeError(w, r, errInvalidBucketName)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		e.createBucket(w, r, bucket)
+	case http.MethodHead:
+		e.headBucket(w, r, bucket)
+	case http.MethodDelete:
+		e.deleteBucket(w, r, bucket)
+	case http.MethodGet:
+		if r.URL.Query().Get("list-type") != "2" {
+			writeError(w, r, errNotImplemented)
+			return
+		}
+		e.listObjectsV2(w, r, bucket)
+	default:
+		writeError(w, r, errMethodNotAllowed)
+	}
+}
+
+func (e *endpoint) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	ctx := r.Context()
+	exists, err := e.index.hasBucket(ctx, bucket)
+	if err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	if !exists {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+
+	query := r.URL.Query()
+	_, uploads := query["uploads"]
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && uploads:
+		e.createMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodPut && uploadID != "":
+		e.uploadPart(w, r, bucket, key, uploadID)
+	case r.Method == http.MethodPost && uploadID != "":
+		e.completeMultipartUpload(w, r, bucket, key, uploadID)
+	case r.Method == http.MethodDelete && uploadID != "":
+		e.abortMultipartUpload(w, r, uploadID)
+	case r.Method == http.MethodPut:
+		e.putObject(w, r, bucket, key)
+	case r.Method == http.MethodGet:
+		e.getObject(w, r, bucket, key, true)
+	case r.Method == http.MethodHead:
+		e.getObject(w, r, bucket, key, false)
+	case r.Method == http.MethodDelete:
+		e.deleteObject(w, r, bucket, key)
+	default:
+		writeError(w, r, errMethodNotAllowed)
+	}
+}
+
+// internalError - logs given error cause and writes `InternalError` response
+func (e *endpoint) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("err: s3 request failed: %s %s, %s\n", r.Method, r.URL.Path, err.Error())
+	writeError(w, r, errInternalError)
+}
+
+func (e *endpoint) listBuckets(w http.ResponseWriter, r *http.Request) {
+	buckets, err := e.index.listBuckets(r.Context())
+	if err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	result := &listAllMyBucketsResult{
+		Xmlns:   s3Namespace,
+		Owner:   owner{ID: ownerID, DisplayName: ownerDisplayName},
+		Buckets: make([]bucketEntry, 0, len(buckets)),
+	}
+	for _, b := range buckets {
+		result.Buckets = append(result.Buckets, bucketEntry{Name: b.Name, CreationDate: formatTime(b.Created)})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (e *endpoint) createBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	ctx := r.Context()
+	exists, err := e.index.hasBucket(ctx, bucket)
+	if err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	if exists {
+		writeError(w, r, errBucketAlreadyOwnedByYou)
+		return
+	}
+	if err := e.index.putBucket(ctx, &bucketInfo{Name: bucket, Created: time.Now()}); err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (e *endpoint) headBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	exists, err := e.index.hasBucket(r.Context(), bucket)
+	if err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	if !exists {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (e *endpoint) deleteBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	ctx := r.Context()
+	exists, err := e.index.hasBucket(ctx, bucket)
+	if err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	if !exists {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	empty, err := e.index.isBucketEmpty(ctx, bucket)
+	if err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	if !empty {
+		writeError(w, r, errBucketNotEmpty)
+		return
+	}
+	if err := e.index.deleteBucket(ctx, bucket); err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listObjectsV2 - lists objects of bucket ordered by key. Supports `prefix`, `delimiter`, `max-keys`,
+// `start-after`, `continuation-token` and `encoding-type` parameters. Continuation token is the hex
+// encoded last key (or common prefix) of previous page.
+func (e *endpoint) listObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) {
+	ctx := r.Context()
+	exists, err := e.index.hasBucket(ctx, bucket)
+	if err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	if !exists {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	startAfter := query.Get("start-after")
+	token := query.Get("continuation-token")
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		writeError(w, r, errInvalidArgument)
+		return
+	}
+	maxKeys := defaultMaxKeys
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, errInvalidArgument)
+			return
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	after := startAfter
+	if token != "" {
+		decoded, err := hex.DecodeString(token)
+		if err != nil {
+			writeError(w, r, errInvalidArgument)
+			return
+		}
+		after = string(decoded)
+	}
+
+	encode := func(s string) string {
+		if encodingType == "url" {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	result := &listBucketResultV2{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            encode(prefix),
+		StartAfter:        encode(startAfter),
+		ContinuationToken: token,
+		MaxKeys:           maxKeys,
+		Delimiter:         encode(delimiter),
+		EncodingType:      encodingType,
+		Contents:          make([]objectEntry, 0),
+		CommonPrefixes:    make([]commonPrefix, 0),
+	}
+
+	last := ""
+	lastPrefix := ""
+	listErr := e.index.listObjects(ctx, bucket, prefix, after, func(info *objectInfo) bool {
+		group := ""
+		if delimiter != "" {
+			if i := strings.Index(info.Key[len(prefix):], delimiter); i >= 0 {
+				group = info.Key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if group != "" && group == lastPrefix {
+			return true
+		}
+		// resuming after a common prefix should skip remaining keys of that prefix
+		if group != "" && strings.HasPrefix(after, group) {
+			return true
+		}
+		if result.KeyCount >= maxKeys {
+			result.IsTruncated = true
+			return false
+		}
+		if group != "" {
+			lastPrefix = group
+			last = group
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: encode(group)})
+		} else {
+			last = info.Key
+			result.Contents = append(result.Contents, objectEntry{
+				Key:          encode(info.Key),
+				LastModified: formatTime(info.LastModified),
+				ETag:         quoteETag(info.ETag),
+				Size:         info.Size,
+				StorageClass: "STANDARD",
+			})
+		}
+		result.KeyCount++
+		return true
+	})
+	if listErr != nil {
+		e.internalError(w, r, listErr)
+		return
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = hex.EncodeToString([]byte(last))
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// quoteETag - wraps etag value with quotes as S3 returns
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
+
+// Captures/Represents reader which tracks size and md5 digest of read content
+type digestReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	size   int64
+}
+
+func newDigestReader(r io.Reader) *digestReader {
+	return &digestReader{reader: r, hash: md5.New()}
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+	if n > 0 {
+		d.hash.Write(p[:n])
+		d.size += int64(n)
+	}
+	return n, err
+}
+
+func (d *digestReader) etag() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// Captures/Represents reader which enforces expected payload size: reading fails with `errIncompleteBody` when
+// payload ends before or exceeds expected size, so content is rejected before it is committed.
+type lengthReader struct {
+	r        io.Reader
+	expected int64
+	read     int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.expected || (err == io.EOF && l.read < l.expected) {
+		return n, errIncompleteBody
+	}
+	return n, err
+}
+
+// payloadSize - returns expected (decoded) payload size of request. Returns -1 when unknown.
+func payloadSize(r *http.Request) int64 {
+	if v := r.Header.Get("x-amz-decoded-content-length"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	}
+	if isChunkedPayload(r) {
+		return -1
+	}
+	return r.ContentLength
+}
+
+// writeContent - writes request payload to block storage, in given stage when it is not empty (see
+// `BlockStorage.CreateStagedBlock`). Returns root block cid, size and md5 digest of payload. Empty payloads are not
+// written, so returned cid is empty for them. Payload not matching expected size fails the write before the file
+// is committed (see `lengthReader`).
+func (e *endpoint) writeContent(ctx context.Context, r *http.Request, name, stage string) (string, int64, string, error) {
+	var body io.Reader = r.Body
+	if isChunkedPayload(r) {
+		body = newChunkedReader(r.Body)
+	}
+	if expected := payloadSize(r); expected >= 0 {
+		body = &lengthReader{r: body, expected: expected}
+	}
+	reader := newDigestReader(util.NewFullReader(body))
+
+	var digest string
+	var err error
+	if stage != "" {
+		digest, err = e.storage.CreateStagedBlock(ctx, stage, name, reader)
+	} else {
+		digest, err = e.storage.CreateBlock(ctx, name, reader)
+	}
+	if err != nil && err != blockstorage.ErrBlockDataEmpty {
+		return "", 0, "", err
+	}
+	return digest, reader.size, reader.etag(), nil
+}
+
+// writeFailure - writes response for given failure. S3 api errors written as is, size and quota limits of block
+// storage as `EntityTooLarge`/`QuotaExceeded`, others as `InternalError`.
+func (e *endpoint) writeFailure(w http.ResponseWriter, r *http.Request, err error) {
+	if apiErr, ok := err.(*apiError); ok {
+		writeError(w, r, apiErr)
+		return
+	}
+	switch err {
+	case blockstorage.ErrFileTooLarge:
+		writeError(w, r, errEntityTooLarge)
+	case blockstorage.ErrQuotaExceeded:
+		writeError(w, r, errQuotaExceeded)
+	default:
+		e.internalError(w, r, err)
+	}
+}
+
+func (e *endpoint) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if r.Header.Get("x-amz-copy-source") != "" {
+		writeError(w, r, errNotImplemented)
+		return
+	}
+	ctx := r.Context()
+	digest, size, etag, err := e.writeContent(ctx, r, bucket+"/"+key, "")
+	if err != nil {
+		e.writeFailure(w, r, err)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	info := &objectInfo{
+		Key:          key,
+		Cid:          digest,
+		Size:         size,
+		ETag:         etag,
+		ContentType:  contentType,
+		LastModified: time.Now(),
+	}
+	if err := e.index.putObject(ctx, bucket, info); err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	if e.debug {
+		log.Printf("debug: s3 object written: %s/%s, %s, %d bytes\n", bucket, key, digest, size)
+	}
+	w.Header().Set("ETag", quoteETag(etag))
+	w.WriteHeader(http.StatusOK)
+}
+
+// getObject - serves GetObject and HeadObject requests. Content only written when `withBody` is true. When
+// reading content fails after headers are written, connection is aborted.
+func (e *endpoint) getObject(w http.ResponseWriter, r *http.Request, bucket, key string, withBody bool) {
+	ctx := r.Context()
+	info, err := e.index.getObject(ctx, bucket, key)
+	if err != nil {
+		if err == errIndexEntryNotFound {
+			writeError(w, r, errNoSuchKey)
+			return
+		}
+		e.internalError(w, r, err)
+		return
+	}
+
+	var root cid.Cid
+	if info.Cid != "" {
+		root, err = cid.Decode(info.Cid)
+		if err != nil {
+			e.internalError(w, r, err)
+			return
+		}
+	}
+
+	// root is resolved before status is written, so unreadable content is reported as error
+	if withBody && info.Cid != "" {
+		if _, err := e.storage.GetBlock(ctx, root); err != nil {
+			e.internalError(w, r, err)
+			return
+		}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", info.ContentType)
+	header.Set("Content-Length", fmt.Sprint(info.Size))
+	header.Set("ETag", quoteETag(info.ETag))
+	header.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	header.Set("x-amz-meta-cid", info.Cid)
+	w.WriteHeader(http.StatusOK)
+
+	if !withBody || info.Cid == "" {
+		return
+	}
+	if err := e.storage.ReadFile(ctx, root, w); err != nil {
+		log.Printf("err: s3 reading object content failed: %s/%s, %s\n", bucket, key, err.Error())
+		// status is already written, so connection is aborted for client to see truncated body as failure
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (e *endpoint) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if err := e.index.deleteObject(r.Context(), bucket, key); err != nil {
+		e.internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
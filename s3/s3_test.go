@@ -0,0 +1,301 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/igumus/blockstorage"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *s3Suite) TestEndpointCreation() {
+	_, err := NewS3Endpoint(context.Background(), nil)
+	require.Equal(s.T(), ErrStorageNotSpecified, err)
+}
+
+func (s *s3Suite) TestBucketOperations() {
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{name: "create_bucket", method: http.MethodPut, path: "/bucket1", status: http.StatusOK},
+		{name: "create_existing_bucket", method: http.MethodPut, path: "/bucket1", status: http.StatusConflict},
+		{name: "create_invalid_bucket", method: http.MethodPut, path: "/Invalid_Bucket", status: http.StatusBadRequest},
+		{name: "head_bucket", method: http.MethodHead, path: "/bucket1", status: http.StatusOK},
+		{name: "head_missing_bucket", method: http.MethodHead, path: "/bucket2", status: http.StatusNotFound},
+		{name: "put_object", method: http.MethodPut, path: "/bucket1/key", status: http.StatusOK},
+		{name: "put_object_missing_bucket", method: http.MethodPut, path: "/bucket2/key", status: http.StatusNotFound},
+		{name: "delete_not_empty_bucket", method: http.MethodDelete, path: "/bucket1", status: http.StatusConflict},
+		{name: "delete_object", method: http.MethodDelete, path: "/bucket1/key", status: http.StatusNoContent},
+		{name: "delete_bucket", method: http.MethodDelete, path: "/bucket1", status: http.StatusNoContent},
+		{name: "delete_missing_bucket", method: http.MethodDelete, path: "/bucket1", status: http.StatusNotFound},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			var body []byte
+			if tc.method == http.MethodPut {
+				body = []byte("data")
+			}
+			resp, _ := s.do(tc.method, tc.path, body, nil)
+			require.Equal(t, tc.status, resp.StatusCode)
+		})
+	}
+}
+
+func (s *s3Suite) TestListBuckets() {
+	for _, bucket := range []string{"zeta", "alpha", "beta"} {
+		resp, _ := s.do(http.MethodPut, "/"+bucket, nil, nil)
+		require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	}
+
+	resp, body := s.do(http.MethodGet, "/", nil, nil)
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+
+	var result listAllMyBucketsResult
+	require.NoError(s.T(), xml.Unmarshal(body, &result))
+	require.Equal(s.T(), 3, len(result.Buckets))
+	require.Equal(s.T(), "alpha", result.Buckets[0].Name)
+	require.Equal(s.T(), "beta", result.Buckets[1].Name)
+	require.Equal(s.T(), "zeta", result.Buckets[2].Name)
+}
+
+func (s *s3Suite) TestObjectRoundTrip() {
+	resp, _ := s.do(http.MethodPut, "/bucket", nil, nil)
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+
+	testCases := []struct {
+		name string
+		key  string
+		size int
+	}{
+		{name: "small_object", key: "small.txt", size: 3},
+		{name: "multi_chunk_object", key: "dir/large.bin", size: 1536 << 10},
+		{name: "empty_object", key: "dir/", size: 0},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			data := generateRandomBytes(t, tc.size)
+			digest := md5.Sum(data)
+			etag := `"` + hex.EncodeToString(digest[:]) + `"`
+
+			resp, _ := s.do(http.MethodPut, "/bucket/"+tc.key, data, map[string]string{"Content-Type": "text/plain"})
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, etag, resp.Header.Get("ETag"))
+
+			resp, _ = s.do(http.MethodHead, "/bucket/"+tc.key, nil, nil)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, fmt.Sprint(tc.size), resp.Header.Get("Content-Length"))
+			require.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+			require.Equal(t, etag, resp.Header.Get("ETag"))
+
+			resp, body := s.do(http.MethodGet, "/bucket/"+tc.key, nil, nil)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, data, body)
+
+			resp, _ = s.do(http.MethodDelete, "/bucket/"+tc.key, nil, nil)
+			require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+			resp, body = s.do(http.MethodGet, "/bucket/"+tc.key, nil, nil)
+			require.Equal(t, http.StatusNotFound, resp.StatusCode)
+			require.Contains(t, string(body), "NoSuchKey")
+		})
+	}
+}
+
+func (s *s3Suite) TestChunkedPayload() {
+	resp, _ := s.do(http.MethodPut, "/bucket", nil, nil)
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+
+	payload := "5;chunk-signature=abc\r\nhello\r\n6;chunk-signature=def\r\n world\r\n0;chunk-signature=ghi\r\n\r\n"
+	resp, _ = s.do(http.MethodPut, "/bucket/chunked", []byte(payload), map[string]string{
+		"x-amz-content-sha256":         "STREAMING-AWS4-HMAC-SHA256-PAYLOAD",
+		"x-amz-decoded-content-length": "11",
+		"Content-Encoding":             "aws-chunked",
+	})
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+
+	resp, body := s.do(http.MethodGet, "/bucket/chunked", nil, nil)
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	require.Equal(s.T(), "hello world", string(body))
+
+	// payload not matching expected size is not persisted
+	objects := s.store.objectCount()
+	for _, size := range []string{"12", "10"} {
+		resp, body = s.do(http.MethodPut, "/bucket/truncated", []byte(payload), map[string]string{
+			"x-amz-content-sha256":         "STREAMING-AWS4-HMAC-SHA256-PAYLOAD",
+			"x-amz-decoded-content-length": size,
+		})
+		require.Equal(s.T(), http.StatusBadRequest, resp.StatusCode)
+		require.Contains(s.T(), string(body), "IncompleteBody")
+	}
+	require.Equal(s.T(), objects, s.store.objectCount())
+	resp, _ = s.do(http.MethodGet, "/bucket/truncated", nil, nil)
+	require.Equal(s.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (s *s3Suite) TestObjectContentUnreadable() {
+	resp, _ := s.do(http.MethodPut, "/bucket", nil, nil)
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	for _, key := range []string{"root.bin", "leaf.bin"} {
+		resp, _ = s.do(http.MethodPut, "/bucket/"+key, generateRandomBytes(s.T(), 1536<<10), nil)
+		require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	}
+	cidOf := func(key string) cid.Cid {
+		resp, _ := s.do(http.MethodHead, "/bucket/"+key, nil, nil)
+		id, err := cid.Decode(resp.Header.Get("x-amz-meta-cid"))
+		require.NoError(s.T(), err)
+		return id
+	}
+
+	// missing root is reported before status is written
+	require.NoError(s.T(), s.store.DeleteObject(context.Background(), cidOf("root.bin")))
+	resp, body := s.do(http.MethodGet, "/bucket/root.bin", nil, nil)
+	require.Equal(s.T(), http.StatusInternalServerError, resp.StatusCode)
+	require.Contains(s.T(), string(body), "InternalError")
+
+	// missing leaf aborts connection, so client does not read truncated content as success
+	root, err := s.storage.GetBlock(context.Background(), cidOf("leaf.bin"))
+	require.NoError(s.T(), err)
+	leaf, err := cid.Decode(root.Links[len(root.Links)-1].Hash)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.store.DeleteObject(context.Background(), leaf))
+	resp, err = http.Get(s.server.URL + "/bucket/leaf.bin")
+	require.NoError(s.T(), err)
+	defer resp.Body.Close()
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	_, err = ioutil.ReadAll(resp.Body)
+	require.Error(s.T(), err)
+}
+
+// listAll - lists bucket with given query by following continuation tokens. Returns keys and common prefixes.
+func (s *s3Suite) listAll(query string) ([]string, []string) {
+	keys := make([]string, 0)
+	prefixes := make([]string, 0)
+	token := ""
+	for {
+		path := "/bucket?list-type=2&" + query
+		if token != "" {
+			path += "&continuation-token=" + token
+		}
+		resp, body := s.do(http.MethodGet, path, nil, nil)
+		require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+
+		var result listBucketResultV2
+		require.NoError(s.T(), xml.Unmarshal(body, &result))
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		require.Equal(s.T(), len(result.Contents)+len(result.CommonPrefixes), result.KeyCount)
+		if !result.IsTruncated {
+			return keys, prefixes
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *s3Suite) TestListObjectsV2() {
+	resp, _ := s.do(http.MethodPut, "/bucket", nil, nil)
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	for _, key := range []string{"b.txt", "a/2.txt", "a/1.txt", "c/d/e.txt", "a/sub/3.txt"} {
+		resp, _ := s.do(http.MethodPut, "/bucket/"+key, []byte(key), nil)
+		require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	}
+
+	testCases := []struct {
+		name     string
+		query    string
+		keys     []string
+		prefixes []string
+	}{
+		{
+			name:     "all_keys",
+			query:    "",
+			keys:     []string{"a/1.txt", "a/2.txt", "a/sub/3.txt", "b.txt", "c/d/e.txt"},
+			prefixes: []string{},
+		},
+		{
+			name:     "all_keys_paginated",
+			query:    "max-keys=2",
+			keys:     []string{"a/1.txt", "a/2.txt", "a/sub/3.txt", "b.txt", "c/d/e.txt"},
+			prefixes: []string{},
+		},
+		{
+			name:     "with_delimiter",
+			query:    "delimiter=/",
+			keys:     []string{"b.txt"},
+			prefixes: []string{"a/", "c/"},
+		},
+		{
+			name:     "with_delimiter_paginated",
+			query:    "delimiter=/&max-keys=1",
+			keys:     []string{"b.txt"},
+			prefixes: []string{"a/", "c/"},
+		},
+		{
+			name:     "with_prefix_and_delimiter",
+			query:    "prefix=a/&delimiter=/",
+			keys:     []string{"a/1.txt", "a/2.txt"},
+			prefixes: []string{"a/sub/"},
+		},
+		{
+			name:     "with_start_after",
+			query:    "start-after=a/2.txt",
+			keys:     []string{"a/sub/3.txt", "b.txt", "c/d/e.txt"},
+			prefixes: []string{},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			keys, prefixes := s.listAll(tc.query)
+			require.Equal(t, tc.keys, keys)
+			require.Equal(t, tc.prefixes, prefixes)
+		})
+	}
+
+	resp, body := s.do(http.MethodGet, "/missing?list-type=2", nil, nil)
+	require.Equal(s.T(), http.StatusNotFound, resp.StatusCode)
+	require.True(s.T(), strings.Contains(string(body), "NoSuchBucket"))
+}
+
+func (s *s3Suite) TestWriteFailure() {
+	e := &endpoint{}
+	for _, tc := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{err: errIncompleteBody, status: http.StatusBadRequest, code: "IncompleteBody"},
+		{err: blockstorage.ErrFileTooLarge, status: http.StatusBadRequest, code: "EntityTooLarge"},
+		{err: blockstorage.ErrQuotaExceeded, status: http.StatusForbidden, code: "QuotaExceeded"},
+		{err: errors.New("failed"), status: http.StatusInternalServerError, code: "InternalError"},
+	} {
+		w := httptest.NewRecorder()
+		e.writeFailure(w, httptest.NewRequest(http.MethodPut, "/bucket/key", nil), tc.err)
+		require.Equal(s.T(), tc.status, w.Code)
+		require.Contains(s.T(), w.Body.String(), tc.code)
+	}
+}
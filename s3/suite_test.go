@@ -0,0 +1,137 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/igumus/go-objectstore-lib"
+	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type s3Suite struct {
+	suite.Suite
+	*require.Assertions
+	ctrl    *gomock.Controller
+	store   *memoryStore
+	storage blockstorage.BlockStorage
+	server  *httptest.Server
+}
+
+// memoryStore - mock object store which keeps objects in memory, and supports deletion
+type memoryStore struct {
+	*mock.MockObjectStore
+	lock   *sync.Mutex
+	lookup map[cid.Cid][]byte
+}
+
+func (m *memoryStore) DeleteObject(_ context.Context, id cid.Cid) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.lookup[id]; !ok {
+		return objectstore.ErrObjectNotExists
+	}
+	delete(m.lookup, id)
+	return nil
+}
+
+// objectCount - returns count of objects in store
+func (m *memoryStore) objectCount() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.lookup)
+}
+
+func generateRandomBytes(t *testing.T, size int) []byte {
+	blk := make([]byte, size)
+	_, err := rand.Read(blk)
+	require.NoError(t, err)
+	return blk
+}
+
+// makeStorage - creates fake block storage instance over in-memory mock object store
+func (s *s3Suite) makeStorage() blockstorage.BlockStorage {
+	lock := &sync.Mutex{}
+	lookup := make(map[cid.Cid][]byte)
+
+	store := mock.NewMockObjectStore(s.ctrl)
+	store.EXPECT().HasObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		_, ok := lookup[id]
+		return ok
+	})
+	store.EXPECT().CreateObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, r io.Reader) (cid.Cid, error) {
+		data, err := ioutil.ReadAll(r)
+		require.NoError(s.T(), err)
+		id, err := objectstore.DigestPrefix.Sum(data)
+		require.NoError(s.T(), err)
+		lock.Lock()
+		defer lock.Unlock()
+		lookup[id] = data
+		return id, nil
+	})
+	store.EXPECT().ReadObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		data, ok := lookup[id]
+		if !ok {
+			return nil, objectstore.ErrObjectNotExists
+		}
+		return data, nil
+	})
+	s.store = &memoryStore{MockObjectStore: store, lock: lock, lookup: lookup}
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(true)
+	peer.EXPECT().GetRemoteBlock(gomock.Any(), gomock.Any()).AnyTimes().Return(nil, errors.New("block not found"))
+
+	storage, err := blockstorage.NewFakeBlockStorage(context.Background(), blockstorage.WithLocalStore(s.store), blockstorage.WithPeer(peer))
+	require.NoError(s.T(), err)
+	return storage
+}
+
+// do - sends request with given method, path and body to test server
+func (s *s3Suite) do(method, path string, body []byte, headers map[string]string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, s.server.URL+path, bytes.NewReader(body))
+	require.NoError(s.T(), err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(s.T(), err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(s.T(), err)
+	return resp, data
+}
+
+func TestS3Suite(t *testing.T) {
+	suite.Run(t, new(s3Suite))
+}
+
+func (s *s3Suite) SetupTest() {
+	s.Assertions = require.New(s.T())
+	s.ctrl = gomock.NewController(s.T())
+	s.storage = s.makeStorage()
+	handler, err := NewS3Endpoint(context.Background(), s.storage)
+	require.NoError(s.T(), err)
+	s.server = httptest.NewServer(handler)
+}
+
+func (s *s3Suite) TearDownTest() {
+	s.server.Close()
+	s.ctrl.Finish()
+}
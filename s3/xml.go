@@ -0,0 +1,163 @@
+package s3
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"time"
+)
+
+// s3Namespace - xml namespace of S3 api responses
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// Owner information returned in listings. Endpoint has no notion of accounts, so single owner used.
+const (
+	ownerID          = "blockstorage"
+	ownerDisplayName = "blockstorage"
+)
+
+// Captures/Represents S3 api error with associated http status
+type apiError struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errBucketAlreadyOwnedByYou = &apiError{"BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.", http.StatusConflict}
+	errBucketNotEmpty          = &apiError{"BucketNotEmpty", "The bucket you tried to delete is not empty.", http.StatusConflict}
+	errEntityTooLarge          = &apiError{"EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size.", http.StatusBadRequest}
+	errIncompleteBody          = &apiError{"IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", http.StatusBadRequest}
+	errInternalError           = &apiError{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+	errInvalidArgument         = &apiError{"InvalidArgument", "Invalid Argument.", http.StatusBadRequest}
+	errInvalidBucketName       = &apiError{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	errInvalidPart             = &apiError{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	errInvalidPartOrder        = &apiError{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	errMalformedXML            = &apiError{"MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.", http.StatusBadRequest}
+	errMethodNotAllowed        = &apiError{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	errNoSuchBucket            = &apiError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	errNoSuchKey               = &apiError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	errNoSuchUpload            = &apiError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	errNotImplemented          = &apiError{"NotImplemented", "A header or query you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	errQuotaExceeded           = &apiError{"QuotaExceeded", "Your storage quota is exceeded.", http.StatusForbidden}
+)
+
+// Captures/Represents xml body of error response
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type bucketEntry struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name      `xml:"ListAllMyBucketsResult"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Owner   owner         `xml:"Owner"`
+	Buckets []bucketEntry `xml:"Buckets>Bucket"`
+}
+
+type objectEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResultV2 struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int            `xml:"KeyCount"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []objectEntry  `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// formatTime - formats given time as S3 listing timestamp (ISO 8601 with milliseconds)
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// writeXML - writes given value as xml response body with given http status
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		log.Printf("err: encoding s3 response failed: %s\n", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// writeError - writes given api error as S3 error response. HEAD requests have no body,
+// so only status written for them.
+func writeError(w http.ResponseWriter, r *http.Request, e *apiError) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.StatusCode)
+		return
+	}
+	writeXML(w, e.StatusCode, &errorResponse{
+		Code:      e.Code,
+		Message:   e.Message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get("x-amz-request-id"),
+	})
+}
@@ -0,0 +1,159 @@
+package blockstorage
+
+import (
+	"context"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/igumus/blockstorage/util"
+	ds "github.com/ipfs/go-datastore"
+)
+
+// stagesNamespace - holds datastore namespace of stages (see `CreateStagedBlock`)
+const stagesNamespace = "/blockstorage/stages"
+
+// stageWriteSetPrefix - prefixes ids of stage write sets, so they are separated from ids of other write sets
+const stageWriteSetPrefix = "stage-"
+
+// stageIDPattern - matches valid stage ids, which are used in datastore keys
+var stageIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// Captures/Represents in-memory state of stage: nodes newly persisted for staged files (removed when stage is
+// discarded), and count of staged files being created.
+type stage struct {
+	ws      *writeSet
+	writers sync.WaitGroup
+}
+
+// stageKey - returns datastore key of stage with given id
+func stageKey(id string) ds.Key {
+	return ds.NewKey(stagesNamespace).ChildString(id)
+}
+
+// CreateStagedBlock - creates file with given `name` and content (see `CreateBlock`) in stage with given id. Nodes
+// newly persisted for staged files are kept (also after restart, see `recoverWriteSets`) until stage is discarded
+// (see `DiscardStage`), and then removed from permanent store unless they are shared with other files meanwhile
+// (e.g. file joining content of staged files). Staged files are not added to file index, and not announced to p2p
+// network.
+//
+// Flow:
+// 1. Validates stage id, and persists stage with caller when it not exists
+// 2. Creates file DAG with write set of stage, so its nodes are recorded to the stage
+//
+// Error:
+// - When stage id is not valid returns `"", ErrStageIDNotValid`
+// - When stage is created by another caller returns `"", ErrStageNotFound`
+// - Otherwise returns `CreateBlock` errors. Nodes persisted until failure are removed when stage is discarded.
+func (s *storage) CreateStagedBlock(ctx context.Context, id string, fname string, reader io.Reader) (string, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return "", stopErr
+	}
+	defer done()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return "", ctxErr
+	}
+	st, err := s.acquireStage(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer st.writers.Done()
+
+	link, err := s.createFile(withWriteSet(ctx, st.ws), fname, reader, false, nil)
+	if err != nil {
+		return "", err
+	}
+	return link.Hash, nil
+}
+
+// DiscardStage - removes nodes newly persisted for staged files of stage with given id (see `CreateStagedBlock`),
+// unless they are shared with other files, and removes the stage. Waits for staged files being created. Discarding
+// a stage which not exists is not an error.
+//
+// Error:
+// - When stage id is not valid returns `ErrStageIDNotValid`
+// - When stage is created by another caller returns `ErrStageNotFound`
+// - When reading or removing stage fails returns error cause
+func (s *storage) DiscardStage(ctx context.Context, id string) error {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return stopErr
+	}
+	defer done()
+	if !stageIDPattern.MatchString(id) {
+		return ErrStageIDNotValid
+	}
+
+	s.stagesLock.Lock()
+	caller, err := s.datastore.Get(ctx, stageKey(id))
+	if err == ds.ErrNotFound {
+		s.stagesLock.Unlock()
+		return nil
+	}
+	if err != nil {
+		s.stagesLock.Unlock()
+		return err
+	}
+	if string(caller) != callerFrom(ctx) {
+		s.stagesLock.Unlock()
+		return ErrStageNotFound
+	}
+	if err := s.datastore.Delete(ctx, stageKey(id)); err != nil {
+		s.stagesLock.Unlock()
+		return err
+	}
+	st, ok := s.stages[id]
+	delete(s.stages, id)
+	s.stagesLock.Unlock()
+
+	if ok {
+		st.writers.Wait()
+		// rollback should not be affected by cancellation of caller
+		s.rollback(context.Background(), st.ws)
+	}
+	if s.debug {
+		log.Printf("debug: stage discarded: %s\n", id)
+	}
+	return nil
+}
+
+// acquireStage - returns stage with given id, persisting it with caller when it not exists, and registers a
+// writer of the stage (caller should call `writers.Done`)
+func (s *storage) acquireStage(ctx context.Context, id string) (*stage, error) {
+	if !stageIDPattern.MatchString(id) {
+		return nil, ErrStageIDNotValid
+	}
+	s.stagesLock.Lock()
+	defer s.stagesLock.Unlock()
+	caller, err := s.datastore.Get(ctx, stageKey(id))
+	switch {
+	case err == ds.ErrNotFound:
+		if err := s.datastore.Put(ctx, stageKey(id), []byte(callerFrom(ctx))); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case string(caller) != callerFrom(ctx):
+		return nil, ErrStageNotFound
+	}
+	st, ok := s.stages[id]
+	if !ok {
+		st = &stage{ws: newNamedWriteSet(stageWriteSetPrefix + id)}
+		st.ws.caller = callerFrom(ctx)
+		s.stages[id] = st
+	}
+	st.writers.Add(1)
+	return st, nil
+}
+
+// stageOf - returns id of stage whose write set has given id, or `""` when write set is not of a stage
+func stageOf(wsID string) string {
+	if !strings.HasPrefix(wsID, stageWriteSetPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(wsID, stageWriteSetPrefix)
+}
@@ -0,0 +1,68 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestStagedBlocks() {
+	ctx := context.Background()
+	store := newMemoryStore(s.T(), s.ctrl)
+	datastore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := s.newTestStorage(WithLocalStore(store), WithDatastore(datastore)).(*storage)
+	bs.chunkSize = 16
+
+	parts := [][]byte{bytes.Repeat([]byte("0123456789"), 4), []byte("abcdefghij")}
+	staged := make([]cid.Cid, 0, len(parts))
+	for i, part := range parts {
+		digest, err := bs.CreateStagedBlock(ctx, "upload-1", "part", bytes.NewReader(part))
+		require.NoError(s.T(), err)
+		id, err := cid.Decode(digest)
+		require.NoError(s.T(), err)
+		staged = append(staged, id)
+
+		content := &bytes.Buffer{}
+		require.NoError(s.T(), bs.ReadFile(ctx, id, content))
+		require.Equal(s.T(), parts[i], content.Bytes())
+	}
+	// leaves and roots of both parts
+	require.Equal(s.T(), 3+1+1+1, store.objectCount())
+	stats, err := bs.ListBlocks(ctx, BlockFilter{})
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 0, len(stats))
+
+	_, err = bs.CreateStagedBlock(ctx, "upload/1", "part", bytes.NewReader(parts[0]))
+	require.Equal(s.T(), ErrStageIDNotValid, err)
+	_, err = bs.CreateStagedBlock(WithCaller(ctx, "other"), "upload-1", "part", bytes.NewReader(parts[0]))
+	require.Equal(s.T(), ErrStageNotFound, err)
+	require.Equal(s.T(), ErrStageNotFound, bs.DiscardStage(WithCaller(ctx, "other"), "upload-1"))
+
+	// stage survives restart
+	restarted := s.newTestStorage(WithLocalStore(store), WithDatastore(datastore)).(*storage)
+	restarted.chunkSize = 16
+	require.Equal(s.T(), 6, store.objectCount())
+
+	// joined file shares leaves of staged files, so they are kept when stage is discarded
+	joined, err := restarted.CreateBlock(ctx, "joined", bytes.NewReader(bytes.Join(parts, nil)))
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), restarted.DiscardStage(ctx, "upload-1"))
+	require.NoError(s.T(), restarted.DiscardStage(ctx, "upload-1"))
+	require.Equal(s.T(), 4+1, store.objectCount())
+
+	root, err := cid.Decode(joined)
+	require.NoError(s.T(), err)
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), restarted.ReadFile(ctx, root, content))
+	require.Equal(s.T(), bytes.Join(parts, nil), content.Bytes())
+	for _, id := range staged {
+		require.False(s.T(), restarted.localStore.HasObject(ctx, id))
+	}
+	entries, err := s.walEntries(restarted)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 0, len(entries))
+}
@@ -3,72 +3,185 @@ package blockstorage
 import (
 	"context"
 	"io"
+	"io/fs"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/igumus/blockstorage/blockpb"
 	"github.com/igumus/blockstorage/peer"
+	"github.com/igumus/blockstorage/util"
 	"github.com/igumus/go-objectstore-lib"
 	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	libpeer "github.com/libp2p/go-libp2p-core/peer"
 )
 
-// Defines/Represents block storage's public functionality
+// Defines/Represents block storage's public functionality. After storage is stopped (see `Stop`), all operations
+// return `ErrStorageStopped`.
 type BlockStorage interface {
 	CreateBlock(context.Context, string, io.Reader) (string, error)
+	CreateBlockWithMetadata(context.Context, string, *blockpb.Metadata, io.Reader) (string, error)
 	GetBlock(context.Context, cid.Cid) (*blockpb.Block, error)
-	Stop() error
+	ReadFile(context.Context, cid.Cid, io.Writer) error
+	ExportCAR(context.Context, cid.Cid, io.Writer) error
+	ImportCAR(context.Context, io.Reader) ([]cid.Cid, error)
+	CreateDirectory(context.Context, string, []*blockpb.Link) (string, error)
+	AddTree(context.Context, string, fs.FS) (string, error)
+	AddTar(context.Context, string, io.Reader) (string, error)
+	AddArchive(context.Context, string, io.Reader) (string, error)
+	ExportTar(context.Context, cid.Cid, io.Writer) error
+	GetByPath(context.Context, cid.Cid, string) (cid.Cid, error)
+	Usage(context.Context, string) (*blockpb.Usage, error)
+	Stat(context.Context, cid.Cid) (*blockpb.BlockStat, error)
+	ListBlocks(context.Context, BlockFilter) ([]*blockpb.BlockStat, error)
+	StartUpload(context.Context, string, *blockpb.Metadata) (string, error)
+	UploadStatus(context.Context, string) (uint64, error)
+	ResumeUpload(context.Context, string, uint64, io.Reader) (string, error)
+	ExpireUploads(context.Context) (int, error)
+	CreateStagedBlock(context.Context, string, string, io.Reader) (string, error)
+	DiscardStage(context.Context, string) error
+	Push(context.Context, cid.Cid, libpeer.ID) (int, error)
+	Replicate(context.Context, cid.Cid, int) error
+	ReplicationStatus(context.Context, cid.Cid) (*blockpb.Replication, error)
+	CacheStats() CacheStats
+	Stop(context.Context) error
 }
 
 // Captures/Represents block storage's internal structure
 type storage struct {
 	debug      bool
 	chunkSize  int
-	localStore objectstore.ObjectStore
-	peer       peer.BlockStoragePeer
+	workers    int
+	encoding   Encoding
+	rawLeaves  bool
+	prefix     cid.Prefix
+	erasure    erasure
+	localStore util.CidStore
+	// codec and addressing of leaf compression (see `WithCompression`)
+	compression blockpb.Compression
+	addressing  Addressing
+	// key provider and mode of leaf encryption (see `WithEncryption`), provider is nil when encryption is disabled
+	keys           KeyProvider
+	encryptionMode EncryptionMode
+	// decoded blocks recently read (see `WithBlockCache`)
+	cache *blockCache
+	// underlying object store of localStore, which is closed by `Stop`
+	lstore    objectstore.ObjectStore
+	datastore ds.Datastore
+	// objects newly persisted by in-flight operations keyed by their key in underlying store (see `transaction`),
+	// and objects being claimed (see `claimNode`)
+	pendingLock sync.Mutex
+	pending     map[cid.Cid]*writeSet
+	claiming    map[cid.Cid]chan struct{}
+	// upload sessions known by this instance (see `StartUpload`)
+	uploadTTL   time.Duration
+	uploadsLock sync.Mutex
+	uploads     map[string]*upload
+	// stages known by this instance (see `CreateStagedBlock`)
+	stagesLock sync.Mutex
+	stages     map[string]*stage
+	// size limit and caller quotas with usage of callers (see `reserve`)
+	maxFileSize uint64
+	quota       quota
+	usageLock   sync.Mutex
+	usage       map[string]*blockpb.Usage
+	reserved    map[string]*blockpb.Usage
+	peer        peer.BlockStoragePeer
+	// interval of checking replicas of designated roots (see `Replicate`)
+	replicationInterval time.Duration
+	// lifecycle state of storage: operations are refused after stopped, in-flight operations are drained by `Stop`
+	// (contexts of operations are derived from `operations`, see `enter`), and background services (see
+	// `startReplication`) are cancelled
+	lifecycleLock    sync.Mutex
+	stopped          bool
+	inflight         sync.WaitGroup
+	operations       context.Context
+	cancelOperations context.CancelFunc
+	background       sync.WaitGroup
+	cancel           context.CancelFunc
+}
+
+// newStorage - returns storage instance with given configuration, without peer protocols and background services
+func newStorage(cfg *blockstorageConfig) *storage {
+	operations, cancelOperations := context.WithCancel(context.Background())
+	return &storage{
+		debug:               cfg.debugMode,
+		chunkSize:           cfg.chunkSize,
+		workers:             cfg.workers,
+		encoding:            cfg.encoding,
+		rawLeaves:           cfg.rawLeaves,
+		prefix:              cfg.prefix,
+		erasure:             cfg.erasure,
+		localStore:          util.WrapObjectStore(cfg.lstore, cfg.datastore),
+		compression:         cfg.compression,
+		addressing:          cfg.addressing,
+		keys:                cfg.keys,
+		encryptionMode:      cfg.encryptionMode,
+		cache:               newBlockCache(cfg.cacheSize),
+		lstore:              cfg.lstore,
+		datastore:           cfg.datastore,
+		pending:             make(map[cid.Cid]*writeSet),
+		claiming:            make(map[cid.Cid]chan struct{}),
+		uploadTTL:           cfg.uploadTTL,
+		uploads:             make(map[string]*upload),
+		stages:              make(map[string]*stage),
+		maxFileSize:         cfg.maxSize,
+		quota:               cfg.quota,
+		usage:               make(map[string]*blockpb.Usage),
+		reserved:            make(map[string]*blockpb.Usage),
+		peer:                cfg.peer,
+		replicationInterval: cfg.replicationInterval,
+		operations:          operations,
+		cancelOperations:    cancelOperations,
+	}
 }
 
 // NewFakeBlockStorage - creates a new `BlockStorage` instance for mocking.
-// - Registering peer Read Protocol disabled.
+// - Registering peer Read/Push Protocols disabled.
+// - Checking replicas periodically disabled.
 // DO NOT USE AS REAL INSTANCE.
 func NewFakeBlockStorage(ctx context.Context, opts ...BlockStorageOption) (BlockStorage, error) {
-	ret := &storage{}
-
 	cfg, cfgErr := createConfig(opts...)
 	if cfgErr != nil {
-		return ret, cfgErr
+		return &storage{}, cfgErr
 	}
 
-	ret.debug = cfg.debugMode
+	ret := newStorage(cfg)
 
-	ret.localStore = cfg.lstore
-	ret.peer = cfg.peer
-
-	ret.chunkSize = cfg.chunkSize
+	if err := ret.recoverWriteSets(ctx); err != nil {
+		return ret, err
+	}
 
 	return ret, nil
 }
 
 // NewBlockStorage - creates a new `BlockStorage` instace. If given options are valid returns the instance.
-// Otherwise return validation error
+// Otherwise return validation error. Nodes of operations interrupted by crash are removed from permanent store
+// before the instance is returned (see `recoverWriteSets`), when datastore is specified (see `WithDatastore`).
+// Otherwise write-ahead log and upload sessions are kept in memory, so they do not survive restart.
 func NewBlockStorage(ctx context.Context, opts ...BlockStorageOption) (BlockStorage, error) {
-	ret := &storage{}
-
 	cfg, cfgErr := createConfig(opts...)
 	if cfgErr != nil {
-		return ret, cfgErr
+		return &storage{}, cfgErr
+	}
+	ret := newStorage(cfg)
+	// recovery runs before peer is started, so nodes of interrupted operations are not served to peers, and failure
+	// does not leave peer running. In-memory datastore has nothing to recover.
+	if cfg.persistent {
+		if err := ret.recoverWriteSets(ctx); err != nil {
+			return ret, err
+		}
+	} else {
+		log.Println("warn: datastore not specified, nodes of operations interrupted by crash are not recovered")
 	}
 
-	ret.debug = cfg.debugMode
-
-	ret.localStore = cfg.lstore
-	ret.peer = cfg.peer
 	ret.peer.RegisterReadProtocol(ctx, ret.localStore)
-
-	ret.chunkSize = cfg.chunkSize
+	ret.peer.RegisterPushProtocol(ctx, ret.receivePushed)
+	if err := ret.peer.Start(ctx); err != nil {
+		return ret, err
+	}
+	ret.startReplication(ctx)
 
 	return ret, nil
 }
-
-func (s *storage) Stop() error {
-	log.Println("info: blockstorage service stopped")
-	return nil
-}
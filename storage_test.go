@@ -2,11 +2,17 @@ package blockstorage
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"io"
+	"io/ioutil"
+	"sync"
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	"github.com/igumus/go-objectstore-lib"
+	"github.com/igumus/go-objectstore-lib/mock"
+	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
@@ -27,6 +33,65 @@ func generateRandomByteReader(t *testing.T, size int) io.Reader {
 	return bytes.NewReader(blk)
 
 }
+
+// memoryStore - mock object store which keeps objects in memory, and supports deletion (`util.ObjectDeleter`)
+type memoryStore struct {
+	*mock.MockObjectStore
+	lock   *sync.Mutex
+	lookup map[cid.Cid][]byte
+}
+
+func (m *memoryStore) DeleteObject(_ context.Context, id cid.Cid) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.lookup[id]; !ok {
+		return objectstore.ErrObjectNotExists
+	}
+	delete(m.lookup, id)
+	return nil
+}
+
+// objectCount - returns count of objects in store
+func (m *memoryStore) objectCount() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.lookup)
+}
+
+// newMemoryStore - creates mock object store which keeps objects in memory
+func newMemoryStore(t testing.TB, ctrl *gomock.Controller) *memoryStore {
+	lock := &sync.Mutex{}
+	lookup := make(map[cid.Cid][]byte)
+
+	store := mock.NewMockObjectStore(ctrl)
+	store.EXPECT().HasObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		_, ok := lookup[id]
+		return ok
+	})
+	store.EXPECT().CreateObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, r io.Reader) (cid.Cid, error) {
+		data, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		id, err := objectstore.DigestPrefix.Sum(data)
+		require.NoError(t, err)
+		lock.Lock()
+		defer lock.Unlock()
+		lookup[id] = data
+		return id, nil
+	})
+	store.EXPECT().ReadObject(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		data, ok := lookup[id]
+		if !ok {
+			return nil, objectstore.ErrObjectNotExists
+		}
+		return data, nil
+	})
+	return &memoryStore{MockObjectStore: store, lock: lock, lookup: lookup}
+}
+
 func TestBlockStorageSuite(t *testing.T) {
 	suite.Run(t, new(blockStorageSuite))
 }
@@ -0,0 +1,301 @@
+package blockstorage
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/util"
+)
+
+// Captures/Represents node of directory tree being built. Files have root link, directories have children
+// and metadata (optional).
+type treeNode struct {
+	link     *blockpb.Link
+	children map[string]*treeNode
+	meta     *blockpb.Metadata
+}
+
+// Captures/Represents in-memory directory tree whose files are already persisted.
+type treeBuilder struct {
+	root *treeNode
+}
+
+func newTreeBuilder() *treeBuilder {
+	return &treeBuilder{root: &treeNode{children: make(map[string]*treeNode)}}
+}
+
+// splitTreePath - splits given slash separated entry path (relative to tree root) to segments.
+// Returns `nil` for root itself, and `ErrPathNotValid` when path is absolute or escapes root.
+func splitTreePath(p string) ([]string, error) {
+	cleaned := path.Clean(p)
+	if cleaned == "." {
+		return nil, nil
+	}
+	if strings.HasPrefix(cleaned, "/") || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return nil, ErrPathNotValid
+	}
+	return strings.Split(cleaned, "/"), nil
+}
+
+// unixMode - converts given file mode to unix permission bits (including setuid, setgid and sticky bits)
+func unixMode(mode fs.FileMode) uint32 {
+	ret := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		ret |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		ret |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		ret |= 01000
+	}
+	return ret
+}
+
+// newMetadata - creates metadata with given mode and modification time. Returns `nil` when both are not set.
+func newMetadata(mode fs.FileMode, mtime time.Time) *blockpb.Metadata {
+	ret := &blockpb.Metadata{Mode: unixMode(mode)}
+	if !mtime.IsZero() {
+		ret.Mtime = mtime.Unix()
+		ret.MtimeNsecs = uint32(mtime.Nanosecond())
+	}
+	if ret.Mode == 0 && ret.Mtime == 0 && ret.MtimeNsecs == 0 {
+		return nil
+	}
+	return ret
+}
+
+// dir - returns directory node with given segments, creates missing directories on the way.
+// Returns `ErrPathNotValid` when any segment is a file.
+func (t *treeBuilder) dir(segments []string) (*treeNode, error) {
+	current := t.root
+	for _, segment := range segments {
+		next, ok := current.children[segment]
+		if !ok {
+			next = &treeNode{children: make(map[string]*treeNode)}
+			current.children[segment] = next
+		}
+		if next.children == nil {
+			return nil, ErrPathNotValid
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// addDir - adds directory with given path (and missing parents) and metadata to tree.
+func (t *treeBuilder) addDir(p string, meta *blockpb.Metadata) error {
+	segments, err := splitTreePath(p)
+	if err != nil {
+		return err
+	}
+	node, err := t.dir(segments)
+	if err != nil {
+		return err
+	}
+	node.meta = meta
+	return nil
+}
+
+// addFile - adds file with given path and root link to tree. Missing parents are created, and existing file
+// with same path is replaced (as later archive entries override earlier ones).
+func (t *treeBuilder) addFile(p string, link *blockpb.Link) error {
+	segments, err := splitTreePath(p)
+	if err != nil {
+		return err
+	}
+	if len(segments) < 1 {
+		return ErrPathNotValid
+	}
+	parent, err := t.dir(segments[:len(segments)-1])
+	if err != nil {
+		return err
+	}
+	name := segments[len(segments)-1]
+	if existing, ok := parent.children[name]; ok && existing.children != nil {
+		return ErrPathNotValid
+	}
+	parent.children[name] = &treeNode{link: link}
+	return nil
+}
+
+// persistTree - persists directories of given tree node bottom-up, and returns link of directory with given name.
+func (s *storage) persistTree(ctx context.Context, name string, node *treeNode) (*blockpb.Link, error) {
+	entries := make([]*blockpb.Link, 0, len(node.children))
+	for childName, child := range node.children {
+		ctxErr := util.CheckContext(ctx)
+		if ctxErr != nil {
+			return nil, ctxErr
+		}
+		link := child.link
+		if child.children != nil {
+			childLink, err := s.persistTree(ctx, childName, child)
+			if err != nil {
+				return nil, err
+			}
+			link = childLink
+		}
+		entries = append(entries, &blockpb.Link{Hash: link.Hash, Name: childName, Tsize: link.Tsize, Type: link.Type})
+	}
+	return s.createDirectory(ctx, name, entries, node.meta)
+}
+
+// AddTree - creates directory DAG with given root `name` from given file system tree.
+//
+// Flow:
+// 1. Walks file system tree in lexical order
+// 	1.1. creates file DAG (see `CreateBlock`) for each regular file (empty files are allowed)
+// 	1.2. skips entries which are neither regular file nor directory (e.g. symlinks)
+// 	1.3. keeps mode and modification time of files and directories as node metadata
+// 2. Creates directory blocks bottom-up (see `CreateDirectory`)
+// 3. Returns cid of root directory
+//
+// Error:
+// - When `name` is not valid returns `"", ErrBlockNameEmpty`
+// - When reading file system fails returns `"", <File System Error>`
+// Nodes persisted until failure are removed from permanent store (see `transaction`).
+func (s *storage) AddTree(ctx context.Context, name string, fsys fs.FS) (string, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return "", stopErr
+	}
+	defer done()
+	link, err := s.transaction(ctx, func(ctx context.Context) (*blockpb.Link, error) {
+		return s.addTree(ctx, name, fsys)
+	})
+	if err != nil {
+		return "", err
+	}
+	return link.Hash, nil
+}
+
+// addTree - creates directory DAG from given file system tree (see `AddTree`)
+func (s *storage) addTree(ctx context.Context, name string, fsys fs.FS) (*blockpb.Link, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, ErrBlockNameEmpty
+	}
+	tree := newTreeBuilder()
+	walkErr := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ctxErr := util.CheckContext(ctx)
+		if ctxErr != nil {
+			return ctxErr
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			if s.debug {
+				log.Printf("debug: skipping tree entry: %s, %s\n", p, d.Type())
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		meta := newMetadata(info.Mode(), info.ModTime())
+		if d.IsDir() {
+			return tree.addDir(p, meta)
+		}
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		link, err := s.createFile(ctx, d.Name(), f, true, meta)
+		if err != nil {
+			return err
+		}
+		return tree.addFile(p, link)
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	return s.persistTree(ctx, name, tree.root)
+}
+
+// AddTar - creates directory DAG with given root `name` from given tar stream.
+//
+// Flow:
+// 1. Reads tar entries in order
+// 	1.1. creates file DAG (see `CreateBlock`) for each regular file (empty files are allowed)
+// 	1.2. skips entries which are neither regular file nor directory (e.g. symlinks)
+// 	1.3. keeps mode and modification time of files and directories as node metadata
+// 2. Creates directory blocks bottom-up (see `CreateDirectory`)
+// 3. Returns cid of root directory
+//
+// Error:
+// - When `name` is not valid returns `"", ErrBlockNameEmpty`
+// - When entry path is absolute, escapes root or conflicts with another entry returns `"", ErrPathNotValid`
+// - When tar stream is not valid returns `"", <Tar Error>`
+// Nodes persisted until failure are removed from permanent store (see `transaction`).
+func (s *storage) AddTar(ctx context.Context, name string, r io.Reader) (string, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return "", stopErr
+	}
+	defer done()
+	link, err := s.transaction(ctx, func(ctx context.Context) (*blockpb.Link, error) {
+		return s.addTar(ctx, name, r)
+	})
+	if err != nil {
+		return "", err
+	}
+	return link.Hash, nil
+}
+
+// addTar - creates directory DAG from given tar stream (see `AddTar`)
+func (s *storage) addTar(ctx context.Context, name string, r io.Reader) (*blockpb.Link, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, ErrBlockNameEmpty
+	}
+	tree := newTreeBuilder()
+	reader := tar.NewReader(r)
+	for {
+		ctxErr := util.CheckContext(ctx)
+		if ctxErr != nil {
+			return nil, ctxErr
+		}
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		meta := newMetadata(header.FileInfo().Mode(), header.ModTime)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := tree.addDir(header.Name, meta); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			link, err := s.createFile(ctx, path.Base(header.Name), util.NewFullReader(reader), true, meta)
+			if err != nil {
+				return nil, err
+			}
+			if err := tree.addFile(header.Name, link); err != nil {
+				return nil, err
+			}
+		default:
+			if s.debug {
+				log.Printf("debug: skipping tar entry: %s, %c\n", header.Name, header.Typeflag)
+			}
+		}
+	}
+
+	// consume rest of stream (e.g. padding after end of archive), so stream failures are not missed
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return nil, err
+	}
+	return s.persistTree(ctx, name, tree.root)
+}
@@ -0,0 +1,167 @@
+package blockstorage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+// tarEntry - represents entry of tar stream generated for tests. Entries with `dir` flag are directories.
+// Default modes are used when `mode` is not set.
+type tarEntry struct {
+	name    string
+	content []byte
+	dir     bool
+	mode    int64
+	mtime   time.Time
+}
+
+// generateTar - generates tar stream with given entries
+func generateTar(t *testing.T, entries ...tarEntry) []byte {
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(entry.content))}
+		if entry.dir {
+			header = &tar.Header{Name: entry.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if entry.mode != 0 {
+			header.Mode = entry.mode
+		}
+		if !entry.mtime.IsZero() {
+			header.ModTime = entry.mtime
+			header.Format = tar.FormatPAX
+		}
+		require.NoError(t, writer.WriteHeader(header))
+		if !entry.dir {
+			_, err := writer.Write(entry.content)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+// requireTreeContent - checks files with given paths under given root have given contents
+func (s *blockStorageSuite) requireTreeContent(t *testing.T, storage BlockStorage, root cid.Cid, files map[string]string) {
+	ctx := context.Background()
+	for p, expected := range files {
+		id, err := storage.GetByPath(ctx, root, p)
+		require.NoError(t, err, p)
+		content := &bytes.Buffer{}
+		require.NoError(t, storage.ReadFile(ctx, id, content))
+		require.Equal(t, expected, content.String(), p)
+	}
+}
+
+func (s *blockStorageSuite) TestAddTree() {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"a.txt":         {Data: []byte("a")},
+		"dir/b.txt":     {Data: []byte("b")},
+		"dir/sub/c.txt": {Data: bytes.Repeat([]byte("c"), 40)},
+		"dir/empty.txt": {Data: []byte{}},
+		"emptydir":      {Mode: fs.ModeDir | 0755},
+	}
+	files := map[string]string{
+		"a.txt":         "a",
+		"dir/b.txt":     "b",
+		"dir/sub/c.txt": string(bytes.Repeat([]byte("c"), 40)),
+		"dir/empty.txt": "",
+	}
+
+	for _, encoding := range []Encoding{BlockPBEncoding, DagPBEncoding} {
+		bs := s.newTestStorage(WithEncoding(encoding))
+		bs.(*storage).chunkSize = 16
+
+		digest, err := bs.AddTree(ctx, "tree", fsys)
+		require.NoError(s.T(), err)
+		root, err := cid.Decode(digest)
+		require.NoError(s.T(), err)
+		s.requireTreeContent(s.T(), bs, root, files)
+
+		emptyDir, err := bs.GetByPath(ctx, root, "emptydir")
+		require.NoError(s.T(), err)
+		block, err := bs.GetBlock(ctx, emptyDir)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), 0, len(block.Links))
+
+		again, err := bs.AddTree(ctx, "tree", fsys)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), digest, again)
+	}
+
+	_, err := s.newTestStorage().AddTree(ctx, " ", fsys)
+	require.Equal(s.T(), ErrBlockNameEmpty, err)
+}
+
+func (s *blockStorageSuite) TestAddTar() {
+	ctx := context.Background()
+
+	testCases := []struct {
+		name    string
+		entries []tarEntry
+		files   map[string]string
+		err     error
+	}{
+		{
+			name: "valid_tar",
+			entries: []tarEntry{
+				{name: "dir/", dir: true},
+				{name: "dir/a.txt", content: []byte("a")},
+				{name: "./b.txt", content: []byte("b")},
+				{name: "implicit/c.txt", content: []byte("c")},
+			},
+			files: map[string]string{"dir/a.txt": "a", "b.txt": "b", "implicit/c.txt": "c"},
+		},
+		{
+			name: "overridden_entry",
+			entries: []tarEntry{
+				{name: "a.txt", content: []byte("old")},
+				{name: "a.txt", content: []byte("new")},
+			},
+			files: map[string]string{"a.txt": "new"},
+		},
+		{
+			name:    "escaping_entry",
+			entries: []tarEntry{{name: "../a.txt", content: []byte("a")}},
+			err:     ErrPathNotValid,
+		},
+		{
+			name:    "absolute_entry",
+			entries: []tarEntry{{name: "/etc/a.txt", content: []byte("a")}},
+			err:     ErrPathNotValid,
+		},
+		{
+			name: "file_directory_conflict",
+			entries: []tarEntry{
+				{name: "a", content: []byte("a")},
+				{name: "a/b.txt", content: []byte("b")},
+			},
+			err: ErrPathNotValid,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		s.T().Run(tc.name, func(t *testing.T) {
+			storage := s.newTestStorage()
+			digest, err := storage.AddTar(ctx, "archive", bytes.NewReader(generateTar(t, tc.entries...)))
+			require.Equal(t, tc.err, err)
+			if tc.err != nil {
+				return
+			}
+			root, err := cid.Decode(digest)
+			require.NoError(t, err)
+			s.requireTreeContent(t, storage, root, tc.files)
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package blockstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/util"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"google.golang.org/protobuf/proto"
+)
+
+// Datastore namespaces of upload sessions and their chunk records
+const (
+	uploadsNamespace      = "/blockstorage/uploads"
+	uploadChunksNamespace = "/blockstorage/upload-chunks"
+)
+
+// uploadIDLen - holds length of random upload session id in bytes
+const uploadIDLen = 16
+
+// Captures/Represents in-memory state of upload session: nodes newly persisted for the session (removed when
+// session expires), and whether a stream is writing to the session.
+type upload struct {
+	ws   *writeSet
+	busy bool
+}
+
+// uploadKey - returns datastore key of upload session with given id
+func uploadKey(id string) ds.Key {
+	return ds.NewKey(uploadsNamespace).ChildString(id)
+}
+
+// uploadChunkKey - returns datastore key of chunk record with given index of upload session with given id.
+// Index is zero padded, so records are ordered by index.
+func uploadChunkKey(id string, index uint64) ds.Key {
+	return ds.NewKey(uploadChunksNamespace).ChildString(id).ChildString(fmt.Sprintf("%020d", index))
+}
+
+// StartUpload - starts resumable upload session of file with given `name` and metadata (see
+// `CreateBlockWithMetadata`), and returns id of session. Content of file is written with one or more
+// `ResumeUpload` calls.
+//
+// Flow:
+// 1. Validates name and metadata (creation time is set at session start)
+// 2. Removes expired sessions (see `ExpireUploads`)
+// 3. Persists session with zero offset to datastore
+//
+// Error:
+// - When `name` is not valid returns `"", ErrBlockNameEmpty`
+// - When `DagPBEncoding` used with attributes, content type or creation time returns `"", ErrMetadataNotSupported`
+// - When persisting session fails returns `""` with error cause
+func (s *storage) StartUpload(ctx context.Context, fname string, meta *blockpb.Metadata) (string, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return "", stopErr
+	}
+	defer done()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return "", ctxErr
+	}
+	name := strings.TrimSpace(fname)
+	if name == "" {
+		return "", ErrBlockNameEmpty
+	}
+	meta, err := s.fileMetadata(meta)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.ExpireUploads(ctx); err != nil {
+		log.Printf("err: expiring upload sessions failed: %s\n", err.Error())
+	}
+
+	random := make([]byte, uploadIDLen)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	key, err := s.newFileKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	session := &blockpb.UploadSession{
+		Id:     hex.EncodeToString(random),
+		Name:   name,
+		Meta:   meta,
+		Caller: callerFrom(ctx),
+	}
+	if key != nil {
+		session.Encryption = key.encryption()
+	}
+	if err := s.putSession(ctx, session); err != nil {
+		return "", err
+	}
+	if s.debug {
+		log.Printf("debug: upload session started: %s, %s\n", session.Id, name)
+	}
+	return session.Id, nil
+}
+
+// UploadStatus - returns committed offset of upload session with given id, which is the offset `ResumeUpload`
+// should continue from.
+//
+// Error:
+// - When session not exists, expired or started by another caller returns `0, ErrUploadNotFound`
+// - When reading session fails returns `0` with error cause
+func (s *storage) UploadStatus(ctx context.Context, id string) (uint64, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return 0, stopErr
+	}
+	defer done()
+	s.uploadsLock.Lock()
+	defer s.uploadsLock.Unlock()
+	session, err := s.getSession(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if session.Caller != callerFrom(ctx) {
+		return 0, ErrUploadNotFound
+	}
+	if s.expired(session) {
+		if err := s.expireUpload(ctx, session); err != nil {
+			log.Printf("err: expiring upload session failed: %s, %s\n", id, err.Error())
+		}
+		return 0, ErrUploadNotFound
+	}
+	return session.Offset, nil
+}
+
+// ResumeUpload - writes content of `reader` to upload session with given id, starting from given offset. When
+// reader ends (`io.EOF`), creates file DAG of all content written to session, and returns its cid.
+//
+// Flow:
+// 1. Marks session busy, so only one stream writes to the session at a time
+// 2. Restores leaves persisted for session (see `fileState`), and continues chunk loop of `CreateBlock` from
+// committed offset. Content is read in whole chunks (see `util.NewFullReader`), so resumed upload creates same DAG
+// regardless of where streams break. After each chunk is persisted, chunk record and offset of session are saved, so
+// content received until failure (in whole chunks) is not received again.
+// 3. Persists root of file DAG, adds it to file index (see `ListBlocks`) and removes session
+//
+// Error:
+// - When session not exists, expired or started by another caller returns `"", ErrUploadNotFound`
+// - When content exceeds max file size returns `"", ErrFileTooLarge`
+// - When caller exceeds its quota returns `"", ErrQuotaExceeded`
+// - When session is written by another stream returns `"", ErrUploadBusy`
+// - When `offset` not matches with committed offset of session (see `UploadStatus`) returns `"", ErrUploadOffsetMismatch`
+// - When session has no content returns `"", ErrBlockDataEmpty`
+// - Otherwise returns `CreateBlock` errors. Session is kept, so upload can be resumed from committed offset.
+func (s *storage) ResumeUpload(ctx context.Context, id string, offset uint64, reader io.Reader) (string, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return "", stopErr
+	}
+	defer done()
+	ctxErr := util.CheckContext(ctx)
+	if ctxErr != nil {
+		return "", ctxErr
+	}
+	session, u, err := s.acquireUpload(ctx, id, offset)
+	if err != nil {
+		return "", err
+	}
+	defer s.releaseUpload(id)
+
+	state, err := s.loadUploadState(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	uploadCtx := withWriteSet(ctx, u.ws)
+	err = s.persistLeaves(uploadCtx, s.limitReader(uploadCtx, util.NewFullReader(reader), session.Offset), state, func(chunk []byte) error {
+		leaf := state.leaves[len(state.leaves)-1]
+		if session.Count == 0 {
+			s.sniffContentType(session.Meta, chunk)
+		}
+		chunkRecord := &blockpb.UploadChunk{Link: leaf.link, Size: leaf.fileSize}
+		if coding := state.erasure; coding != nil {
+			chunkRecord.Stored = coding.Sizes[len(coding.Sizes)-1]
+			if len(state.stripe) == 0 {
+				// leaf completes stripe, whose parity is persisted
+				chunkRecord.Parity = coding.Parity[len(coding.Parity)-int(coding.ParityShards):]
+			}
+		}
+		record, err := proto.Marshal(chunkRecord)
+		if err != nil {
+			return err
+		}
+		if err := s.datastore.Put(ctx, uploadChunkKey(id, session.Count), record); err != nil {
+			return err
+		}
+		session.Count++
+		session.Offset += leaf.fileSize
+		return s.putSession(ctx, session)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.reserve(uploadCtx, u.ws, 0, 1); err != nil {
+		return "", err
+	}
+	link, err := s.persistFileRoot(uploadCtx, session.Name, state, false, session.Meta)
+	if err != nil {
+		return "", err
+	}
+	if err := s.indexFile(ctx, link); err != nil {
+		return "", err
+	}
+	if err := s.completeUpload(ctx, session, u); err != nil {
+		return "", err
+	}
+	return link.Hash, nil
+}
+
+// ExpireUploads - removes upload sessions which are not written longer than upload ttl (see `WithUploadTTL`),
+// and returns number of removed sessions. Nodes newly persisted for removed sessions (also before restart, see
+// `recoverWriteSets`) are removed from permanent store, unless they are shared with other files.
+//
+// Error:
+// When querying or removing sessions fails returns error cause
+func (s *storage) ExpireUploads(ctx context.Context) (int, error) {
+	ctx, done, stopErr := s.enter(ctx)
+	if stopErr != nil {
+		return 0, stopErr
+	}
+	defer done()
+	results, err := s.datastore.Query(ctx, query.Query{Prefix: uploadsNamespace})
+	if err != nil {
+		return 0, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return 0, err
+	}
+
+	s.uploadsLock.Lock()
+	defer s.uploadsLock.Unlock()
+	expired := 0
+	for _, entry := range entries {
+		session := &blockpb.UploadSession{}
+		if err := proto.Unmarshal(entry.Value, session); err != nil {
+			return expired, err
+		}
+		if u, ok := s.uploads[session.Id]; (ok && u.busy) || !s.expired(session) {
+			continue
+		}
+		if err := s.expireUpload(ctx, session); err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// getSession - reads upload session with given id from datastore
+func (s *storage) getSession(ctx context.Context, id string) (*blockpb.UploadSession, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ErrUploadNotFound
+	}
+	data, err := s.datastore.Get(ctx, uploadKey(id))
+	if err == ds.ErrNotFound {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	session := &blockpb.UploadSession{}
+	if err := proto.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// putSession - persists given upload session to datastore with current time as last update time
+func (s *storage) putSession(ctx context.Context, session *blockpb.UploadSession) error {
+	session.Updated = time.Now().UnixNano()
+	data, err := proto.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.datastore.Put(ctx, uploadKey(session.Id), data)
+}
+
+// expired - checks given upload session is not written longer than upload ttl
+func (s *storage) expired(session *blockpb.UploadSession) bool {
+	return time.Since(time.Unix(0, session.Updated)) > s.uploadTTL
+}
+
+// acquireUpload - reads upload session with given id, validates it can be resumed from given offset, and marks
+// it busy. Returns session with its in-memory state.
+func (s *storage) acquireUpload(ctx context.Context, id string, offset uint64) (*blockpb.UploadSession, *upload, error) {
+	s.uploadsLock.Lock()
+	defer s.uploadsLock.Unlock()
+	u, ok := s.uploads[id]
+	if ok && u.busy {
+		return nil, nil, ErrUploadBusy
+	}
+	session, err := s.getSession(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session.Caller != callerFrom(ctx) {
+		return nil, nil, ErrUploadNotFound
+	}
+	if s.expired(session) {
+		if err := s.expireUpload(ctx, session); err != nil {
+			log.Printf("err: expiring upload session failed: %s, %s\n", id, err.Error())
+		}
+		return nil, nil, ErrUploadNotFound
+	}
+	if session.Offset != offset {
+		return nil, nil, ErrUploadOffsetMismatch
+	}
+	if !ok {
+		u = &upload{ws: newNamedWriteSet(id)}
+		s.uploads[id] = u
+	}
+	// reservation covers committed content only (e.g. after restart, or failure in the middle of chunk)
+	u.ws.caller = session.Caller
+	s.setReservation(u.ws, session.Offset, 0)
+	u.busy = true
+	return session, u, nil
+}
+
+// releaseUpload - marks upload session with given id as not busy
+func (s *storage) releaseUpload(id string) {
+	s.uploadsLock.Lock()
+	defer s.uploadsLock.Unlock()
+	if u, ok := s.uploads[id]; ok {
+		u.busy = false
+	}
+}
+
+// loadUploadState - restores state of file DAG (persisted leaves, file key and erasure coding, see
+// `restoreStripes`) of given upload session from its chunk records
+func (s *storage) loadUploadState(ctx context.Context, session *blockpb.UploadSession) (*fileState, error) {
+	key, err := s.restoreFileKey(ctx, session.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	state := s.newFileState(key)
+	state.leaves = make([]*sizedLink, 0, session.Count)
+	for i := uint64(0); i < session.Count; i++ {
+		data, err := s.datastore.Get(ctx, uploadChunkKey(session.Id, i))
+		if err != nil {
+			return nil, err
+		}
+		record := &blockpb.UploadChunk{}
+		if err := proto.Unmarshal(data, record); err != nil {
+			return nil, err
+		}
+		state.leaves = append(state.leaves, &sizedLink{link: record.Link, fileSize: record.Size})
+		if state.erasure != nil {
+			state.erasure.Sizes = append(state.erasure.Sizes, record.Stored)
+			state.erasure.Parity = append(state.erasure.Parity, record.Parity...)
+			for _, parity := range record.Parity {
+				if parity.Tsize > state.erasure.ShardSize {
+					state.erasure.ShardSize = parity.Tsize
+				}
+			}
+		}
+	}
+	if state.erasure != nil {
+		if err := s.restoreStripes(ctx, state); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// completeUpload - releases nodes of given upload session (as they are referenced by persisted root, see
+// `commit`), and removes the session. Removal failures are logged, as file is already created.
+func (s *storage) completeUpload(ctx context.Context, session *blockpb.UploadSession, u *upload) error {
+	s.uploadsLock.Lock()
+	defer s.uploadsLock.Unlock()
+	if err := s.commit(ctx, u.ws); err != nil {
+		return err
+	}
+	delete(s.uploads, session.Id)
+	if err := s.removeSession(ctx, session); err != nil {
+		log.Printf("err: removing upload session failed: %s, %s\n", session.Id, err.Error())
+	}
+	if s.debug {
+		log.Printf("debug: upload session completed: %s, %s\n", session.Id, session.Name)
+	}
+	return nil
+}
+
+// expireUpload - removes nodes persisted for given upload session (see `rollback`) and the session. Caller should
+// hold `uploadsLock`.
+func (s *storage) expireUpload(ctx context.Context, session *blockpb.UploadSession) error {
+	if u, ok := s.uploads[session.Id]; ok {
+		// rollback should not be affected by cancellation of caller
+		s.rollback(context.Background(), u.ws)
+		delete(s.uploads, session.Id)
+	}
+	if s.debug {
+		log.Printf("debug: upload session expired: %s, %s\n", session.Id, session.Name)
+	}
+	return s.removeSession(ctx, session)
+}
+
+// removeSession - removes chunk records and given upload session from datastore
+func (s *storage) removeSession(ctx context.Context, session *blockpb.UploadSession) error {
+	for i := uint64(0); i < session.Count; i++ {
+		if err := s.datastore.Delete(ctx, uploadChunkKey(session.Id, i)); err != nil {
+			return err
+		}
+	}
+	return s.datastore.Delete(ctx, uploadKey(session.Id))
+}
@@ -0,0 +1,157 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing/iotest"
+	"time"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestResumeUpload() {
+	ctx := context.Background()
+	readErr := errors.New("connection dropped")
+	data := bytes.Repeat([]byte("0123456789"), 10)
+
+	for _, encoding := range []Encoding{BlockPBEncoding, DagPBEncoding} {
+		bs := s.newTestStorage(WithEncoding(encoding))
+		bs.(*storage).chunkSize = 16
+
+		id, err := bs.StartUpload(ctx, "upload.txt", nil)
+		require.NoError(s.T(), err)
+		offset, err := bs.UploadStatus(ctx, id)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), uint64(0), offset)
+
+		// stream breaks in the middle of third chunk
+		_, err = bs.ResumeUpload(ctx, id, 0, io.MultiReader(bytes.NewReader(data[:40]), iotest.ErrReader(readErr)))
+		require.Equal(s.T(), readErr, err)
+		offset, err = bs.UploadStatus(ctx, id)
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), uint64(32), offset)
+
+		_, err = bs.ResumeUpload(ctx, id, 0, bytes.NewReader(data))
+		require.Equal(s.T(), ErrUploadOffsetMismatch, err)
+
+		digest, err := bs.ResumeUpload(ctx, id, offset, bytes.NewReader(data[offset:]))
+		require.NoError(s.T(), err)
+		_, err = bs.UploadStatus(ctx, id)
+		require.Equal(s.T(), ErrUploadNotFound, err)
+		_, err = bs.ResumeUpload(ctx, id, offset, bytes.NewReader(data[offset:]))
+		require.Equal(s.T(), ErrUploadNotFound, err)
+
+		root, err := cid.Decode(digest)
+		require.NoError(s.T(), err)
+		content := &bytes.Buffer{}
+		require.NoError(s.T(), bs.ReadFile(ctx, root, content))
+		require.Equal(s.T(), data, content.Bytes())
+
+		if encoding == DagPBEncoding {
+			// resumed upload creates same DAG as uninterrupted upload
+			expected, err := bs.CreateBlock(ctx, "upload.txt", bytes.NewReader(data))
+			require.NoError(s.T(), err)
+			require.Equal(s.T(), expected, digest)
+			continue
+		}
+		stats, err := bs.ListBlocks(ctx, BlockFilter{NamePrefix: "upload"})
+		require.NoError(s.T(), err)
+		require.Equal(s.T(), 1, len(stats))
+		require.Equal(s.T(), digest, stats[0].Cid)
+		require.Equal(s.T(), uint64(len(data)), stats[0].Size)
+		require.Equal(s.T(), "text/plain; charset=utf-8", stats[0].Meta.ContentType)
+	}
+}
+
+func (s *blockStorageSuite) TestStartUploadValidation() {
+	ctx := context.Background()
+
+	_, err := s.newTestStorage().StartUpload(ctx, " ", nil)
+	require.Equal(s.T(), ErrBlockNameEmpty, err)
+
+	_, err = s.newTestStorage(WithEncoding(DagPBEncoding)).StartUpload(ctx, "upload.txt", &blockpb.Metadata{ContentType: "text/plain"})
+	require.Equal(s.T(), ErrMetadataNotSupported, err)
+
+	bs := s.newTestStorage()
+	_, err = bs.UploadStatus(ctx, "unknown")
+	require.Equal(s.T(), ErrUploadNotFound, err)
+
+	id, err := bs.StartUpload(ctx, "empty.txt", nil)
+	require.NoError(s.T(), err)
+	_, err = bs.ResumeUpload(ctx, id, 0, bytes.NewReader(nil))
+	require.Equal(s.T(), ErrBlockDataEmpty, err)
+	offset, err := bs.UploadStatus(ctx, id)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(0), offset)
+}
+
+func (s *blockStorageSuite) TestResumeUploadBusy() {
+	ctx := context.Background()
+	bs := s.newTestStorage()
+	bs.(*storage).chunkSize = 16
+
+	id, err := bs.StartUpload(ctx, "upload.txt", nil)
+	require.NoError(s.T(), err)
+
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := bs.ResumeUpload(ctx, id, 0, pr)
+		done <- err
+	}()
+	// write returns once the first stream reads, so the session is acquired
+	_, err = pw.Write([]byte("first stream"))
+	require.NoError(s.T(), err)
+
+	_, err = bs.ResumeUpload(ctx, id, 0, bytes.NewReader([]byte("second stream")))
+	require.Equal(s.T(), ErrUploadBusy, err)
+
+	require.NoError(s.T(), pw.Close())
+	require.NoError(s.T(), <-done)
+}
+
+func (s *blockStorageSuite) TestExpireUploads() {
+	ctx := context.Background()
+	readErr := errors.New("connection dropped")
+	store := newMemoryStore(s.T(), s.ctrl)
+	ttl := 50 * time.Millisecond
+	bs := s.newTestStorage(WithLocalStore(store), WithUploadTTL(ttl)).(*storage)
+	bs.chunkSize = 16
+
+	stale, err := bs.StartUpload(ctx, "stale.txt", nil)
+	require.NoError(s.T(), err)
+	_, err = bs.ResumeUpload(ctx, stale, 0, io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("0123456789"), 4)), iotest.ErrReader(readErr)))
+	require.Equal(s.T(), readErr, err)
+	require.Equal(s.T(), 2, store.objectCount())
+
+	time.Sleep(2 * ttl)
+	active, err := bs.StartUpload(ctx, "active.txt", nil)
+	require.NoError(s.T(), err)
+
+	// starting upload removes stale session with its persisted chunks
+	_, err = bs.UploadStatus(ctx, stale)
+	require.Equal(s.T(), ErrUploadNotFound, err)
+	require.Equal(s.T(), 0, store.objectCount())
+	require.Equal(s.T(), 0, len(bs.pending))
+	results, err := bs.datastore.Query(ctx, query.Query{Prefix: uploadChunksNamespace, KeysOnly: true})
+	require.NoError(s.T(), err)
+	entries, err := results.Rest()
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 0, len(entries))
+
+	expired, err := bs.ExpireUploads(ctx)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 0, expired)
+
+	time.Sleep(2 * ttl)
+	expired, err = bs.ExpireUploads(ctx)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 1, expired)
+	_, err = bs.ResumeUpload(ctx, active, 0, bytes.NewReader([]byte("late")))
+	require.Equal(s.T(), ErrUploadNotFound, err)
+}
@@ -0,0 +1,23 @@
+package util
+
+import "io"
+
+// Captures/Represents reader whose reads fill given buffer until underlying reader ends (see `NewFullReader`)
+type fullReader struct {
+	reader io.Reader
+}
+
+// NewFullReader - returns reader whose reads fill given buffer, only last read before end of `reader` may be
+// shorter. Files are chunked regarding sizes of reads (see `BlockStorage.CreateBlock`), so content of readers with
+// arbitrary read sizes (e.g. network bodies, decompressors) is chunked same regardless of how it arrives.
+func NewFullReader(reader io.Reader) io.Reader {
+	return &fullReader{reader: reader}
+}
+
+func (r *fullReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(r.reader, p)
+	if err == io.ErrUnexpectedEOF {
+		return n, io.EOF
+	}
+	return n, err
+}
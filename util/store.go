@@ -0,0 +1,204 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/igumus/go-objectstore-lib"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+// ErrDeleteNotSupported is return, when underlying object store does not support deleting objects
+var ErrDeleteNotSupported = errors.New("blockstorage: object store not supports deletion")
+
+// Datastore namespaces of multihash to object store key mappings, and references of object store keys by mappings
+const (
+	mappingNamespace   = "/blockstorage/multihash"
+	referenceNamespace = "/blockstorage/multihash-refs"
+)
+
+// ObjectDeleter - object store which supports deleting objects (optional capability of `objectstore.ObjectStore`)
+type ObjectDeleter interface {
+	DeleteObject(context.Context, cid.Cid) error
+}
+
+// CidStore - object store which addresses objects with cids of any version, codec and hash function.
+type CidStore interface {
+	objectstore.ObjectStore
+	ObjectDeleter
+	// PutObject - persists given data addressed with given cid. Data is not verified against the cid.
+	PutObject(context.Context, cid.Cid, []byte) error
+	// ObjectKey - returns key of object with given data in underlying object store
+	ObjectKey([]byte) (cid.Cid, error)
+	// HasKey - checks object with given key exists in underlying object store
+	HasKey(context.Context, cid.Cid) bool
+	// DeleteMapping - removes mapping of given cid, object which the cid is mapped to is kept
+	DeleteMapping(context.Context, cid.Cid) error
+}
+
+// Captures/Represents object store wrapper which translates cids to keys of underlying object store.
+type cidStore struct {
+	store   objectstore.ObjectStore
+	mapping ds.Datastore
+}
+
+// WrapObjectStore - wraps given object store, so objects can be addressed with cids of any version/codec.
+// Underlying store always keys objects with CIDv1 raw cids of its own hash function (`objectstore.DigestPrefix`),
+// so objects addressed with cids of other hash functions (or with digest of other binary form, e.g. compressed
+// blocks addressed with digest of original block) are mapped to store keys via `mapping` datastore.
+// When `mapping` is nil, mappings are kept in memory.
+func WrapObjectStore(store objectstore.ObjectStore, mapping ds.Datastore) CidStore {
+	if store == nil {
+		return nil
+	}
+	if ret, ok := store.(CidStore); ok {
+		return ret
+	}
+	if mapping == nil {
+		mapping = dssync.MutexWrap(ds.NewMapDatastore())
+	}
+	return &cidStore{store: store, mapping: mapping}
+}
+
+// isNativeHash - checks given cid uses same hash function with underlying object store
+func isNativeHash(id cid.Cid) bool {
+	return id.Prefix().MhType == objectstore.DigestPrefix.MhType
+}
+
+// mappingKey - returns datastore key of mapping of given cid. Mappings are keyed by multihash, so cids with
+// different version/codec but same multihash share the mapping.
+func mappingKey(id cid.Cid) ds.Key {
+	return ds.NewKey(mappingNamespace).ChildString(id.Hash().B58String())
+}
+
+// referencePrefix - returns datastore key prefix of references of given object store key
+func referencePrefix(key cid.Cid) ds.Key {
+	return ds.NewKey(referenceNamespace).ChildString(key.Hash().B58String())
+}
+
+// referenceKey - returns datastore key which records mapping of given cid references given object store key
+func referenceKey(key, id cid.Cid) ds.Key {
+	return referencePrefix(key).ChildString(id.Hash().B58String())
+}
+
+// storeKey - returns key of the object with given cid in underlying object store. Mapped cids are looked up first,
+// since objects with native hash are mapped as well when their cid is not digest of stored binary form.
+func (c *cidStore) storeKey(ctx context.Context, id cid.Cid) (cid.Cid, bool) {
+	if !id.Defined() {
+		return cid.Undef, false
+	}
+	if bin, err := c.mapping.Get(ctx, mappingKey(id)); err == nil {
+		key, err := cid.Cast(bin)
+		if err != nil {
+			return cid.Undef, false
+		}
+		return key, true
+	}
+	if isNativeHash(id) {
+		if id.Version() == objectstore.DigestPrefix.Version && id.Type() == objectstore.DigestPrefix.Codec {
+			return id, true
+		}
+		return cid.NewCidV1(objectstore.DigestPrefix.Codec, id.Hash()), true
+	}
+	return cid.Undef, false
+}
+
+func (c *cidStore) CreateObject(ctx context.Context, r io.Reader) (cid.Cid, error) {
+	return c.store.CreateObject(ctx, r)
+}
+
+func (c *cidStore) PutObject(ctx context.Context, id cid.Cid, data []byte) error {
+	key, err := c.store.CreateObject(ctx, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if isNativeHash(id) && bytes.Equal(key.Hash(), id.Hash()) {
+		return nil
+	}
+	if err := c.mapping.Put(ctx, referenceKey(key, id), []byte{}); err != nil {
+		return err
+	}
+	return c.mapping.Put(ctx, mappingKey(id), key.Bytes())
+}
+
+func (c *cidStore) ObjectKey(data []byte) (cid.Cid, error) {
+	return objectstore.DigestPrefix.Sum(data)
+}
+
+func (c *cidStore) HasKey(ctx context.Context, key cid.Cid) bool {
+	return c.store.HasObject(ctx, key)
+}
+
+func (c *cidStore) ReadObject(ctx context.Context, id cid.Cid) ([]byte, error) {
+	key, ok := c.storeKey(ctx, id)
+	if !ok {
+		return nil, objectstore.ErrObjectNotExists
+	}
+	return c.store.ReadObject(ctx, key)
+}
+
+func (c *cidStore) HasObject(ctx context.Context, id cid.Cid) bool {
+	key, ok := c.storeKey(ctx, id)
+	if !ok {
+		return false
+	}
+	return c.store.HasObject(ctx, key)
+}
+
+func (c *cidStore) ListObject(ctx context.Context) <-chan objectstore.ListObjectEvent {
+	return c.store.ListObject(ctx)
+}
+
+// DeleteObject - deletes object with given cid, and mapping of the cid. Object is kept when mappings of other
+// cids still reference it. Returns `ErrDeleteNotSupported` when underlying store does not implement
+// `ObjectDeleter`.
+func (c *cidStore) DeleteObject(ctx context.Context, id cid.Cid) error {
+	key, ok := c.storeKey(ctx, id)
+	if !ok {
+		return objectstore.ErrObjectNotExists
+	}
+	deleter, ok := c.store.(ObjectDeleter)
+	if !ok {
+		return ErrDeleteNotSupported
+	}
+	results, err := c.mapping.Query(ctx, query.Query{Prefix: referencePrefix(key).String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	references, err := results.Rest()
+	if err != nil {
+		return err
+	}
+	for _, reference := range references {
+		if reference.Key != referenceKey(key, id).String() {
+			return c.DeleteMapping(ctx, id)
+		}
+	}
+	if err := deleter.DeleteObject(ctx, key); err != nil {
+		return err
+	}
+	return c.DeleteMapping(ctx, id)
+}
+
+// DeleteMapping - removes mapping of given cid and its reference of object store key. Cids which are not mapped
+// are ignored.
+func (c *cidStore) DeleteMapping(ctx context.Context, id cid.Cid) error {
+	bin, err := c.mapping.Get(ctx, mappingKey(id))
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if key, err := cid.Cast(bin); err == nil {
+		if err := c.mapping.Delete(ctx, referenceKey(key, id)); err != nil {
+			return err
+		}
+	}
+	return c.mapping.Delete(ctx, mappingKey(id))
+}
@@ -0,0 +1,423 @@
+package blockstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"github.com/igumus/blockstorage/blockpb"
+	"github.com/igumus/blockstorage/util"
+	"github.com/igumus/go-objectstore-lib"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Datastore namespaces of write-ahead log: nodes claimed by write sets, and commit records of write sets whose
+// log entries are being removed
+const (
+	walNamespace       = "/blockstorage/wal"
+	walCommitNamespace = "/blockstorage/wal-commits"
+)
+
+// writeSetIDLen - holds length of random write set id in bytes
+const writeSetIDLen = 16
+
+// Captures/Represents nodes newly persisted by an in-flight operation (e.g. `CreateBlock`), which are removed
+// when the operation fails. Nodes are recorded to write-ahead log with write set id before they are persisted,
+// so nodes of operations interrupted by crash are removed on startup (see `recoverWriteSets`).
+type writeSet struct {
+	id string
+	// objects newly persisted by write set keyed by their key in underlying store, with cids of nodes addressing
+	// them (see `claimNode`)
+	owned map[cid.Cid][]cid.Cid
+	// cids of nodes newly mapped to objects which already exist in underlying store
+	mappings map[cid.Cid]bool
+	// closed when rollback of write set completes, `nil` when write set is not being rolled back
+	rollingBack chan struct{}
+	// caller of operation with usage reserved by operation (see `reserve`)
+	caller  string
+	bytes   uint64
+	objects uint64
+}
+
+// writeSetKey - context key of operation's write set
+type writeSetKey struct{}
+
+// newWriteSet - returns empty write set with random id
+func newWriteSet() *writeSet {
+	random := make([]byte, writeSetIDLen)
+	// id only separates log entries of write sets, so short read of entropy source is not fatal
+	_, _ = rand.Read(random)
+	return newNamedWriteSet(hex.EncodeToString(random))
+}
+
+// newNamedWriteSet - returns empty write set with given id (e.g. upload session id)
+func newNamedWriteSet(id string) *writeSet {
+	return &writeSet{id: id, owned: make(map[cid.Cid][]cid.Cid), mappings: make(map[cid.Cid]bool)}
+}
+
+// nodes - returns cids of nodes claimed by write set. Caller should hold `pendingLock` when write set is in-flight.
+func (ws *writeSet) nodes() []cid.Cid {
+	ret := make([]cid.Cid, 0, len(ws.owned)+len(ws.mappings))
+	for _, ids := range ws.owned {
+		ret = append(ret, ids...)
+	}
+	for id := range ws.mappings {
+		ret = append(ret, id)
+	}
+	return ret
+}
+
+// reset - releases nodes claimed by write set. Caller should hold `pendingLock` when write set is in-flight.
+func (ws *writeSet) reset() {
+	ws.owned = make(map[cid.Cid][]cid.Cid)
+	ws.mappings = make(map[cid.Cid]bool)
+}
+
+// withWriteSet - returns context which carries given write set
+func withWriteSet(ctx context.Context, ws *writeSet) context.Context {
+	return context.WithValue(ctx, writeSetKey{}, ws)
+}
+
+// writeSetFrom - returns write set carried by given context, or `nil` when there is not any
+func writeSetFrom(ctx context.Context) *writeSet {
+	ws, _ := ctx.Value(writeSetKey{}).(*writeSet)
+	return ws
+}
+
+// walKey - returns write-ahead log key of node with given cid claimed by write set with given id
+func walKey(wsID string, id cid.Cid) ds.Key {
+	return ds.NewKey(walNamespace).ChildString(wsID).ChildString(id.String())
+}
+
+// walCommitKey - returns key of commit record of write set with given id
+func walCommitKey(wsID string) ds.Key {
+	return ds.NewKey(walCommitNamespace).ChildString(wsID)
+}
+
+// claimNode - records node with given cid and binary form (which is about to be persisted) to given write set and
+// write-ahead log, when object of the node (addressed with its key in underlying store, which may be shared by cids
+// of other nodes, see `util.CidStore`) not exists in permanent store. When only the cid is not mapped to existing
+// object, the mapping is claimed, so rollback never deletes the object. When the object is already claimed by
+// another operation (or persisted without write set), the object is shared, so it is released from write set of
+// its owner. Returns whether the node is claimed by given write set, in which case announcing the node is deferred
+// to `commit`.
+//
+// Flow:
+// 1. Waits for other claims of same object, and rollback of its owner (see `rollback`)
+// 2. Shares object claimed by another write set, or marks object as being claimed
+// 3. Checks existence of object and mapping in permanent store
+// 4. Records node to write-ahead log, then to write set
+//
+// Only pending and claiming objects are updated under `pendingLock`, store and log are accessed without holding it.
+//
+// Error:
+// When recording node to write-ahead log fails, returns error cause, and node should not be persisted
+func (s *storage) claimNode(ctx context.Context, ws *writeSet, id cid.Cid, data []byte) (bool, error) {
+	key, err := s.localStore.ObjectKey(data)
+	if err != nil {
+		return false, err
+	}
+
+	var owner *writeSet
+	var pending bool
+	s.pendingLock.Lock()
+	for {
+		var wait chan struct{}
+		if claiming, ok := s.claiming[key]; ok {
+			wait = claiming
+		} else if owner, pending = s.pending[key]; pending && owner.rollingBack != nil {
+			wait = owner.rollingBack
+		} else {
+			break
+		}
+		s.pendingLock.Unlock()
+		<-wait
+		s.pendingLock.Lock()
+	}
+	switch {
+	case pending && owner != ws:
+		released := owner.owned[key]
+		delete(owner.owned, key)
+		delete(s.pending, key)
+		s.pendingLock.Unlock()
+		return false, s.removeLog(ctx, owner.id, released, false)
+	case pending:
+		for _, claimed := range ws.owned[key] {
+			if claimed == id {
+				s.pendingLock.Unlock()
+				return true, nil
+			}
+		}
+		s.pendingLock.Unlock()
+		return s.claimObject(ctx, ws, key, id, true)
+	case ws == nil:
+		s.pendingLock.Unlock()
+		return false, nil
+	}
+	claiming := make(chan struct{})
+	s.claiming[key] = claiming
+	s.pendingLock.Unlock()
+	defer func() {
+		s.pendingLock.Lock()
+		delete(s.claiming, key)
+		s.pendingLock.Unlock()
+		close(claiming)
+	}()
+
+	if !s.localStore.HasKey(ctx, key) {
+		return s.claimObject(ctx, ws, key, id, false)
+	}
+	if s.localStore.HasObject(ctx, id) {
+		return false, nil
+	}
+	if err := s.datastore.Put(ctx, walKey(ws.id, id), []byte{}); err != nil {
+		return false, err
+	}
+	s.pendingLock.Lock()
+	ws.mappings[id] = true
+	s.pendingLock.Unlock()
+	return true, nil
+}
+
+// claimObject - records node with given cid, whose object with given key is new (or already claimed by given
+// write set when `owned`), to write-ahead log and write set (see `claimNode`). Returns `false` when owned object is
+// shared by another write set meanwhile.
+func (s *storage) claimObject(ctx context.Context, ws *writeSet, key, id cid.Cid, owned bool) (bool, error) {
+	if err := s.datastore.Put(ctx, walKey(ws.id, id), key.Bytes()); err != nil {
+		return false, err
+	}
+	s.pendingLock.Lock()
+	if owned && s.pending[key] != ws {
+		s.pendingLock.Unlock()
+		return false, s.datastore.Delete(ctx, walKey(ws.id, id))
+	}
+	s.pending[key] = ws
+	ws.owned[key] = append(ws.owned[key], id)
+	s.pendingLock.Unlock()
+	return true, nil
+}
+
+// commit - releases nodes of given write set, as they are referenced by persisted root, and announces them to p2p
+// network. Commit record is persisted before log entries of write set are removed, so partially removed entries
+// are not rolled back on recovery.
+//
+// Error:
+// When persisting usage of caller (see `commitUsage`) or commit record fails, returns error cause and write set is
+// not changed (should be rolled back)
+func (s *storage) commit(ctx context.Context, ws *writeSet) error {
+	if err := s.commitUsage(ctx, ws); err != nil {
+		return err
+	}
+	if err := s.datastore.Put(ctx, walCommitKey(ws.id), []byte{}); err != nil {
+		return err
+	}
+	s.pendingLock.Lock()
+	ids := ws.nodes()
+	for key := range ws.owned {
+		delete(s.pending, key)
+	}
+	ws.reset()
+	s.pendingLock.Unlock()
+	if err := s.removeLog(ctx, ws.id, ids, true); err != nil {
+		log.Printf("err: removing write-ahead log failed: %s, %s\n", ws.id, err.Error())
+	}
+
+	for _, id := range ids {
+		s.peer.AnnounceBlock(ctx, id)
+	}
+	return nil
+}
+
+// removeLog - removes write-ahead log entries of given nodes of write set with given id, then commit record of the
+// write set when `completed`
+func (s *storage) removeLog(ctx context.Context, wsID string, ids []cid.Cid, completed bool) error {
+	for _, id := range ids {
+		if err := s.datastore.Delete(ctx, walKey(wsID, id)); err != nil {
+			return err
+		}
+	}
+	if !completed {
+		return nil
+	}
+	return s.datastore.Delete(ctx, walCommitKey(wsID))
+}
+
+// rollback - deletes objects newly persisted by given write set from permanent store, removes mappings claimed by
+// write set, and releases usage reserved by write set. Objects stay pending until they are deleted, so operations
+// persisting same objects meanwhile wait for rollback (see `claimNode`). Deletion failures are logged, as rollback
+// is best effort (e.g. underlying store may not support deletion). Log entries of nodes which failed to be deleted
+// are kept, so deletion is retried on recovery.
+func (s *storage) rollback(ctx context.Context, ws *writeSet) {
+	s.releaseUsage(ws)
+	s.pendingLock.Lock()
+	rollingBack := make(chan struct{})
+	ws.rollingBack = rollingBack
+	objects, mappings := ws.owned, ws.mappings
+	ws.reset()
+	s.pendingLock.Unlock()
+
+	removed := make([]cid.Cid, 0, len(objects)+len(mappings))
+	for _, ids := range objects {
+		for _, id := range ids {
+			s.cache.remove(id)
+			err := s.localStore.DeleteObject(ctx, id)
+			switch {
+			case err == util.ErrDeleteNotSupported:
+				if s.debug {
+					log.Printf("debug: rollback skipped, store not supports deletion: %s\n", id)
+				}
+			case err == objectstore.ErrObjectNotExists:
+				// node is claimed, but operation failed before persisting it
+			case err != nil:
+				log.Printf("err: rolling back node failed: %s, %s\n", id, err.Error())
+				continue
+			case s.debug:
+				log.Printf("debug: rolled back node: %s\n", id)
+			}
+			removed = append(removed, id)
+		}
+	}
+	for id := range mappings {
+		s.cache.remove(id)
+		if err := s.localStore.DeleteMapping(ctx, id); err != nil {
+			log.Printf("err: rolling back node mapping failed: %s, %s\n", id, err.Error())
+			continue
+		}
+		removed = append(removed, id)
+	}
+
+	s.pendingLock.Lock()
+	for key := range objects {
+		if s.pending[key] == ws {
+			delete(s.pending, key)
+		}
+	}
+	ws.rollingBack = nil
+	s.pendingLock.Unlock()
+	close(rollingBack)
+	if err := s.removeLog(ctx, ws.id, removed, true); err != nil {
+		log.Printf("err: removing write-ahead log failed: %s, %s\n", ws.id, err.Error())
+	}
+}
+
+// transaction - runs given creation function with a write set, so nodes newly persisted by the function are
+// removed from permanent store when it fails. Nested transactions join the write set of outer transaction.
+// Nodes are announced to p2p network, and usage reserved for caller is accounted, only when the function succeeds
+// (see `commit`).
+func (s *storage) transaction(ctx context.Context, fn func(context.Context) (*blockpb.Link, error)) (*blockpb.Link, error) {
+	if writeSetFrom(ctx) != nil {
+		return fn(ctx)
+	}
+	ws := newWriteSet()
+	ws.caller = callerFrom(ctx)
+	link, err := fn(withWriteSet(ctx, ws))
+	if err == nil {
+		err = s.commit(ctx, ws)
+	}
+	if err != nil {
+		// rollback should not be affected by cancellation of failed operation
+		s.rollback(context.Background(), ws)
+		return nil, err
+	}
+	return link, nil
+}
+
+// recoverWriteSets - cleans up write sets left in write-ahead log by operations interrupted by crash. Should be
+// called on startup, before any operation.
+//
+// Flow:
+// 1. Groups log entries by write set id
+// 2. Removes log entries of committed write sets (crashed while removing log)
+// 3. Restores write sets of upload sessions and stages which still exist, so their nodes are kept until sessions
+// complete or expire (see `ResumeUpload`), or stages are discarded (see `DiscardStage`)
+// 4. Rolls back other write sets: removes their nodes from file index and permanent store (see `rollback`)
+//
+// Error:
+// When reading or updating write-ahead log fails returns error cause
+func (s *storage) recoverWriteSets(ctx context.Context) error {
+	results, err := s.datastore.Query(ctx, query.Query{Prefix: walNamespace})
+	if err != nil {
+		return err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return err
+	}
+
+	sets := make(map[string]*writeSet)
+	for _, entry := range entries {
+		key := ds.RawKey(entry.Key)
+		wsID := key.Parent().BaseNamespace()
+		id, err := cid.Decode(key.BaseNamespace())
+		if err != nil {
+			log.Printf("warn: removing invalid write-ahead log entry: %s\n", entry.Key)
+			if err := s.datastore.Delete(ctx, key); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := sets[wsID]; !ok {
+			sets[wsID] = newNamedWriteSet(wsID)
+		}
+		// entries of nodes whose objects are claimed record object key, entries of claimed mappings are empty
+		if len(entry.Value) == 0 {
+			sets[wsID].mappings[id] = true
+			continue
+		}
+		objectKey, err := cid.Cast(entry.Value)
+		if err != nil {
+			return err
+		}
+		sets[wsID].owned[objectKey] = append(sets[wsID].owned[objectKey], id)
+	}
+
+	for wsID, ws := range sets {
+		committed, err := s.datastore.Has(ctx, walCommitKey(wsID))
+		if err != nil {
+			return err
+		}
+		if committed {
+			if err := s.removeLog(ctx, wsID, ws.nodes(), true); err != nil {
+				return err
+			}
+			continue
+		}
+		uploading, err := s.datastore.Has(ctx, uploadKey(wsID))
+		if err != nil {
+			return err
+		}
+		if uploading {
+			s.uploads[wsID] = &upload{ws: ws}
+			for objectKey := range ws.owned {
+				s.pending[objectKey] = ws
+			}
+			continue
+		}
+		if stageID := stageOf(wsID); stageID != "" {
+			caller, err := s.datastore.Get(ctx, stageKey(stageID))
+			if err != nil && err != ds.ErrNotFound {
+				return err
+			}
+			if err == nil {
+				ws.caller = string(caller)
+				s.stages[stageID] = &stage{ws: ws}
+				for objectKey := range ws.owned {
+					s.pending[objectKey] = ws
+				}
+				continue
+			}
+		}
+		ids := ws.nodes()
+		for _, id := range ids {
+			if err := s.datastore.Delete(ctx, fileIndexKey(id)); err != nil {
+				return err
+			}
+		}
+		log.Printf("info: rolling back interrupted write set: %s, %d nodes\n", wsID, len(ids))
+		s.rollback(ctx, ws)
+	}
+	return nil
+}
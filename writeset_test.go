@@ -0,0 +1,288 @@
+package blockstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igumus/blockstorage/blockpb"
+	mockpeer "github.com/igumus/blockstorage/peer/mock"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *blockStorageSuite) TestTransactionRollback() {
+	ctx := context.Background()
+	readErr := errors.New("read failed")
+	shared := bytes.Repeat([]byte("s"), 16)
+
+	for _, encoding := range []Encoding{BlockPBEncoding, DagPBEncoding} {
+		store := newMemoryStore(s.T(), s.ctrl)
+		bs := s.newTestStorage(WithLocalStore(store), WithEncoding(encoding))
+		bs.(*storage).chunkSize = 16
+
+		digest, err := bs.CreateBlock(ctx, "shared.txt", bytes.NewReader(shared))
+		require.NoError(s.T(), err)
+		count := store.objectCount()
+
+		testCases := []struct {
+			name   string
+			create func() error
+			err    error
+		}{
+			{
+				name: "create_block",
+				create: func() error {
+					_, err := bs.CreateBlock(ctx, "failed.txt", io.MultiReader(
+						bytes.NewReader(shared),
+						bytes.NewReader(bytes.Repeat([]byte("n"), 40)),
+						iotest.ErrReader(readErr),
+					))
+					return err
+				},
+				err: readErr,
+			},
+			{
+				name: "add_tar",
+				create: func() error {
+					archive := generateTar(s.T(),
+						tarEntry{name: "a.txt", content: bytes.Repeat([]byte("a"), 40)},
+						tarEntry{name: "b.txt", content: shared},
+					)
+					_, err := bs.AddTar(ctx, "archive", io.MultiReader(bytes.NewReader(archive[:len(archive)-1024]), iotest.ErrReader(readErr)))
+					return err
+				},
+				err: readErr,
+			},
+			{
+				name: "cancelled_context",
+				create: func() error {
+					cancelled, cancel := context.WithCancel(ctx)
+					reader := io.MultiReader(
+						bytes.NewReader(bytes.Repeat([]byte("c"), 40)),
+						iotest.ErrReader(readErr),
+					)
+					_, err := bs.CreateBlock(cancelled, "cancelled.txt", readerFunc(func(p []byte) (int, error) {
+						n, err := reader.Read(p)
+						cancel()
+						return n, err
+					}))
+					return err
+				},
+			},
+		}
+
+		for i := range testCases {
+			tc := testCases[i]
+
+			s.T().Run(tc.name, func(t *testing.T) {
+				err := tc.create()
+				require.Error(t, err)
+				if tc.err != nil {
+					require.Equal(t, tc.err, err)
+				}
+				require.Equal(t, count, store.objectCount())
+				require.Equal(t, 0, len(bs.(*storage).pending))
+
+				root, err := cid.Decode(digest)
+				require.NoError(t, err)
+				content := &bytes.Buffer{}
+				require.NoError(t, bs.ReadFile(ctx, root, content))
+				require.Equal(t, shared, content.Bytes())
+			})
+		}
+	}
+}
+
+func (s *blockStorageSuite) TestTransactionRollbackWithoutDeletion() {
+	ctx := context.Background()
+	readErr := errors.New("read failed")
+	store := newMemoryStore(s.T(), s.ctrl)
+
+	// underlying store without `util.ObjectDeleter` capability
+	bs := s.newTestStorage(WithLocalStore(store.MockObjectStore))
+	bs.(*storage).chunkSize = 16
+	_, err := bs.CreateBlock(ctx, "failed.txt", io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("0123456789"), 4)), iotest.ErrReader(readErr)))
+	require.Equal(s.T(), readErr, err)
+	require.Equal(s.T(), 3, store.objectCount())
+	require.Equal(s.T(), 0, len(bs.(*storage).pending))
+}
+
+func (s *blockStorageSuite) TestTransactionSharedNodes() {
+	ctx := context.Background()
+	store := newMemoryStore(s.T(), s.ctrl)
+	bs := s.newTestStorage(WithLocalStore(store)).(*storage)
+	data := []byte("shared node")
+
+	// in-flight operation persists new node
+	ws := newWriteSet()
+	inflight := withWriteSet(ctx, ws)
+	id, err := bs.persistNode(inflight, cid.Raw, data)
+	require.NoError(s.T(), err)
+	require.Contains(s.T(), ws.nodes(), id)
+
+	// another operation persists same node and succeeds
+	_, err = bs.transaction(ctx, func(ctx context.Context) (*blockpb.Link, error) {
+		shared, err := bs.persistNode(ctx, cid.Raw, data)
+		require.Equal(s.T(), id, shared)
+		return &blockpb.Link{Hash: shared.String()}, err
+	})
+	require.NoError(s.T(), err)
+	require.NotContains(s.T(), ws.nodes(), id)
+
+	// failure of in-flight operation not removes shared node
+	bs.rollback(ctx, ws)
+	require.True(s.T(), store.HasObject(ctx, id))
+	require.Equal(s.T(), 0, len(bs.pending))
+}
+
+func (s *blockStorageSuite) TestTransactionSharedStoreKey() {
+	ctx := context.Background()
+	readErr := errors.New("read failed")
+	store := newMemoryStore(s.T(), s.ctrl)
+	datastore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := s.newTestStorage(WithLocalStore(store), WithDatastore(datastore)).(*storage)
+	bs.chunkSize = 16
+	content := bytes.Repeat([]byte("0123456789"), 4)
+
+	digest, err := bs.CreateBlock(ctx, "committed.txt", bytes.NewReader(content))
+	require.NoError(s.T(), err)
+	count := store.objectCount()
+
+	// leaves addressed with other hash function are stored with keys of committed leaves, failure only removes
+	// their mappings
+	bs.prefix = cid.Prefix{Version: 1, MhType: mh.BLAKE3, MhLength: -1}
+	_, err = bs.CreateBlock(ctx, "failed.txt", io.MultiReader(bytes.NewReader(content), iotest.ErrReader(readErr)))
+	require.Equal(s.T(), readErr, err)
+	require.Equal(s.T(), count, store.objectCount())
+	require.Equal(s.T(), 0, len(bs.pending))
+
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+	read := &bytes.Buffer{}
+	require.NoError(s.T(), bs.ReadFile(ctx, root, read))
+	require.Equal(s.T(), content, read.Bytes())
+}
+
+// readerFunc - adapts given function to `io.Reader`
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func (s *blockStorageSuite) TestTransactionDeferredAnnouncement() {
+	ctx := context.Background()
+	readErr := errors.New("read failed")
+	store := newMemoryStore(s.T(), s.ctrl)
+	announced := make(map[cid.Cid]bool)
+	peer := mockpeer.NewMockBlockStoragePeer(s.ctrl)
+	peer.EXPECT().AnnounceBlock(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(func(_ context.Context, id cid.Cid) bool {
+		announced[id] = true
+		return true
+	})
+	bs := s.newTestStorage(WithLocalStore(store), WithPeer(peer))
+	bs.(*storage).chunkSize = 16
+
+	// nodes of failed operation are never announced
+	_, err := bs.CreateBlock(ctx, "failed.txt", io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("0123456789"), 4)), iotest.ErrReader(readErr)))
+	require.Equal(s.T(), readErr, err)
+	require.Equal(s.T(), 0, len(announced))
+
+	_, err = bs.CreateBlock(ctx, "file.txt", bytes.NewReader(bytes.Repeat([]byte("0123456789"), 4)))
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), store.objectCount(), len(announced))
+	for id := range store.lookup {
+		require.True(s.T(), announced[id])
+	}
+	entries, err := s.walEntries(bs.(*storage))
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 0, len(entries))
+}
+
+func (s *blockStorageSuite) TestRecoverWriteSets() {
+	ctx := context.Background()
+	readErr := errors.New("read failed")
+	store := newMemoryStore(s.T(), s.ctrl)
+	datastore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := s.newTestStorage(WithLocalStore(store), WithDatastore(datastore)).(*storage)
+	bs.chunkSize = 16
+
+	committed, err := bs.CreateBlock(ctx, "committed.txt", bytes.NewReader([]byte("committed")))
+	require.NoError(s.T(), err)
+	count := store.objectCount()
+
+	// operation crashes after persisting nodes
+	crashed := withWriteSet(ctx, newWriteSet())
+	link, err := bs.createFile(crashed, "crashed.txt", bytes.NewReader(bytes.Repeat([]byte("0123456789"), 4)), false, nil)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), bs.indexFile(crashed, link))
+
+	// operation crashes while removing write-ahead log of committed nodes
+	id, err := cid.Decode(committed)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), datastore.Put(ctx, walKey("committing", id), []byte{}))
+	require.NoError(s.T(), datastore.Put(ctx, walCommitKey("committing"), []byte{}))
+
+	// upload session is interrupted
+	session, err := bs.StartUpload(ctx, "upload.txt", nil)
+	require.NoError(s.T(), err)
+	_, err = bs.ResumeUpload(ctx, session, 0, io.MultiReader(bytes.NewReader([]byte("0123456789abcdefXYZ")), iotest.ErrReader(readErr)))
+	require.Equal(s.T(), readErr, err)
+	require.Equal(s.T(), count+4+1, store.objectCount())
+
+	// restart
+	recovered := s.newTestStorage(WithLocalStore(store), WithDatastore(datastore), WithUploadTTL(time.Hour)).(*storage)
+	recovered.chunkSize = 16
+	require.Equal(s.T(), count+1, store.objectCount())
+	entries, err := s.walEntries(recovered)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 1, len(entries))
+	stats, err := recovered.ListBlocks(ctx, BlockFilter{})
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 1, len(stats))
+	require.Equal(s.T(), committed, stats[0].Cid)
+
+	// nodes of interrupted upload are kept until session completes
+	offset, err := recovered.UploadStatus(ctx, session)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), uint64(16), offset)
+	digest, err := recovered.ResumeUpload(ctx, session, offset, bytes.NewReader([]byte("XYZ")))
+	require.NoError(s.T(), err)
+	root, err := cid.Decode(digest)
+	require.NoError(s.T(), err)
+	content := &bytes.Buffer{}
+	require.NoError(s.T(), recovered.ReadFile(ctx, root, content))
+	require.Equal(s.T(), "0123456789abcdefXYZ", content.String())
+	entries, err = s.walEntries(recovered)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), 0, len(entries))
+}
+
+// walEntries - returns keys of write-ahead log entries and commit records of given storage
+func (s *blockStorageSuite) walEntries(bs *storage) ([]string, error) {
+	ret := make([]string, 0)
+	for _, prefix := range []string{walNamespace, walCommitNamespace} {
+		results, err := bs.datastore.Query(context.Background(), query.Query{Prefix: prefix, KeysOnly: true})
+		if err != nil {
+			return nil, err
+		}
+		entries, err := results.Rest()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			ret = append(ret, entry.Key)
+		}
+	}
+	return ret, nil
+}